@@ -0,0 +1,178 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Aggregate of a value over an interval
+type Aggregate struct {
+	// ID of the value
+	ID ValueID
+	// Start of the interval
+	Start time.Time
+	// Interval length
+	Interval time.Duration
+	// Count of samples
+	Count int
+	// Avg of all samples
+	Avg float64
+	// Min of all samples
+	Min float64
+	// Max of all samples
+	Max float64
+	// Energy integral of power values in Wh (VAh, varh) within the interval
+	Energy float64
+}
+
+// aggregateBucket collects the samples of one value in the current interval
+type aggregateBucket struct {
+	aggregate Aggregate
+	sum       float64
+	// last sample for energy integration
+	lastTime  time.Time
+	lastValue float64
+}
+
+// Aggregator downsamples values into fixed intervals (e.g. time.Minute, 5*time.Minute, time.Hour).
+// Samples must be added in chronological order.
+type Aggregator struct {
+	mutex    sync.Mutex
+	interval time.Duration
+	buckets  map[ValueID]*aggregateBucket
+	callback func(Aggregate)
+}
+
+// NewAggregator for the interval, callback (optional) is called with the aggregate of each finished interval
+func NewAggregator(interval time.Duration, callback func(Aggregate)) *Aggregator {
+	return &Aggregator{
+		interval: interval,
+		buckets:  make(map[ValueID]*aggregateBucket),
+		callback: callback,
+	}
+}
+
+// Add values sampled at the given time
+func (a *Aggregator) Add(t time.Time, values map[ValueID]interface{}) {
+	a.mutex.Lock()
+	var finished []Aggregate
+	for id, value := range values {
+		f, ok := ToFloat(value)
+		if !ok || math.IsNaN(f) {
+			continue
+		}
+		if aggregate, ok := a.add(id, t, f); ok {
+			finished = append(finished, aggregate)
+		}
+	}
+	a.mutex.Unlock()
+
+	if a.callback == nil {
+		return
+	}
+	for _, aggregate := range finished {
+		a.callback(aggregate)
+	}
+}
+
+// Flush returns the aggregates of the current unfinished intervals and resets the aggregator
+func (a *Aggregator) Flush() []Aggregate {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	aggregates := make([]Aggregate, 0, len(a.buckets))
+	for _, bucket := range a.buckets {
+		aggregates = append(aggregates, bucket.finish())
+	}
+	a.buckets = make(map[ValueID]*aggregateBucket)
+	return aggregates
+}
+
+// add sample and returns the aggregate of the previous interval if it is finished
+func (a *Aggregator) add(id ValueID, t time.Time, value float64) (Aggregate, bool) {
+	start := t.Truncate(a.interval)
+	integrate := valueDescription(id).Type == "power"
+
+	bucket, ok := a.buckets[id]
+	if !ok {
+		a.buckets[id] = newAggregateBucket(id, start, a.interval, t, value)
+		return Aggregate{}, false
+	}
+
+	if bucket.aggregate.Start.Equal(start) {
+		if integrate {
+			bucket.aggregate.Energy += energy(bucket.lastTime, bucket.lastValue, t, value)
+		}
+		bucket.sample(t, value)
+		return Aggregate{}, false
+	}
+
+	// interval finished -> split energy at the interval boundary
+	next := newAggregateBucket(id, start, a.interval, t, value)
+	if integrate && start.Sub(bucket.aggregate.Start) == a.interval {
+		boundary := start
+		total := t.Sub(bucket.lastTime).Seconds()
+		boundaryValue := bucket.lastValue
+		if total > 0 {
+			boundaryValue += (value - bucket.lastValue) * boundary.Sub(bucket.lastTime).Seconds() / total
+		}
+		bucket.aggregate.Energy += energy(bucket.lastTime, bucket.lastValue, boundary, boundaryValue)
+		next.aggregate.Energy += energy(boundary, boundaryValue, t, value)
+	}
+	a.buckets[id] = next
+	return bucket.finish(), true
+}
+
+// newAggregateBucket with the first sample
+func newAggregateBucket(id ValueID, start time.Time, interval time.Duration, t time.Time, value float64) *aggregateBucket {
+	bucket := &aggregateBucket{
+		aggregate: Aggregate{
+			ID:       id,
+			Start:    start,
+			Interval: interval,
+			Min:      value,
+			Max:      value,
+		},
+	}
+	bucket.sample(t, value)
+	return bucket
+}
+
+// sample adds the value to the bucket
+func (b *aggregateBucket) sample(t time.Time, value float64) {
+	b.aggregate.Count++
+	b.sum += value
+	b.aggregate.Min = min(b.aggregate.Min, value)
+	b.aggregate.Max = max(b.aggregate.Max, value)
+	b.lastTime = t
+	b.lastValue = value
+}
+
+// finish returns the aggregate of the bucket
+func (b *aggregateBucket) finish() Aggregate {
+	aggregate := b.aggregate
+	if aggregate.Count > 0 {
+		aggregate.Avg = b.sum / float64(aggregate.Count)
+	}
+	return aggregate
+}
+
+// energy integral in Wh of linear power between two samples
+func energy(t1 time.Time, p1 float64, t2 time.Time, p2 float64) float64 {
+	return (p1 + p2) / 2 * t2.Sub(t1).Hours()
+}
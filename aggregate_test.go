@@ -0,0 +1,98 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAggregator(t *testing.T) {
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	type sample struct {
+		at    time.Duration
+		value interface{}
+	}
+	tests := []struct {
+		name     string
+		id       ValueID
+		samples  []sample
+		finished []Aggregate
+		flushed  []Aggregate
+	}{
+		{"one interval", ActivePowerPlus,
+			[]sample{{0, uint32(1000)}, {15 * time.Minute, uint32(2000)}, {30 * time.Minute, uint32(0)}},
+			nil,
+			[]Aggregate{{ID: ActivePowerPlus, Start: start, Interval: time.Hour, Count: 3, Avg: 1000, Min: 0, Max: 2000, Energy: 625}}},
+		{"split at boundary", ActivePowerPlus,
+			[]sample{{30 * time.Minute, uint32(1000)}, {90 * time.Minute, uint32(1000)}},
+			[]Aggregate{{ID: ActivePowerPlus, Start: start, Interval: time.Hour, Count: 1, Avg: 1000, Min: 1000, Max: 1000, Energy: 500}},
+			[]Aggregate{{ID: ActivePowerPlus, Start: start.Add(time.Hour), Interval: time.Hour, Count: 1, Avg: 1000, Min: 1000, Max: 1000, Energy: 500}}},
+		{"ramp at boundary", ActivePowerPlus,
+			[]sample{{0, uint32(0)}, {time.Hour, uint32(1000)}},
+			[]Aggregate{{ID: ActivePowerPlus, Start: start, Interval: time.Hour, Count: 1, Avg: 0, Min: 0, Max: 0, Energy: 500}},
+			[]Aggregate{{ID: ActivePowerPlus, Start: start.Add(time.Hour), Interval: time.Hour, Count: 1, Avg: 1000, Min: 1000, Max: 1000}}},
+		{"gap", ActivePowerPlus,
+			[]sample{{0, uint32(1000)}, {150 * time.Minute, uint32(1000)}},
+			[]Aggregate{{ID: ActivePowerPlus, Start: start, Interval: time.Hour, Count: 1, Avg: 1000, Min: 1000, Max: 1000}},
+			[]Aggregate{{ID: ActivePowerPlus, Start: start.Add(2 * time.Hour), Interval: time.Hour, Count: 1, Avg: 1000, Min: 1000, Max: 1000}}},
+		{"not integrated", VoltageL1,
+			[]sample{{0, 230.0}, {30 * time.Minute, 232.0}},
+			nil,
+			[]Aggregate{{ID: VoltageL1, Start: start, Interval: time.Hour, Count: 2, Avg: 231, Min: 230, Max: 232}}},
+		{"skipped values", ActivePowerPlus,
+			[]sample{{0, "n/a"}, {10 * time.Minute, math.NaN()}, {20 * time.Minute, uint32(500)}},
+			nil,
+			[]Aggregate{{ID: ActivePowerPlus, Start: start, Interval: time.Hour, Count: 1, Avg: 500, Min: 500, Max: 500}}},
+		{"no samples", ActivePowerPlus, nil, nil, []Aggregate{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ass := assert.New(t)
+
+			var finished []Aggregate
+			aggregator := NewAggregator(time.Hour, func(aggregate Aggregate) {
+				finished = append(finished, aggregate)
+			})
+			for _, s := range tt.samples {
+				aggregator.Add(start.Add(s.at), map[ValueID]interface{}{tt.id: s.value})
+			}
+			ass.Equal(tt.finished, finished)
+			ass.Equal(tt.flushed, aggregator.Flush())
+			ass.Empty(aggregator.Flush())
+		})
+	}
+}
+
+func TestAggregator_values(t *testing.T) {
+	ass := assert.New(t)
+
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	aggregator := NewAggregator(time.Minute, nil)
+	aggregator.Add(start, map[ValueID]interface{}{ActivePowerPlus: uint32(600), VoltageL1: 230.0})
+	aggregator.Add(start.Add(30*time.Second), map[ValueID]interface{}{ActivePowerPlus: uint32(600)})
+
+	aggregates := make(map[ValueID]Aggregate)
+	for _, aggregate := range aggregator.Flush() {
+		aggregates[aggregate.ID] = aggregate
+	}
+	ass.Len(aggregates, 2)
+	ass.Equal(2, aggregates[ActivePowerPlus].Count)
+	ass.InDelta(5.0, aggregates[ActivePowerPlus].Energy, 1e-9)
+	ass.Equal(1, aggregates[VoltageL1].Count)
+}
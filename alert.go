@@ -0,0 +1,288 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+// AlertCondition of an alert rule
+type AlertCondition int
+
+// alert conditions
+const (
+	// AlertAbove triggers if the value is above the threshold
+	AlertAbove AlertCondition = iota
+	// AlertBelow triggers if the value is below the threshold
+	AlertBelow
+	// AlertOffline triggers if a device sent no values
+	AlertOffline
+)
+
+// AlertRule defines when an alert is raised
+type AlertRule struct {
+	// Name of the rule
+	Name string
+	// Serial of the device (0 -> all devices)
+	Serial uint32
+	// Value to check (ignored for AlertOffline)
+	Value ValueID
+	// Condition to check
+	Condition AlertCondition
+	// Threshold of the value (ignored for AlertOffline)
+	Threshold float64
+	// Duration the condition must be met before the alert is raised
+	Duration time.Duration
+	// Hysteresis the value must fall below (above) the threshold to clear the alert
+	Hysteresis float64
+}
+
+// AlertEvent is sent if an alert is raised or cleared
+type AlertEvent struct {
+	// Rule of the alert
+	Rule AlertRule
+	// Serial of the device
+	Serial uint32
+	// Value that raised or cleared the alert (nil for AlertOffline)
+	Value interface{}
+	// Active is true if the alert is raised and false if it is cleared
+	Active bool
+	// Time of the event
+	Time time.Time
+}
+
+// alertKey identifies the state of a rule for a device
+type alertKey struct {
+	rule   int
+	serial uint32
+}
+
+// alertState of a rule for a device
+type alertState struct {
+	since  time.Time
+	active bool
+}
+
+// AlertEngine checks values against alert rules
+type AlertEngine struct {
+	mutex    sync.Mutex
+	rules    []AlertRule
+	states   map[alertKey]*alertState
+	lastSeen map[uint32]time.Time
+
+	listenerMutex sync.Mutex
+	callbacks     []func(AlertEvent)
+	channels      []chan AlertEvent
+}
+
+// NewAlertEngine creates an alert engine without rules
+func NewAlertEngine() *AlertEngine {
+	return &AlertEngine{
+		states:   make(map[alertKey]*alertState),
+		lastSeen: make(map[uint32]time.Time),
+	}
+}
+
+// AddRule to the engine
+func (e *AlertEngine) AddRule(rule AlertRule) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.rules = append(e.rules, rule)
+}
+
+// OnAlert registers a callback for alert events
+func (e *AlertEngine) OnAlert(callback func(AlertEvent)) {
+	e.listenerMutex.Lock()
+	defer e.listenerMutex.Unlock()
+	e.callbacks = append(e.callbacks, callback)
+}
+
+// RegisterAlertListener for alert events.
+// Events are dropped if the channel is not ready to receive.
+func (e *AlertEngine) RegisterAlertListener(ch chan AlertEvent) {
+	e.listenerMutex.Lock()
+	defer e.listenerMutex.Unlock()
+	e.channels = append(e.channels, ch)
+}
+
+// UnregisterAlertListener for alert events
+func (e *AlertEngine) UnregisterAlertListener(ch chan AlertEvent) {
+	e.listenerMutex.Lock()
+	defer e.listenerMutex.Unlock()
+	e.channels = slices.DeleteFunc(e.channels, func(c chan AlertEvent) bool {
+		return c == ch
+	})
+}
+
+// Update checks the values of the device against all rules
+func (e *AlertEngine) Update(device *Device, values map[ValueID]interface{}) {
+	e.UpdateValues(device.SerialNumber(), values, time.Now())
+}
+
+// UpdateValues checks the values of the device with the given serial against all rules
+func (e *AlertEngine) UpdateValues(serial uint32, values map[ValueID]interface{}, now time.Time) {
+	var events []AlertEvent
+
+	e.mutex.Lock()
+	e.lastSeen[serial] = now
+	for i, rule := range e.rules {
+		if rule.Serial != 0 && rule.Serial != serial {
+			continue
+		}
+		state := e.state(i, serial)
+
+		if rule.Condition == AlertOffline {
+			if state.active {
+				state.active = false
+				events = append(events, AlertEvent{Rule: rule, Serial: serial, Time: now})
+			}
+			continue
+		}
+
+		value, ok := values[rule.Value]
+		if !ok {
+			continue
+		}
+		f, ok := ToFloat(value)
+		if !ok {
+			continue
+		}
+
+		if state.active {
+			if rule.cleared(f) {
+				state.active = false
+				state.since = time.Time{}
+				events = append(events, AlertEvent{Rule: rule, Serial: serial, Value: value, Time: now})
+			}
+			continue
+		}
+
+		if !rule.triggered(f) {
+			state.since = time.Time{}
+			continue
+		}
+		if state.since.IsZero() {
+			state.since = now
+		}
+		if now.Sub(state.since) >= rule.Duration {
+			state.active = true
+			events = append(events, AlertEvent{Rule: rule, Serial: serial, Value: value, Active: true, Time: now})
+		}
+	}
+	e.mutex.Unlock()
+
+	e.send(events)
+}
+
+// Check offline rules, must be called periodically (see Run)
+func (e *AlertEngine) Check(now time.Time) {
+	var events []AlertEvent
+
+	e.mutex.Lock()
+	for i, rule := range e.rules {
+		if rule.Condition != AlertOffline {
+			continue
+		}
+		for serial, seen := range e.lastSeen {
+			if rule.Serial != 0 && rule.Serial != serial {
+				continue
+			}
+			state := e.state(i, serial)
+			if !state.active && now.Sub(seen) >= rule.Duration {
+				state.active = true
+				events = append(events, AlertEvent{Rule: rule, Serial: serial, Active: true, Time: now})
+			}
+		}
+	}
+	e.mutex.Unlock()
+
+	e.send(events)
+}
+
+// Run checks offline rules in the given interval until the context is done
+func (e *AlertEngine) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			e.Check(now)
+		}
+	}
+}
+
+// state of rule for device
+func (e *AlertEngine) state(rule int, serial uint32) *alertState {
+	key := alertKey{rule: rule, serial: serial}
+	state, ok := e.states[key]
+	if !ok {
+		state = new(alertState)
+		e.states[key] = state
+	}
+	return state
+}
+
+// send events to all listeners
+func (e *AlertEngine) send(events []AlertEvent) {
+	if len(events) == 0 {
+		return
+	}
+
+	e.listenerMutex.Lock()
+	callbacks := slices.Clone(e.callbacks)
+	channels := slices.Clone(e.channels)
+	e.listenerMutex.Unlock()
+
+	for _, event := range events {
+		for _, callback := range callbacks {
+			callback(event)
+		}
+		for _, ch := range channels {
+			select {
+			case ch <- event:
+			default:
+				Log.Printf("alert listener busy - drop event for rule %s", event.Rule.Name)
+			}
+		}
+	}
+}
+
+// triggered checks if the value meets the condition
+func (r AlertRule) triggered(value float64) bool {
+	switch r.Condition {
+	case AlertAbove:
+		return value > r.Threshold
+	case AlertBelow:
+		return value < r.Threshold
+	}
+	return false
+}
+
+// cleared checks if the value left the condition including hysteresis
+func (r AlertRule) cleared(value float64) bool {
+	switch r.Condition {
+	case AlertAbove:
+		return value <= r.Threshold-r.Hysteresis
+	case AlertBelow:
+		return value >= r.Threshold+r.Hysteresis
+	}
+	return true
+}
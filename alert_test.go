@@ -0,0 +1,168 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAlertEngine_UpdateValues(t *testing.T) {
+	// times in seconds since the first update
+	type update struct {
+		at     int
+		serial uint32
+		value  interface{}
+	}
+	type event struct {
+		at     int
+		active bool
+	}
+	above := AlertRule{Name: "power", Value: ActivePowerPlus, Condition: AlertAbove, Threshold: 20, Hysteresis: 10}
+	below := AlertRule{Name: "voltage", Value: ActivePowerPlus, Condition: AlertBelow, Threshold: 100, Hysteresis: 20}
+	tests := []struct {
+		name    string
+		rule    AlertRule
+		updates []update
+		events  []event
+	}{
+		{
+			name:    "above",
+			rule:    above,
+			updates: []update{{0, 1, 10.0}, {1, 1, 30.0}, {2, 1, 31.0}},
+			events:  []event{{1, true}},
+		},
+		{
+			name:    "above hysteresis",
+			rule:    above,
+			updates: []update{{0, 1, 30.0}, {1, 1, 15.0}, {2, 1, 25.0}, {3, 1, 10.0}, {4, 1, 21.0}},
+			events:  []event{{0, true}, {3, false}, {4, true}},
+		},
+		{
+			name:    "below hysteresis",
+			rule:    below,
+			updates: []update{{0, 1, 150.0}, {1, 1, 90.0}, {2, 1, 110.0}, {3, 1, 120.0}},
+			events:  []event{{1, true}, {3, false}},
+		},
+		{
+			name: "duration",
+			rule: AlertRule{Value: ActivePowerPlus, Condition: AlertAbove, Threshold: 20, Duration: 10 * time.Second},
+			updates: []update{
+				{0, 1, 30.0}, {5, 1, 30.0},
+				// reset below the threshold
+				{6, 1, 15.0}, {7, 1, 30.0}, {16, 1, 30.0}, {17, 1, 30.0},
+			},
+			events: []event{{17, true}},
+		},
+		{
+			name:    "integer values",
+			rule:    above,
+			updates: []update{{0, 1, uint32(30)}, {1, 1, int64(5)}},
+			events:  []event{{0, true}, {1, false}},
+		},
+		{
+			name:    "missing and invalid values",
+			rule:    above,
+			updates: []update{{0, 1, nil}, {1, 1, "30"}},
+		},
+		{
+			name:    "device of rule",
+			rule:    AlertRule{Serial: 2, Value: ActivePowerPlus, Condition: AlertAbove, Threshold: 20},
+			updates: []update{{0, 1, 30.0}, {1, 2, 30.0}},
+			events:  []event{{1, true}},
+		},
+		{
+			name:    "state per device",
+			rule:    above,
+			updates: []update{{0, 1, 30.0}, {1, 2, 30.0}, {2, 1, 5.0}},
+			events:  []event{{0, true}, {1, true}, {2, false}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ass := assert.New(t)
+
+			var events []AlertEvent
+			engine := NewAlertEngine()
+			engine.AddRule(tt.rule)
+			engine.OnAlert(func(event AlertEvent) {
+				events = append(events, event)
+			})
+
+			start := time.Now()
+			for _, u := range tt.updates {
+				values := map[ValueID]interface{}{}
+				if u.value != nil {
+					values[ActivePowerPlus] = u.value
+				}
+				engine.UpdateValues(u.serial, values, start.Add(time.Duration(u.at)*time.Second))
+			}
+
+			var got []event
+			for _, e := range events {
+				ass.Equal(tt.rule, e.Rule)
+				got = append(got, event{int(e.Time.Sub(start) / time.Second), e.Active})
+			}
+			ass.Equal(tt.events, got)
+		})
+	}
+}
+
+func TestAlertEngine_Check(t *testing.T) {
+	ass := assert.New(t)
+
+	engine := NewAlertEngine()
+	engine.AddRule(AlertRule{Name: "offline", Condition: AlertOffline, Duration: time.Minute})
+	engine.AddRule(AlertRule{Name: "power", Value: ActivePowerPlus, Condition: AlertAbove, Threshold: 20})
+	events := make(chan AlertEvent, 10)
+	engine.RegisterAlertListener(events)
+
+	start := time.Now()
+	engine.UpdateValues(1, nil, start)
+
+	// raised once after the duration
+	engine.Check(start.Add(30 * time.Second))
+	ass.Empty(events)
+	engine.Check(start.Add(time.Minute))
+	ass.Equal(AlertEvent{Rule: engine.rules[0], Serial: 1, Active: true, Time: start.Add(time.Minute)}, <-events)
+	engine.Check(start.Add(2 * time.Minute))
+	ass.Empty(events)
+
+	// cleared by the next values
+	engine.UpdateValues(1, nil, start.Add(3*time.Minute))
+	ass.Equal(AlertEvent{Rule: engine.rules[0], Serial: 1, Time: start.Add(3 * time.Minute)}, <-events)
+	engine.Check(start.Add(3*time.Minute + 30*time.Second))
+	ass.Empty(events)
+
+	// no events after unregistering
+	engine.UnregisterAlertListener(events)
+	engine.Check(start.Add(5 * time.Minute))
+	ass.Empty(events)
+}
+
+func TestAlertEngine_busyListener(t *testing.T) {
+	ass := assert.New(t)
+
+	engine := NewAlertEngine()
+	engine.AddRule(AlertRule{Value: ActivePowerPlus, Condition: AlertAbove, Threshold: 20})
+	events := make(chan AlertEvent)
+	engine.RegisterAlertListener(events)
+
+	// event dropped instead of blocking
+	engine.UpdateValues(1, map[ValueID]interface{}{ActivePowerPlus: 30.0}, time.Now())
+	ass.Empty(events)
+}
@@ -0,0 +1,229 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"runtime"
+	"slices"
+	"sync"
+	"time"
+
+	"golang.org/x/net/ipv4"
+)
+
+// WithAllInterfaces joins the multicast group on every multicast capable
+// interface (up, not loopback, with an IPv4 address) instead of a single one.
+// The set of interfaces is updated by the membership check (see
+// WithMembershipCheckInterval) and multicast packets are sent on all of them.
+// Can't be combined with an explicit interface, local IP or interface index.
+func WithAllInterfaces() ConnectionOption {
+	return func(c *connectionConfig) {
+		c.allInterfaces = true
+	}
+}
+
+// interfaceMemberships of a connection in all-interfaces mode
+type interfaceMemberships struct {
+	// set on creation of the connection
+	enabled bool
+
+	mutex sync.Mutex
+	// joined interfaces by name
+	joined map[string]joinedInterface
+}
+
+// joinedInterface the multicast group was joined on
+type joinedInterface struct {
+	index int
+	state string
+}
+
+// names of the joined interfaces
+func (m *interfaceMemberships) names() []string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var names []string
+	for name := range m.joined {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// indexes of the joined interfaces
+func (m *interfaceMemberships) indexes() []int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var indexes []int
+	for _, inf := range m.joined {
+		indexes = append(indexes, inf.index)
+	}
+	slices.Sort(indexes)
+	return indexes
+}
+
+// multicastInterfaces returns all interfaces usable for Speedwire multicast
+func multicastInterfaces() ([]net.Interface, error) {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	return slices.DeleteFunc(interfaces, func(inf net.Interface) bool {
+		if inf.Flags&net.FlagUp == 0 || inf.Flags&net.FlagMulticast == 0 || inf.Flags&net.FlagLoopback != 0 {
+			return true
+		}
+		addresses, err := inf.Addrs()
+		if err != nil {
+			return true
+		}
+		return !slices.ContainsFunc(addresses, func(address net.Addr) bool {
+			network, ok := address.(*net.IPNet)
+			return ok && network.IP.To4() != nil
+		})
+	}), nil
+}
+
+// listenMulticastAll creates the socket of the all-interfaces mode,
+// the group is joined by syncInterfaces
+func listenMulticastAll(config *connectionConfig, group *net.UDPAddr) (net.PacketConn, error) {
+	if config.interfaceIndex != 0 || config.localIP != nil {
+		return nil, fmt.Errorf("all interfaces mode can't be combined with an explicit interface")
+	}
+	return listenUDP4(config, fmt.Sprintf(":%d", group.Port))
+}
+
+// syncInterfaces joins the multicast group on new and changed interfaces and
+// leaves it on removed ones. With rejoin the group is joined again on all interfaces.
+func (c *Connection) syncInterfaces(rejoin bool) []MembershipEvent {
+	socket, ok := c.socket.(*net.UDPConn)
+	if !ok {
+		return []MembershipEvent{{Reason: "sync interfaces", Err: fmt.Errorf("socket does not support multicast")}}
+	}
+	interfaces, err := multicastInterfaces()
+	if err != nil {
+		return []MembershipEvent{{Reason: "sync interfaces", Err: err}}
+	}
+
+	packetConn := ipv4.NewPacketConn(socket)
+	group := &net.UDPAddr{IP: c.address.IP}
+
+	m := &c.memberships
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.joined == nil {
+		m.joined = make(map[string]joinedInterface)
+	}
+
+	var events []MembershipEvent
+	current := make(map[string]bool)
+	for i := range interfaces {
+		inf := &interfaces[i]
+		current[inf.Name] = true
+		state := interfaceState(inf)
+
+		old, joined := m.joined[inf.Name]
+		var reason string
+		switch {
+		case !joined:
+			reason = "interface added"
+		case old.state != state || old.index != inf.Index:
+			reason = "interface changed"
+		case rejoin:
+			reason = "no packets received"
+		default:
+			continue
+		}
+
+		if joined {
+			_ = packetConn.LeaveGroup(inf, group)
+		}
+		err := packetConn.JoinGroup(inf, group)
+		if err != nil {
+			delete(m.joined, inf.Name)
+		} else {
+			m.joined[inf.Name] = joinedInterface{index: inf.Index, state: state}
+		}
+		events = append(events, MembershipEvent{Interface: inf.Name, Reason: reason, Err: err})
+	}
+
+	for name, old := range m.joined {
+		if current[name] {
+			continue
+		}
+		if inf, err := net.InterfaceByIndex(old.index); err == nil {
+			_ = packetConn.LeaveGroup(inf, group)
+		}
+		delete(m.joined, name)
+		events = append(events, MembershipEvent{Interface: name, Reason: "interface removed"})
+	}
+
+	var joinErr error
+	if len(m.joined) == 0 {
+		joinErr = errors.New("no multicast capable interface joined")
+	}
+	c.diagnostics.joinDone(joinErr)
+	return events
+}
+
+// allInterfacesLoop updates the joined interfaces periodically
+func (c *Connection) allInterfacesLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-c.closed:
+			return
+		}
+
+		rejoin := time.Since(time.Unix(0, c.lastReceived.Load())) > interval
+		for _, event := range c.syncInterfaces(rejoin) {
+			Log.Printf("multicast group on %s (%s): %v", event.Interface, event.Reason, event.Err)
+			c.handleMembershipEvent(event)
+		}
+	}
+}
+
+// writeAllInterfaces sends the multicast packet on every joined interface,
+// it fails only if no interface was reached. Windows ignores the interface of
+// control messages, packets are sent on the default interface there.
+func (c *Connection) writeAllInterfaces(packet *RawPacket) error {
+	socket, ok := c.socket.(*net.UDPConn)
+	indexes := c.memberships.indexes()
+	if !ok || len(indexes) == 0 || runtime.GOOS == "windows" {
+		_, err := c.socket.WriteTo(packet.Data, packet.Address)
+		return err
+	}
+
+	packetConn := ipv4.NewPacketConn(socket)
+	var errs []error
+	for _, index := range indexes {
+		_, err := packetConn.WriteTo(packet.Data, &ipv4.ControlMessage{IfIndex: index}, packet.Address)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) == len(indexes) {
+		return errors.Join(errs...)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"net"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListenMulticastAll_explicit(t *testing.T) {
+	ass := assert.New(t)
+
+	group := &net.UDPAddr{IP: net.IPv4(239, 12, 255, 254), Port: 9522}
+	_, err := listenMulticastAll(&connectionConfig{allInterfaces: true, interfaceIndex: 1}, group)
+	ass.Error(err)
+	_, err = listenMulticastAll(&connectionConfig{allInterfaces: true, localIP: net.IPv4(192, 168, 0, 2)}, group)
+	ass.Error(err)
+}
+
+func TestMulticastInterfaces(t *testing.T) {
+	ass := assert.New(t)
+
+	interfaces, err := multicastInterfaces()
+	require.NoError(t, err)
+	for _, inf := range interfaces {
+		ass.NotZero(inf.Flags&net.FlagUp, inf.Name)
+		ass.NotZero(inf.Flags&net.FlagMulticast, inf.Name)
+		ass.Zero(inf.Flags&net.FlagLoopback, inf.Name)
+	}
+}
+
+func TestConnection_syncInterfaces(t *testing.T) {
+	ass := assert.New(t)
+
+	socket, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4zero})
+	require.NoError(t, err)
+	conn := newConnection(socket, &net.UDPAddr{IP: net.IPv4(239, 12, 255, 254), Port: 9522})
+	defer conn.Close()
+	conn.memberships.enabled = true
+
+	interfaces, err := multicastInterfaces()
+	require.NoError(t, err)
+
+	// every interface is tried once
+	events := conn.syncInterfaces(false)
+	ass.Len(events, len(interfaces))
+	var joined []string
+	for _, event := range events {
+		ass.Equal("interface added", event.Reason)
+		if event.Err == nil {
+			joined = append(joined, event.Interface)
+		}
+	}
+	slices.Sort(joined)
+	ass.Equal(joined, conn.memberships.names())
+	ass.Empty(conn.syncInterfaces(false))
+
+	events = conn.syncInterfaces(true)
+	ass.Len(events, len(joined))
+	for _, event := range events {
+		ass.Equal("no packets received", event.Reason)
+	}
+
+	// vanished interfaces are left
+	conn.memberships.mutex.Lock()
+	conn.memberships.joined["gone0"] = joinedInterface{index: -1, state: "up"}
+	conn.memberships.mutex.Unlock()
+	ass.Equal([]MembershipEvent{{Interface: "gone0", Reason: "interface removed"}}, conn.syncInterfaces(false))
+	ass.NotContains(conn.memberships.names(), "gone0")
+}
+
+func TestConnection_syncInterfaces_packetConn(t *testing.T) {
+	ass := assert.New(t)
+
+	socket := &writtenConn{idleConn: idleConn{closed: make(chan struct{})}}
+	conn, err := NewPacketConnection(socket)
+	require.NoError(t, err)
+	defer conn.Close()
+	conn.memberships.enabled = true
+
+	events := conn.syncInterfaces(false)
+	require.Len(t, events, 1)
+	ass.Error(events[0].Err)
+	ass.Empty(conn.memberships.names())
+
+	// multicast packets are sent on the socket without joined interfaces
+	group := &net.UDPAddr{IP: net.IPv4(239, 12, 255, 254), Port: 9522}
+	ass.NoError(conn.send(&RawPacket{Direction: RecordSend, Address: group, Data: []byte{1, 2, 3}}))
+	ass.Equal([][]byte{{1, 2, 3}}, socket.packets())
+}
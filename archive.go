@@ -0,0 +1,105 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/pb82/sunny/proto"
+	"github.com/pb82/sunny/proto/net2"
+)
+
+// DayArchiveInterval of the records of the day archive
+const DayArchiveInterval = 5 * time.Minute
+
+// ArchiveRecord is a record of the day archive of an inverter
+type ArchiveRecord struct {
+	Time time.Time
+	// TotalYield counter in Ws
+	TotalYield float64
+	// Power average in W since the previous record
+	Power float64
+}
+
+// GetDayArchive of the inverter with the energy counter in DayArchiveInterval steps.
+// The day starts at midnight in the location of day.
+func (d *Device) GetDayArchive(ctx context.Context, day time.Time) ([]ArchiveRecord, error) {
+	if d.energyMeter {
+		return nil, fmt.Errorf("%w: energy meters have no day archive", ErrUnsupportedValue)
+	}
+	err := d.health.allow()
+	if err != nil {
+		return nil, err
+	}
+
+	err = d.login(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer d.logout()
+
+	start := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
+	end := start.AddDate(0, 0, 1)
+	Log.Printf("day archive for %s: %s", d.Address(), start.Format(time.DateOnly))
+	// the record before the day is requested for the power of the first interval
+	request := proto.NewDeviceDataBuilder(net2.CommandGetValues, net2.ObjectDayArchive).
+		Control(net2.ControlArchiveRequest).
+		Parameters(uint32(start.Add(-DayArchiveInterval).Unix()), uint32(end.Add(-DayArchiveInterval).Unix())).
+		Build()
+
+	response, err := d.sendDeviceDataResponse(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	if response.Status == 0x15 {
+		return nil, nil
+	}
+	if response.Status != 0 {
+		return nil, fmt.Errorf("failed to get day archive: %w (status 0x%X)", ErrDeviceBusy, response.Status)
+	}
+	return parseDayArchive(response.Data, start, end), nil
+}
+
+// parseDayArchive records between start (inclusive) and end, records without value are skipped
+func parseDayArchive(data []byte, start, end time.Time) []ArchiveRecord {
+	var records []ArchiveRecord
+	var previous *ArchiveRecord
+	for index := 0; index+net2.DayArchiveRecordSize <= len(data); index += net2.DayArchiveRecordSize {
+		timestamp := binary.LittleEndian.Uint32(data[index:])
+		counter := binary.LittleEndian.Uint64(data[index+4:])
+		if timestamp == 0 || counter == math.MaxUint64 {
+			continue
+		}
+
+		record := ArchiveRecord{
+			Time: time.Unix(int64(timestamp), 0).In(start.Location()),
+			// counter in Wh
+			TotalYield: float64(counter) * 3600,
+		}
+		if previous != nil && record.Time.After(previous.Time) {
+			record.Power = (record.TotalYield - previous.TotalYield) / record.Time.Sub(previous.Time).Seconds()
+		}
+		previous = &record
+		if record.Time.Before(start) || !record.Time.Before(end) {
+			continue
+		}
+		records = append(records, record)
+	}
+	return records
+}
@@ -0,0 +1,107 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pb82/sunny"
+	"github.com/stretchr/testify/assert"
+)
+
+// archiveRecords from (inclusive) to with 100 Wh per interval
+func archiveRecords(from, to time.Time) []sunny.ArchiveRecord {
+	var records []sunny.ArchiveRecord
+	counter := 1000.0
+	for t := from; t.Before(to); t = t.Add(sunny.DayArchiveInterval) {
+		records = append(records, sunny.ArchiveRecord{Time: t, TotalYield: counter * 3600})
+		counter += 100
+	}
+	return records
+}
+
+func TestDevice_GetDayArchive(t *testing.T) {
+	ass := assert.New(t)
+
+	inverter, device := newTestDevice(t)
+	day := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	// including the record before the day
+	inverter.SetDayArchive(archiveRecords(day.Add(-sunny.DayArchiveInterval), day.AddDate(0, 0, 1)))
+
+	records, err := device.GetDayArchive(context.Background(), day.Add(12*time.Hour))
+	ass.NoError(err)
+	if ass.Len(records, 288) {
+		ass.Equal(day, records[0].Time)
+		ass.Equal(1100.0*3600, records[0].TotalYield)
+		ass.Equal(day.Add(24*time.Hour-sunny.DayArchiveInterval), records[287].Time)
+		for _, record := range records {
+			ass.InDelta(1200, record.Power, 1e-9)
+		}
+	}
+
+	// day without records
+	records, err = device.GetDayArchive(context.Background(), day.AddDate(0, 0, 1))
+	ass.NoError(err)
+	ass.Empty(records)
+}
+
+// memoryArchive is an ArchiveStore in memory
+type memoryArchive struct {
+	mutex sync.Mutex
+	days  map[time.Time][]sunny.ArchiveRecord
+}
+
+func (m *memoryArchive) ArchiveDays(_ context.Context, _ uint32, from, to time.Time) ([]time.Time, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var days []time.Time
+	for day := range m.days {
+		if !day.Before(from) && !day.After(to) {
+			days = append(days, day)
+		}
+	}
+	return days, nil
+}
+
+func (m *memoryArchive) StoreArchiveDay(_ context.Context, _ uint32, day time.Time, records []sunny.ArchiveRecord) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.days[day] = records
+	return nil
+}
+
+func TestBackfill_Run(t *testing.T) {
+	ass := assert.New(t)
+
+	inverter, device := newTestDevice(t)
+	now := time.Now().In(time.UTC)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	inverter.SetDayArchive(archiveRecords(today.AddDate(0, 0, -2), today))
+
+	store := &memoryArchive{days: make(map[time.Time][]sunny.ArchiveRecord)}
+	backfill := sunny.NewBackfill(store, nil, 2*24*time.Hour)
+	backfill.Location = time.UTC
+	backfill.AddDevice(device)
+
+	ass.NoError(backfill.Run(context.Background()))
+	ass.Empty(backfill.Jobs())
+	ass.Len(store.days, 2)
+	ass.Len(store.days[today.AddDate(0, 0, -2)], 288)
+	ass.Len(store.days[today.AddDate(0, 0, -1)], 288)
+}
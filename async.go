@@ -0,0 +1,46 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"context"
+)
+
+// Result of an asynchronous request
+type Result struct {
+	// Device the values were requested from
+	Device *Device
+	// Values received from the device (also set on a *MultiError)
+	Values map[ValueID]interface{}
+	// Err of the request
+	Err error
+}
+
+// GetValuesAsync requests all values in the background.
+// The channel receives exactly one result and is closed afterwards.
+func (d *Device) GetValuesAsync(ctx context.Context) <-chan Result {
+	result := make(chan Result, 1)
+	go func() {
+		defer close(result)
+
+		values, err := d.GetValuesCtx(ctx)
+		result <- Result{
+			Device: d,
+			Values: values,
+			Err:    err,
+		}
+	}()
+	return result
+}
@@ -0,0 +1,392 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"time"
+)
+
+// DefaultBackfillRetry of failed archive downloads
+var DefaultBackfillRetry = RetryPolicy{
+	MaxAttempts:   5,
+	InitialDelay:  time.Minute,
+	BackoffFactor: 4,
+}
+
+// ArchiveStore is the local store of downloaded archive days
+type ArchiveStore interface {
+	// ArchiveDays returns the stored days of the device between from and to (inclusive)
+	ArchiveDays(ctx context.Context, serial uint32, from, to time.Time) ([]time.Time, error)
+	// StoreArchiveDay saves the records of a downloaded day (also called without records)
+	StoreArchiveDay(ctx context.Context, serial uint32, day time.Time, records []ArchiveRecord) error
+}
+
+// ArchiveDownloader downloads the day archive of the device
+type ArchiveDownloader func(ctx context.Context, device *Device, day time.Time) ([]ArchiveRecord, error)
+
+// DownloadDayArchive is the ArchiveDownloader reading the day archive via Speedwire
+func DownloadDayArchive(ctx context.Context, device *Device, day time.Time) ([]ArchiveRecord, error) {
+	return device.GetDayArchive(ctx, day)
+}
+
+// BackfillJob is the download of an archive day
+type BackfillJob struct {
+	// Serial number of the device
+	Serial uint32 `json:"serial"`
+	// Day of the archive (start of the day)
+	Day time.Time `json:"day"`
+	// Attempts of failed downloads
+	Attempts int `json:"attempts,omitempty"`
+	// LastError of the latest failed download
+	LastError string `json:"lastError,omitempty"`
+	// NextAttempt of a failed download
+	NextAttempt time.Time `json:"nextAttempt,omitempty"`
+	// Failed is true if all attempts failed, see Backfill.ResetFailed
+	Failed bool `json:"failed,omitempty"`
+}
+
+// backfillKey identifies a job
+type backfillKey struct {
+	serial uint32
+	day    string
+}
+
+// key of the job
+func (j *BackfillJob) key() backfillKey {
+	return backfillKey{serial: j.Serial, day: j.Day.Format(time.DateOnly)}
+}
+
+// Backfill downloads the archive days of inverters missing in the local store.
+// Interrupted runs resume with the days still missing; the state of failed
+// jobs can be kept across restarts with SaveState and RestoreState.
+type Backfill struct {
+	// Retention window of the archive, days within it are downloaded (today excluded)
+	Retention time.Duration
+	// Location of the day boundaries (nil -> time.Local)
+	Location *time.Location
+	// Retry of failed downloads per day
+	Retry RetryPolicy
+
+	store    ArchiveStore
+	download ArchiveDownloader
+	limiter  rateLimiter
+
+	mutex   sync.Mutex
+	devices []*Device
+	jobs    map[backfillKey]*BackfillJob
+}
+
+// NewBackfill creates a backfill of the retention window with DefaultBackfillRetry,
+// days are downloaded with DownloadDayArchive if download is nil
+func NewBackfill(store ArchiveStore, download ArchiveDownloader, retention time.Duration) *Backfill {
+	if download == nil {
+		download = DownloadDayArchive
+	}
+	return &Backfill{
+		Retention: retention,
+		Retry:     DefaultBackfillRetry,
+		store:     store,
+		download:  download,
+		jobs:      make(map[backfillKey]*BackfillJob),
+	}
+}
+
+// SetRateLimit of started downloads of all devices (jobs per second, 0 -> unlimited).
+// Downloads are sent with PriorityLow, so a rate limit of the connection
+// prefers other requests.
+func (b *Backfill) SetRateLimit(rate float64, burst int) {
+	b.limiter.set(rate, burst)
+}
+
+// AddDevice adds an inverter to the backfill
+func (b *Backfill) AddDevice(device *Device) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if !slices.Contains(b.devices, device) {
+		b.devices = append(b.devices, device)
+	}
+}
+
+// RemoveDevice removes the inverter and its jobs
+func (b *Backfill) RemoveDevice(device *Device) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.devices = slices.DeleteFunc(b.devices, func(d *Device) bool { return d == device })
+	for key := range b.jobs {
+		if key.serial == device.SerialNumber() {
+			delete(b.jobs, key)
+		}
+	}
+}
+
+// location of the day boundaries
+func (b *Backfill) location() *time.Location {
+	if b.Location == nil {
+		return time.Local
+	}
+	return b.Location
+}
+
+// window returns the first and last day of the retention window
+func (b *Backfill) window(now time.Time) (time.Time, time.Time) {
+	now = now.In(b.location())
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	first := now.Add(-b.Retention)
+	first = time.Date(first.Year(), first.Month(), first.Day(), 0, 0, 0, 0, now.Location())
+	return first, today.AddDate(0, 0, -1)
+}
+
+// Plan determines the days missing in the store and adds their jobs.
+// Jobs of days outside of the retention window are removed.
+func (b *Backfill) Plan(ctx context.Context) ([]BackfillJob, error) {
+	first, last := b.window(time.Now())
+
+	b.mutex.Lock()
+	devices := slices.Clone(b.devices)
+	b.mutex.Unlock()
+
+	var errs []error
+	planned := make(map[uint32]bool)
+	missing := make(map[backfillKey]*BackfillJob)
+	for _, device := range devices {
+		serial := device.SerialNumber()
+		if serial == 0 || device.energyMeter {
+			continue // not identified or without archive
+		}
+
+		stored, err := b.store.ArchiveDays(ctx, serial, first, last)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("archive days of %d: %w", serial, err))
+			continue
+		}
+		planned[serial] = true
+		done := make(map[string]bool, len(stored))
+		for _, day := range stored {
+			done[day.In(b.location()).Format(time.DateOnly)] = true
+		}
+		for day := first; !day.After(last); day = day.AddDate(0, 0, 1) {
+			job := &BackfillJob{Serial: serial, Day: day}
+			if !done[day.Format(time.DateOnly)] {
+				missing[job.key()] = job
+			}
+		}
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for key := range b.jobs {
+		if _, ok := missing[key]; !ok && planned[key.serial] {
+			delete(b.jobs, key)
+		}
+	}
+	for key, job := range missing {
+		if _, ok := b.jobs[key]; !ok {
+			b.jobs[key] = job
+		}
+	}
+	return b.jobList(), errors.Join(errs...)
+}
+
+// Jobs returns all pending and failed jobs, the oldest day first
+func (b *Backfill) Jobs() []BackfillJob {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.jobList()
+}
+
+// jobList returns a copy of the sorted jobs, the mutex must be held
+func (b *Backfill) jobList() []BackfillJob {
+	jobs := make([]BackfillJob, 0, len(b.jobs))
+	for _, job := range b.jobs {
+		jobs = append(jobs, *job)
+	}
+	slices.SortFunc(jobs, func(a, b BackfillJob) int {
+		return cmp.Or(a.Day.Compare(b.Day), cmp.Compare(a.Serial, b.Serial))
+	})
+	return jobs
+}
+
+// ResetFailed jobs, so they are attempted again
+func (b *Backfill) ResetFailed() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for _, job := range b.jobs {
+		if job.Failed {
+			job.Attempts = 0
+			job.Failed = false
+			job.NextAttempt = time.Time{}
+		}
+	}
+}
+
+// Run plans the missing days and downloads them until all jobs are done or
+// failed. Every device downloads one day at a time, the oldest day first.
+// It stops if ctx is done; interrupted jobs are not counted as failed.
+func (b *Backfill) Run(ctx context.Context) error {
+	_, err := b.Plan(ctx)
+	if err != nil {
+		Log.Printf("backfill - failed to plan: %v", err)
+	}
+
+	b.mutex.Lock()
+	devices := slices.Clone(b.devices)
+	b.mutex.Unlock()
+
+	var wg sync.WaitGroup
+	for _, device := range devices {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b.runDevice(ctx, device)
+		}()
+	}
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	var errs []error
+	for _, job := range b.Jobs() {
+		if job.Failed {
+			errs = append(errs, fmt.Errorf("archive %s of %d: %s", job.Day.Format(time.DateOnly), job.Serial, job.LastError))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// runDevice downloads the jobs of the device
+func (b *Backfill) runDevice(ctx context.Context, device *Device) {
+	for {
+		job, wait, ok := b.next(device.SerialNumber(), time.Now())
+		if !ok {
+			return
+		}
+		if wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			}
+			continue
+		}
+
+		err := b.limiter.wait(ctx, PriorityLow)
+		if err != nil {
+			return
+		}
+		err = b.run(ctx, device, job)
+		if ctx.Err() != nil {
+			return
+		}
+		b.done(job, err)
+	}
+}
+
+// next returns the oldest job of the serial which can be started or the
+// time to wait for the next attempt of failed jobs
+func (b *Backfill) next(serial uint32, now time.Time) (BackfillJob, time.Duration, bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	var next *BackfillJob
+	for _, job := range b.jobs {
+		if job.Serial != serial || job.Failed {
+			continue
+		}
+		if next == nil || job.NextAttempt.Before(next.NextAttempt) ||
+			(job.NextAttempt.Equal(next.NextAttempt) && job.Day.Before(next.Day)) {
+			next = job
+		}
+	}
+	if next == nil {
+		return BackfillJob{}, 0, false
+	}
+	return *next, next.NextAttempt.Sub(now), true
+}
+
+// run downloads and stores the day of the job
+func (b *Backfill) run(ctx context.Context, device *Device, job BackfillJob) error {
+	ctx = WithPriority(ctx, PriorityLow)
+	records, err := b.download(ctx, device, job.Day)
+	if err != nil {
+		return err
+	}
+	return b.store.StoreArchiveDay(ctx, job.Serial, job.Day, records)
+}
+
+// done removes the job or schedules its next attempt
+func (b *Backfill) done(job BackfillJob, err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	current, ok := b.jobs[job.key()]
+	if !ok {
+		return // removed while running
+	}
+	if err == nil {
+		delete(b.jobs, job.key())
+		return
+	}
+
+	current.Attempts++
+	current.LastError = err.Error()
+	if current.Attempts >= b.Retry.attempts() {
+		current.Failed = true
+		current.NextAttempt = time.Time{}
+		Log.Printf("backfill - archive %s of %d failed: %v", job.Day.Format(time.DateOnly), job.Serial, err)
+		return
+	}
+	current.NextAttempt = time.Now().Add(b.Retry.delay(current.Attempts - 1))
+}
+
+// SaveState writes the pending and failed jobs as JSON
+func (b *Backfill) SaveState(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(b.Jobs())
+}
+
+// RestoreState adds the jobs written by SaveState, so attempts of failed
+// days are kept. Days already stored are removed by the next Plan.
+func (b *Backfill) RestoreState(r io.Reader) error {
+	var jobs []BackfillJob
+	err := json.NewDecoder(r).Decode(&jobs)
+	if err != nil {
+		return fmt.Errorf("invalid backfill state: %w", err)
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for _, job := range jobs {
+		job.Day = job.Day.In(b.location())
+		b.jobs[job.key()] = &job
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/pb82/sunny/proto"
+)
+
+// BackpressurePolicy defines how packets are handled for busy receivers
+type BackpressurePolicy int
+
+const (
+	// DropNewest drops received packets if the receiver is busy (default)
+	DropNewest BackpressurePolicy = iota
+	// DropOldest drops the oldest queued packet to make room for the received one
+	DropOldest
+	// Block waits up to the timeout for the receiver before the packet is dropped.
+	// Note: this delays all packets decoded by the same worker.
+	Block
+)
+
+// Backpressure configuration of a receiver
+type Backpressure struct {
+	Policy BackpressurePolicy
+	// Timeout for the Block policy
+	Timeout time.Duration
+}
+
+// packetReceiver receives packets of one IP
+type packetReceiver struct {
+	ch           chan *proto.Packet
+	backpressure Backpressure
+	dropped      atomic.Uint64
+	// ticker of received energy meter packets
+	clock deviceClock
+}
+
+// newPacketReceiver with a channel of the given size
+func newPacketReceiver(size int, backpressure Backpressure) *packetReceiver {
+	return &packetReceiver{
+		ch:           make(chan *proto.Packet, size),
+		backpressure: backpressure,
+	}
+}
+
+// deliver packet according to the backpressure policy, returns false if a packet was dropped
+func (r *packetReceiver) deliver(packet *proto.Packet) bool {
+	r.clock.observe(packet, time.Now())
+
+	select {
+	case r.ch <- packet:
+		return true
+	default:
+	}
+
+	switch r.backpressure.Policy {
+	case DropOldest:
+		select {
+		case <-r.ch:
+		default:
+		}
+		select {
+		case r.ch <- packet:
+		default:
+		}
+
+	case Block:
+		timer := time.NewTimer(r.backpressure.Timeout)
+		defer timer.Stop()
+		select {
+		case r.ch <- packet:
+			return true
+		case <-timer.C:
+		}
+	}
+
+	r.dropped.Add(1)
+	return false
+}
+
+// DroppedPackets returns the amount of received packets dropped because the device was busy
+func (d *Device) DroppedPackets() uint64 {
+	return d.receiver.dropped.Load()
+}
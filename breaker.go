@@ -0,0 +1,83 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// CircuitBreaker stops requests to unresponsive devices
+type CircuitBreaker struct {
+	// Threshold of consecutive timeouts to trip the breaker (0 -> disabled)
+	Threshold int
+	// ProbeInterval between requests while the breaker is tripped
+	ProbeInterval time.Duration
+}
+
+// WithCircuitBreaker trips after threshold consecutive timeouts; while tripped
+// only one request per probe interval is sent, others fail with ErrCircuitOpen
+func WithCircuitBreaker(threshold int, probeInterval time.Duration) DeviceOption {
+	return func(c *deviceConfig) {
+		c.breaker = &CircuitBreaker{
+			Threshold:     threshold,
+			ProbeInterval: probeInterval,
+		}
+	}
+}
+
+// SetCircuitBreaker of the device, nil disables the breaker
+func (d *Device) SetCircuitBreaker(breaker *CircuitBreaker) {
+	d.health.mutex.Lock()
+	defer d.health.mutex.Unlock()
+	d.health.breaker = breaker
+}
+
+// tripped returns true if the breaker is open
+func (h *deviceHealth) tripped() bool {
+	return h.breaker != nil && h.breaker.Threshold > 0 &&
+		h.consecutiveTimeouts >= h.breaker.Threshold
+}
+
+// allow checks the circuit breaker before sending requests
+func (h *deviceHealth) allow() error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if !h.tripped() {
+		return nil
+	}
+	if time.Since(h.lastProbe) < h.breaker.ProbeInterval {
+		return fmt.Errorf("%w: %d consecutive timeouts", ErrCircuitOpen, h.consecutiveTimeouts)
+	}
+	h.lastProbe = time.Now()
+	return nil
+}
+
+// updateBreaker after a poll, must be called with locked mutex
+func (h *deviceHealth) updateBreaker(err error) {
+	switch {
+	case errors.Is(err, ErrCircuitOpen):
+	case errors.Is(err, ErrTimeout):
+		h.consecutiveTimeouts++
+		if h.breaker != nil && h.consecutiveTimeouts == h.breaker.Threshold {
+			h.lastProbe = time.Now()
+		}
+	default:
+		// device responded
+		h.consecutiveTimeouts = 0
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeviceHealth_breaker(t *testing.T) {
+	timeout := fmt.Errorf("%w: no response", ErrTimeout)
+	open := fmt.Errorf("%w: 2 consecutive timeouts", ErrCircuitOpen)
+	tests := []struct {
+		name    string
+		breaker *CircuitBreaker
+		results []error
+		tripped bool
+		// error of allow after the results
+		allow error
+	}{
+		{"no breaker", nil, []error{timeout, timeout, timeout}, false, nil},
+		{"disabled", &CircuitBreaker{Threshold: 0, ProbeInterval: time.Hour}, []error{timeout, timeout}, false, nil},
+		{"below threshold", &CircuitBreaker{Threshold: 2, ProbeInterval: time.Hour}, []error{timeout}, false, nil},
+		{"tripped", &CircuitBreaker{Threshold: 2, ProbeInterval: time.Hour}, []error{timeout, timeout}, true, ErrCircuitOpen},
+		{"probe due", &CircuitBreaker{Threshold: 2}, []error{timeout, timeout}, true, nil},
+		{"response resets", &CircuitBreaker{Threshold: 2, ProbeInterval: time.Hour}, []error{timeout, nil, timeout}, false, nil},
+		{"other error resets", &CircuitBreaker{Threshold: 2, ProbeInterval: time.Hour}, []error{timeout, errors.New("busy"), timeout}, false, nil},
+		{"open ignored", &CircuitBreaker{Threshold: 2, ProbeInterval: time.Hour}, []error{timeout, timeout, open}, true, ErrCircuitOpen},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ass := assert.New(t)
+
+			h := deviceHealth{breaker: tt.breaker}
+			for _, err := range tt.results {
+				h.updateBreaker(err)
+			}
+			ass.Equal(tt.tripped, h.tripped())
+			if tt.allow == nil {
+				ass.NoError(h.allow())
+			} else {
+				ass.ErrorIs(h.allow(), tt.allow)
+			}
+		})
+	}
+}
+
+func TestDeviceHealth_allow_probe(t *testing.T) {
+	ass := assert.New(t)
+
+	h := deviceHealth{breaker: &CircuitBreaker{Threshold: 1, ProbeInterval: 30 * time.Millisecond}}
+	h.updateBreaker(ErrTimeout)
+	ass.ErrorIs(h.allow(), ErrCircuitOpen)
+
+	// one probe per interval
+	time.Sleep(40 * time.Millisecond)
+	ass.NoError(h.allow())
+	ass.ErrorIs(h.allow(), ErrCircuitOpen)
+
+	// a response closes the breaker
+	h.updateBreaker(nil)
+	ass.NoError(h.allow())
+	ass.NoError(h.allow())
+}
@@ -0,0 +1,61 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+// default buffer sizes of channels
+const (
+	// DefaultReceiverBufferSize of packets queued per device
+	DefaultReceiverBufferSize = 2
+	// DefaultDiscoveryBufferSize of discovered IPs queued per discovery
+	DefaultDiscoveryBufferSize = 0
+)
+
+// WithReceiverBufferSize sets the default amount of packets queued for devices of the connection
+func WithReceiverBufferSize(size int) ConnectionOption {
+	return func(c *connectionConfig) {
+		c.receiverBufferSize = &size
+	}
+}
+
+// WithDiscoveryBufferSize sets the amount of discovered IPs queued during discovery
+func WithDiscoveryBufferSize(size int) ConnectionOption {
+	return func(c *connectionConfig) {
+		c.discoveryBufferSize = &size
+	}
+}
+
+// WithDeviceReceiverBufferSize sets the amount of packets queued for the device
+// (e.g. energy meters read slower than they broadcast)
+func WithDeviceReceiverBufferSize(size int) DeviceOption {
+	return func(c *deviceConfig) {
+		c.receiverBufferSize = &size
+	}
+}
+
+// SetBufferSizes of channels for devices and discoveries created afterwards
+func (c *Connection) SetBufferSizes(receiver, discovery int) {
+	c.receiverBufferSize.Store(int32(receiver))
+	c.discoveryBufferSize.Store(int32(discovery))
+}
+
+// applyBufferSizes of the config to the connection
+func (c *Connection) applyBufferSizes(config *connectionConfig) {
+	if config.receiverBufferSize != nil {
+		c.receiverBufferSize.Store(int32(*config.receiverBufferSize))
+	}
+	if config.discoveryBufferSize != nil {
+		c.discoveryBufferSize.Store(int32(*config.discoveryBufferSize))
+	}
+}
@@ -0,0 +1,276 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"sync"
+	"time"
+)
+
+// ValueSource is the transport a value was received with
+type ValueSource int
+
+// sources of values
+const (
+	// SourceSpeedwire for responses and energy meter broadcasts
+	SourceSpeedwire ValueSource = iota
+	// SourceWebConnect for values of the WebConnect fallback
+	SourceWebConnect
+)
+
+// String representation of the source
+func (s ValueSource) String() string {
+	switch s {
+	case SourceSpeedwire:
+		return "speedwire"
+	case SourceWebConnect:
+		return "webconnect"
+	}
+	return fmt.Sprintf("ValueSource(%d)", int(s))
+}
+
+// Freshness of a cached value
+type Freshness struct {
+	// Received time of the value
+	Received time.Time
+	// Age of the value at the time of the lookup
+	Age time.Duration
+	// Source the value was received from
+	Source ValueSource
+	// Expired is true if the value is older than its TTL (kept for KeepStale)
+	Expired bool
+	// Failed is true if the last refresh attempt did not return the value
+	// (e.g. the device did not answer)
+	Failed bool
+}
+
+// CachedValue with its freshness
+type CachedValue struct {
+	Value interface{}
+	Freshness
+}
+
+// ValueCache shares the values of a device between callers of GetValues
+// within the TTL of the values
+type ValueCache struct {
+	// TTL of values without own TTL
+	TTL time.Duration
+	// TTLs per value (e.g. longer for energy counters)
+	TTLs map[ValueID]time.Duration
+	// KeepStale keeps expired values for lookups with their freshness
+	// (GetValues never returns expired values)
+	KeepStale time.Duration
+
+	mutex   sync.Mutex
+	entries map[ValueID]cacheEntry
+	// expired values kept for KeepStale
+	stale map[ValueID]cacheEntry
+	// time of the last refresh attempt
+	lastFetch time.Time
+	call      *cacheCall
+}
+
+// cacheEntry is a cached value with its receive time
+type cacheEntry struct {
+	value    interface{}
+	received time.Time
+	// timestamp reported by the device (zero if not reported)
+	reported time.Time
+	source   ValueSource
+}
+
+// cacheCall is a pending request shared by all callers
+type cacheCall struct {
+	done   chan struct{}
+	values map[ValueID]interface{}
+	times  map[ValueID]time.Time
+	err    error
+}
+
+// NewValueCache with the default TTL for all values
+func NewValueCache(ttl time.Duration) *ValueCache {
+	return &ValueCache{
+		TTL:     ttl,
+		TTLs:    make(map[ValueID]time.Duration),
+		entries: make(map[ValueID]cacheEntry),
+		stale:   make(map[ValueID]cacheEntry),
+	}
+}
+
+// SetValueCache used by GetValues, nil disables caching
+func (d *Device) SetValueCache(cache *ValueCache) {
+	d.cache.Store(cache)
+}
+
+// Invalidate all cached values
+func (c *ValueCache) Invalidate() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.entries = make(map[ValueID]cacheEntry)
+	c.stale = make(map[ValueID]cacheEntry)
+}
+
+// Lookup a cached value with its freshness, expired values are returned within KeepStale
+func (c *ValueCache) Lookup(id ValueID) (CachedValue, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry, ok := c.entries[id]
+	if !ok {
+		entry, ok = c.stale[id]
+	}
+	if !ok {
+		return CachedValue{}, false
+	}
+	return c.cachedValue(id, entry, time.Now()), true
+}
+
+// CachedValues returns all cached values with their freshness, including
+// expired values within KeepStale
+func (c *ValueCache) CachedValues() map[ValueID]CachedValue {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := time.Now()
+	values := make(map[ValueID]CachedValue, len(c.entries)+len(c.stale))
+	for id, entry := range c.stale {
+		values[id] = c.cachedValue(id, entry, now)
+	}
+	for id, entry := range c.entries {
+		values[id] = c.cachedValue(id, entry, now)
+	}
+	return values
+}
+
+// cachedValue of the entry at the given time
+func (c *ValueCache) cachedValue(id ValueID, entry cacheEntry, now time.Time) CachedValue {
+	return CachedValue{
+		Value: entry.value,
+		Freshness: Freshness{
+			Received: entry.received,
+			Age:      now.Sub(entry.received),
+			Source:   entry.source,
+			Expired:  now.Sub(entry.received) >= c.ttl(id),
+			Failed:   entry.received.Before(c.lastFetch),
+		},
+	}
+}
+
+// ttl of the value
+func (c *ValueCache) ttl(id ValueID) time.Duration {
+	if ttl, ok := c.TTLs[id]; ok {
+		return ttl
+	}
+	return c.TTL
+}
+
+// valid returns true if cached values exist and none is expired
+func (c *ValueCache) valid(now time.Time) bool {
+	if len(c.entries) == 0 {
+		return false
+	}
+	for id, entry := range c.entries {
+		if now.Sub(entry.received) >= c.ttl(id) {
+			return false
+		}
+	}
+	return true
+}
+
+// values returns a copy of all cached values and their reported timestamps
+func (c *ValueCache) values() (map[ValueID]interface{}, map[ValueID]time.Time) {
+	values := make(map[ValueID]interface{}, len(c.entries))
+	times := make(map[ValueID]time.Time)
+	for id, entry := range c.entries {
+		values[id] = entry.value
+		if !entry.reported.IsZero() {
+			times[id] = entry.reported
+		}
+	}
+	return values, times
+}
+
+// store received values and drop expired ones
+// Values missing in the response (e.g. failed groups) are kept until they expire.
+func (c *ValueCache) store(values map[ValueID]interface{}, times map[ValueID]time.Time, source ValueSource, now time.Time) {
+	for id, value := range values {
+		c.entries[id] = cacheEntry{value: value, received: now, reported: times[id], source: source}
+		delete(c.stale, id)
+	}
+	c.expire(now)
+}
+
+// expire values older than their TTL, they are kept as stale for KeepStale
+func (c *ValueCache) expire(now time.Time) {
+	for id, entry := range c.entries {
+		if now.Sub(entry.received) >= c.ttl(id) {
+			delete(c.entries, id)
+			if c.KeepStale > 0 {
+				c.stale[id] = entry
+			}
+		}
+	}
+	for id, entry := range c.stale {
+		if now.Sub(entry.received) >= c.ttl(id)+c.KeepStale {
+			delete(c.stale, id)
+		}
+	}
+}
+
+// get cached values with their reported timestamps or fetch them.
+// Concurrent callers share one fetch, fetched is true for the caller that performed it.
+func (c *ValueCache) get(ctx context.Context, fetch func() (map[ValueID]interface{}, map[ValueID]time.Time, ValueSource, error)) (values map[ValueID]interface{}, times map[ValueID]time.Time, fetched bool, err error) {
+	c.mutex.Lock()
+	if c.valid(time.Now()) {
+		defer c.mutex.Unlock()
+		values, times = c.values()
+		return values, times, false, nil
+	}
+
+	call := c.call
+	if call != nil {
+		c.mutex.Unlock()
+		select {
+		case <-call.done:
+			return maps.Clone(call.values), maps.Clone(call.times), false, call.err
+		case <-ctx.Done():
+			return nil, nil, false, fmt.Errorf("%w: waiting for shared request", ErrTimeout)
+		}
+	}
+
+	call = &cacheCall{done: make(chan struct{})}
+	c.call = call
+	c.mutex.Unlock()
+
+	values, times, source, err := fetch()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	now := time.Now()
+	c.lastFetch = now
+	if values != nil {
+		c.store(values, times, source, now)
+		values, times = c.values()
+	} else {
+		c.expire(now)
+	}
+	call.values, call.times, call.err = values, times, err
+	c.call = nil
+	close(call.done)
+	return maps.Clone(values), maps.Clone(times), true, err
+}
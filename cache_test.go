@@ -0,0 +1,243 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValueCache_get(t *testing.T) {
+	power := map[ValueID]interface{}{ActivePowerPlus: uint32(100), DeviceName: "SN: 1"}
+	tests := []struct {
+		name string
+		ttls map[ValueID]time.Duration
+		// values of the first and second fetch, nil fails the fetch
+		first, second map[ValueID]interface{}
+		fetched       bool
+		values        map[ValueID]interface{}
+	}{
+		{"cached", nil, power, nil, false, power},
+		{"failed fetch", nil, nil, power, true, power},
+		{"expired", map[ValueID]time.Duration{ActivePowerPlus: time.Millisecond}, power,
+			map[ValueID]interface{}{ActivePowerPlus: uint32(200), DeviceName: "SN: 1"}, true,
+			map[ValueID]interface{}{ActivePowerPlus: uint32(200), DeviceName: "SN: 1"}},
+		{"missing values kept", map[ValueID]time.Duration{ActivePowerPlus: time.Millisecond}, power,
+			map[ValueID]interface{}{ActivePowerPlus: uint32(200)}, true,
+			map[ValueID]interface{}{ActivePowerPlus: uint32(200), DeviceName: "SN: 1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ass := assert.New(t)
+
+			cache := NewValueCache(time.Hour)
+			if tt.ttls != nil {
+				cache.TTLs = tt.ttls
+			}
+			fetch := func(values map[ValueID]interface{}) func() (map[ValueID]interface{}, map[ValueID]time.Time, ValueSource, error) {
+				return func() (map[ValueID]interface{}, map[ValueID]time.Time, ValueSource, error) {
+					if values == nil {
+						return nil, nil, SourceSpeedwire, ErrTimeout
+					}
+					return values, nil, SourceSpeedwire, nil
+				}
+			}
+
+			values, _, fetched, err := cache.get(context.Background(), fetch(tt.first))
+			ass.True(fetched)
+			if tt.first == nil {
+				ass.ErrorIs(err, ErrTimeout)
+				ass.Empty(values)
+			}
+			time.Sleep(5 * time.Millisecond)
+
+			values, _, fetched, err = cache.get(context.Background(), fetch(tt.second))
+			ass.NoError(err)
+			ass.Equal(tt.fetched, fetched)
+			ass.Equal(tt.values, values)
+		})
+	}
+}
+
+func TestValueCache_get_times(t *testing.T) {
+	ass := assert.New(t)
+
+	reported := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	cache := NewValueCache(time.Hour)
+	_, times, fetched, err := cache.get(context.Background(), func() (map[ValueID]interface{}, map[ValueID]time.Time, ValueSource, error) {
+		return map[ValueID]interface{}{ActivePowerPlus: uint32(100), DeviceName: "SN: 1"},
+			map[ValueID]time.Time{ActivePowerPlus: reported}, SourceSpeedwire, nil
+	})
+	ass.NoError(err)
+	ass.True(fetched)
+	ass.Equal(map[ValueID]time.Time{ActivePowerPlus: reported}, times)
+
+	// cached values keep the reported timestamps
+	_, times, fetched, err = cache.get(context.Background(), nil)
+	ass.NoError(err)
+	ass.False(fetched)
+	ass.Equal(map[ValueID]time.Time{ActivePowerPlus: reported}, times)
+}
+
+func TestValueCache_get_shared(t *testing.T) {
+	ass := assert.New(t)
+
+	cache := NewValueCache(time.Hour)
+	release := make(chan struct{})
+	var calls, fetchers atomic.Int32
+	fetch := func() (map[ValueID]interface{}, map[ValueID]time.Time, ValueSource, error) {
+		calls.Add(1)
+		<-release
+		return map[ValueID]interface{}{ActivePowerPlus: uint32(100)}, nil, SourceSpeedwire, nil
+	}
+
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			values, _, fetched, err := cache.get(context.Background(), fetch)
+			ass.NoError(err)
+			ass.Equal(map[ValueID]interface{}{ActivePowerPlus: uint32(100)}, values)
+			if fetched {
+				fetchers.Add(1)
+			}
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	ass.Equal(int32(1), calls.Load())
+	ass.Equal(int32(1), fetchers.Load())
+}
+
+func TestValueCache_get_sharedError(t *testing.T) {
+	ass := assert.New(t)
+
+	cache := NewValueCache(time.Hour)
+	release := make(chan struct{})
+	fetch := func() (map[ValueID]interface{}, map[ValueID]time.Time, ValueSource, error) {
+		<-release
+		return nil, nil, SourceSpeedwire, ErrTimeout
+	}
+
+	done := make(chan error)
+	go func() {
+		_, _, _, err := cache.get(context.Background(), fetch)
+		done <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	// a waiter with an expired context gives up, others get the shared error
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, _, fetched, err := cache.get(ctx, fetch)
+	ass.False(fetched)
+	ass.ErrorIs(err, ErrTimeout)
+
+	go func() {
+		_, _, _, err := cache.get(context.Background(), fetch)
+		done <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	ass.ErrorIs(<-done, ErrTimeout)
+	ass.ErrorIs(<-done, ErrTimeout)
+}
+
+func TestValueCache_Lookup(t *testing.T) {
+	tests := []struct {
+		name      string
+		ttl       time.Duration
+		ttls      map[ValueID]time.Duration
+		keepStale time.Duration
+		age       time.Duration
+		// failed adds a later refresh without the value
+		failed bool
+		// expire runs the expiry of the cache before the lookup
+		expire  bool
+		found   bool
+		expired bool
+	}{
+		{name: "fresh", ttl: time.Minute, age: time.Second, found: true},
+		{name: "expired", ttl: time.Minute, age: 2 * time.Minute, found: true, expired: true},
+		{name: "value ttl", ttl: time.Minute, ttls: map[ValueID]time.Duration{ActivePowerPlus: time.Hour}, age: 2 * time.Minute, found: true},
+		{name: "failed", ttl: time.Minute, age: time.Second, failed: true, found: true},
+		{name: "expired dropped", ttl: time.Minute, age: 2 * time.Minute, expire: true},
+		{name: "expired stale", ttl: time.Minute, keepStale: time.Hour, age: 2 * time.Minute, failed: true, expire: true, found: true, expired: true},
+		{name: "stale dropped", ttl: time.Minute, keepStale: time.Minute, age: 3 * time.Minute, expire: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ass := assert.New(t)
+
+			now := time.Now()
+			received := now.Add(-tt.age)
+			cache := NewValueCache(tt.ttl)
+			if tt.ttls != nil {
+				cache.TTLs = tt.ttls
+			}
+			cache.KeepStale = tt.keepStale
+			cache.store(map[ValueID]interface{}{ActivePowerPlus: uint32(100)}, nil, SourceWebConnect, received)
+			cache.lastFetch = received
+			if tt.failed {
+				cache.lastFetch = received.Add(time.Millisecond)
+			}
+			if tt.expire {
+				cache.expire(now)
+			}
+
+			value, ok := cache.Lookup(ActivePowerPlus)
+			ass.Equal(tt.found, ok)
+			ass.Equal(tt.found, len(cache.CachedValues()) == 1)
+			if !tt.found {
+				return
+			}
+			ass.Equal(uint32(100), value.Value)
+			ass.Equal(received, value.Received)
+			ass.GreaterOrEqual(value.Age, tt.age)
+			ass.Equal(SourceWebConnect, value.Source)
+			ass.Equal(tt.expired, value.Expired)
+			ass.Equal(tt.failed, value.Failed)
+		})
+	}
+}
+
+func TestValueCache_Invalidate(t *testing.T) {
+	ass := assert.New(t)
+
+	cache := NewValueCache(time.Hour)
+	cache.KeepStale = time.Hour
+	cache.store(map[ValueID]interface{}{ActivePowerPlus: uint32(100)}, nil, SourceSpeedwire, time.Now())
+	cache.Invalidate()
+
+	_, ok := cache.Lookup(ActivePowerPlus)
+	ass.False(ok)
+	calls := 0
+	_, _, fetched, err := cache.get(context.Background(), func() (map[ValueID]interface{}, map[ValueID]time.Time, ValueSource, error) {
+		calls++
+		return nil, nil, SourceSpeedwire, errors.New("failed")
+	})
+	ass.Error(err)
+	ass.True(fetched)
+	ass.Equal(1, calls)
+}
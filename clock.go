@@ -0,0 +1,161 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pb82/sunny/proto"
+	"github.com/pb82/sunny/proto/net2"
+)
+
+// clockRestartJump of the ticker backwards which is handled as restart of
+// the device, smaller jumps are reordered packets
+const clockRestartJump = time.Minute
+
+// ClockState relates the millisecond ticker of energy meter broadcasts to the host clock
+type ClockState struct {
+	// Ticker of the last broadcast in ms (wraps after 49.7 days)
+	Ticker uint32
+	// Received is the host time of the last broadcast
+	Received time.Time
+	// Samples since the start of the device used for the drift estimation
+	Samples int
+	// Drift of the device clock against the host clock, positive if the
+	// device clock runs fast (e.g. 20e-6 for 20 ppm)
+	Drift float64
+}
+
+// deviceClock estimates the drift of the device ticker by a linear
+// regression of the offset to the host clock
+type deviceClock struct {
+	mutex sync.Mutex
+	// first sample since the start of the device
+	startTicker uint64
+	startTime   time.Time
+	// last sample, extended includes wraps of the ticker
+	ticker   uint32
+	extended uint64
+	received time.Time
+	samples  int
+	// sums of device time x and offset y (host - device) in seconds
+	sumX, sumY, sumXX, sumXY float64
+}
+
+// observe the ticker of energy meter packets
+func (c *deviceClock) observe(packet *proto.Packet, now time.Time) {
+	entry, ok := packet.GetEntry(proto.SmaNet2PacketEntryTag).(*proto.SmaNet2PacketEntry)
+	if !ok {
+		return
+	}
+	meter, ok := entry.Content.(*net2.EnergyMeterPacket)
+	if !ok {
+		return
+	}
+	c.sample(meter.Ticker, now)
+}
+
+// sample the ticker received at the given host time
+func (c *deviceClock) sample(ticker uint32, now time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	delta := int32(ticker - c.ticker)
+	restart := delta < 0 &&
+		(int64(-delta) > clockRestartJump.Milliseconds() || c.extended < c.startTicker+uint64(-delta))
+	switch {
+	case c.samples > 0 && delta == 0:
+		// duplicate
+		return
+	case c.samples > 0 && delta < 0 && !restart:
+		// reordered or late packet
+		return
+	case c.samples == 0 || restart:
+		// first sample or restart of the device
+		c.startTicker = uint64(ticker)
+		c.startTime = now
+		c.extended = uint64(ticker)
+		c.samples = 0
+		c.sumX, c.sumY, c.sumXX, c.sumXY = 0, 0, 0, 0
+	default:
+		c.extended += uint64(delta)
+	}
+	c.ticker = ticker
+	c.received = now
+	c.samples++
+
+	x := float64(c.extended-c.startTicker) / 1000
+	y := now.Sub(c.startTime).Seconds() - x
+	c.sumX += x
+	c.sumY += y
+	c.sumXX += x * x
+	c.sumXY += x * y
+}
+
+// regression returns offset and slope of the host clock over device time, the mutex must be locked
+func (c *deviceClock) regression() (offset, slope float64) {
+	n := float64(c.samples)
+	if n == 0 {
+		return 0, 0
+	}
+	denominator := n*c.sumXX - c.sumX*c.sumX
+	if c.samples > 1 && denominator > 0 {
+		slope = (n*c.sumXY - c.sumX*c.sumY) / denominator
+	}
+	return (c.sumY - slope*c.sumX) / n, slope
+}
+
+// state of the clock
+func (c *deviceClock) state() ClockState {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	state := ClockState{
+		Ticker:   c.ticker,
+		Received: c.received,
+		Samples:  c.samples,
+	}
+	if _, slope := c.regression(); slope != 0 {
+		state.Drift = -slope
+	}
+	return state
+}
+
+// time of the ticker on the host clock
+func (c *deviceClock) time(ticker uint32) (time.Time, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.samples == 0 {
+		return time.Time{}, false
+	}
+	offset, slope := c.regression()
+	x := float64(int64(c.extended)+int64(int32(ticker-c.ticker))-int64(c.startTicker)) / 1000
+	seconds := x + offset + slope*x
+	return c.startTime.Add(time.Duration(seconds * float64(time.Second))), true
+}
+
+// Clock returns the ticker and drift of energy meter broadcasts (zero for inverters)
+func (d *Device) Clock() ClockState {
+	return d.receiver.clock.state()
+}
+
+// TickerTime maps a ticker of the energy meter (e.g. of a recorded packet) to
+// the host clock, corrected by the measured drift.
+// Returns false if no broadcast was received yet.
+func (d *Device) TickerTime(ticker uint32) (time.Time, bool) {
+	return d.receiver.clock.time(ticker)
+}
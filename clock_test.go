@@ -0,0 +1,92 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// sampleClock feeds count samples in 1s host intervals, the device ticker runs with the drift
+func sampleClock(c *deviceClock, start time.Time, ticker uint32, count int, drift float64) time.Time {
+	now := start
+	for i := range count {
+		now = start.Add(time.Duration(i) * time.Second)
+		c.sample(ticker+uint32(math.Round(float64(i)*1000*(1+drift))), now)
+	}
+	return now
+}
+
+func TestDeviceClock_drift(t *testing.T) {
+	ass := assert.New(t)
+
+	clock := new(deviceClock)
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	sampleClock(clock, start, 1000, 600, 100e-6)
+
+	state := clock.state()
+	ass.Equal(600, state.Samples)
+	ass.InDelta(100e-6, state.Drift, 1e-6)
+
+	// ticker of the first sample maps to its host time
+	at, ok := clock.time(1000)
+	ass.True(ok)
+	ass.WithinDuration(start, at, time.Millisecond)
+}
+
+func TestDeviceClock_sample(t *testing.T) {
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		// ticker of the sample after 60 samples starting at ticker 100000
+		ticker  uint32
+		samples int
+	}{
+		{"next", 100000 + 60000, 61},
+		{"duplicate", 100000 + 59000, 60},
+		{"reordered", 100000 + 58500, 60},
+		{"restart", 5000, 1},
+		{"below start", 90000, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := new(deviceClock)
+			now := sampleClock(clock, start, 100000, 60, 0)
+			clock.sample(tt.ticker, now.Add(time.Second))
+			assert.Equal(t, tt.samples, clock.state().Samples)
+		})
+	}
+}
+
+func TestDeviceClock_wrap(t *testing.T) {
+	ass := assert.New(t)
+
+	clock := new(deviceClock)
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	now := sampleClock(clock, start, math.MaxUint32-5000, 10, 0)
+
+	state := clock.state()
+	ass.Equal(10, state.Samples)
+	ass.Equal(uint32(3999), state.Ticker)
+
+	// ticker after the wrap maps to the host clock
+	at, ok := clock.time(state.Ticker)
+	ass.True(ok)
+	ass.WithinDuration(now, at, time.Millisecond)
+}
@@ -0,0 +1,275 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cloud provides an optional client for the SMA monitoring API
+// (Sunny Portal / ennexOS) to read plant configuration and history.
+package cloud
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// default endpoints of the SMA monitoring API
+const (
+	DefaultBaseURL  = "https://monitoring.smaapis.de"
+	DefaultTokenURL = "https://auth.smaapis.de/oauth2/token"
+)
+
+// ErrUnauthorized is returned if the API rejects the access token
+var ErrUnauthorized = errors.New("cloud: unauthorized")
+
+// TokenSource provides access tokens for API requests
+type TokenSource interface {
+	// Token returns a valid access token
+	Token(ctx context.Context) (string, error)
+}
+
+// StaticToken is a fixed access token
+type StaticToken string
+
+// Token returns the static token
+func (s StaticToken) Token(context.Context) (string, error) {
+	return string(s), nil
+}
+
+// ClientCredentials gets access tokens with the OAuth2 client credentials grant
+type ClientCredentials struct {
+	ClientID     string
+	ClientSecret string
+	// TokenURL of the authorization server (default DefaultTokenURL)
+	TokenURL string
+
+	mutex   sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// Token returns a cached token or requests a new one
+func (c *ClientCredentials) Token(ctx context.Context) (string, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.token != "" && time.Now().Before(c.expires) {
+		return c.token, nil
+	}
+
+	tokenURL := c.TokenURL
+	if tokenURL == "" {
+		tokenURL = DefaultTokenURL
+	}
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {c.ClientID},
+		"client_secret": {c.ClientSecret},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("cloud: token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%w: token request status %d", ErrUnauthorized, resp.StatusCode)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&token)
+	if err != nil {
+		return "", fmt.Errorf("cloud: invalid token response: %w", err)
+	}
+
+	c.token = token.AccessToken
+	// renew token shortly before it expires
+	c.expires = time.Now().Add(time.Duration(token.ExpiresIn)*time.Second - time.Minute)
+	return c.token, nil
+}
+
+// Client for the SMA monitoring API
+type Client struct {
+	baseURL string
+	tokens  TokenSource
+	client  *http.Client
+}
+
+// NewClient creates a client using the given token source
+func NewClient(tokens TokenSource) *Client {
+	return &Client{
+		baseURL: DefaultBaseURL,
+		tokens:  tokens,
+		client:  http.DefaultClient,
+	}
+}
+
+// SetBaseURL of the API (e.g. for the sandbox)
+func (c *Client) SetBaseURL(baseURL string) {
+	c.baseURL = strings.TrimSuffix(baseURL, "/")
+}
+
+// SetHTTPClient used for requests
+func (c *Client) SetHTTPClient(client *http.Client) {
+	c.client = client
+}
+
+// Plant configured in the portal
+type Plant struct {
+	PlantID  string `json:"plantId"`
+	Name     string `json:"name"`
+	Timezone string `json:"timezone"`
+}
+
+// Device of a plant
+type Device struct {
+	DeviceID string `json:"deviceId"`
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Product  string `json:"product"`
+	Serial   string `json:"serial"`
+	IsActive bool   `json:"isActive"`
+}
+
+// Measurement is a single entry of a measurement set, values are keyed by their API name
+type Measurement struct {
+	Time   time.Time
+	Values map[string]float64
+}
+
+// Period of measurement sets
+type Period string
+
+// known periods
+const (
+	PeriodRecent Period = "Recent"
+	PeriodDay    Period = "Day"
+	PeriodMonth  Period = "Month"
+	PeriodYear   Period = "Year"
+)
+
+// Plants the token has access to
+func (c *Client) Plants(ctx context.Context) ([]Plant, error) {
+	var response struct {
+		Plants []Plant `json:"plants"`
+	}
+	err := c.get(ctx, "/v1/plants", nil, &response)
+	return response.Plants, err
+}
+
+// Devices of the plant
+func (c *Client) Devices(ctx context.Context, plantID string) ([]Device, error) {
+	var response struct {
+		Devices []Device `json:"devices"`
+	}
+	err := c.get(ctx, "/v1/plants/"+url.PathEscape(plantID)+"/devices", nil, &response)
+	return response.Devices, err
+}
+
+// Measurements of a device for the period containing date, e.g. set "EnergyAndPowerPv"
+func (c *Client) Measurements(ctx context.Context, deviceID, set string, period Period, date time.Time) ([]Measurement, error) {
+	path := fmt.Sprintf("/v1/devices/%s/measurements/sets/%s/%s",
+		url.PathEscape(deviceID), url.PathEscape(set), period)
+
+	query := url.Values{}
+	if period != PeriodRecent {
+		query.Set("Date", date.Format(dateFormat(period)))
+	}
+
+	var response struct {
+		Set []map[string]interface{} `json:"set"`
+	}
+	err := c.get(ctx, path, query, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	measurements := make([]Measurement, 0, len(response.Set))
+	for _, entry := range response.Set {
+		m := Measurement{Values: make(map[string]float64, len(entry))}
+		for key, value := range entry {
+			switch v := value.(type) {
+			case string:
+				if key == "time" {
+					m.Time, _ = time.Parse(time.RFC3339, v)
+				}
+			case float64:
+				m.Values[key] = v
+			}
+		}
+		measurements = append(measurements, m)
+	}
+	return measurements, nil
+}
+
+// dateFormat of the Date parameter for the period
+func dateFormat(period Period) string {
+	switch period {
+	case PeriodMonth:
+		return "2006-01"
+	case PeriodYear:
+		return "2006"
+	}
+	return "2006-01-02"
+}
+
+// get JSON from API
+func (c *Client) get(ctx context.Context, path string, query url.Values, response interface{}) error {
+	token, err := c.tokens.Token(ctx)
+	if err != nil {
+		return err
+	}
+
+	target := c.baseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("cloud: request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("%w: status %d", ErrUnauthorized, resp.StatusCode)
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("cloud: request %s failed with status %d", path, resp.StatusCode)
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(response)
+	if err != nil {
+		return fmt.Errorf("cloud: invalid response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTokenServer issues tokens valid for expiresIn seconds and counts the requests
+func newTokenServer(t *testing.T, expiresIn int, requests *atomic.Int32) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := requests.Add(1)
+		if r.PostFormValue("client_secret") != "secret" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": fmt.Sprintf("token-%d", n),
+			"expires_in":   expiresIn,
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestClientCredentials_Token(t *testing.T) {
+	tests := []struct {
+		name      string
+		expiresIn int
+		secret    string
+		tokens    []string
+		requests  int32
+		err       error
+	}{
+		{name: "cached", expiresIn: 3600, secret: "secret", tokens: []string{"token-1", "token-1"}, requests: 1},
+		// renewed a minute before it expires
+		{name: "renewed", expiresIn: 30, secret: "secret", tokens: []string{"token-1", "token-2"}, requests: 2},
+		{name: "rejected", expiresIn: 3600, secret: "wrong", err: ErrUnauthorized, requests: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ass := assert.New(t)
+
+			var requests atomic.Int32
+			server := newTokenServer(t, tt.expiresIn, &requests)
+			credentials := &ClientCredentials{ClientID: "id", ClientSecret: tt.secret, TokenURL: server.URL}
+
+			if tt.err != nil {
+				_, err := credentials.Token(context.Background())
+				ass.ErrorIs(err, tt.err)
+			}
+			for _, expected := range tt.tokens {
+				token, err := credentials.Token(context.Background())
+				ass.NoError(err)
+				ass.Equal(expected, token)
+			}
+			ass.Equal(tt.requests, requests.Load())
+		})
+	}
+}
+
+// newAPIServer answers requests with the response of the path and checks the access token
+func newAPIServer(t *testing.T, responses map[string]string) *Client {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		response, ok := responses[r.URL.RequestURI()]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(response))
+	}))
+	t.Cleanup(server.Close)
+
+	client := NewClient(StaticToken("token"))
+	client.SetBaseURL(server.URL + "/")
+	return client
+}
+
+func TestClient_Plants(t *testing.T) {
+	ass := assert.New(t)
+
+	client := newAPIServer(t, map[string]string{
+		"/v1/plants": `{"plants": [{"plantId": "1", "name": "Home", "timezone": "Europe/Berlin"}]}`,
+	})
+	plants, err := client.Plants(context.Background())
+	ass.NoError(err)
+	ass.Equal([]Plant{{PlantID: "1", Name: "Home", Timezone: "Europe/Berlin"}}, plants)
+}
+
+func TestClient_Devices(t *testing.T) {
+	ass := assert.New(t)
+
+	client := newAPIServer(t, map[string]string{
+		"/v1/plants/a%2Fb/devices": `{"devices": [{"deviceId": "7", "name": "SB 3.0", "serial": "1234", "isActive": true}]}`,
+	})
+	devices, err := client.Devices(context.Background(), "a/b")
+	ass.NoError(err)
+	ass.Equal([]Device{{DeviceID: "7", Name: "SB 3.0", Serial: "1234", IsActive: true}}, devices)
+}
+
+func TestClient_Measurements(t *testing.T) {
+	date := time.Date(2024, 6, 15, 0, 0, 0, 0, time.UTC)
+	set := `{"set": [{"time": "2024-06-15T12:00:00Z", "pvGeneration": 1500.5, "unit": "W"}, {"pvGeneration": 0}]}`
+	tests := []struct {
+		period Period
+		uri    string
+	}{
+		{PeriodRecent, "/v1/devices/7/measurements/sets/EnergyAndPowerPv/Recent"},
+		{PeriodDay, "/v1/devices/7/measurements/sets/EnergyAndPowerPv/Day?Date=2024-06-15"},
+		{PeriodMonth, "/v1/devices/7/measurements/sets/EnergyAndPowerPv/Month?Date=2024-06"},
+		{PeriodYear, "/v1/devices/7/measurements/sets/EnergyAndPowerPv/Year?Date=2024"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.period), func(t *testing.T) {
+			ass := assert.New(t)
+
+			client := newAPIServer(t, map[string]string{tt.uri: set})
+			measurements, err := client.Measurements(context.Background(), "7", "EnergyAndPowerPv", tt.period, date)
+			ass.NoError(err)
+			ass.Equal([]Measurement{
+				{Time: time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC), Values: map[string]float64{"pvGeneration": 1500.5}},
+				{Values: map[string]float64{"pvGeneration": 0}},
+			}, measurements)
+		})
+	}
+}
+
+func TestClient_errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		token  string
+		status int
+		body   string
+		err    error
+	}{
+		{name: "unauthorized", token: "expired", err: ErrUnauthorized},
+		{name: "forbidden", token: "token", status: http.StatusForbidden, err: ErrUnauthorized},
+		{name: "server error", token: "token", status: http.StatusInternalServerError},
+		{name: "invalid json", token: "token", status: http.StatusOK, body: "{"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ass := assert.New(t)
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Authorization") != "Bearer token" {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			client := NewClient(StaticToken(tt.token))
+			client.SetBaseURL(server.URL)
+			_, err := client.Plants(context.Background())
+			ass.Error(err)
+			if tt.err != nil {
+				ass.ErrorIs(err, tt.err)
+			} else {
+				ass.NotErrorIs(err, ErrUnauthorized)
+			}
+		})
+	}
+}
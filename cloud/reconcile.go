@@ -0,0 +1,65 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"strconv"
+
+	"github.com/pb82/sunny"
+)
+
+// Match of a portal device with a local device
+type Match struct {
+	Cloud Device
+	Local *sunny.Device
+}
+
+// ReconcileResult of portal and local devices
+type ReconcileResult struct {
+	// Matched devices with the same serial number
+	Matched []Match
+	// CloudOnly devices not found locally
+	CloudOnly []Device
+	// LocalOnly devices not configured in the portal
+	LocalOnly []*sunny.Device
+}
+
+// Reconcile portal devices with locally discovered devices by serial number
+func Reconcile(cloudDevices []Device, localDevices []*sunny.Device) ReconcileResult {
+	var result ReconcileResult
+
+	local := make(map[uint32]*sunny.Device, len(localDevices))
+	for _, device := range localDevices {
+		local[device.SerialNumber()] = device
+	}
+
+	matched := make(map[uint32]bool)
+	for _, device := range cloudDevices {
+		serial, err := strconv.ParseUint(device.Serial, 10, 32)
+		if l, ok := local[uint32(serial)]; err == nil && ok {
+			result.Matched = append(result.Matched, Match{Cloud: device, Local: l})
+			matched[uint32(serial)] = true
+			continue
+		}
+		result.CloudOnly = append(result.CloudOnly, device)
+	}
+
+	for _, device := range localDevices {
+		if !matched[device.SerialNumber()] {
+			result.LocalOnly = append(result.LocalOnly, device)
+		}
+	}
+	return result
+}
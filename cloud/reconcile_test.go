@@ -0,0 +1,53 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pb82/sunny"
+	"github.com/pb82/sunny/sunnytest"
+)
+
+func TestReconcile(t *testing.T) {
+	ass := assert.New(t)
+
+	network := sunnytest.NewNetwork()
+	defer network.Close()
+	connection, err := network.Connection()
+	require.NoError(t, err)
+	var local []*sunny.Device
+	for i, ip := range []string{"192.168.0.20", "192.168.0.21"} {
+		_, err := network.AddInverter(ip, uint32(1000+i), "0000")
+		require.NoError(t, err)
+		device, err := connection.NewDevice(ip, "0000")
+		require.NoError(t, err)
+		local = append(local, device)
+	}
+
+	cloudDevices := []Device{
+		{DeviceID: "1", Serial: "1000"},
+		{DeviceID: "2", Serial: "2000"},
+		// serials of the portal may be missing
+		{DeviceID: "3", Serial: ""},
+	}
+	result := Reconcile(cloudDevices, local)
+	ass.Equal([]Match{{Cloud: cloudDevices[0], Local: local[0]}}, result.Matched)
+	ass.Equal([]Device{cloudDevices[1], cloudDevices[2]}, result.CloudOnly)
+	ass.Equal([]*sunny.Device{local[1]}, result.LocalOnly)
+}
@@ -0,0 +1,142 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"slices"
+)
+
+// ClusterRoleMaster is the ClusterRole of the master of a cluster
+const ClusterRoleMaster = 1
+
+// clusterValues are reported by every device of a cluster but belong to the whole cluster
+var clusterValues = map[ValueID]bool{
+	BatteryCharge:      true,
+	BatteryTemperature: true,
+	BatteryCapacity:    true,
+	BatteryChargeMode:  true,
+	OperatingMode:      true,
+	GeneratorStatus:    true,
+	ExternalPower:      true,
+	ClusterAddress:     true,
+}
+
+// Cluster of Sunny Island devices sharing one battery
+type Cluster struct {
+	// Address of the cluster
+	Address uint32
+	// Master of the cluster, nil if it was not found
+	Master *Device
+	// Slaves of the cluster
+	Slaves []*Device
+}
+
+// ClusterValues of all devices of a cluster
+type ClusterValues struct {
+	// Cluster wide values (battery, operating mode, generator) reported by the master
+	Cluster map[ValueID]interface{}
+	// Devices contains the remaining values of each device by serial number
+	Devices map[uint32]map[ValueID]interface{}
+}
+
+// Devices of the cluster, the master first
+func (c *Cluster) Devices() []*Device {
+	var devices []*Device
+	if c.Master != nil {
+		devices = append(devices, c.Master)
+	}
+	return append(devices, c.Slaves...)
+}
+
+// GetValues of all devices in the cluster.
+// Cluster wide values are only taken from the master (or the first slave without master).
+// Received values are also returned on error.
+func (c *Cluster) GetValues(ctx context.Context) (ClusterValues, error) {
+	result := ClusterValues{
+		Cluster: make(map[ValueID]interface{}),
+		Devices: make(map[uint32]map[ValueID]interface{}),
+	}
+
+	var errs []error
+	for _, device := range c.Devices() {
+		values, err := device.GetValuesCtx(ctx)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		if values == nil {
+			continue
+		}
+
+		own := len(result.Cluster) == 0
+		for id, value := range values {
+			if !clusterValues[id] {
+				continue
+			}
+			if own {
+				result.Cluster[id] = value
+			}
+			delete(values, id)
+		}
+		result.Devices[device.SerialNumber()] = values
+	}
+	return result, errors.Join(errs...)
+}
+
+// GroupClusters groups Sunny Island devices by their cluster address.
+// Devices without cluster information (e.g. PV inverters, energy meters) are returned as standalone devices.
+func GroupClusters(ctx context.Context, devices []*Device) (clusters []*Cluster, standalone []*Device, err error) {
+	byAddress := make(map[uint32]*Cluster)
+	for _, device := range devices {
+		if device.IsEnergyMeter() {
+			standalone = append(standalone, device)
+			continue
+		}
+
+		role, err := device.GetValueCtx(ctx, ClusterRole)
+		if err != nil {
+			return nil, nil, err
+		}
+		address, err := device.GetValueCtx(ctx, ClusterAddress)
+		if err != nil {
+			return nil, nil, err
+		}
+		roleNumber, ok := ToFloat(role)
+		addressNumber, addressOk := ToFloat(address)
+		if !ok || !addressOk {
+			standalone = append(standalone, device)
+			continue
+		}
+
+		cluster, ok := byAddress[uint32(addressNumber)]
+		if !ok {
+			cluster = &Cluster{Address: uint32(addressNumber)}
+			byAddress[cluster.Address] = cluster
+			clusters = append(clusters, cluster)
+		}
+		if roleNumber == ClusterRoleMaster && cluster.Master == nil {
+			cluster.Master = device
+		} else {
+			cluster.Slaves = append(cluster.Slaves, device)
+		}
+	}
+
+	slices.SortFunc(clusters, func(a, b *Cluster) int {
+		return cmp.Compare(a.Address, b.Address)
+	})
+	return clusters, standalone, nil
+}
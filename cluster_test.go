@@ -0,0 +1,94 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pb82/sunny"
+	"github.com/pb82/sunny/proto/net2"
+	"github.com/pb82/sunny/sunnytest"
+)
+
+func TestGroupClusters(t *testing.T) {
+	ass := assert.New(t)
+
+	network := sunnytest.NewNetwork()
+	defer network.Close()
+	connection, err := network.Connection()
+	require.NoError(t, err)
+
+	// slave, master, PV inverter without cluster information
+	inverterValues := []map[sunny.ValueID]interface{}{
+		{sunny.ClusterAddress: uint32(5), sunny.ClusterRole: uint32(2), sunny.BatteryCharge: uint32(79), sunny.ActivePowerPlus: uint32(1000)},
+		{sunny.ClusterAddress: uint32(5), sunny.ClusterRole: uint32(1), sunny.BatteryCharge: uint32(80), sunny.ActivePowerPlus: uint32(1200)},
+		{sunny.ActivePowerPlus: uint32(3000)},
+	}
+	var inverters []*sunnytest.Inverter
+	var devices []*sunny.Device
+	for i, values := range inverterValues {
+		ip := fmt.Sprintf("192.168.0.%d", 10*(i+1))
+		inverter, err := network.AddInverter(ip, uint32(1000+i), "0000")
+		require.NoError(t, err)
+		inverter.SetValues(values)
+		inverters = append(inverters, inverter)
+		device, err := connection.NewDevice(ip, "0000")
+		require.NoError(t, err)
+		devices = append(devices, device)
+	}
+	_, err = network.AddEnergyMeter("192.168.0.40", net2.DeviceId{SusyID: 0x015D, SerialNumber: 3000})
+	require.NoError(t, err)
+	meter, err := connection.NewDevice("192.168.0.40", "")
+	require.NoError(t, err)
+	devices = append(devices, meter)
+
+	clusters, standalone, err := sunny.GroupClusters(context.Background(), devices)
+	require.NoError(t, err)
+	require.Len(t, clusters, 1)
+	ass.Equal(uint32(5), clusters[0].Address)
+	ass.Same(devices[1], clusters[0].Master)
+	ass.Equal([]*sunny.Device{devices[0]}, clusters[0].Slaves)
+	ass.Equal([]*sunny.Device{devices[1], devices[0]}, clusters[0].Devices())
+	ass.Equal([]*sunny.Device{devices[2], meter}, standalone)
+
+	// cluster values of the master
+	values, err := clusters[0].GetValues(context.Background())
+	ass.NoError(err)
+	ass.Equal(sunny.ClusterValues{
+		Cluster: map[sunny.ValueID]interface{}{sunny.ClusterAddress: uint32(5), sunny.BatteryCharge: uint32(80)},
+		Devices: map[uint32]map[sunny.ValueID]interface{}{
+			1000: {sunny.ClusterRole: uint32(2), sunny.ActivePowerPlus: uint32(1000)},
+			1001: {sunny.ClusterRole: uint32(1), sunny.ActivePowerPlus: uint32(1200)},
+		},
+	}, values)
+
+	// cluster values of the slave without master
+	inverters[1].SetOffline(true)
+	devices[1].SetTimeout(100 * time.Millisecond)
+	values, err = clusters[0].GetValues(context.Background())
+	ass.ErrorIs(err, sunny.ErrTimeout)
+	ass.Equal(sunny.ClusterValues{
+		Cluster: map[sunny.ValueID]interface{}{sunny.ClusterAddress: uint32(5), sunny.BatteryCharge: uint32(79)},
+		Devices: map[uint32]map[sunny.ValueID]interface{}{
+			1000: {sunny.ClusterRole: uint32(2), sunny.ActivePowerPlus: uint32(1000)},
+		},
+	}, values)
+}
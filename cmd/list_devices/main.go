@@ -24,7 +24,7 @@ import (
 	"github.com/pb82/sunny"
 )
 
-var inf = flag.String("inf", "", "Interface devices are connected to")
+var inf = flag.String("inf", "", "Interface (name, local IP or CIDR) devices are connected to")
 
 func main() {
 	flag.Parse()
@@ -51,14 +51,13 @@ func main() {
 			values, err := device.GetValues()
 			if err != nil {
 				fmt.Printf("ERROR: %v\n", err)
-			} else {
-				for key, value := range values {
-					switch value.(type) {
-					case float64:
-						fmt.Printf("%s: %f %s\n", key, value, sunny.GetValueInfo(key).Unit)
-					default:
-						fmt.Printf("%s: %v %s\n", key, value, sunny.GetValueInfo(key).Unit)
-					}
+			}
+			for key, value := range values {
+				switch value.(type) {
+				case float64:
+					fmt.Printf("%s: %f %s\n", key, value, sunny.GetValueInfo(key).Unit)
+				default:
+					fmt.Printf("%s: %v %s\n", key, value, sunny.GetValueInfo(key).Unit)
 				}
 			}
 			fmt.Printf("==================================================\n")
@@ -72,9 +71,19 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
-	connection.DiscoverDevices(ctx, devices, "0000")
+	err = connection.DiscoverDevices(ctx, devices, "0000")
 	cancel()
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+	}
 
 	close(devices)
 	wg.Wait()
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err = sunny.Shutdown(ctx)
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+	}
 }
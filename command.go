@@ -0,0 +1,51 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pb82/sunny/proto"
+)
+
+// SendCommand sends a generic command to the inverter and returns its response.
+// The device is logged in before and logged out after the command.
+// Correlation, resends and the timeout (deadline of ctx) are handled like for
+// value requests; the status of the response is not checked.
+func (d *Device) SendCommand(ctx context.Context, cmd proto.Command) (response proto.Response, err error) {
+	if d.energyMeter {
+		return proto.Response{}, fmt.Errorf("%w: energy meters do not support commands", ErrUnsupportedValue)
+	}
+	defer func() {
+		d.pollDone(err)
+	}()
+	err = d.health.allow()
+	if err != nil {
+		return proto.Response{}, err
+	}
+
+	err = d.login(ctx)
+	if err != nil {
+		return proto.Response{}, err
+	}
+	defer d.logout()
+
+	data, err := d.sendDeviceDataResponse(ctx, cmd.DeviceData())
+	if err != nil {
+		return proto.Response{}, err
+	}
+	return proto.NewResponse(data), nil
+}
@@ -0,0 +1,301 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package config loads the description of a plant (interfaces, devices,
+// credentials and polling) from a YAML or JSON file and creates the
+// connections, devices and pollers of it.
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/pb82/sunny"
+)
+
+// DefaultPollInterval if no interval is configured
+const DefaultPollInterval = 10 * time.Second
+
+// Config of a plant.
+//
+// The file is YAML or JSON:
+//
+//	definitions:
+//	  - values.yaml
+//	pollInterval: 30s
+//	interfaces:
+//	  - name: eth0
+//	    devices:
+//	      - address: 192.168.1.10
+//	        serial: 1234567890
+//	        passwordEnv: INVERTER_PASSWORD
+//	        values: [ActivePowerPlus, ActiveEnergyPlus]
+//	      - address: 192.168.1.11
+//	        password: "0000"
+//	        userGroup: installer
+//	        pollInterval: 5s
+type Config struct {
+	// Definitions are files with custom values (see sunny.LoadValueDefinitions)
+	Definitions []string `yaml:"definitions" json:"definitions"`
+	// PollInterval of devices without own interval
+	PollInterval time.Duration `yaml:"pollInterval" json:"pollInterval"`
+	// Interfaces the devices are connected to
+	Interfaces []Interface `yaml:"interfaces" json:"interfaces"`
+}
+
+// Interface with its devices
+type Interface struct {
+	// Name, local IP or CIDR of the interface ("" for the default interface)
+	Name string `yaml:"name" json:"name"`
+	// ReusePort shares the Speedwire port with other applications (see sunny.WithReusePort)
+	ReusePort bool `yaml:"reusePort" json:"reusePort"`
+	// DSCP of sent packets (see sunny.WithDSCP)
+	DSCP *int `yaml:"dscp" json:"dscp"`
+	// Devices connected to the interface
+	Devices []Device `yaml:"devices" json:"devices"`
+}
+
+// Device of the plant
+type Device struct {
+	// Address (IP or host name) of the device
+	Address string `yaml:"address" json:"address"`
+	// Serial is checked after identification of the device (0 -> not checked)
+	Serial uint32 `yaml:"serial" json:"serial"`
+	// Password of the device
+	Password string `yaml:"password" json:"password"`
+	// PasswordEnv is the environment variable containing the password
+	PasswordEnv string `yaml:"passwordEnv" json:"passwordEnv"`
+	// UserGroup used for login ("user" or "installer")
+	UserGroup string `yaml:"userGroup" json:"userGroup"`
+	// PollInterval of the device
+	PollInterval time.Duration `yaml:"pollInterval" json:"pollInterval"`
+	// Values to poll by name (e.g. "ActivePowerPlus"), all if empty
+	Values []string `yaml:"values" json:"values"`
+}
+
+// Load the config from a YAML or JSON file
+func Load(path string) (*Config, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return Read(file)
+}
+
+// Read the config in YAML or JSON format
+func Read(r io.Reader) (*Config, error) {
+	var config Config
+	err := yaml.NewDecoder(r).Decode(&config)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	return &config, nil
+}
+
+// Plant created from a config
+type Plant struct {
+	// Connections of all interfaces (changed by Reload)
+	Connections []*sunny.Connection
+	// Pollers of all devices (changed by Reload)
+	Pollers []*Poller
+
+	mutex sync.Mutex
+	// connections by interface key
+	interfaces map[string]*sunny.Connection
+	// loaded definition files
+	definitions map[string]bool
+	// current Run (nil -> not running)
+	run *plantRun
+}
+
+// Build the connections, devices and pollers of the config.
+// Custom value definitions are registered first.
+func (c *Config) Build() (*Plant, error) {
+	plant := &Plant{
+		interfaces:  make(map[string]*sunny.Connection),
+		definitions: make(map[string]bool),
+	}
+	err := plant.loadDefinitions(c)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, inf := range c.Interfaces {
+		connection, err := plant.connection(inf)
+		if err != nil {
+			plant.Close()
+			return nil, err
+		}
+
+		for _, def := range inf.Devices {
+			poller, err := c.newPoller(connection, inf, def)
+			if err != nil {
+				plant.Close()
+				return nil, fmt.Errorf("failed to create device %s: %w", def.Address, err)
+			}
+			plant.Pollers = append(plant.Pollers, poller)
+		}
+	}
+	return plant, nil
+}
+
+// loadDefinitions of the config which were not loaded before
+func (p *Plant) loadDefinitions(c *Config) error {
+	for _, path := range c.Definitions {
+		if p.definitions[path] {
+			continue
+		}
+		_, err := sunny.LoadValueDefinitions(path)
+		if err != nil {
+			return fmt.Errorf("failed to load definitions %s: %w", path, err)
+		}
+		p.definitions[path] = true
+	}
+	return nil
+}
+
+// connection of the interface, created if not known yet
+func (p *Plant) connection(inf Interface) (*sunny.Connection, error) {
+	if connection, ok := p.interfaces[inf.key()]; ok {
+		return connection, nil
+	}
+
+	var options []sunny.ConnectionOption
+	if inf.ReusePort {
+		options = append(options, sunny.WithReusePort())
+	}
+	if inf.DSCP != nil {
+		options = append(options, sunny.WithDSCP(*inf.DSCP))
+	}
+	connection, err := sunny.NewConnection(inf.Name, options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create connection for interface %q: %w", inf.Name, err)
+	}
+	p.interfaces[inf.key()] = connection
+	p.Connections = append(p.Connections, connection)
+	return connection, nil
+}
+
+// key identifies interfaces with the same connection options
+func (i Interface) key() string {
+	dscp := -1
+	if i.DSCP != nil {
+		dscp = *i.DSCP
+	}
+	return fmt.Sprintf("%s/%t/%d", i.Name, i.ReusePort, dscp)
+}
+
+// newPoller for the configured device
+func (c *Config) newPoller(connection *sunny.Connection, inf Interface, def Device) (*Poller, error) {
+	values, err := def.valueIDs()
+	if err != nil {
+		return nil, err
+	}
+	credentials, err := def.credentials()
+	if err != nil {
+		return nil, err
+	}
+
+	poller := &Poller{
+		Interval:    c.interval(def),
+		Values:      values,
+		key:         inf.key() + "/" + def.Address,
+		serial:      def.Serial,
+		credentials: &credentialSwitch{},
+	}
+	poller.credentials.set(credentials)
+	poller.Device, err = connection.NewDeviceWithCredentials(def.Address, poller.credentials)
+	if err != nil {
+		return nil, err
+	}
+	if def.Serial != 0 && poller.Device.SerialNumber() != def.Serial {
+		poller.Device.Close()
+		return nil, fmt.Errorf("serial %d does not match configured serial %d", poller.Device.SerialNumber(), def.Serial)
+	}
+	return poller, nil
+}
+
+// interval of the device
+func (c *Config) interval(def Device) time.Duration {
+	if def.PollInterval != 0 {
+		return def.PollInterval
+	}
+	if c.PollInterval != 0 {
+		return c.PollInterval
+	}
+	return DefaultPollInterval
+}
+
+// valueIDs of the selected values
+func (d Device) valueIDs() ([]sunny.ValueID, error) {
+	var ids []sunny.ValueID
+	for _, name := range d.Values {
+		id, err := sunny.LookupValueID(name)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// credentials of the device
+func (d Device) credentials() (sunny.CredentialProvider, error) {
+	var group sunny.UserGroup
+	switch d.UserGroup {
+	case "", "user":
+		group = sunny.UserGroupUser
+	case "installer":
+		group = sunny.UserGroupInstaller
+	default:
+		return nil, fmt.Errorf("unknown user group %q", d.UserGroup)
+	}
+	if d.PasswordEnv != "" && d.Password != "" {
+		return nil, errors.New("password and passwordEnv are exclusive")
+	}
+
+	if d.PasswordEnv == "" && group == sunny.UserGroupUser {
+		return sunny.StaticCredentials(d.Password), nil
+	}
+	return sunny.CredentialFunc(func(ctx context.Context, serial uint32) (sunny.Credentials, error) {
+		password := d.Password
+		if d.PasswordEnv != "" {
+			credentials, err := sunny.EnvCredentials(d.PasswordEnv).Credentials(ctx, serial)
+			if err != nil {
+				return sunny.Credentials{}, err
+			}
+			password = credentials.Password
+		}
+		return sunny.Credentials{Password: password, UserGroup: group}, nil
+	}), nil
+}
+
+// Close all devices and connections of the plant (logged in devices are logged out)
+func (p *Plant) Close() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for _, connection := range p.Connections {
+		connection.Close()
+	}
+}
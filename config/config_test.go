@@ -0,0 +1,190 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/pb82/sunny"
+	"github.com/pb82/sunny/sunnytest"
+)
+
+func TestRead(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		config *Config
+		err    bool
+	}{
+		{
+			name: "yaml",
+			input: `
+pollInterval: 30s
+interfaces:
+  - name: eth0
+    devices:
+      - address: 192.168.1.10
+        serial: 1234567890
+        values: [ActivePowerPlus]
+      - address: 192.168.1.11
+        userGroup: installer
+        pollInterval: 5s
+`,
+			config: &Config{
+				PollInterval: 30 * time.Second,
+				Interfaces: []Interface{{
+					Name: "eth0",
+					Devices: []Device{
+						{Address: "192.168.1.10", Serial: 1234567890, Values: []string{"ActivePowerPlus"}},
+						{Address: "192.168.1.11", UserGroup: "installer", PollInterval: 5 * time.Second},
+					},
+				}},
+			},
+		},
+		{
+			name:  "json",
+			input: `{"interfaces": [{"name": "eth0", "dscp": 46, "devices": [{"address": "192.168.1.10", "password": "0000"}]}]}`,
+			config: &Config{
+				Interfaces: []Interface{{
+					Name:    "eth0",
+					DSCP:    ptr(46),
+					Devices: []Device{{Address: "192.168.1.10", Password: "0000"}},
+				}},
+			},
+		},
+		{name: "empty", input: "", config: &Config{}},
+		{name: "invalid", input: "interfaces: {", err: true},
+		{name: "wrong type", input: "pollInterval: [1]", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ass := assert.New(t)
+
+			config, err := Read(strings.NewReader(tt.input))
+			if tt.err {
+				ass.Error(err)
+				return
+			}
+			ass.NoError(err)
+			ass.Equal(tt.config, config)
+		})
+	}
+}
+
+func TestConfig_Build_definitions(t *testing.T) {
+	ass := assert.New(t)
+
+	config := &Config{Definitions: []string{"testdata/missing.yaml"}}
+	_, err := config.Build()
+	ass.ErrorContains(err, "failed to load definitions testdata/missing.yaml")
+}
+
+func TestDevice_credentials(t *testing.T) {
+	t.Setenv("SUNNY_TEST_PASSWORD", "secret")
+
+	tests := []struct {
+		name        string
+		device      Device
+		credentials sunny.Credentials
+		err         bool
+	}{
+		{
+			name:        "user",
+			device:      Device{Password: "0000"},
+			credentials: sunny.Credentials{Password: "0000", UserGroup: sunny.UserGroupUser},
+		},
+		{
+			name:        "installer",
+			device:      Device{Password: "1111", UserGroup: "installer"},
+			credentials: sunny.Credentials{Password: "1111", UserGroup: sunny.UserGroupInstaller},
+		},
+		{
+			name:        "environment",
+			device:      Device{PasswordEnv: "SUNNY_TEST_PASSWORD", UserGroup: "user"},
+			credentials: sunny.Credentials{Password: "secret", UserGroup: sunny.UserGroupUser},
+		},
+		{name: "unknown group", device: Device{UserGroup: "admin"}, err: true},
+		{name: "exclusive", device: Device{Password: "0000", PasswordEnv: "SUNNY_TEST_PASSWORD"}, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ass := assert.New(t)
+
+			provider, err := tt.device.credentials()
+			if tt.err {
+				ass.Error(err)
+				return
+			}
+			ass.NoError(err)
+			credentials, err := provider.Credentials(context.Background(), 1234)
+			ass.NoError(err)
+			ass.Equal(tt.credentials, credentials)
+		})
+	}
+}
+
+func TestConfig_newPoller(t *testing.T) {
+	network := sunnytest.NewNetwork()
+	defer network.Close()
+	_, err := network.AddInverter("192.168.0.20", 1234, "0000")
+	assert.NoError(t, err)
+	connection, err := network.Connection()
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		device   Device
+		interval time.Duration
+		err      string
+	}{
+		{
+			name:     "valid",
+			device:   Device{Address: "192.168.0.20", Serial: 1234, Password: "0000", Values: []string{"ActivePowerPlus"}},
+			interval: time.Minute,
+		},
+		{
+			name:     "own interval",
+			device:   Device{Address: "192.168.0.20", Password: "0000", PollInterval: 5 * time.Second},
+			interval: 5 * time.Second,
+		},
+		{name: "unknown value", device: Device{Address: "192.168.0.20", Values: []string{"Unknown"}}, err: "Unknown"},
+		{name: "wrong serial", device: Device{Address: "192.168.0.20", Serial: 4321}, err: "does not match configured serial 4321"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ass := assert.New(t)
+
+			config := &Config{PollInterval: time.Minute}
+			poller, err := config.newPoller(connection, Interface{}, tt.device)
+			if tt.err != "" {
+				ass.ErrorContains(err, tt.err)
+				return
+			}
+			ass.NoError(err)
+			defer poller.Device.Close()
+			ass.Equal(uint32(1234), poller.Device.SerialNumber())
+			ass.Equal(tt.interval, poller.Interval)
+		})
+	}
+}
+
+func ptr[T any](value T) *T {
+	return &value
+}
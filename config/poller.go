@@ -0,0 +1,196 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pb82/sunny"
+)
+
+// Poller reads the values of a device periodically.
+// Interval and Values of a running poller are changed with Update.
+type Poller struct {
+	// Device to poll
+	Device *sunny.Device
+	// Interval between polls
+	Interval time.Duration
+	// Values to return, all if empty
+	Values []sunny.ValueID
+
+	mutex   sync.Mutex
+	updated chan struct{}
+
+	// identifies the configured device on reload
+	key    string
+	serial uint32
+	// credentials of the device, replaced on reload
+	credentials *credentialSwitch
+}
+
+// PollResult of a single poll
+type PollResult struct {
+	// Device the values are from
+	Device *sunny.Device
+	// Time of the poll
+	Time time.Time
+	// Values received from the device (also set on partial failures)
+	Values map[sunny.ValueID]interface{}
+	// Err of the poll
+	Err error
+}
+
+// Update the interval and values of the poller, a running poller uses the
+// new interval immediately
+func (p *Poller) Update(interval time.Duration, values []sunny.ValueID) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.Interval = interval
+	p.Values = values
+	select {
+	case p.changed() <- struct{}{}:
+	default:
+	}
+}
+
+// changed is notified on updates, the mutex must be locked
+func (p *Poller) changed() chan struct{} {
+	if p.updated == nil {
+		p.updated = make(chan struct{}, 1)
+	}
+	return p.updated
+}
+
+// settings of the poller
+func (p *Poller) settings() (time.Duration, []sunny.ValueID, chan struct{}) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.Interval, p.Values, p.changed()
+}
+
+// Run polls the device until ctx is done, handle is called with the result of each poll
+func (p *Poller) Run(ctx context.Context, handle func(PollResult)) {
+	interval, _, updated := p.settings()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		handle(p.Poll(ctx))
+		if !p.wait(ctx, ticker, updated) {
+			return
+		}
+	}
+}
+
+// wait for the next poll, returns false if ctx is done
+func (p *Poller) wait(ctx context.Context, ticker *time.Ticker, updated chan struct{}) bool {
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+			return true
+		case <-updated:
+			interval, _, _ := p.settings()
+			ticker.Reset(interval)
+		}
+	}
+}
+
+// Poll the device once, limited to the timeout of the device
+func (p *Poller) Poll(ctx context.Context) PollResult {
+	_, ids, _ := p.settings()
+
+	ctx, cancel := context.WithTimeout(ctx, p.Device.Timeout())
+	defer cancel()
+
+	now := time.Now()
+	values, err := p.Device.GetValuesCtx(ctx)
+	if len(ids) > 0 && values != nil {
+		selected := make(map[sunny.ValueID]interface{}, len(ids))
+		for _, id := range ids {
+			if value, ok := values[id]; ok {
+				selected[id] = value
+			}
+		}
+		values = selected
+	}
+
+	return PollResult{
+		Device: p.Device,
+		Time:   now,
+		Values: values,
+		Err:    err,
+	}
+}
+
+// Run polls all devices of the plant until ctx is done.
+// handle is called with the result of each poll and must be safe for concurrent use.
+// Devices added by Reload are polled as well.
+func (p *Plant) Run(ctx context.Context, handle func(PollResult)) {
+	run := &plantRun{
+		ctx:     ctx,
+		handle:  handle,
+		cancels: make(map[*Poller]context.CancelFunc),
+	}
+
+	p.mutex.Lock()
+	p.run = run
+	for _, poller := range p.Pollers {
+		run.start(poller)
+	}
+	p.mutex.Unlock()
+
+	<-ctx.Done()
+	run.wg.Wait()
+
+	p.mutex.Lock()
+	if p.run == run {
+		p.run = nil
+	}
+	p.mutex.Unlock()
+}
+
+// plantRun are the running pollers of a plant
+type plantRun struct {
+	ctx     context.Context
+	handle  func(PollResult)
+	wg      sync.WaitGroup
+	cancels map[*Poller]context.CancelFunc
+}
+
+// start the poller
+func (r *plantRun) start(poller *Poller) {
+	ctx, cancel := context.WithCancel(r.ctx)
+	r.cancels[poller] = cancel
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		poller.Run(ctx, r.handle)
+	}()
+}
+
+// stop the poller
+func (r *plantRun) stop(poller *Poller) {
+	if cancel, ok := r.cancels[poller]; ok {
+		cancel()
+		delete(r.cancels, poller)
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/pb82/sunny"
+	"github.com/pb82/sunny/proto/net2"
+	"github.com/pb82/sunny/sunnytest"
+)
+
+func TestPoller_Poll(t *testing.T) {
+	ass := assert.New(t)
+
+	network := sunnytest.NewNetwork()
+	defer network.Close()
+	inverter, err := network.AddInverter("192.168.0.20", 1234, "0000")
+	ass.NoError(err)
+	inverter.SetValues(map[sunny.ValueID]interface{}{
+		sunny.ActivePowerPlus:  uint32(1500),
+		sunny.ActiveEnergyPlus: float64(12.5),
+	})
+	connection, err := network.Connection()
+	ass.NoError(err)
+	device, err := connection.NewDevice("192.168.0.20", "0000")
+	ass.NoError(err)
+
+	// only the selected values are returned
+	poller := &Poller{Device: device, Interval: time.Second, Values: []sunny.ValueID{sunny.ActivePowerPlus}}
+	result := poller.Poll(context.Background())
+	ass.NoError(result.Err)
+	ass.Same(device, result.Device)
+	ass.Equal(map[sunny.ValueID]interface{}{sunny.ActivePowerPlus: uint32(1500)}, result.Values)
+}
+
+func TestPoller_Poll_timeout(t *testing.T) {
+	ass := assert.New(t)
+
+	network := sunnytest.NewNetwork()
+	defer network.Close()
+	meter, err := network.AddEnergyMeter("192.168.0.30", net2.DeviceId{SusyID: 0x015D, SerialNumber: 3000})
+	ass.NoError(err)
+	connection, err := network.Connection()
+	ass.NoError(err)
+	device, err := connection.NewDevice("192.168.0.30", "")
+	ass.NoError(err)
+	ass.True(device.IsEnergyMeter())
+
+	// silent energy meter with a context without deadline
+	meter.Close()
+	device.SetTimeout(100 * time.Millisecond)
+	poller := &Poller{Device: device, Interval: time.Second}
+	start := time.Now()
+	result := poller.Poll(context.Background())
+	ass.ErrorIs(result.Err, sunny.ErrTimeout)
+	ass.Less(time.Since(start), time.Second)
+}
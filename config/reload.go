@@ -0,0 +1,178 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"syscall"
+
+	"github.com/pb82/sunny"
+)
+
+// Reload applies the config to the running plant without recreating the
+// connections of unchanged interfaces. Poll intervals, value selections and
+// credentials of known devices are updated, new devices are added and removed
+// devices and interfaces are closed. Invalid devices are reported in the
+// returned error, all other changes are applied.
+func (p *Plant) Reload(c *Config) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	err := p.loadDefinitions(c)
+	if err != nil {
+		return err
+	}
+
+	// close removed devices and interfaces first, a changed interface may
+	// need the port of the old connection
+	wanted := make(map[string]uint32)
+	interfaces := make(map[string]bool)
+	for _, inf := range c.Interfaces {
+		interfaces[inf.key()] = true
+		for _, def := range inf.Devices {
+			wanted[inf.key()+"/"+def.Address] = def.Serial
+		}
+	}
+	known := make(map[string]*Poller, len(p.Pollers))
+	for _, poller := range p.Pollers {
+		serial, ok := wanted[poller.key]
+		if ok && serial == poller.serial {
+			known[poller.key] = poller
+			continue
+		}
+		if p.run != nil {
+			p.run.stop(poller)
+		}
+		poller.Device.Close()
+	}
+	for key, connection := range p.interfaces {
+		if interfaces[key] {
+			continue
+		}
+		connection.Close()
+		delete(p.interfaces, key)
+		p.Connections = slices.DeleteFunc(p.Connections, func(entry *sunny.Connection) bool {
+			return entry == connection
+		})
+	}
+
+	var errs []error
+	var pollers []*Poller
+	for _, inf := range c.Interfaces {
+		connection, err := p.connection(inf)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		for _, def := range inf.Devices {
+			poller, err := p.reloadDevice(c, connection, inf, def, known)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to reload device %s: %w", def.Address, err))
+			}
+			if poller != nil {
+				pollers = append(pollers, poller)
+			}
+		}
+	}
+
+	p.Pollers = pollers
+	return errors.Join(errs...)
+}
+
+// reloadDevice updates the known poller of the device or creates a new one.
+// A known poller is also returned if its new settings are invalid.
+func (p *Plant) reloadDevice(c *Config, connection *sunny.Connection, inf Interface, def Device, known map[string]*Poller) (*Poller, error) {
+	poller, ok := known[inf.key()+"/"+def.Address]
+	if !ok {
+		poller, err := c.newPoller(connection, inf, def)
+		if err != nil {
+			return nil, err
+		}
+		if p.run != nil {
+			p.run.start(poller)
+		}
+		return poller, nil
+	}
+
+	// keep polling with the old settings if the new ones are invalid
+	values, err := def.valueIDs()
+	if err == nil {
+		var credentials sunny.CredentialProvider
+		credentials, err = def.credentials()
+		if err == nil {
+			poller.credentials.set(credentials)
+			poller.Update(c.interval(def), values)
+		}
+	}
+	return poller, err
+}
+
+// ReloadOnSignal loads the config file and applies it to the plant each time
+// one of the signals (default SIGHUP) is received, until ctx is done.
+// done is called with the result of each reload and may be nil.
+func (p *Plant) ReloadOnSignal(ctx context.Context, path string, done func(error), signals ...os.Signal) {
+	if len(signals) == 0 {
+		signals = []os.Signal{syscall.SIGHUP}
+	}
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, signals...)
+	defer signal.Stop(ch)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ch:
+		}
+
+		config, err := Load(path)
+		if err == nil {
+			err = p.Reload(config)
+		}
+		if done != nil {
+			done(err)
+		}
+	}
+}
+
+// credentialSwitch is a credential provider which can be replaced while
+// the device is in use
+type credentialSwitch struct {
+	mutex    sync.RWMutex
+	provider sunny.CredentialProvider
+}
+
+// set the provider used for the next logins
+func (s *credentialSwitch) set(provider sunny.CredentialProvider) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.provider = provider
+}
+
+// Credentials of the current provider
+func (s *credentialSwitch) Credentials(ctx context.Context, serial uint32) (sunny.Credentials, error) {
+	s.mutex.RLock()
+	provider := s.provider
+	s.mutex.RUnlock()
+
+	return provider.Credentials(ctx, serial)
+}
@@ -0,0 +1,173 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/pb82/sunny"
+	"github.com/pb82/sunny/sunnytest"
+)
+
+func TestPlant_Reload(t *testing.T) {
+	ass := assert.New(t)
+
+	network := sunnytest.NewNetwork()
+	defer network.Close()
+	for i, ip := range []string{"192.168.0.20", "192.168.0.21", "192.168.0.22"} {
+		_, err := network.AddInverter(ip, uint32(1234+i), "0000")
+		ass.NoError(err)
+	}
+
+	plant := newTestPlant(t, network, &Config{
+		PollInterval: 10 * time.Second,
+		Interfaces: []Interface{
+			{Devices: []Device{{Address: "192.168.0.20", Password: "0000"}, {Address: "192.168.0.21", Password: "0000"}}},
+			{Name: "eth1"},
+		},
+	})
+	defer plant.Close()
+	ass.Len(plant.Pollers, 2)
+	known := plant.Pollers[0]
+
+	// changed settings, removed and added devices, removed interface
+	err := plant.Reload(&Config{
+		PollInterval: 10 * time.Second,
+		Interfaces: []Interface{
+			{Devices: []Device{
+				{Address: "192.168.0.20", Password: "0000", PollInterval: 5 * time.Second, Values: []string{"ActivePowerPlus"}},
+				{Address: "192.168.0.22", Password: "0000"},
+			}},
+		},
+	})
+	ass.NoError(err)
+	ass.Len(plant.Connections, 1)
+	ass.Len(plant.interfaces, 1)
+	ass.Len(plant.Pollers, 2)
+	ass.Same(known, plant.Pollers[0])
+	ass.Equal(5*time.Second, known.Interval)
+	ass.Equal([]sunny.ValueID{sunny.ActivePowerPlus}, known.Values)
+	ass.Equal(uint32(1236), plant.Pollers[1].Device.SerialNumber())
+
+	// invalid settings keep the known device with its old settings
+	err = plant.Reload(&Config{
+		Interfaces: []Interface{
+			{Devices: []Device{
+				{Address: "192.168.0.20", Values: []string{"Unknown"}},
+				{Address: "192.168.0.22", Password: "0000"},
+			}},
+		},
+	})
+	ass.ErrorContains(err, "failed to reload device 192.168.0.20")
+	ass.Len(plant.Pollers, 2)
+	ass.Same(known, plant.Pollers[0])
+	ass.Equal(5*time.Second, known.Interval)
+
+	// changed serial recreates the device
+	err = plant.Reload(&Config{
+		Interfaces: []Interface{
+			{Devices: []Device{{Address: "192.168.0.20", Serial: 1234, Password: "0000"}}},
+		},
+	})
+	ass.NoError(err)
+	ass.Len(plant.Pollers, 1)
+	ass.NotSame(known, plant.Pollers[0])
+}
+
+func TestPlant_Reload_running(t *testing.T) {
+	ass := assert.New(t)
+
+	network := sunnytest.NewNetwork()
+	defer network.Close()
+	for i, ip := range []string{"192.168.0.20", "192.168.0.21"} {
+		inverter, err := network.AddInverter(ip, uint32(1234+i), "0000")
+		ass.NoError(err)
+		inverter.SetValue(sunny.ActivePowerPlus, uint32(1500))
+	}
+
+	plant := newTestPlant(t, network, &Config{
+		PollInterval: 20 * time.Millisecond,
+		Interfaces:   []Interface{{Devices: []Device{{Address: "192.168.0.20", Password: "0000"}}}},
+	})
+	defer plant.Close()
+
+	var mutex sync.Mutex
+	polled := make(map[uint32]int)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		plant.Run(ctx, func(result PollResult) {
+			// polls of stopped devices are canceled
+			if result.Err != nil {
+				return
+			}
+			mutex.Lock()
+			defer mutex.Unlock()
+			polled[result.Device.SerialNumber()]++
+		})
+	}()
+	count := func(serial uint32) int {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return polled[serial]
+	}
+	ass.Eventually(func() bool {
+		return count(1234) > 0
+	}, time.Second, time.Millisecond)
+
+	// added device is polled, removed device is stopped
+	ass.NoError(plant.Reload(&Config{
+		PollInterval: 20 * time.Millisecond,
+		Interfaces:   []Interface{{Devices: []Device{{Address: "192.168.0.21", Password: "0000"}}}},
+	}))
+	ass.Eventually(func() bool {
+		return count(1235) > 0
+	}, time.Second, time.Millisecond)
+	removed := count(1234)
+	time.Sleep(100 * time.Millisecond)
+	ass.Equal(removed, count(1234))
+
+	cancel()
+	<-done
+}
+
+// newTestPlant builds the plant of the config with connections of the network
+// instead of network interfaces, the interfaces get consecutive client IPs
+func newTestPlant(t *testing.T, network *sunnytest.Network, config *Config) *Plant {
+	plant := &Plant{
+		interfaces:  make(map[string]*sunny.Connection),
+		definitions: make(map[string]bool),
+	}
+	for i, inf := range config.Interfaces {
+		connection, err := network.ConnectionAt(net.IPv4(192, 168, 0, byte(1+i)))
+		assert.NoError(t, err)
+		plant.interfaces[inf.key()] = connection
+		plant.Connections = append(plant.Connections, connection)
+
+		for _, def := range inf.Devices {
+			poller, err := config.newPoller(connection, inf, def)
+			assert.NoError(t, err)
+			plant.Pollers = append(plant.Pollers, poller)
+		}
+	}
+	return plant
+}
@@ -15,12 +15,18 @@
 package sunny
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"maps"
 	"net"
 	"slices"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/pb82/sunny/proto"
+	"github.com/pb82/sunny/proto/net2"
 )
 
 const listenAddress = "239.12.255.254:9522"
@@ -33,33 +39,119 @@ type Connection struct {
 	// multicast address
 	address *net.UDPAddr
 	// multicast socket
-	socket *net.UDPConn
-
-	// buffer for received packet
-	receiverMutex    sync.RWMutex
-	receiverChannels map[string][]chan *proto.Packet
+	socket net.PacketConn
+	// key in the connection cache (empty if not cached)
+	key string
+
+	// closed on shutdown, internal goroutines are tracked by running
+	closed    chan struct{}
+	closeOnce sync.Once
+	running   sync.WaitGroup
+
+	// devices created with this connection
+	devicesMutex sync.Mutex
+	devices      map[*Device]struct{}
+
+	// middleware for sent and received packets
+	middlewareMutex sync.RWMutex
+	middleware      []Middleware
+
+	// optional recorder of all sent and received packets
+	recorderMutex sync.Mutex
+	recorder      *Recorder
+
+	// receivers of packets per IP (copy on write for lock-free lookups)
+	receiverMutex sync.Mutex
+	receivers     atomic.Pointer[receiverMap]
+
+	// workers decoding received packets
+	workers []chan receivedPacket
+
+	// channels for responses of pending requests
+	responseMutex    sync.RWMutex
+	responseChannels map[responseKey]*pendingResponse
+	// amount of pending requests per IP
+	responseIPs map[string]int
+
+	// filter for retransmitted packets
+	duplicates duplicateFilter
+
+	// limiter for sent packets
+	limiter rateLimiter
+	// queue of the asynchronous send worker (nil -> synchronous)
+	sendQueueMutex sync.Mutex
+	sendQueue      atomic.Pointer[sendQueue]
+
+	// retry policy for new devices
+	retryPolicy atomic.Pointer[RetryPolicy]
+	// buffer sizes for channels of new devices and discoveries
+	receiverBufferSize  atomic.Int32
+	discoveryBufferSize atomic.Int32
+
+	// time of last received packet (unix nano)
+	lastReceived atomic.Int64
+	// socket and membership state
+	diagnostics connectionDiagnostics
+	// joined interfaces in all-interfaces mode
+	memberships interfaceMemberships
+	// time of last received packet per IP
+	seenMutex sync.RWMutex
+	lastSeen  map[string]time.Time
+
+	// listener for multicast membership refreshes
+	membershipMutex    sync.RWMutex
+	membershipChannels []chan MembershipEvent
+
+	// observers of all decoded packets
+	observerMutex sync.RWMutex
+	observers     []*packetObserver
+
+	// sender of requests (nil -> default of net2.NewDeviceData)
+	sourceID atomic.Pointer[net2.DeviceId]
+
+	// identity used to answer discovery requests (nil -> disabled)
+	responder atomic.Pointer[ResponderIdentity]
 
 	// interface for device discovery
 	discoverMutex    sync.RWMutex
 	discoverChannels []chan string
+	// destinations of discovery requests (empty -> multicast group)
+	discoveryDestinations []*net.UDPAddr
+	// time of the last device found by discovery (unix nano)
+	lastDiscovery atomic.Int64
+	// devices identified in parallel during discovery (0 -> default)
+	discoveryParallelism atomic.Int32
+
+	// re-bind devices answering from a new IP
+	addressTracking atomic.Bool
+	// time of the last broadcast ping to locate devices (unix nano)
+	lastLocate atomic.Int64
 }
 
-// NewConnection creates a new Connection object and starts listening
-func NewConnection(inf string) (*Connection, error) {
+// NewConnection creates a new Connection object and starts listening.
+// The interface inf is optional and can be empty. It is either the name of
+// the interface, a local IP address ("10.0.5.2") or a network ("10.0.5.0/24")
+// of the interface.
+func NewConnection(inf string, options ...ConnectionOption) (*Connection, error) {
 	connectionMutex.Lock()
 	defer connectionMutex.Unlock()
 
-	// connection already known
-	if c, ok := connections[inf]; ok {
-		return c, nil
+	var config connectionConfig
+	for _, option := range options {
+		option(&config)
+	}
+	inf, err := resolveInterface(inf, &config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create connection: %w", err)
 	}
 
-	conn := Connection{
-		receiverChannels: make(map[string][]chan *proto.Packet),
+	// connection already known
+	key := inf + "/" + config.key()
+	if c, ok := connections[key]; ok {
+		return c, nil
 	}
 
-	var err error
-	conn.address, err = net.ResolveUDPAddr("udp", listenAddress)
+	address, err := net.ResolveUDPAddr("udp", listenAddress)
 	if err != nil {
 		return nil, err
 	}
@@ -73,61 +165,227 @@ func NewConnection(inf string) (*Connection, error) {
 		}
 	}
 
-	conn.socket, err = net.ListenMulticastUDP("udp", listenInterface, conn.address)
+	var socket net.PacketConn
+	if config.allInterfaces {
+		if listenInterface != nil {
+			return nil, fmt.Errorf("failed to create connection: all interfaces mode can't be combined with interface %s", inf)
+		}
+		socket, err = listenMulticastAll(&config, address)
+	} else if config.explicitBinding() {
+		socket, err = listenMulticastExplicit(listenInterface, &config, address)
+	} else {
+		socket, err = listenMulticast(listenInterface, address)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to create connection: %w", err)
 	}
+	if config.dscp != nil {
+		err = setDSCP(socket, *config.dscp)
+		if err != nil {
+			_ = socket.Close()
+			return nil, err
+		}
+	}
+
+	conn := newConnection(socket, address)
+	conn.diagnostics.bound(listenInterface, config.localIP)
+	if config.allInterfaces {
+		conn.memberships.enabled = true
+		for _, event := range conn.syncInterfaces(false) {
+			Log.Printf("multicast group on %s (%s): %v", event.Interface, event.Reason, event.Err)
+		}
+	}
+	conn.applyBufferSizes(&config)
+	if config.discoveryDestinations != nil {
+		conn.SetDiscoveryDestinations(append(config.discoveryDestinations, config.discoveryTargets...)...)
+	} else {
+		conn.SetDiscoveryTargets(config.discoveryTargets...)
+	}
+	if config.discoveryParallelism != nil {
+		conn.SetDiscoveryParallelism(*config.discoveryParallelism)
+	}
+	if config.sendQueueSize != nil {
+		conn.SetSendQueue(*config.sendQueueSize)
+	}
+	if config.sourceID != nil {
+		conn.SetSourceID(*config.sourceID)
+	}
+	conn.SetAddressTracking(config.addressTracking)
+
+	interval := DefaultMembershipCheckInterval
+	if config.membershipInterval != nil {
+		interval = *config.membershipInterval
+	}
+	if interval > 0 {
+		conn.running.Add(1)
+		go func() {
+			defer conn.running.Done()
+			if config.allInterfaces {
+				conn.allInterfacesLoop(interval)
+			} else {
+				conn.membershipLoop(listenInterface, interval)
+			}
+		}()
+	}
 
-	err = conn.socket.SetReadBuffer(2048)
+	conn.key = key
+	connections[key] = conn
+	return conn, nil
+}
+
+// listenMulticast creates the default multicast socket
+func listenMulticast(inf *net.Interface, address *net.UDPAddr) (net.PacketConn, error) {
+	socket, err := net.ListenMulticastUDP("udp", inf, address)
 	if err != nil {
 		return nil, err
 	}
 
-	go conn.listenLoop()
+	err = socket.SetReadBuffer(2048)
+	if err != nil {
+		_ = socket.Close()
+		return nil, err
+	}
+	return socket, nil
+}
 
-	connections[inf] = &conn
-	return &conn, nil
+// NewPacketConnection creates a Connection on top of the given socket and starts listening.
+// The socket is used instead of a multicast socket, e.g. for tests without
+// network access or user space network stacks. Discovery requests are sent to
+// the Speedwire multicast address via the socket.
+// Connections created by this function are not shared with NewConnection.
+func NewPacketConnection(socket net.PacketConn) (*Connection, error) {
+	address, err := net.ResolveUDPAddr("udp", listenAddress)
+	if err != nil {
+		return nil, err
+	}
+	return newConnection(socket, address), nil
 }
 
-// listenLoop for received packets
-func (c *Connection) listenLoop() {
-	b := make([]byte, 2048)
+// newConnection creates a Connection on the given socket and starts listening
+func newConnection(socket net.PacketConn, address *net.UDPAddr) *Connection {
+	conn := &Connection{
+		address:          address,
+		socket:           socket,
+		responseChannels: make(map[responseKey]*pendingResponse),
+		responseIPs:      make(map[string]int),
+		lastSeen:         make(map[string]time.Time),
+		closed:           make(chan struct{}),
+		devices:          make(map[*Device]struct{}),
+	}
 
-	for c.socket != nil {
-		n, src, err := c.socket.ReadFromUDP(b)
-		if err != nil {
-			// failed to read from udp -> retry
-			if DetailedPacketLogging.Load() {
-				Log.Printf("DBG: UDP read failed: %v", err)
-			}
-			continue
-		}
+	conn.receivers.Store(&receiverMap{})
+	conn.SetRetryPolicy(DefaultRetryPolicy)
+	conn.SetBufferSizes(DefaultReceiverBufferSize, DefaultDiscoveryBufferSize)
+
+	conn.startWorkers()
+	conn.running.Add(1)
+	go func() {
+		defer conn.running.Done()
+		conn.listenLoop()
+		conn.stopWorkers()
+	}()
+	return conn
+}
 
-		srcIP := src.IP.String()
-		var pack proto.Packet
-		err = pack.Read(b[:n])
-		if err != nil {
-			// invalid packet received -> retry
-			Log.Printf("recv %s invalid: %v", srcIP, err)
-			continue
-		}
+// SetRetryPolicy used for devices created afterwards with this connection
+func (c *Connection) SetRetryPolicy(policy RetryPolicy) {
+	c.retryPolicy.Store(&policy)
+}
+
+// Record all sent and received packets of this connection to the given recorder.
+// Passing nil stops a running recording.
+func (c *Connection) Record(recorder *Recorder) {
+	c.recorderMutex.Lock()
+	defer c.recorderMutex.Unlock()
+
+	c.recorder = recorder
+}
+
+// record packet data with the active recorder (if any)
+func (c *Connection) record(direction string, address net.Addr, data []byte) {
+	c.recorderMutex.Lock()
+	defer c.recorderMutex.Unlock()
+
+	if c.recorder == nil {
+		return
+	}
+	err := c.recorder.add(direction, address, data)
+	if err != nil {
+		Log.Printf("failed to record packet: %v", err)
+	}
+}
+
+// process a received packet and forward it to the receivers
+func (c *Connection) process(packet *RawPacket) error {
+	srcIP := packet.Address.IP.String()
+	// decoded entries are forwarded -> reference a copy of the reused receive buffer
+	var pack proto.Packet
+	err := pack.ReadLazy(bytes.Clone(packet.Data))
+	if err != nil {
+		// invalid packet received -> retry
+		counters.decodeFailures.Add(1)
+		Log.Printf("recv %s invalid: %v", srcIP, err)
+		return nil
+	}
+
+	c.markSeen(srcIP)
+	c.respond(packet.Address, &pack)
+	c.handleDiscovered(srcIP)
+
+	// skip decoding of packets without receiver
+	observed := c.hasObservers()
+	unknown := !c.hasReceivers(srcIP)
+	tracking := unknown && c.addressTracking.Load()
+	if !observed && unknown && !tracking {
+		return nil
+	}
+
+	err = pack.Decode()
+	if err != nil {
+		counters.decodeFailures.Add(1)
+		Log.Printf("recv %s invalid: %v", srcIP, err)
+		return nil
+	}
+	if DetailedPacketLogging.Load() {
 		Log.Printf("recv %s: [%s]", srcIP, pack)
+	}
+	if observed {
+		c.observe(packet.Address.IP, &pack)
+	}
+
+	if c.duplicates.isDuplicate(srcIP, &pack) {
+		if DetailedPacketLogging.Load() {
+			Log.Printf("DBG: drop duplicate packet from %s: [%s]", srcIP, pack)
+		}
+		return nil
+	}
+	if tracking {
+		c.trackAddress(packet.Address, &pack)
+	}
+	if c.handleResponse(srcIP, &pack) {
+		return nil
+	}
+	c.handlePackets(srcIP, &pack)
+	return nil
+}
 
-		c.handleDiscovered(srcIP)
-		c.handlePackets(srcIP, &pack)
+// hasReceivers checks if any receiver or pending request exists for the IP
+func (c *Connection) hasReceivers(srcIp string) bool {
+	if len((*c.receivers.Load())[srcIp]) > 0 {
+		return true
 	}
+
+	c.responseMutex.RLock()
+	defer c.responseMutex.RUnlock()
+	return c.responseIPs[srcIp] > 0
 }
 
 // handlePackets and forward to receivers
 func (c *Connection) handlePackets(srcIp string, packet *proto.Packet) {
-	c.receiverMutex.RLock()
-	defer c.receiverMutex.RUnlock()
-
-	for _, ch := range c.receiverChannels[srcIp] {
-		select {
-		case ch <- packet:
-		default:
-			// channel for received packets busy -> drop packet
+	for _, receiver := range (*c.receivers.Load())[srcIp] {
+		if !receiver.deliver(packet) {
+			// channel for received packets busy -> packet dropped
+			counters.drops.Add(1)
 			if DetailedPacketLogging.Load() {
 				Log.Printf("DBG: receiver channel busy -> drop packet from %s: [%s]", srcIp, packet)
 			}
@@ -135,27 +393,151 @@ func (c *Connection) handlePackets(srcIp string, packet *proto.Packet) {
 	}
 }
 
-// registerReceiver channel for a specific IP
-func (c *Connection) registerReceiver(srcIp string, ch chan *proto.Packet) {
+// registerReceiver for a specific IP
+func (c *Connection) registerReceiver(srcIp string, receiver *packetReceiver) {
 	c.receiverMutex.Lock()
 	defer c.receiverMutex.Unlock()
 
-	c.receiverChannels[srcIp] = append(c.receiverChannels[srcIp], ch)
+	receivers := maps.Clone(*c.receivers.Load())
+	receivers[srcIp] = append(slices.Clone(receivers[srcIp]), receiver)
+	c.receivers.Store(&receivers)
+	counters.receivers.Add(1)
 }
 
-// unregisterReceiver channel for a specific IP
-func (c *Connection) unregisterReceiver(srcIp string, ch chan *proto.Packet) {
+// unregisterReceiver for a specific IP
+func (c *Connection) unregisterReceiver(srcIp string, receiver *packetReceiver) {
 	c.receiverMutex.Lock()
 	defer c.receiverMutex.Unlock()
 
-	receivers, ok := c.receiverChannels[srcIp]
+	receivers := maps.Clone(*c.receivers.Load())
+	channels, ok := receivers[srcIp]
 	if !ok {
 		return // IP not in list -> no channel to unregister
 	}
 
-	c.receiverChannels[srcIp] = slices.DeleteFunc(receivers, func(receiver chan *proto.Packet) bool {
-		return receiver == ch
+	count := len(channels)
+	channels = slices.DeleteFunc(slices.Clone(channels), func(r *packetReceiver) bool {
+		return r == receiver
 	})
+	counters.receivers.Add(int64(len(channels) - count))
+	if len(channels) == 0 {
+		delete(receivers, srcIp)
+	} else {
+		receivers[srcIp] = channels
+	}
+	c.receivers.Store(&receivers)
+}
+
+// receiverMap contains the receivers per IP
+type receiverMap map[string][]*packetReceiver
+
+// responseKey identifies a pending request
+type responseKey struct {
+	srcIp    string
+	packetID uint16
+}
+
+// pendingResponse of a request
+type pendingResponse struct {
+	// current key, changed if the device gets a new address
+	key       responseKey
+	ch        chan *net2.DeviceData
+	fragments net2.Fragments
+}
+
+// handleResponse forwards the packet to the registered response channel.
+// Responses spanning multiple frames are reassembled before forwarding.
+// Returns true if the packet was a response of a pending request.
+func (c *Connection) handleResponse(srcIp string, packet *proto.Packet) bool {
+	entry, ok := packet.GetEntry(proto.SmaNet2PacketEntryTag).(*proto.SmaNet2PacketEntry)
+	if !ok {
+		return false
+	}
+	data, ok := entry.Content.(*net2.DeviceData)
+	if !ok {
+		return false
+	}
+
+	c.responseMutex.Lock()
+	defer c.responseMutex.Unlock()
+
+	pending, ok := c.responseChannels[responseKey{srcIp, data.PacketID}]
+	if !ok {
+		return false
+	}
+
+	data = pending.fragments.Add(data)
+	if data == nil {
+		return true // wait for missing fragments
+	}
+
+	select {
+	case pending.ch <- data:
+	default:
+		// response already received -> drop duplicate
+		if DetailedPacketLogging.Load() {
+			Log.Printf("DBG: response channel busy -> drop packet from %s: [%s]", srcIp, packet)
+		}
+	}
+	return true
+}
+
+// registerResponse channel for a pending request. If the packet ID of the
+// request is used by another pending request of the IP, a free ID is assigned.
+func (c *Connection) registerResponse(srcIp string, data *net2.DeviceData, ch chan *net2.DeviceData) (*pendingResponse, error) {
+	c.responseMutex.Lock()
+	defer c.responseMutex.Unlock()
+
+	for range net2.PacketIDMask + 1 {
+		key := responseKey{srcIp, data.PacketID}
+		if _, ok := c.responseChannels[key]; !ok {
+			pending := &pendingResponse{key: key, ch: ch}
+			c.responseIPs[srcIp]++
+			c.responseChannels[key] = pending
+			return pending, nil
+		}
+		data.PacketID = net2.NextPacketID()
+	}
+	return nil, fmt.Errorf("%w: no free packet ID for %s", ErrDeviceBusy, srcIp)
+}
+
+// unregisterResponse channel of a finished request
+func (c *Connection) unregisterResponse(pending *pendingResponse) {
+	c.responseMutex.Lock()
+	defer c.responseMutex.Unlock()
+
+	key := pending.key
+	if c.responseChannels[key] != pending {
+		return
+	}
+	delete(c.responseChannels, key)
+	if c.responseIPs[key.srcIp]--; c.responseIPs[key.srcIp] <= 0 {
+		delete(c.responseIPs, key.srcIp)
+	}
+}
+
+// moveResponses of pending requests to the new IP of a device.
+// Responses with a packet ID already pending at the new IP stay at the old one.
+func (c *Connection) moveResponses(oldIp, newIp string) {
+	c.responseMutex.Lock()
+	defer c.responseMutex.Unlock()
+
+	for key, pending := range c.responseChannels {
+		if key.srcIp != oldIp {
+			continue
+		}
+		moved := responseKey{newIp, key.packetID}
+		if _, ok := c.responseChannels[moved]; ok {
+			continue
+		}
+		delete(c.responseChannels, key)
+		c.responseChannels[moved] = pending
+		pending.key = moved
+		if c.responseIPs[oldIp]--; c.responseIPs[oldIp] <= 0 {
+			delete(c.responseIPs, oldIp)
+		}
+		c.responseIPs[newIp]++
+	}
 }
 
 // handleDiscovered devices and forward IP to registered channels
@@ -195,10 +577,61 @@ func (c *Connection) unregisterDiscoverer(ch chan string) {
 
 // sendPacket to the given address
 func (c *Connection) sendPacket(address *net.UDPAddr, packet *proto.Packet) error {
+	return c.sendPacketCtx(context.Background(), address, packet)
+}
+
+// sendPacketCtx sends the packet with the priority of ctx, waiting for the
+// rate limit stops if ctx is done
+func (c *Connection) sendPacketCtx(ctx context.Context, address *net.UDPAddr, packet *proto.Packet) error {
 	Log.Printf("send %s: [%s]", address.IP.String(), packet)
-	_, err := c.socket.WriteToUDP(packet.Bytes(), address)
+	return c.writeCtx(ctx, packet.Bytes(), address)
+}
+
+// write raw data to the given address
+func (c *Connection) write(data []byte, address *net.UDPAddr) error {
+	return c.writeCtx(context.Background(), data, address)
+}
+
+// writeCtx writes raw data to the given address with the priority of ctx
+func (c *Connection) writeCtx(ctx context.Context, data []byte, address *net.UDPAddr) error {
+	return c.handle(&RawPacket{
+		Direction: RecordSend,
+		Address:   address,
+		Data:      data,
+		Priority:  priorityFrom(ctx),
+		ctx:       ctx,
+	}, c.writeSocket)
+}
+
+// writeSocket sends the packet on the socket or queues it for the send worker
+func (c *Connection) writeSocket(packet *RawPacket) error {
+	if queue := c.sendQueue.Load(); queue != nil {
+		queued, err := queue.push(packet)
+		if queued {
+			return err
+		}
+	}
+
+	err := c.limiter.wait(packet.Context(), packet.Priority)
+	if err != nil {
+		return fmt.Errorf("%w: rate limit: %w", ErrTimeout, err)
+	}
+	return c.send(packet)
+}
+
+// send writes the packet to the socket
+func (c *Connection) send(packet *RawPacket) error {
+	c.record(RecordSend, packet.Address, packet.Data)
+	var err error
+	if c.memberships.enabled && packet.Address.IP.IsMulticast() {
+		err = c.writeAllInterfaces(packet)
+	} else {
+		_, err = c.socket.WriteTo(packet.Data, packet.Address)
+	}
 	if err != nil {
+		c.diagnostics.failed(err)
 		return fmt.Errorf("send: %w", err)
 	}
+	counters.packetsOut.Add(1)
 	return nil
 }
@@ -0,0 +1,96 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"testing"
+
+	"github.com/pb82/sunny/proto/net2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnection_registerResponse(t *testing.T) {
+	ass := assert.New(t)
+
+	conn, err := NewPacketConnection(&idleConn{closed: make(chan struct{})})
+	ass.NoError(err)
+
+	first := &net2.DeviceData{PacketID: 0x12}
+	second := &net2.DeviceData{PacketID: 0x12}
+	firstCh := make(chan *net2.DeviceData, 1)
+	secondCh := make(chan *net2.DeviceData, 1)
+	firstPending, err := conn.registerResponse("192.168.0.10", first, firstCh)
+	ass.NoError(err)
+	secondPending, err := conn.registerResponse("192.168.0.10", second, secondCh)
+	ass.NoError(err)
+	ass.NotEqual(first.PacketID, second.PacketID)
+
+	// other devices may use the same ID
+	other := &net2.DeviceData{PacketID: 0x12}
+	otherPending, err := conn.registerResponse("192.168.0.11", other, make(chan *net2.DeviceData, 1))
+	ass.NoError(err)
+	ass.Equal(uint16(0x12), other.PacketID)
+
+	// finished request does not remove the other one
+	conn.unregisterResponse(secondPending)
+	ass.Contains(conn.responseChannels, responseKey{"192.168.0.10", first.PacketID})
+	ass.Equal(firstCh, conn.responseChannels[responseKey{"192.168.0.10", first.PacketID}].ch)
+	conn.unregisterResponse(firstPending)
+	conn.unregisterResponse(otherPending)
+	ass.Empty(conn.responseChannels)
+	ass.Empty(conn.responseIPs)
+}
+
+func TestConnection_moveResponses(t *testing.T) {
+	ass := assert.New(t)
+
+	conn, err := NewPacketConnection(&idleConn{closed: make(chan struct{})})
+	ass.NoError(err)
+
+	moved := &net2.DeviceData{PacketID: 0x12}
+	kept := &net2.DeviceData{PacketID: 0x13}
+	movedPending, err := conn.registerResponse("192.168.0.10", moved, make(chan *net2.DeviceData, 1))
+	ass.NoError(err)
+	keptPending, err := conn.registerResponse("192.168.0.10", kept, make(chan *net2.DeviceData, 1))
+	ass.NoError(err)
+	// packet ID already pending at the new IP
+	otherPending, err := conn.registerResponse("192.168.0.11", &net2.DeviceData{PacketID: 0x13}, make(chan *net2.DeviceData, 1))
+	ass.NoError(err)
+
+	conn.moveResponses("192.168.0.10", "192.168.0.11")
+	ass.Contains(conn.responseChannels, responseKey{"192.168.0.11", 0x12})
+	ass.Contains(conn.responseChannels, responseKey{"192.168.0.10", 0x13})
+	ass.Equal(1, conn.responseIPs["192.168.0.10"])
+	ass.Equal(2, conn.responseIPs["192.168.0.11"])
+
+	conn.unregisterResponse(movedPending)
+	conn.unregisterResponse(keptPending)
+	conn.unregisterResponse(otherPending)
+	ass.Empty(conn.responseChannels)
+	ass.Empty(conn.responseIPs)
+}
+
+func TestNextPacketID(t *testing.T) {
+	ass := assert.New(t)
+
+	// IDs use 15 bits
+	seen := make(map[uint16]bool)
+	for range net2.PacketIDMask + 1 {
+		id := net2.NextPacketID()
+		ass.LessOrEqual(id, uint16(net2.PacketIDMask))
+		seen[id] = true
+	}
+	ass.Len(seen, net2.PacketIDMask+1)
+}
@@ -0,0 +1,76 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"expvar"
+	"sync/atomic"
+)
+
+// counters of all connections, published as "sunny" via expvar (/debug/vars)
+var counters struct {
+	packetsIn      atomic.Uint64
+	packetsOut     atomic.Uint64
+	decodeFailures atomic.Uint64
+	drops          atomic.Uint64
+	duplicates     atomic.Uint64
+	sendOverflows  atomic.Uint64
+	sendExpired    atomic.Uint64
+	receivers      atomic.Int64
+	sessions       atomic.Int64
+}
+
+// Counters is a snapshot of the internal counters of all connections
+type Counters struct {
+	// PacketsIn received datagrams
+	PacketsIn uint64 `json:"packets_in"`
+	// PacketsOut sent datagrams
+	PacketsOut uint64 `json:"packets_out"`
+	// DecodeFailures of received datagrams
+	DecodeFailures uint64 `json:"decode_failures"`
+	// Drops of packets because of busy receivers
+	Drops uint64 `json:"drops"`
+	// Duplicates suppressed retransmitted packets
+	Duplicates uint64 `json:"duplicates"`
+	// SendOverflows of packets rejected because of a full send queue
+	SendOverflows uint64 `json:"send_overflows"`
+	// SendExpired queued packets dropped because their deadline passed
+	SendExpired uint64 `json:"send_expired"`
+	// ActiveReceivers registered for received packets
+	ActiveReceivers int64 `json:"active_receivers"`
+	// ActiveSessions logged in devices
+	ActiveSessions int64 `json:"active_sessions"`
+}
+
+// GetCounters returns the current internal counters
+func GetCounters() Counters {
+	return Counters{
+		PacketsIn:       counters.packetsIn.Load(),
+		PacketsOut:      counters.packetsOut.Load(),
+		DecodeFailures:  counters.decodeFailures.Load(),
+		Drops:           counters.drops.Load(),
+		Duplicates:      counters.duplicates.Load(),
+		SendOverflows:   counters.sendOverflows.Load(),
+		SendExpired:     counters.sendExpired.Load(),
+		ActiveReceivers: counters.receivers.Load(),
+		ActiveSessions:  counters.sessions.Load(),
+	}
+}
+
+func init() {
+	expvar.Publish("sunny", expvar.Func(func() interface{} {
+		return GetCounters()
+	}))
+}
@@ -0,0 +1,170 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+)
+
+// UserGroup used for login
+type UserGroup int
+
+const (
+	// UserGroupUser default user account
+	UserGroupUser UserGroup = iota
+	// UserGroupInstaller installer account
+	UserGroupInstaller
+)
+
+// String representation of the user group
+func (g UserGroup) String() string {
+	switch g {
+	case UserGroupUser:
+		return "user"
+	case UserGroupInstaller:
+		return "installer"
+	}
+	return fmt.Sprintf("UserGroup(%d)", int(g))
+}
+
+// loginID returns the user group identifier used in login requests
+func (g UserGroup) loginID() uint32 {
+	if g == UserGroupInstaller {
+		return 10
+	}
+	return 7
+}
+
+// encryptKey returns the key to "encrypt" the password
+func (g UserGroup) encryptKey() byte {
+	if g == UserGroupInstaller {
+		return 0xBB
+	}
+	return 0x88
+}
+
+// Credentials used for login
+type Credentials struct {
+	Password  string
+	UserGroup UserGroup
+}
+
+// CredentialProvider is consulted on every login to get the credentials of a device
+type CredentialProvider interface {
+	// Credentials for the device with the given serial number
+	Credentials(ctx context.Context, serial uint32) (Credentials, error)
+}
+
+// StaticCredentials provides the same user password for all devices
+type StaticCredentials string
+
+// Credentials for the device with the given serial number
+func (s StaticCredentials) Credentials(context.Context, uint32) (Credentials, error) {
+	return Credentials{Password: string(s)}, nil
+}
+
+// EnvCredentials reads the user password from the environment variable with the given name
+type EnvCredentials string
+
+// Credentials for the device with the given serial number
+func (e EnvCredentials) Credentials(context.Context, uint32) (Credentials, error) {
+	password, ok := os.LookupEnv(string(e))
+	if !ok {
+		return Credentials{}, fmt.Errorf("environment variable %s not set", string(e))
+	}
+	return Credentials{Password: password}, nil
+}
+
+// CredentialFunc provides credentials by calling the function
+type CredentialFunc func(ctx context.Context, serial uint32) (Credentials, error)
+
+// Credentials for the device with the given serial number
+func (f CredentialFunc) Credentials(ctx context.Context, serial uint32) (Credentials, error) {
+	return f(ctx, serial)
+}
+
+// MultiCredentialProvider offers several credentials that are tried in order on login
+type MultiCredentialProvider interface {
+	CredentialProvider
+
+	// CandidateCredentials for the device with the given serial number in the order to try
+	CandidateCredentials(ctx context.Context, serial uint32) ([]Credentials, error)
+	// LoginSucceeded is called with the credentials that worked for the device
+	LoginSucceeded(serial uint32, credentials Credentials)
+}
+
+// FallbackCredentials tries a list of credentials in order (e.g. user and installer
+// password) and caches which one worked per serial number
+type FallbackCredentials struct {
+	list []Credentials
+
+	mutex   sync.Mutex
+	working map[uint32]Credentials
+}
+
+// NewFallbackCredentials creates a provider trying the given credentials in order
+func NewFallbackCredentials(credentials ...Credentials) *FallbackCredentials {
+	return &FallbackCredentials{
+		list:    credentials,
+		working: make(map[uint32]Credentials),
+	}
+}
+
+// Credentials returns the credentials which worked last for the device or the first one
+func (f *FallbackCredentials) Credentials(_ context.Context, serial uint32) (Credentials, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if c, ok := f.working[serial]; ok {
+		return c, nil
+	}
+	if len(f.list) == 0 {
+		return Credentials{}, fmt.Errorf("no credentials configured")
+	}
+	return f.list[0], nil
+}
+
+// CandidateCredentials starting with the credentials that worked last for the device
+func (f *FallbackCredentials) CandidateCredentials(_ context.Context, serial uint32) ([]Credentials, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if len(f.list) == 0 {
+		return nil, fmt.Errorf("no credentials configured")
+	}
+
+	candidates := make([]Credentials, 0, len(f.list))
+	if c, ok := f.working[serial]; ok {
+		candidates = append(candidates, c)
+	}
+	for _, c := range f.list {
+		if !slices.Contains(candidates, c) {
+			candidates = append(candidates, c)
+		}
+	}
+	return candidates, nil
+}
+
+// LoginSucceeded caches the working credentials for the device
+func (f *FallbackCredentials) LoginSucceeded(serial uint32, credentials Credentials) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.working[serial] = credentials
+}
@@ -0,0 +1,126 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"context"
+
+	"github.com/pb82/sunny/proto"
+	"github.com/pb82/sunny/proto/net2"
+)
+
+// DataManager provides access to the devices of a plant via an SMA Data Manager (or data logger).
+// Requests for child devices are sent to the Data Manager, which forwards them to the device.
+type DataManager struct {
+	device      *Device
+	credentials CredentialProvider
+	options     []DeviceOption
+}
+
+// NewDataManager creates a Data Manager instance, the options are also used for its child devices
+func (c *Connection) NewDataManager(address, password string, options ...DeviceOption) (*DataManager, error) {
+	return c.NewDataManagerWithCredentials(address, StaticCredentials(password), options...)
+}
+
+// NewDataManagerWithCredentials creates a Data Manager instance which gets the
+// login credentials from the given provider
+func (c *Connection) NewDataManagerWithCredentials(address string, credentials CredentialProvider, options ...DeviceOption) (*DataManager, error) {
+	device, err := c.NewDeviceWithCredentials(address, credentials, options...)
+	if err != nil {
+		return nil, err
+	}
+	return &DataManager{
+		device:      device,
+		credentials: credentials,
+		options:     options,
+	}, nil
+}
+
+// Device of the Data Manager itself
+func (m *DataManager) Device() *Device {
+	return m.device
+}
+
+// Close the Data Manager (child devices must be closed separately)
+func (m *DataManager) Close() {
+	m.device.Close()
+}
+
+// Children lists the devices responding via the Data Manager, it stops if ctx is done
+// or no further device responded within the request timeout.
+// The devices found so far are also returned if ctx is done.
+func (m *DataManager) Children(ctx context.Context) ([]DeviceInfo, error) {
+	// device without ID -> ping is broadcast to all devices behind the Data Manager
+	scanner, err := m.device.conn.NewDeviceWithCredentialsCtx(ctx, m.device.Address().IP.String(), nil, WithoutIdentification())
+	if err != nil {
+		return nil, err
+	}
+	defer scanner.Close()
+
+	pingData := proto.NewDeviceDataBuilder(net2.CommandGetValues, 0).
+		Parameters(0, 0).
+		Build()
+	err = scanner.sendDeviceData(ctx, pingData)
+	if err != nil {
+		return nil, err
+	}
+
+	var children []DeviceInfo
+	known := map[net2.DeviceId]bool{m.device.id: true}
+	for {
+		receiveCtx, cancel := context.WithTimeout(ctx, m.device.Timeout())
+		entry, err := scanner.readNet2(receiveCtx)
+		cancel()
+		if err != nil {
+			// no further responses
+			return children, ctx.Err()
+		}
+
+		data, ok := entry.Content.(*net2.DeviceData)
+		if !ok || known[data.Source] {
+			continue
+		}
+		known[data.Source] = true
+		Log.Printf("new device at data manager %s - Serial=%d", m.device.Address().IP, data.Source.SerialNumber)
+		children = append(children, DeviceInfo{ID: data.Source})
+	}
+}
+
+// Child creates a device instance for a child of the Data Manager
+func (m *DataManager) Child(info DeviceInfo) (*Device, error) {
+	options := append(append([]DeviceOption(nil), m.options...), WithDeviceInfo(info))
+	return m.device.conn.NewDeviceWithCredentials(m.device.Address().IP.String(), m.credentials, options...)
+}
+
+// Devices creates device instances for all children of the Data Manager
+func (m *DataManager) Devices(ctx context.Context) ([]*Device, error) {
+	children, err := m.Children(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	devices := make([]*Device, 0, len(children))
+	for _, info := range children {
+		device, err := m.Child(info)
+		if err != nil {
+			for _, d := range devices {
+				d.Close()
+			}
+			return nil, err
+		}
+		devices = append(devices, device)
+	}
+	return devices, nil
+}
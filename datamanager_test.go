@@ -0,0 +1,88 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pb82/sunny"
+	"github.com/pb82/sunny/sunnytest"
+)
+
+func TestDataManager_Devices(t *testing.T) {
+	ass := assert.New(t)
+
+	network := sunnytest.NewNetwork()
+	defer network.Close()
+	manager, err := network.AddInverter("192.168.0.20", 1000, "0000")
+	require.NoError(t, err)
+	for i, power := range []uint32{1500, 2500} {
+		child := manager.AddChild(uint32(2001+i), "0000")
+		child.SetValue(sunny.ActivePowerPlus, power)
+	}
+	connection, err := network.Connection()
+	require.NoError(t, err)
+
+	dataManager, err := connection.NewDataManager("192.168.0.20", "0000")
+	require.NoError(t, err)
+	defer dataManager.Close()
+	ass.Equal(uint32(1000), dataManager.Device().SerialNumber())
+	dataManager.Device().SetTimeout(100 * time.Millisecond)
+
+	devices, err := dataManager.Devices(context.Background())
+	require.NoError(t, err)
+	require.Len(t, devices, 2)
+	for i, power := range []uint32{1500, 2500} {
+		ass.Equal(uint32(2001+i), devices[i].SerialNumber())
+		ass.Equal("192.168.0.20", devices[i].Address().IP.String())
+
+		// requests are forwarded to the child
+		values, err := devices[i].GetValues()
+		ass.NoError(err)
+		ass.Equal(power, values[sunny.ActivePowerPlus])
+		devices[i].Close()
+	}
+}
+
+func TestDataManager_Children_canceled(t *testing.T) {
+	ass := assert.New(t)
+
+	network := sunnytest.NewNetwork()
+	defer network.Close()
+	manager, err := network.AddInverter("192.168.0.20", 1000, "0000")
+	require.NoError(t, err)
+	manager.AddChild(2001, "0000")
+	connection, err := network.Connection()
+	require.NoError(t, err)
+	dataManager, err := connection.NewDataManager("192.168.0.20", "0000")
+	require.NoError(t, err)
+	defer dataManager.Close()
+
+	// children found before ctx is done are returned
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	children, err := dataManager.Children(ctx)
+	ass.ErrorIs(err, context.DeadlineExceeded)
+	require.Len(t, children, 1)
+	ass.Equal(uint32(2001), children[0].ID.SerialNumber)
+
+	_, err = dataManager.Devices(ctx)
+	ass.ErrorIs(err, context.DeadlineExceeded)
+}
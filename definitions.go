@@ -0,0 +1,114 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ValueDefinitions is a set of custom values loaded from a file.
+//
+// The file is YAML or JSON:
+//
+//	inverter:
+//	  - name: BatteryCycles
+//	    description: Battery charge cycles
+//	    object: 0x5100
+//	    start: 0x00498E00
+//	    end: 0x00498EFF
+//	    code: 0x498E
+//	energyMeter:
+//	  - name: ActiveEnergyPlusTariff1
+//	    obis: "0:1.8.1"
+type ValueDefinitions struct {
+	Inverter    []InverterValueDefinition    `yaml:"inverter" json:"inverter"`
+	EnergyMeter []EnergyMeterValueDefinition `yaml:"energyMeter" json:"energyMeter"`
+}
+
+// ValueDefinition is the common part of custom value definitions
+type ValueDefinition struct {
+	Name        string  `yaml:"name" json:"name"`
+	Description string  `yaml:"description" json:"description"`
+	Unit        string  `yaml:"unit" json:"unit"`
+	Type        string  `yaml:"type" json:"type"`
+	Factor      float64 `yaml:"factor" json:"factor"`
+}
+
+// decoder of the definition
+func (d ValueDefinition) decoder() ValueDecoder {
+	return ValueDecoder(d)
+}
+
+// InverterValueDefinition defines a custom inverter value (see RegisterInverterValue)
+type InverterValueDefinition struct {
+	ValueDefinition `yaml:",inline"`
+
+	Object uint16 `yaml:"object" json:"object"`
+	Start  uint32 `yaml:"start" json:"start"`
+	End    uint32 `yaml:"end" json:"end"`
+	Code   uint16 `yaml:"code" json:"code"`
+}
+
+// EnergyMeterValueDefinition defines a custom energy meter value (see RegisterEnergyMeterValue)
+type EnergyMeterValueDefinition struct {
+	ValueDefinition `yaml:",inline"`
+
+	OBIS string `yaml:"obis" json:"obis"`
+}
+
+// LoadValueDefinitions from a YAML or JSON file and registers the values
+func LoadValueDefinitions(path string) ([]ValueID, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ReadValueDefinitions(file)
+}
+
+// ReadValueDefinitions in YAML or JSON format and registers the values
+func ReadValueDefinitions(r io.Reader) ([]ValueID, error) {
+	var definitions ValueDefinitions
+	err := yaml.NewDecoder(r).Decode(&definitions)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("invalid value definitions: %w", err)
+	}
+	return definitions.Register()
+}
+
+// Register all values of the definitions, stops on the first error
+func (d ValueDefinitions) Register() ([]ValueID, error) {
+	var ids []ValueID
+	for _, def := range d.Inverter {
+		id, err := RegisterInverterValue(def.Object, def.Start, def.End, def.Code, def.decoder())
+		if err != nil {
+			return ids, err
+		}
+		ids = append(ids, id)
+	}
+	for _, def := range d.EnergyMeter {
+		id, err := RegisterEnergyMeterValue(def.OBIS, def.decoder())
+		if err != nil {
+			return ids, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
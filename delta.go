@@ -0,0 +1,88 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"math"
+	"reflect"
+	"sync"
+)
+
+// DeltaFilter keeps the last returned values and removes unchanged ones
+type DeltaFilter struct {
+	// Epsilon per unit, numeric values are unchanged if the difference is not larger
+	Epsilon map[string]float64
+
+	mutex sync.Mutex
+	last  map[ValueID]interface{}
+}
+
+// NewDeltaFilter creates a filter with the given epsilon per unit (e.g. "W": 5)
+func NewDeltaFilter(epsilon map[string]float64) *DeltaFilter {
+	return &DeltaFilter{
+		Epsilon: epsilon,
+		last:    make(map[ValueID]interface{}),
+	}
+}
+
+// Filter returns only the values changed since the last call.
+// Values missing in a response are kept and not reported as changed.
+func (f *DeltaFilter) Filter(values map[ValueID]interface{}) map[ValueID]interface{} {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	changed := make(map[ValueID]interface{})
+	for id, value := range values {
+		last, ok := f.last[id]
+		if ok && !f.changed(id, last, value) {
+			continue
+		}
+		f.last[id] = value
+		changed[id] = value
+	}
+	return changed
+}
+
+// Reset forgets the last values, so all values are returned on the next call
+func (f *DeltaFilter) Reset() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.last = make(map[ValueID]interface{})
+}
+
+// changed checks if value differs from the last returned one
+func (f *DeltaFilter) changed(id ValueID, last, value interface{}) bool {
+	a, okA := ToFloat(last)
+	b, okB := ToFloat(value)
+	if okA && okB {
+		return math.Abs(a-b) > f.Epsilon[valueDescription(id).Unit]
+	}
+	return !reflect.DeepEqual(last, value)
+}
+
+// SetDeltaFilter used by GetValues to return only changed values, nil returns all values
+func (d *Device) SetDeltaFilter(filter *DeltaFilter) {
+	d.delta.Store(filter)
+}
+
+// filterDelta of values if a delta filter is set
+func (d *Device) filterDelta(values map[ValueID]interface{}) map[ValueID]interface{} {
+	filter := d.delta.Load()
+	if filter == nil || values == nil {
+		return values
+	}
+	return filter.Filter(values)
+}
@@ -0,0 +1,86 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeltaFilter_Filter(t *testing.T) {
+	epsilon := map[string]float64{"W": 5}
+	tests := []struct {
+		name    string
+		last    map[ValueID]interface{}
+		values  map[ValueID]interface{}
+		changed map[ValueID]interface{}
+	}{
+		{"first call", nil,
+			map[ValueID]interface{}{ActivePowerPlus: uint32(100)},
+			map[ValueID]interface{}{ActivePowerPlus: uint32(100)}},
+		{"within epsilon", map[ValueID]interface{}{ActivePowerPlus: uint32(100)},
+			map[ValueID]interface{}{ActivePowerPlus: uint32(105)},
+			map[ValueID]interface{}{}},
+		{"above epsilon", map[ValueID]interface{}{ActivePowerPlus: uint32(100)},
+			map[ValueID]interface{}{ActivePowerPlus: uint32(94)},
+			map[ValueID]interface{}{ActivePowerPlus: uint32(94)}},
+		{"without epsilon", map[ValueID]interface{}{VoltageL1: 230.0},
+			map[ValueID]interface{}{VoltageL1: 230.1},
+			map[ValueID]interface{}{VoltageL1: 230.1}},
+		{"mixed numeric types", map[ValueID]interface{}{ActivePowerPlus: uint32(100)},
+			map[ValueID]interface{}{ActivePowerPlus: int64(102)},
+			map[ValueID]interface{}{}},
+		{"unchanged string", map[ValueID]interface{}{DeviceName: "SN: 1"},
+			map[ValueID]interface{}{DeviceName: "SN: 1"},
+			map[ValueID]interface{}{}},
+		{"changed string", map[ValueID]interface{}{DeviceName: "SN: 1"},
+			map[ValueID]interface{}{DeviceName: "SN: 2"},
+			map[ValueID]interface{}{DeviceName: "SN: 2"}},
+		{"missing value", map[ValueID]interface{}{ActivePowerPlus: uint32(100), DeviceName: "SN: 1"},
+			map[ValueID]interface{}{DeviceName: "SN: 1"},
+			map[ValueID]interface{}{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter := NewDeltaFilter(epsilon)
+			filter.Filter(tt.last)
+			assert.Equal(t, tt.changed, filter.Filter(tt.values))
+		})
+	}
+}
+
+func TestDeltaFilter_Filter_drift(t *testing.T) {
+	ass := assert.New(t)
+
+	// small changes add up against the last returned value
+	filter := NewDeltaFilter(map[string]float64{"W": 5})
+	ass.Len(filter.Filter(map[ValueID]interface{}{ActivePowerPlus: uint32(100)}), 1)
+	ass.Empty(filter.Filter(map[ValueID]interface{}{ActivePowerPlus: uint32(103)}))
+	ass.Empty(filter.Filter(map[ValueID]interface{}{ActivePowerPlus: uint32(105)}))
+	ass.Len(filter.Filter(map[ValueID]interface{}{ActivePowerPlus: uint32(106)}), 1)
+	ass.Empty(filter.Filter(map[ValueID]interface{}{ActivePowerPlus: uint32(108)}))
+}
+
+func TestDeltaFilter_Reset(t *testing.T) {
+	ass := assert.New(t)
+
+	filter := NewDeltaFilter(nil)
+	values := map[ValueID]interface{}{DeviceName: "SN: 1"}
+	ass.Equal(values, filter.Filter(values))
+	ass.Empty(filter.Filter(values))
+	filter.Reset()
+	ass.Equal(values, filter.Filter(values))
+}
@@ -16,74 +16,160 @@ package sunny
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pb82/sunny/proto"
 	"github.com/pb82/sunny/proto/net2"
 )
 
+// DefaultTimeout for requests of new devices
+const DefaultTimeout = time.Second * 3
+
+// maxParallelRequests limits the amount of pending requests per device during value scans
+const maxParallelRequests = 4
+
 // Device instance for communication with inverter and energy meter
 type Device struct {
 	// Address of inverter or energy meter
-	address *net.UDPAddr
-	// password for inverter communication
-	password string
+	address atomic.Pointer[net.UDPAddr]
+	// all addresses the device answered from (primary first)
+	addressMutex sync.Mutex
+	addresses    []*net.UDPAddr
+	// credentials for inverter communication
+	credentials atomic.Pointer[CredentialProvider]
+	// user group of last successful login
+	userGroup atomic.Int32
 
 	// Connection instance for communication
 	conn *Connection
+	// retry policy for requests
+	retryPolicy atomic.Pointer[RetryPolicy]
+	// timeout for requests without context
+	timeout atomic.Int64
+	// optional plausibility checks of values
+	validator atomic.Pointer[Validator]
+	// optional filter of unchanged values
+	delta atomic.Pointer[DeltaFilter]
+	// optional cache of values shared by callers
+	cache atomic.Pointer[ValueCache]
+	// source of the last received values
+	source atomic.Int32
+	// health of the device
+	health deviceHealth
+	// round-trip and loss statistics
+	stats requestStats
+	// lifecycle events of the device
+	events deviceEvents
+	// optional WebConnect client used if Speedwire requests fail
+	webConnect atomic.Pointer[WebConnectClient]
 
 	// device information
 	energyMeter bool
 	id          net2.DeviceId
+	// firmware version of the last received values
+	firmware atomic.Pointer[FirmwareVersion]
 
-	// receiver channel for received package with IP of this device
-	receiver chan *proto.Packet
+	// receiver for received package with IP of this device
+	receiver *packetReceiver
 }
 
-// NewDevice creates a new device instance
-func (c *Connection) NewDevice(address, password string) (*Device, error) {
-	device := Device{
-		conn:     c,
-		password: password,
-		receiver: make(chan *proto.Packet, 2),
+// NewDevice creates a new device instance.
+// No login is performed, requests log in on demand and log out afterwards.
+func (c *Connection) NewDevice(address, password string, options ...DeviceOption) (*Device, error) {
+	return c.NewDeviceCtx(context.Background(), address, password, options...)
+}
+
+// NewDeviceCtx creates a new device instance, the identification stops if ctx is done
+func (c *Connection) NewDeviceCtx(ctx context.Context, address, password string, options ...DeviceOption) (*Device, error) {
+	return c.NewDeviceWithCredentialsCtx(ctx, address, StaticCredentials(password), options...)
+}
+
+// NewDeviceWithCredentials creates a new device instance which gets the
+// login credentials from the given provider
+func (c *Connection) NewDeviceWithCredentials(address string, credentials CredentialProvider, options ...DeviceOption) (*Device, error) {
+	return c.NewDeviceWithCredentialsCtx(context.Background(), address, credentials, options...)
+}
+
+// NewDeviceWithCredentialsCtx creates a new device instance which gets the
+// login credentials from the given provider, the identification stops if ctx is done
+func (c *Connection) NewDeviceWithCredentialsCtx(ctx context.Context, address string, credentials CredentialProvider, options ...DeviceOption) (*Device, error) {
+	config := deviceConfig{identify: true}
+	for _, option := range options {
+		option(&config)
+	}
+
+	device := Device{conn: c}
+	device.credentials.Store(&credentials)
+	device.retryPolicy.Store(c.retryPolicy.Load())
+	device.SetTimeout(DefaultTimeout)
+	if config.timeout != nil {
+		device.SetTimeout(*config.timeout)
+	}
+	if config.retryPolicy != nil {
+		device.SetRetryPolicy(*config.retryPolicy)
+	}
+	bufferSize := int(c.receiverBufferSize.Load())
+	if config.receiverBufferSize != nil {
+		bufferSize = *config.receiverBufferSize
 	}
+	device.receiver = newPacketReceiver(bufferSize, config.backpressure)
+	device.health.breaker = config.breaker
 
-	var err error
-	device.address, err = net.ResolveUDPAddr("udp", address+":9522")
+	resolved, err := resolveDevice(ctx, address)
 	if err != nil {
 		return nil, fmt.Errorf("failed to resolve udp address: %w", err)
 	}
+	device.address.Store(resolved)
+	device.addresses = []*net.UDPAddr{resolved}
 	// update address with resolved IP (in case of DNS)
-	address = device.address.IP.String()
+	address = resolved.IP.String()
 
 	// register receiver channel for this device
 	c.registerReceiver(address, device.receiver)
+	c.addDevice(&device)
+
+	// skip identification of known devices
+	if config.info != nil {
+		device.id = config.info.ID
+		device.energyMeter = config.info.EnergyMeter
+		return &device, nil
+	}
+	if !config.identify {
+		return &device, nil
+	}
 
 	// send ping
-	pingData := net2.NewDeviceData(0xa0)
-	pingData.AddParameter(0)
-	pingData.AddParameter(0)
+	pingData := proto.NewDeviceDataBuilder(net2.CommandGetValues, 0).
+		Parameters(0, 0).
+		Build()
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	ctx, cancel := context.WithTimeout(ctx, device.Timeout())
 	defer cancel()
-	for {
+	for attempt := 0; ; attempt++ {
 		// check for timeout
 		select {
 		case <-ctx.Done():
-			return nil, fmt.Errorf("no Speedwire ping response for %s", address)
+			device.Close()
+			return nil, fmt.Errorf("%w: no Speedwire ping response for %s", ErrTimeout, address)
 		default:
 		}
 
-		err = device.sendDeviceData(pingData)
+		err = device.sendDeviceData(ctx, pingData)
 		if err != nil {
 			Log.Printf("failed to send Speedwire ping request for %s", address)
+			device.Close()
 			return nil, err
 		}
+		sent := time.Now()
 
 		// wait for receive
-		receiveCtx, receiveCancel := context.WithTimeout(ctx, time.Millisecond*500)
+		receiveCtx, receiveCancel := context.WithTimeout(ctx, device.retryPolicy.Load().delay(attempt))
 		net2Entry, err := device.readNet2(receiveCtx)
 		receiveCancel()
 		if err != nil {
@@ -100,19 +186,101 @@ func (c *Connection) NewDevice(address, password string) (*Device, error) {
 		case *net2.DeviceData:
 			Log.Printf("new inverter at %s - Serial=%d", address, c.Source.SerialNumber)
 			device.id = c.Source
+			device.stats.received(time.Since(sent), attempt > 0)
 			return &device, nil
 		}
 	}
 }
 
+// resolveDevice address (IP or host name), the lookup stops if ctx is done
+func resolveDevice(ctx context.Context, address string) (*net.UDPAddr, error) {
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip", address)
+	if err != nil {
+		return nil, err
+	}
+	// prefer IPv4 like the Speedwire multicast group
+	ip := ips[0]
+	for _, candidate := range ips {
+		if candidate.To4() != nil {
+			ip = candidate.To4()
+			break
+		}
+	}
+	return &net.UDPAddr{IP: ip, Port: 9522}, nil
+}
+
+// Addresses returns all addresses the device was found at, the used address first
+func (d *Device) Addresses() []*net.UDPAddr {
+	d.addressMutex.Lock()
+	defer d.addressMutex.Unlock()
+	return slices.Clone(d.addresses)
+}
+
+// addAddress of the device, with primary set requests are sent to the address from now on
+func (d *Device) addAddress(address *net.UDPAddr, primary bool) {
+	d.addressMutex.Lock()
+	defer d.addressMutex.Unlock()
+
+	current := d.Address()
+	d.addresses = slices.DeleteFunc(d.addresses, func(a *net.UDPAddr) bool {
+		return a.IP.Equal(address.IP)
+	})
+	if !primary || current.IP.Equal(address.IP) || !d.conn.hasDevice(d) {
+		d.addresses = append(d.addresses, address)
+		return
+	}
+
+	// receive packets of the new address before the old one is removed
+	d.conn.registerReceiver(address.IP.String(), d.receiver)
+	d.conn.unregisterReceiver(current.IP.String(), d.receiver)
+	d.conn.moveResponses(current.IP.String(), address.IP.String())
+	d.address.Store(address)
+	d.addresses = append([]*net.UDPAddr{address}, d.addresses...)
+	Log.Printf("device %d now uses %s instead of %s", d.id.SerialNumber, address.IP, current.IP)
+}
+
 // Close unregister receiver channel
 func (d *Device) Close() {
-	d.conn.unregisterReceiver(d.address.IP.String(), d.receiver)
+	d.addressMutex.Lock()
+	defer d.addressMutex.Unlock()
+	d.conn.unregisterReceiver(d.Address().IP.String(), d.receiver)
+	d.conn.removeDevice(d)
+	d.closeEvents()
 }
 
 // SetPassword for device communication
 func (d *Device) SetPassword(pw string) {
-	d.password = pw
+	d.SetCredentialProvider(StaticCredentials(pw))
+}
+
+// SetCredentialProvider consulted on login
+func (d *Device) SetCredentialProvider(credentials CredentialProvider) {
+	d.credentials.Store(&credentials)
+}
+
+// credentialProvider of the device
+func (d *Device) credentialProvider() CredentialProvider {
+	return *d.credentials.Load()
+}
+
+// SetRetryPolicy for requests to this device
+func (d *Device) SetRetryPolicy(policy RetryPolicy) {
+	d.retryPolicy.Store(&policy)
+}
+
+// SetTimeout for requests without context (GetValue, GetValues)
+func (d *Device) SetTimeout(timeout time.Duration) {
+	d.timeout.Store(int64(timeout))
+}
+
+// Timeout returns the timeout for requests without context
+func (d *Device) Timeout() time.Duration {
+	return time.Duration(d.timeout.Load())
+}
+
+// UserGroup returns the user group of the last successful login
+func (d *Device) UserGroup() UserGroup {
+	return UserGroup(d.userGroup.Load())
 }
 
 // SerialNumber returns the serial number of the device
@@ -122,7 +290,7 @@ func (d *Device) SerialNumber() uint32 {
 
 // Address returns the address of the device
 func (d *Device) Address() *net.UDPAddr {
-	return d.address
+	return d.address.Load()
 }
 
 // IsEnergyMeter returns true if devices is an energy meter
@@ -133,14 +301,14 @@ func (d *Device) IsEnergyMeter() bool {
 // GetValue from inverter and returns nil if value does not exist
 // Note: to request multiple values use GetValues
 func (d *Device) GetValue(id ValueID) (interface{}, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	ctx, cancel := context.WithTimeout(context.Background(), d.Timeout())
 	defer cancel()
 	return d.GetValueCtx(ctx, id)
 }
 
 // GetValueCtx from inverter and returns nil if value does not exist
 // Note: to request multiple values use GetValues
-func (d *Device) GetValueCtx(ctx context.Context, id ValueID) (interface{}, error) {
+func (d *Device) GetValueCtx(ctx context.Context, id ValueID) (value interface{}, err error) {
 	if d.energyMeter {
 		// handle some fixed energy meter values
 		if id == DeviceClass {
@@ -149,41 +317,106 @@ func (d *Device) GetValueCtx(ctx context.Context, id ValueID) (interface{}, erro
 		if id == DeviceName {
 			return "Energy Meter", nil
 		}
+		if _, ok := lookupEnergyMeterValue(id); !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedValue, id)
+		}
 
 		// no selective request for energy meter -> request all
-		values, err := d.GetValuesCtx(ctx)
+		values, _, err := d.getValues(ctx)
+		d.pollDone(err)
 		if err != nil {
 			return nil, err
 		}
 		return values[id], nil
 	}
 
+	if _, ok := LookupInverterValue(id); !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedValue, id)
+	}
+	defer func() {
+		d.pollDone(err)
+	}()
+	err = d.health.allow()
+	if err != nil {
+		return nil, err
+	}
+
 	// clear queue -> get fresh data
 	d.clearReceiver()
 
-	err := d.loginRetry(ctx, 3)
+	values, err := d.getInverterValue(ctx, id)
+	if err != nil {
+		values, err = d.webConnectFallback(ctx, err)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	d.updateFirmware(values)
+	d.applyProfiles(values)
+	d.validate(values)
+	d.valuesUpdated(values)
+	return values[id], nil
+}
+
+// getInverterValue requests the values containing id via Speedwire
+func (d *Device) getInverterValue(ctx context.Context, id ValueID) (map[ValueID]interface{}, error) {
+	err := d.login(ctx)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
-	values, err := d.requestValues(ctx, getInverterRequest(id))
+	values, _, err := d.requestValues(ctx, getInverterRequest(id))
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
 	d.logout()
-	return values[id], nil
+	return values, nil
 }
 
 // GetValues from device
 func (d *Device) GetValues() (map[ValueID]interface{}, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	ctx, cancel := context.WithTimeout(context.Background(), d.Timeout())
 	defer cancel()
 	return d.GetValuesCtx(ctx)
 }
 
 // GetValuesCtx from device
+// If some value groups of an inverter fail, the received values are returned
+// together with a *MultiError.
+// With a delta filter only changed values are returned.
+// With a value cache the values are shared with other callers within their TTL.
 func (d *Device) GetValuesCtx(ctx context.Context) (map[ValueID]interface{}, error) {
+	values, _, err := d.fetchValues(ctx)
+	return values, err
+}
+
+// fetchValues of GetValuesCtx with the timestamps reported by the device (if available)
+func (d *Device) fetchValues(ctx context.Context) (map[ValueID]interface{}, map[ValueID]time.Time, error) {
+	if cache := d.cache.Load(); cache != nil {
+		values, times, fetched, err := cache.get(ctx, func() (map[ValueID]interface{}, map[ValueID]time.Time, ValueSource, error) {
+			values, times, err := d.getValues(ctx)
+			return values, times, ValueSource(d.source.Load()), err
+		})
+		if fetched {
+			d.pollDone(partialSuccess(err, len(values) > 0))
+		}
+		return d.filterDelta(values), times, err
+	}
+
+	values, times, err := d.getValues(ctx)
+	d.pollDone(partialSuccess(err, len(values) > 0))
+	return d.filterDelta(values), times, err
+}
+
+// getValues from device with the timestamps reported by the device (if available)
+func (d *Device) getValues(ctx context.Context) (map[ValueID]interface{}, map[ValueID]time.Time, error) {
+	err := d.health.allow()
+	if err != nil {
+		return nil, nil, err
+	}
+
 	// clear queue -> get fresh data
 	d.clearReceiver()
 
@@ -192,7 +425,7 @@ func (d *Device) GetValuesCtx(ctx context.Context) (map[ValueID]interface{}, err
 			// check for timeout
 			select {
 			case <-ctx.Done():
-				return nil, fmt.Errorf("energy meter does not respond")
+				return nil, nil, fmt.Errorf("%w: energy meter does not respond", ErrTimeout)
 			default:
 			}
 
@@ -206,63 +439,160 @@ func (d *Device) GetValuesCtx(ctx context.Context) (map[ValueID]interface{}, err
 			if !ok {
 				continue
 			}
-			return convertEnergyMeterValues(packet.GetValues()), nil
+			values := convertEnergyMeterValues(packet.GetValues())
+			d.processValues(values)
+			return values, nil, nil
 		}
 	}
 
-	// login to device
-	err := d.loginRetry(ctx, 3)
-	if err != nil {
-		return nil, err
+	values, times, err := d.getInverterValues(ctx)
+	if err == nil && len(values) == 0 && d.webConnect.Load() != nil {
+		err = fmt.Errorf("%w: no values received", ErrTimeout)
 	}
-
-	// request all values and join to one map
-	valuesMap := make(map[ValueID]interface{})
-	for _, def := range getAllInverterRequests() {
-		values, err := d.requestValues(ctx, def)
+	source := SourceSpeedwire
+	if err != nil && len(values) == 0 {
+		times = nil
+		values, err = d.webConnectFallback(ctx, err)
 		if err != nil {
-			Log.Printf("failed to get values for %s: %v", d.address, err)
-			continue
-		}
-		if values == nil {
-			continue
+			return nil, nil, err
 		}
+		source = SourceWebConnect
+	}
+	d.source.Store(int32(source))
+
+	d.processValues(values)
+	return values, times, err
+}
+
+// processValues after they were received (firmware, profiles, validation and observers)
+func (d *Device) processValues(values map[ValueID]interface{}) {
+	d.updateFirmware(values)
+	d.applyProfiles(values)
+	d.validate(values)
+	d.valuesUpdated(values)
+}
+
+// getInverterValues requests all values via Speedwire, received values are also returned on a *MultiError
+func (d *Device) getInverterValues(ctx context.Context) (map[ValueID]interface{}, map[ValueID]time.Time, error) {
+	valuesMap := make(map[ValueID]interface{})
+	timesMap := make(map[ValueID]time.Time)
+	err := d.streamInverterValues(ctx, func(values map[ValueID]interface{}, times map[ValueID]time.Time) {
 		for id, value := range values {
 			valuesMap[id] = value
 		}
+		for id, t := range times {
+			timesMap[id] = t
+		}
+	})
+	var multi *MultiError
+	if err != nil && !errors.As(err, &multi) {
+		return nil, nil, err
+	}
+	return valuesMap, timesMap, err
+}
+
+// streamInverterValues requests all values via Speedwire in parallel.
+// handle is called with the values and reported timestamps of each response, calls are serialized.
+// Failed value groups are returned as *MultiError.
+func (d *Device) streamInverterValues(ctx context.Context, handle func(map[ValueID]interface{}, map[ValueID]time.Time)) error {
+	// login to device
+	err := d.login(ctx)
+	if err != nil {
+		return err
 	}
 
+	var handleMutex sync.Mutex
+	var failed []*GroupError
+	var wg sync.WaitGroup
+	limit := make(chan struct{}, maxParallelRequests)
+	for _, def := range d.inverterRequests() {
+		wg.Add(1)
+		limit <- struct{}{}
+		go func(def InverterValuesDef) {
+			defer func() {
+				<-limit
+				wg.Done()
+			}()
+
+			values, times, err := d.requestValues(ctx, def)
+
+			handleMutex.Lock()
+			defer handleMutex.Unlock()
+			if err != nil {
+				Log.Printf("failed to get values for %s: %v", d.Address(), err)
+				failed = append(failed, &GroupError{
+					Object: def.Object,
+					Start:  def.Start,
+					End:    def.End,
+					Values: getInverterGroupValues(def),
+					Err:    err,
+				})
+				return
+			}
+			handle(values, times)
+		}(def)
+	}
+	wg.Wait()
+
 	// logout
 	d.logout()
 
-	return valuesMap, nil
+	if len(failed) > 0 {
+		return &MultiError{Errors: failed}
+	}
+	return nil
 }
 
-func (d *Device) loginRetry(ctx context.Context, trys int) (err error) {
-	for i := 0; i < trys; i++ {
-		if err = d.login(ctx); err == nil {
-			return
+// login to device with the credentials of the provider
+// Multiple credentials of a MultiCredentialProvider are tried in order.
+func (d *Device) login(ctx context.Context) (err error) {
+	Log.Printf("login for %s", d.Address())
+	defer func() {
+		d.loginDone(err)
+	}()
+
+	provider := d.credentialProvider()
+	multi, ok := provider.(MultiCredentialProvider)
+	if !ok {
+		credentials, err := provider.Credentials(ctx, d.id.SerialNumber)
+		if err != nil {
+			return fmt.Errorf("login failed - no credentials: %w", err)
 		}
+		return d.loginWith(ctx, credentials)
 	}
-	return
-}
 
-// login to device
-func (d *Device) login(ctx context.Context) error {
-	Log.Printf("login for %s", d.address)
-	loginData := net2.NewDeviceData(0xa0)
-	loginData.Command = 0x0c
-	loginData.Object = 0xfffd
-	loginData.JobNumber = 0x01
+	candidates, err := multi.CandidateCredentials(ctx, d.id.SerialNumber)
+	if err != nil {
+		return fmt.Errorf("login failed - no credentials: %w", err)
+	}
+	for _, credentials := range candidates {
+		err = d.loginWith(ctx, credentials)
+		if err == nil {
+			multi.LoginSucceeded(d.id.SerialNumber, credentials)
+			return nil
+		}
+		if !errors.Is(err, ErrAuthFailed) {
+			return err
+		}
+		Log.Printf("login for %s as %s rejected -> try next credentials", d.Address(), credentials.UserGroup)
+	}
+	return err
+}
 
-	loginData.AddParameter(7) // 10 for installer
-	loginData.AddParameter(0x0384)
-	loginData.AddParameter(uint32(time.Now().Unix()))
-	loginData.AddParameter(0)
+// loginWith the given credentials
+func (d *Device) loginWith(ctx context.Context, credentials Credentials) error {
+	builder := proto.NewDeviceDataBuilder(net2.CommandLogin, net2.ObjectSession).
+		JobNumber(0x01).
+		Parameters(
+			credentials.UserGroup.loginID(),
+			0x0384,
+			uint32(time.Now().Unix()),
+			0,
+		)
 
 	// "encrypt" user password
-	pass := []byte(d.password)
-	encryptKey := byte(0x88) // 0xBB for installer
+	pass := []byte(credentials.Password)
+	encryptKey := credentials.UserGroup.encryptKey()
 
 	passwordData := make([]byte, 12)
 	for i := 0; i < 12; i++ {
@@ -272,155 +602,147 @@ func (d *Device) login(ctx context.Context) error {
 			passwordData[i] = encryptKey
 		}
 	}
-	loginData.Data = passwordData
+	loginData := builder.Data(passwordData).Build()
 
-	response, err := d.sendDeviceDataResponse(loginData, time.Millisecond*500, ctx)
+	response, err := d.sendDeviceDataResponse(ctx, loginData)
 	if err != nil {
 		return fmt.Errorf("login failed: %w", err)
 	}
 
+	if response.Status == loginStatusInvalidPassword {
+		return fmt.Errorf("login failed: %w", ErrAuthFailed)
+	}
 	if response.Status != 0 {
-		return fmt.Errorf("login failed")
+		return fmt.Errorf("login failed: %w (status 0x%X)", ErrDeviceBusy, response.Status)
 	}
+
+	d.userGroup.Store(int32(credentials.UserGroup))
+	d.health.setSession(true)
 	return nil
 }
 
 // logout to device
 func (d *Device) logout() {
-	Log.Printf("logout for %s", d.address)
-	request := net2.NewDeviceData(0xa0)
-	request.Command = 0x0e
-	request.Object = 0xfffd
-	request.JobNumber = 0x03
-
-	request.AddParameter(0xFFFFFFFF)
-
-	_ = d.sendDeviceData(request)
+	Log.Printf("logout for %s", d.Address())
+	request := proto.NewDeviceDataBuilder(net2.CommandLogout, net2.ObjectSession).
+		JobNumber(0x03).
+		Parameters(0xFFFFFFFF).
+		Build()
+
+	_ = d.sendDeviceData(context.Background(), request)
+	d.health.setSession(false)
 }
 
-// requestValues from given definition
-func (d *Device) requestValues(ctx context.Context, def InverterValuesDef) (map[ValueID]interface{}, error) {
-	Log.Printf("requestValues for %s: 0x%X 0x%X 0x%X", d.address, def.Object, def.Start, def.End)
-	request := net2.NewDeviceData(0xa0)
-	request.Object = def.Object
-	request.AddParameter(def.Start)
-	request.AddParameter(def.End)
+// requestValues from given definition, returns the values and their timestamps reported by the device
+func (d *Device) requestValues(ctx context.Context, def InverterValuesDef) (map[ValueID]interface{}, map[ValueID]time.Time, error) {
+	Log.Printf("requestValues for %s: 0x%X 0x%X 0x%X", d.Address(), def.Object, def.Start, def.End)
+	request := proto.NewDeviceDataBuilder(net2.CommandGetValues, def.Object).
+		Parameters(def.Start, def.End).
+		Build()
 
-	response, err := d.sendDeviceDataResponse(request, time.Millisecond*500, ctx)
+	response, err := d.sendDeviceDataResponse(ctx, request)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	if response.Status == 0x15 {
-		return nil, nil
+		return nil, nil, nil
 	}
 	if response.Status != 0 {
-		return nil, fmt.Errorf("failed to get values")
+		return nil, nil, fmt.Errorf("failed to get values: %w (status 0x%X)", ErrDeviceBusy, response.Status)
 	}
 
-	return parseInverterValues(response.ResponseValues), nil
+	return parseInverterValues(response.ResponseValues), parseInverterTimestamps(response.ResponseValues), nil
 }
 
 // sendDeviceDataResponse sends the package and wait for response
-func (d *Device) sendDeviceDataResponse(data *net2.DeviceData,
-	resendInterval time.Duration, ctx context.Context) (*net2.DeviceData, error) {
-	for {
+// Responses are correlated by packet ID so multiple requests can be pending at the same time.
+// The request is resent according to the retry policy of the device.
+func (d *Device) sendDeviceDataResponse(ctx context.Context, data *net2.DeviceData) (*net2.DeviceData, error) {
+	address := d.Address().IP.String()
+	response := make(chan *net2.DeviceData, 1)
+	pending, err := d.conn.registerResponse(address, data, response)
+	if err != nil {
+		return nil, err
+	}
+	defer d.conn.unregisterResponse(pending)
+
+	policy := *d.retryPolicy.Load()
+	for attempt := 0; attempt < policy.attempts(); attempt++ {
 		// stop after timeout
 		select {
 		case <-ctx.Done():
-			return nil, fmt.Errorf("no packet received in timeout")
+			return nil, fmt.Errorf("%w: no packet received", ErrTimeout)
 		default:
 		}
 
 		// send request
-		err := d.sendDeviceData(data)
+		err := d.sendDeviceData(ctx, data)
 		if err != nil {
 			return nil, err
 		}
+		sent := time.Now()
 
-		// wait for response
-		receiveCtx, cancel := context.WithTimeout(ctx, resendInterval)
-
-		// wait for package until timeout
-		for {
-			select {
-			case <-receiveCtx.Done():
-				cancel()
-				return nil, fmt.Errorf("no packet received in timeout")
-			default:
-			}
-
-			responseData, err := d.readNet2DeviceData(receiveCtx, data.PacketID)
-			if err != nil {
-				continue // no valid packet
-			}
-			cancel()
+		// wait for response until next attempt
+		timer := time.NewTimer(policy.delay(attempt))
+		select {
+		case responseData := <-response:
+			timer.Stop()
+			d.stats.received(time.Since(sent), attempt > 0)
 			return responseData, nil
+		case <-ctx.Done():
+			timer.Stop()
+			d.stats.sentLost()
+			return nil, fmt.Errorf("%w: no packet received", ErrTimeout)
+		case <-timer.C:
+			d.stats.sentLost()
 		}
 	}
+	d.locate()
+	return nil, fmt.Errorf("%w: no packet received after %d attempts", ErrTimeout, policy.attempts())
 }
 
-// sendDeviceData sends the package
-func (d *Device) sendDeviceData(data *net2.DeviceData) error {
+// sendDeviceData sends the package with the priority and deadline of ctx
+func (d *Device) sendDeviceData(ctx context.Context, data *net2.DeviceData) error {
 	if d.id.SusyID == 0 && d.id.SerialNumber == 0 {
-		data.Destination.SusyID = 0xFFFF
-		data.Destination.SerialNumber = 0xFFFFFFFF
+		data.Destination = net2.BroadcastDeviceId
 	} else {
 		data.Destination = d.id
 	}
+	if id := d.conn.sourceID.Load(); id != nil {
+		data.Source = *id
+	}
 
-	var pack proto.Packet
-	pack.AddEntry(&proto.GroupPacketEntry{
-		Group: 0x00000001,
-	})
-	pack.AddEntry(&proto.SmaNet2PacketEntry{
-		Content: data,
-	})
+	pack := proto.NewPacketBuilder().
+		Group(proto.GroupDefault).
+		Net2(data).
+		Build()
 
-	return d.conn.sendPacket(d.address, &pack)
+	return d.conn.sendPacketCtx(ctx, d.Address(), pack)
 }
 
 // readNet2 read package from Connection
 func (d *Device) readNet2(ctx context.Context) (*proto.SmaNet2PacketEntry, error) {
 	var packet *proto.Packet
 	select {
-	case packet = <-d.receiver:
+	case packet = <-d.receiver.ch:
 	case <-ctx.Done():
-		return nil, fmt.Errorf("device does not respond at %s", d.address.IP.String())
+		return nil, fmt.Errorf("%w: device does not respond at %s", ErrTimeout, d.Address().IP.String())
 	}
 
 	entry := packet.GetEntry(proto.SmaNet2PacketEntryTag)
 	if entry == nil {
-		return nil, fmt.Errorf("received invalid response from %s", d.address.IP.String())
+		return nil, fmt.Errorf("%w: received from %s", ErrInvalidResponse, d.Address().IP.String())
 	}
 
 	return entry.(*proto.SmaNet2PacketEntry), nil
 }
 
-// readNet2DeviceData read package from Connection
-func (d *Device) readNet2DeviceData(ctx context.Context, pkgId uint16) (*net2.DeviceData, error) {
-	entry, err := d.readNet2(ctx)
-	if err != nil {
-		return nil, err
-	}
-
-	responseData, ok := entry.Content.(*net2.DeviceData)
-	if !ok {
-		return nil, fmt.Errorf("invalid data received from %s", d.address.IP.String())
-	}
-
-	if responseData.PacketID != pkgId {
-		return nil, fmt.Errorf("invalid package received from %s (%d)", d.address.IP.String(), responseData.PacketID)
-	}
-
-	return responseData, nil
-}
-
 // clearReceiver channel packages
 func (d *Device) clearReceiver() {
 	for {
 		select {
-		case <-d.receiver:
+		case <-d.receiver.ch:
 		default:
 			return
 		}
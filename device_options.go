@@ -0,0 +1,100 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"time"
+
+	"github.com/pb82/sunny/proto/net2"
+)
+
+// DeviceOption configures a new device
+type DeviceOption func(*deviceConfig)
+
+// deviceConfig of a new device
+type deviceConfig struct {
+	timeout      *time.Duration
+	retryPolicy  *RetryPolicy
+	info         *DeviceInfo
+	identify     bool
+	backpressure Backpressure
+	breaker      *CircuitBreaker
+	// buffer size of received packets (nil -> default of connection)
+	receiverBufferSize *int
+}
+
+// DeviceInfo identifies a device
+type DeviceInfo struct {
+	// ID of the device
+	ID net2.DeviceId
+	// EnergyMeter is true for energy meters
+	EnergyMeter bool
+}
+
+// WithRequestTimeout for requests without context and the identification of the device
+func WithRequestTimeout(timeout time.Duration) DeviceOption {
+	return func(c *deviceConfig) {
+		c.timeout = &timeout
+	}
+}
+
+// WithRetries sets the amount of resends for requests without response
+func WithRetries(retries int) DeviceOption {
+	return func(c *deviceConfig) {
+		policy := DefaultRetryPolicy
+		if c.retryPolicy != nil {
+			policy = *c.retryPolicy
+		}
+		policy.MaxAttempts = retries + 1
+		c.retryPolicy = &policy
+	}
+}
+
+// WithDeviceRetryPolicy for requests of the device
+func WithDeviceRetryPolicy(policy RetryPolicy) DeviceOption {
+	return func(c *deviceConfig) {
+		c.retryPolicy = &policy
+	}
+}
+
+// WithDeviceInfo of an already known device, the device is not identified again
+func WithDeviceInfo(info DeviceInfo) DeviceOption {
+	return func(c *deviceConfig) {
+		c.info = &info
+	}
+}
+
+// WithoutIdentification creates the device without waiting for a response.
+// The serial number stays unknown and requests are broadcast to all devices at the address.
+func WithoutIdentification() DeviceOption {
+	return func(c *deviceConfig) {
+		c.identify = false
+	}
+}
+
+// WithBackpressure sets the policy for received packets if the device does not read them fast enough
+func WithBackpressure(backpressure Backpressure) DeviceOption {
+	return func(c *deviceConfig) {
+		c.backpressure = backpressure
+	}
+}
+
+// Info of the device
+func (d *Device) Info() DeviceInfo {
+	return DeviceInfo{
+		ID:          d.id,
+		EnergyMeter: d.energyMeter,
+	}
+}
@@ -0,0 +1,357 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pb82/sunny"
+	"github.com/pb82/sunny/sunnytest"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestDevice creates a fake inverter with a device connected to it
+func newTestDevice(t *testing.T, options ...sunny.DeviceOption) (*sunnytest.Inverter, *sunny.Device) {
+	t.Helper()
+
+	network := sunnytest.NewNetwork()
+	t.Cleanup(network.Close)
+
+	inverter, err := network.AddInverter("192.168.0.20", 1234, "0000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := network.Connection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	device, err := conn.NewDevice("192.168.0.20", "0000", options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(device.Close)
+	return inverter, device
+}
+
+func TestDevice_concurrentRequests(t *testing.T) {
+	ass := assert.New(t)
+
+	inverter, device := newTestDevice(t)
+	values := map[sunny.ValueID]interface{}{
+		sunny.ActivePowerPlus:   int64(1500),
+		sunny.ActiveEnergyPlus:  int64(3600 * 1000),
+		sunny.DeviceTemperature: 42.5,
+		sunny.UtilityFrequency:  50.01,
+	}
+	inverter.SetValues(values)
+	inverter.SetLatency(10 * time.Millisecond)
+
+	var wg sync.WaitGroup
+	for range 8 {
+		for id, expected := range values {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				value, err := device.GetValue(id)
+				if ass.NoError(err, id) {
+					ass.InDelta(expected, value, 0.01, id)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+}
+
+func TestRegisterInverterValue_whilePolling(t *testing.T) {
+	ass := assert.New(t)
+
+	inverter, device := newTestDevice(t)
+	inverter.SetValue(sunny.ActivePowerPlus, int64(1500))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range 20 {
+			_, err := device.GetValues()
+			ass.NoError(err)
+		}
+	}()
+
+	// registered while values are requested and parsed
+	for i := range 20 {
+		_, err := sunny.RegisterInverterValue(0x5100, 0x00720000, 0x007200FF, uint16(0x7200+i), sunny.ValueDecoder{
+			Name: fmt.Sprintf("PollingTestValue%d", i),
+		})
+		ass.NoError(err)
+	}
+	<-done
+}
+
+func TestDevice_settersWhilePolling(t *testing.T) {
+	ass := assert.New(t)
+
+	inverter, device := newTestDevice(t)
+	inverter.SetValue(sunny.ActivePowerPlus, int64(1500))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range 20 {
+			_, err := device.GetValues()
+			ass.NoError(err)
+		}
+	}()
+
+	// changed while values are requested
+	for range 20 {
+		device.SetPassword("0000")
+		device.SetRetryPolicy(sunny.DefaultRetryPolicy)
+		device.SetTimeout(sunny.DefaultTimeout)
+		device.SetDeltaFilter(nil)
+		device.SetValueCache(nil)
+		device.SetValidator(nil)
+	}
+	<-done
+}
+
+func TestConnection_SetBufferSizes_whileCreatingDevices(t *testing.T) {
+	ass := assert.New(t)
+
+	network := sunnytest.NewNetwork()
+	t.Cleanup(network.Close)
+	_, err := network.AddInverter("192.168.0.20", 1234, "0000")
+	ass.NoError(err)
+	conn, err := network.Connection()
+	ass.NoError(err)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := range 20 {
+			conn.SetBufferSizes(i, i)
+		}
+	}()
+
+	for range 5 {
+		device, err := conn.NewDevice("192.168.0.20", "0000")
+		if ass.NoError(err) {
+			device.Close()
+		}
+	}
+	<-done
+}
+
+func TestDevice_Values(t *testing.T) {
+	ass := assert.New(t)
+
+	inverter, device := newTestDevice(t)
+	inverter.SetValue(sunny.ActivePowerPlus, int64(1500))
+	device.SetTimeout(200 * time.Millisecond)
+
+	values := make(map[sunny.ValueID]sunny.Value)
+	for value, err := range device.Values(context.Background()) {
+		ass.NoError(err)
+		values[value.ID] = value
+	}
+	ass.Equal(uint32(1500), values[sunny.ActivePowerPlus].Raw)
+
+	// failed requests are yielded as error
+	inverter.SetOffline(true)
+	var errs []error
+	for value, err := range device.Values(context.Background()) {
+		if err != nil {
+			errs = append(errs, err)
+			ass.Zero(value)
+		}
+	}
+	if ass.Len(errs, 1) {
+		ass.ErrorIs(errs[0], sunny.ErrTimeout)
+	}
+	ass.False(device.Health().Healthy)
+}
+
+func TestDevice_Values_cache(t *testing.T) {
+	ass := assert.New(t)
+
+	inverter, device := newTestDevice(t)
+	inverter.SetValue(sunny.ActivePowerPlus, int64(1500))
+	device.SetValueCache(sunny.NewValueCache(time.Minute))
+
+	_, err := device.GetValues()
+	ass.NoError(err)
+	requests := inverter.Requests()
+
+	// served from the cache shared with GetValues
+	values := make(map[sunny.ValueID]sunny.Value)
+	for value, err := range device.Values(context.Background()) {
+		ass.NoError(err)
+		values[value.ID] = value
+	}
+	ass.Equal(uint32(1500), values[sunny.ActivePowerPlus].Raw)
+	ass.Equal(requests, inverter.Requests())
+}
+
+func TestDevice_GetTypedValues(t *testing.T) {
+	ass := assert.New(t)
+
+	inverter, device := newTestDevice(t)
+	inverter.SetValue(sunny.ActivePowerPlus, int64(1500))
+
+	values, err := device.GetTypedValues(context.Background())
+	ass.NoError(err)
+	power := values[sunny.ActivePowerPlus]
+	ass.Equal(uint32(1500), power.Raw)
+	ass.True(power.Reported)
+	ass.WithinDuration(time.Now(), power.Timestamp, 2*time.Second)
+
+	// reported timestamps are kept by the cache
+	device.SetValueCache(sunny.NewValueCache(time.Minute))
+	for range 2 {
+		values, err = device.GetTypedValues(context.Background())
+		ass.NoError(err)
+		ass.True(values[sunny.ActivePowerPlus].Reported)
+	}
+}
+
+func TestDevice_GetValues(t *testing.T) {
+	ass := assert.New(t)
+
+	inverter, device := newTestDevice(t)
+	inverter.SetValues(map[sunny.ValueID]interface{}{
+		sunny.ActivePowerPlus: uint32(1500),
+		sunny.DeviceName:      "SN: 1234",
+	})
+	device.SetRetryPolicy(sunny.RetryPolicy{MaxAttempts: 2, InitialDelay: 100 * time.Millisecond})
+
+	// lost request is resent
+	inverter.DropNext(1)
+	values, err := device.GetValues()
+	ass.NoError(err)
+	ass.Equal(uint32(1500), values[sunny.ActivePowerPlus])
+	ass.Equal("SN: 1234", values[sunny.DeviceName])
+
+	// all value groups fail
+	inverter.SetStatus(0x0001)
+	_, err = device.GetValues()
+	var multi *sunny.MultiError
+	ass.ErrorAs(err, &multi)
+	ass.ErrorIs(err, sunny.ErrDeviceBusy)
+}
+
+func TestDevice_GetValues_cache(t *testing.T) {
+	ass := assert.New(t)
+
+	inverter, device := newTestDevice(t)
+	inverter.SetValue(sunny.ActivePowerPlus, uint32(1500))
+	cache := sunny.NewValueCache(time.Minute)
+	device.SetValueCache(cache)
+
+	_, err := device.GetValues()
+	ass.NoError(err)
+
+	// cached values are returned without requests
+	before := settledRequests(inverter)
+	_, err = device.GetValues()
+	ass.NoError(err)
+	ass.Equal(before, inverter.Requests())
+
+	cache.Invalidate()
+	_, err = device.GetValues()
+	ass.NoError(err)
+	perPoll := settledRequests(inverter) - before
+
+	// concurrent callers share one request
+	cache.Invalidate()
+	before = settledRequests(inverter)
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			values, err := device.GetValues()
+			ass.NoError(err)
+			ass.Equal(uint32(1500), values[sunny.ActivePowerPlus])
+		}()
+	}
+	wg.Wait()
+	ass.Equal(before+perPoll, settledRequests(inverter))
+}
+
+// settledRequests of the inverter after the logout (sent without response) arrived
+func settledRequests(inverter *sunnytest.Inverter) int {
+	requests := inverter.Requests()
+	for {
+		time.Sleep(20 * time.Millisecond)
+		current := inverter.Requests()
+		if current == requests {
+			return current
+		}
+		requests = current
+	}
+}
+
+func TestDevice_circuitBreaker(t *testing.T) {
+	ass := assert.New(t)
+
+	inverter, device := newTestDevice(t, sunny.WithCircuitBreaker(2, time.Hour))
+	inverter.SetValue(sunny.ActivePowerPlus, uint32(1500))
+	device.SetRetryPolicy(sunny.RetryPolicy{MaxAttempts: 1, InitialDelay: 50 * time.Millisecond})
+
+	inverter.SetOffline(true)
+	for range 2 {
+		_, err := device.GetValues()
+		ass.ErrorIs(err, sunny.ErrTimeout)
+	}
+	ass.True(device.Health().Tripped)
+
+	// tripped -> no requests until the next probe
+	requests := inverter.Requests()
+	_, err := device.GetValues()
+	ass.ErrorIs(err, sunny.ErrCircuitOpen)
+	ass.Equal(requests, inverter.Requests())
+
+	// successful probe closes the breaker
+	inverter.SetOffline(false)
+	device.SetCircuitBreaker(&sunny.CircuitBreaker{Threshold: 2, ProbeInterval: time.Nanosecond})
+	_, err = device.GetValues()
+	ass.NoError(err)
+	ass.False(device.Health().Tripped)
+}
+
+func TestDevice_GetValuesCtx_rateLimit(t *testing.T) {
+	ass := assert.New(t)
+
+	network := sunnytest.NewNetwork()
+	defer network.Close()
+	inverter, err := network.AddInverter("192.168.0.20", 1234, "0000")
+	ass.NoError(err)
+	inverter.SetValue(sunny.ActivePowerPlus, uint32(1500))
+	conn, err := network.Connection()
+	ass.NoError(err)
+	device, err := conn.NewDevice("192.168.0.20", "0000")
+	ass.NoError(err)
+
+	// the request waits for the rate limit until ctx is done
+	conn.SetRateLimit(2, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = device.GetValuesCtx(ctx)
+	ass.ErrorIs(err, sunny.ErrTimeout)
+	ass.ErrorIs(err, context.DeadlineExceeded)
+}
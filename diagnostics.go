@@ -0,0 +1,153 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// diagnosticsWindow is the amount of seconds the received packets are counted
+const diagnosticsWindow = 60
+
+// Diagnostics of the socket and multicast membership of a connection
+type Diagnostics struct {
+	// Multicast is true if the socket joined the Speedwire multicast group
+	// (false for connections on custom transports)
+	Multicast bool
+	// Group is the multicast group address
+	Group string
+	// Joined is true if the last join of the multicast group succeeded
+	Joined bool
+	// JoinError of the last failed join
+	JoinError error
+	// Interface the socket is bound to (empty for the system default)
+	Interface string
+	// Interfaces the group is joined on in all-interfaces mode
+	Interfaces []string
+	// LocalIP the socket is bound to (nil if not bound explicitly)
+	LocalIP net.IP
+	// PacketsReceived within the last Window
+	PacketsReceived int
+	// Window of PacketsReceived
+	Window time.Duration
+	// LastReceived time of the last received packet
+	LastReceived time.Time
+	// LastSocketError of reading from or writing to the socket
+	LastSocketError error
+	// LastSocketErrorTime is the time of LastSocketError
+	LastSocketErrorTime time.Time
+}
+
+// connectionDiagnostics collects the state for Diagnostics
+type connectionDiagnostics struct {
+	mutex     sync.Mutex
+	multicast bool
+	joined    bool
+	joinError error
+	inf       string
+	localIP   net.IP
+
+	socketError     error
+	socketErrorTime time.Time
+
+	// received packets per second (ring buffer)
+	seconds [diagnosticsWindow]int64
+	counts  [diagnosticsWindow]int
+}
+
+// bound records the multicast binding of the socket
+func (d *connectionDiagnostics) bound(inf *net.Interface, localIP net.IP) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.multicast = true
+	d.joined = true
+	if inf != nil {
+		d.inf = inf.Name
+	}
+	d.localIP = localIP
+}
+
+// joinDone records the result of joining the multicast group
+func (d *connectionDiagnostics) joinDone(err error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.joined = err == nil
+	if err != nil {
+		d.joinError = err
+	}
+}
+
+// failed records a socket error, errors of the closed socket are ignored
+func (d *connectionDiagnostics) failed(err error) {
+	if errors.Is(err, net.ErrClosed) {
+		return
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.socketError = err
+	d.socketErrorTime = time.Now()
+}
+
+// received counts a packet received at the given time
+func (d *connectionDiagnostics) received(now time.Time) {
+	second := now.Unix()
+	index := second % diagnosticsWindow
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.seconds[index] != second {
+		d.seconds[index] = second
+		d.counts[index] = 0
+	}
+	d.counts[index]++
+}
+
+// Diagnostics returns the socket and multicast state of the connection,
+// e.g. to find the reason why discovery finds no devices
+func (c *Connection) Diagnostics() Diagnostics {
+	interfaces := c.memberships.names()
+
+	d := &c.diagnostics
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	diagnostics := Diagnostics{
+		Multicast:           d.multicast,
+		Group:               c.address.String(),
+		Joined:              d.joined,
+		JoinError:           d.joinError,
+		Interface:           d.inf,
+		Interfaces:          interfaces,
+		LocalIP:             d.localIP,
+		Window:              diagnosticsWindow * time.Second,
+		LastReceived:        unixNanoTime(c.lastReceived.Load()),
+		LastSocketError:     d.socketError,
+		LastSocketErrorTime: d.socketErrorTime,
+	}
+
+	oldest := time.Now().Unix() - diagnosticsWindow
+	for i, second := range d.seconds {
+		if second > oldest {
+			diagnostics.PacketsReceived += d.counts[i]
+		}
+	}
+	return diagnostics
+}
@@ -16,12 +16,123 @@ package sunny
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
 	"sync"
 	"time"
 
 	"github.com/pb82/sunny/proto"
 )
 
+// discoverInterval between discovery requests
+const discoverInterval = time.Millisecond * 500
+
+// DefaultDiscoveryParallelism is the amount of devices identified in parallel during discovery
+const DefaultDiscoveryParallelism = 16
+
+// WithDiscoveryParallelism limits the amount of devices identified in parallel during discovery
+func WithDiscoveryParallelism(parallelism int) ConnectionOption {
+	return func(c *connectionConfig) {
+		c.discoveryParallelism = &parallelism
+	}
+}
+
+// SetDiscoveryParallelism limits the amount of devices identified in parallel
+// by discoveries started afterwards (values < 1 -> DefaultDiscoveryParallelism)
+func (c *Connection) SetDiscoveryParallelism(parallelism int) {
+	c.discoveryParallelism.Store(int32(parallelism))
+}
+
+// DiscoveryParallelism returns the amount of devices identified in parallel during discovery
+func (c *Connection) DiscoveryParallelism() int {
+	parallelism := int(c.discoveryParallelism.Load())
+	if parallelism < 1 {
+		return DefaultDiscoveryParallelism
+	}
+	return parallelism
+}
+
+// destinations of discovery requests
+var (
+	// DiscoveryMulticast is the Speedwire multicast group, the default destination
+	DiscoveryMulticast = net.IPv4(239, 12, 255, 254)
+	// DiscoveryLimitedBroadcast reaches all devices of the local network segment,
+	// also if multicast is filtered by switches
+	DiscoveryLimitedBroadcast = net.IPv4bcast
+)
+
+// WithDiscoveryTarget sends discovery requests also to the given address, e.g. the
+// directed broadcast address (192.168.1.255) of networks where multicast is filtered
+func WithDiscoveryTarget(ip net.IP) ConnectionOption {
+	return func(c *connectionConfig) {
+		c.discoveryTargets = append(c.discoveryTargets, ip)
+	}
+}
+
+// WithDiscoveryBroadcast sends discovery requests also to the limited broadcast (255.255.255.255)
+func WithDiscoveryBroadcast() ConnectionOption {
+	return WithDiscoveryTarget(DiscoveryLimitedBroadcast)
+}
+
+// WithDiscoveryDestinations replaces the destinations of discovery requests.
+// The multicast group is only used if it is part of ips (see DiscoveryMulticast).
+func WithDiscoveryDestinations(ips ...net.IP) ConnectionOption {
+	return func(c *connectionConfig) {
+		c.discoveryDestinations = append([]net.IP{}, ips...)
+	}
+}
+
+// SetDiscoveryTargets replaces the additional targets of discovery requests.
+// Requests are always sent to the multicast group.
+func (c *Connection) SetDiscoveryTargets(ips ...net.IP) {
+	c.SetDiscoveryDestinations(append([]net.IP{c.address.IP}, ips...)...)
+}
+
+// SetDiscoveryDestinations replaces all destinations of discovery requests,
+// including the multicast group. Without ips only the multicast group is used.
+func (c *Connection) SetDiscoveryDestinations(ips ...net.IP) {
+	if len(ips) == 0 {
+		ips = []net.IP{c.address.IP}
+	}
+
+	destinations := make([]*net.UDPAddr, 0, len(ips))
+	for _, ip := range ips {
+		if slices.ContainsFunc(destinations, func(address *net.UDPAddr) bool {
+			return address.IP.Equal(ip)
+		}) {
+			continue
+		}
+		destinations = append(destinations, &net.UDPAddr{IP: ip, Port: c.address.Port})
+	}
+
+	c.discoverMutex.Lock()
+	defer c.discoverMutex.Unlock()
+	c.discoveryDestinations = destinations
+}
+
+// DiscoveryDestinations returns the IPs discovery requests are sent to
+func (c *Connection) DiscoveryDestinations() []net.IP {
+	addresses := c.discoveryAddresses()
+	ips := make([]net.IP, 0, len(addresses))
+	for _, address := range addresses {
+		ips = append(ips, address.IP)
+	}
+	return ips
+}
+
+// discoveryAddresses returns all destinations of discovery requests
+func (c *Connection) discoveryAddresses() []*net.UDPAddr {
+	c.discoverMutex.RLock()
+	defer c.discoverMutex.RUnlock()
+
+	if len(c.discoveryDestinations) == 0 {
+		return []*net.UDPAddr{c.address}
+	}
+	return slices.Clone(c.discoveryDestinations)
+}
+
 // SimpleDiscoverDevices in Connection with a simpler interface
 func (c *Connection) SimpleDiscoverDevices(password string) []*Device {
 	// add found devices to list
@@ -39,62 +150,205 @@ func (c *Connection) SimpleDiscoverDevices(password string) []*Device {
 
 	// search for devices
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
-	c.DiscoverDevices(ctx, devices, password)
+	err := c.DiscoverDevices(ctx, devices, password)
 	cancel()
+	if err != nil {
+		Log.Printf("discover failed: %v", err)
+	}
 
 	close(devices)
 	wg.Wait()
 	return deviceList
 }
 
-// DiscoverDevices in Connection
-func (c *Connection) DiscoverDevices(ctx context.Context, devices chan *Device, password string) {
+// DiscoverFunc calls found for each discovered device until ctx is done or found
+// returns false. Calls of found are serialized. Devices discovered after the
+// stop are closed.
+func (c *Connection) DiscoverFunc(ctx context.Context, password string, found func(*Device) bool) error {
+	return c.DiscoverFuncWithCredentials(ctx, StaticCredentials(password), found)
+}
+
+// DiscoverFuncWithCredentials is DiscoverFunc with the given credential provider
+func (c *Connection) DiscoverFuncWithCredentials(ctx context.Context, credentials CredentialProvider, found func(*Device) bool) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	devices := make(chan *Device)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.DiscoverDevicesWithCredentials(ctx, devices, credentials)
+	}()
+
+	stopped := false
+	for {
+		select {
+		case device := <-devices:
+			if stopped {
+				device.Close()
+				continue
+			}
+			if !found(device) {
+				stopped = true
+				cancel()
+			}
+		case err := <-done:
+			return err
+		}
+	}
+}
+
+// DiscoverDevices in Connection until ctx is done.
+// Found devices are sent to the channel. Devices are identified concurrently
+// (see SetDiscoveryParallelism), a slow device does not delay the others.
+// All started goroutines have exited when the function returns; an error is
+// returned if discovery requests can't be sent.
+func (c *Connection) DiscoverDevices(ctx context.Context, devices chan *Device, password string) error {
+	return c.DiscoverDevicesWithCredentials(ctx, devices, StaticCredentials(password))
+}
+
+// DiscoverDevicesWithCredentials in Connection, discovered devices use the given credential provider
+func (c *Connection) DiscoverDevicesWithCredentials(ctx context.Context, devices chan *Device, credentials CredentialProvider) error {
 	var wg sync.WaitGroup
-	knownIps := make(map[string]*Device)
+	knownIps := make(map[string]bool)
+	// devices by serial to detect devices reachable via multiple IPs
+	knownSerials := make(map[uint32]*Device)
 	var knownMutex sync.Mutex
-	ticker := time.NewTicker(time.Millisecond * 500)
+	ticker := time.NewTicker(discoverInterval)
+	defer ticker.Stop()
 
-	discoverCh := make(chan string)
+	// stop pending identifications on return
+	ctx, cancel := context.WithCancel(ctx)
+	defer wg.Wait()
+	defer cancel()
+
+	discoverCh := make(chan string, c.discoveryBufferSize.Load())
 	c.registerDiscoverer(discoverCh)
 	defer c.unregisterDiscoverer(discoverCh)
 
-loop:
+	// fails only if no destination was reached
+	send := func() error {
+		request := proto.NewDiscoveryRequest().Bytes()
+		var errs []error
+		addresses := c.discoveryAddresses()
+		for _, address := range addresses {
+			Log.Printf("send discover package to %s", address)
+			err := c.writeCtx(ctx, request, address)
+			if err != nil {
+				Log.Printf("failed to send discovery request to %s: %v", address, err)
+				errs = append(errs, fmt.Errorf("failed to send discovery request to %s: %w", address, err))
+			}
+		}
+		if len(errs) == len(addresses) {
+			return errors.Join(errs...)
+		}
+		return nil
+	}
+
+	// forget IP to retry on next response
+	forget := func(ip string) {
+		knownMutex.Lock()
+		delete(knownIps, ip)
+		knownMutex.Unlock()
+	}
+
+	// identify device at IP and forward it
+	identify := func(ip string) {
+		device, err := c.NewDeviceWithCredentialsCtx(ctx, ip, credentials)
+		if err != nil {
+			Log.Printf("discover - skip ip %s: %v", ip, err)
+			forget(ip)
+			return
+		}
+
+		knownMutex.Lock()
+		existing, duplicate := knownSerials[device.SerialNumber()]
+		if !duplicate {
+			knownSerials[device.SerialNumber()] = device
+		}
+		knownMutex.Unlock()
+		if duplicate {
+			// prefer the path with the lower latency
+			stats, existingStats := device.Stats(), existing.Stats()
+			faster := stats.Samples > 0 && existingStats.Samples > 0 && stats.MinRTT < existingStats.MinRTT
+			existing.addAddress(device.Address(), faster)
+			device.Close()
+			Log.Printf("discover - device %d also reachable at %s", existing.SerialNumber(), ip)
+			return
+		}
+
+		Log.Printf("found device %d at %s", device.SerialNumber(), ip)
+		c.lastDiscovery.Store(time.Now().UnixNano())
+		select {
+		case devices <- device:
+		case <-ctx.Done():
+			device.Close()
+		}
+	}
+
+	// workers identifying discovered IPs
+	parallelism := c.DiscoveryParallelism()
+	pending := make(chan string)
+	wg.Add(parallelism)
+	for range parallelism {
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case ip := <-pending:
+					identify(ip)
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	err := send()
+	if err != nil {
+		return err
+	}
+
+	// discovered IPs waiting for a worker
+	var queue []string
 	for {
+		var next chan string
+		if len(queue) > 0 {
+			next = pending
+		}
+
 		select {
 		case <-ctx.Done():
-			break loop
+			return nil
+
+		case next <- firstOf(queue):
+			queue = queue[1:]
 
 		// handle received responses
 		case ip := <-discoverCh:
-			wg.Add(1)
-			go func(ip string) {
-				knownMutex.Lock()
-				defer knownMutex.Unlock()
-
-				if _, ok := knownIps[ip]; !ok {
-					device, err := c.NewDevice(ip, password)
-					if err != nil {
-						Log.Printf("discover - skip ip %s: %v", ip, err)
-					} else {
-						Log.Printf("found device %d at %s", device.SerialNumber(), ip)
-						knownIps[ip] = device
-						devices <- device
-					}
-				}
+			knownMutex.Lock()
+			known := knownIps[ip]
+			knownIps[ip] = true
+			knownMutex.Unlock()
+			if known {
+				continue
+			}
 
-				wg.Done()
-			}(ip)
+			queue = append(queue, ip)
 
 		// send discover packages
 		case <-ticker.C:
-			// send discover packet
-			Log.Printf("send discover package")
-			_, err := c.socket.WriteTo(proto.NewDiscoveryRequest().Bytes(), c.address)
+			err := send()
 			if err != nil {
-				Log.Printf("failed to send packet: %w", err)
+				return err
 			}
 		}
 	}
-	ticker.Stop()
-	wg.Wait()
+}
+
+// firstOf returns the first entry of the queue or an empty string
+func firstOf(queue []string) string {
+	if len(queue) == 0 {
+		return ""
+	}
+	return queue[0]
 }
@@ -0,0 +1,57 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pb82/sunny"
+	"github.com/pb82/sunny/sunnytest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnection_DiscoverFunc_slowDevice(t *testing.T) {
+	ass := assert.New(t)
+
+	network := sunnytest.NewNetwork()
+	defer network.Close()
+	connection, err := network.Connection()
+	ass.NoError(err)
+
+	// discovered, but the identification times out
+	slow, err := network.AddInverter("192.168.100.10", 1000, "0000")
+	ass.NoError(err)
+	slow.SetOffline(true)
+
+	// found while the slow device is identified
+	time.AfterFunc(100*time.Millisecond, func() {
+		_, err := network.AddInverter("192.168.100.11", 2000, "0000")
+		ass.NoError(err)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	start := time.Now()
+	var found []uint32
+	err = connection.DiscoverFunc(ctx, "0000", func(device *sunny.Device) bool {
+		found = append(found, device.SerialNumber())
+		return false
+	})
+	ass.NoError(err)
+	ass.Equal([]uint32{2000}, found)
+	ass.Less(time.Since(start), sunny.DefaultTimeout)
+}
@@ -0,0 +1,115 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pb82/sunny/proto"
+	"github.com/pb82/sunny/proto/net2"
+)
+
+// duplicateWindow in which packets with the same sequence number are handled as duplicates
+const duplicateWindow = time.Second * 2
+
+// sequenceKey identifies a packet of a source
+type sequenceKey struct {
+	// energy meter: serial number, device data: packet ID
+	id uint32
+	// energy meter: ticker, device data: packet count
+	sequence uint32
+	meter    bool
+	// command, object and destination of device data, so responses to
+	// different requests with a reused packet ID are kept
+	command     uint8
+	object      uint16
+	destination net2.DeviceId
+	// source of device data, devices behind a Data Manager share the IP
+	source net2.DeviceId
+}
+
+// duplicateFilter tracks sequence numbers per source to detect retransmitted packets
+type duplicateFilter struct {
+	mutex sync.Mutex
+	seen  map[string]map[sequenceKey]time.Time
+
+	suppressed atomic.Uint64
+}
+
+// isDuplicate returns true if the packet was already received from the source within the window
+func (f *duplicateFilter) isDuplicate(srcIp string, packet *proto.Packet) bool {
+	key, ok := packetSequence(packet)
+	if !ok {
+		return false
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.seen == nil {
+		f.seen = make(map[string]map[sequenceKey]time.Time)
+	}
+	source, ok := f.seen[srcIp]
+	if !ok {
+		source = make(map[sequenceKey]time.Time)
+		f.seen[srcIp] = source
+	}
+
+	now := time.Now()
+	if received, ok := source[key]; ok && now.Sub(received) < duplicateWindow {
+		f.suppressed.Add(1)
+		counters.duplicates.Add(1)
+		return true
+	}
+	source[key] = now
+
+	// cleanup outdated entries
+	for k, received := range source {
+		if now.Sub(received) >= duplicateWindow {
+			delete(source, k)
+		}
+	}
+	return false
+}
+
+// packetSequence returns the sequence key of energy meter and device data packets
+func packetSequence(packet *proto.Packet) (sequenceKey, bool) {
+	entry, ok := packet.GetEntry(proto.SmaNet2PacketEntryTag).(*proto.SmaNet2PacketEntry)
+	if !ok {
+		return sequenceKey{}, false
+	}
+
+	switch c := entry.Content.(type) {
+	case *net2.EnergyMeterPacket:
+		return sequenceKey{id: c.Id.SerialNumber, sequence: c.Ticker, meter: true}, true
+	case *net2.DeviceData:
+		return sequenceKey{
+			id:          uint32(c.PacketID),
+			sequence:    uint32(c.PacketCount),
+			command:     c.Command,
+			object:      c.Object,
+			destination: c.Destination,
+			source:      c.Source,
+		}, true
+	}
+	return sequenceKey{}, false
+}
+
+// SuppressedDuplicates returns the amount of dropped duplicate packets
+func (c *Connection) SuppressedDuplicates() uint64 {
+	return c.duplicates.suppressed.Load()
+}
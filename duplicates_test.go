@@ -0,0 +1,95 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pb82/sunny/proto"
+	"github.com/pb82/sunny/proto/net2"
+	"github.com/stretchr/testify/assert"
+)
+
+// net2Packet wraps the content in a packet
+func net2Packet(content proto.SmaNet2SubPacket) *proto.Packet {
+	return proto.NewPacketBuilder().Net2(content).Build()
+}
+
+func TestDuplicateFilter_isDuplicate(t *testing.T) {
+	client := net2.DeviceId{SusyID: 0x7D, SerialNumber: 0x3A28}
+	other := net2.DeviceId{SusyID: 0x7D, SerialNumber: 0x3A29}
+	child := net2.DeviceId{SusyID: 0x0138, SerialNumber: 2001}
+	response := func(packetID, count uint16, object uint16, destination net2.DeviceId) *proto.Packet {
+		return net2Packet(&net2.DeviceData{
+			Destination: destination,
+			PacketID:    packetID,
+			PacketCount: count,
+			Command:     net2.CommandValues,
+			Object:      object,
+		})
+	}
+	meter := func(serial, ticker uint32) *proto.Packet {
+		return net2Packet(&net2.EnergyMeterPacket{Id: net2.DeviceId{SusyID: 349, SerialNumber: serial}, Ticker: ticker})
+	}
+
+	tests := []struct {
+		name      string
+		src       string
+		packet    *proto.Packet
+		duplicate bool
+	}{
+		{"first response", "10.0.0.1", response(1, 0, 0x5100, client), false},
+		{"resent response", "10.0.0.1", response(1, 0, 0x5100, client), true},
+		{"other source", "10.0.0.2", response(1, 0, 0x5100, client), false},
+		{"other fragment", "10.0.0.1", response(1, 1, 0x5100, client), false},
+		{"reused ID for other object", "10.0.0.1", response(1, 0, 0x5200, client), false},
+		{"reused ID for other client", "10.0.0.1", response(1, 0, 0x5100, other), false},
+		{"other device at the same IP", "10.0.0.1", net2Packet(&net2.DeviceData{
+			Source:      child,
+			Destination: client,
+			PacketID:    1,
+			Command:     net2.CommandValues,
+			Object:      0x5100,
+		}), false},
+		{"meter", "10.0.0.3", meter(1000, 5000), false},
+		{"meter resent", "10.0.0.3", meter(1000, 5000), true},
+		{"meter next ticker", "10.0.0.3", meter(1000, 6000), false},
+		{"other packet", "10.0.0.1", proto.NewPacketBuilder().Build(), false},
+	}
+
+	filter := new(duplicateFilter)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.duplicate, filter.isDuplicate(tt.src, tt.packet))
+		})
+	}
+	assert.Equal(t, uint64(2), filter.suppressed.Load())
+}
+
+func TestDuplicateFilter_window(t *testing.T) {
+	ass := assert.New(t)
+
+	filter := new(duplicateFilter)
+	packet := net2Packet(&net2.EnergyMeterPacket{Id: net2.DeviceId{SerialNumber: 1000}, Ticker: 5000})
+	ass.False(filter.isDuplicate("10.0.0.3", packet))
+
+	// received before the window -> not a duplicate
+	for key := range filter.seen["10.0.0.3"] {
+		filter.seen["10.0.0.3"][key] = time.Now().Add(-duplicateWindow)
+	}
+	ass.False(filter.isDuplicate("10.0.0.3", packet))
+	ass.True(filter.isDuplicate("10.0.0.3", packet))
+}
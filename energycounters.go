@@ -0,0 +1,182 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"sync"
+)
+
+// EnergyTotals are the monotonic grid energy counters of a meter in Ws
+type EnergyTotals struct {
+	// Consumption from the grid (ActiveEnergyPlus)
+	Consumption float64
+	// FeedIn into the grid (ActiveEnergyMinus)
+	FeedIn float64
+	// ConsumptionReading and FeedInReading are the last readings of the meter
+	ConsumptionReading float64
+	FeedInReading      float64
+	// Resets of the meter counters handled so far (wrap, reset or swap)
+	Resets int
+}
+
+// EnergyCounters keeps monotonic totals of the grid consumption and feed-in
+// counters of energy meters, so downstream energy accounting is not affected
+// by counter wraps, resets (e.g. after a firmware update) or meter swaps.
+// Totals start at the first reading of a meter.
+type EnergyCounters struct {
+	// MaxStep is the largest plausible increase between two readings in Ws,
+	// larger jumps are handled as meter swap and not counted (0 -> unlimited)
+	MaxStep float64
+	// Modulus of counters that wrap around (0 -> counters don't wrap)
+	Modulus float64
+	// Tolerance of decreasing readings in Ws which are ignored (e.g. rounding)
+	Tolerance float64
+
+	mutex    sync.Mutex
+	counters map[energyCounterKey]*energyCounter
+	resets   map[uint32]int
+	// totals of replaced meters to continue from on the first reading
+	replaced map[energyCounterKey]float64
+}
+
+// energyCounterKey identifies a counter of a meter
+type energyCounterKey struct {
+	serial uint32
+	id     ValueID
+}
+
+// energyCounter is the state of a single counter, the total is last + offset
+type energyCounter struct {
+	last   float64
+	offset float64
+}
+
+// NewEnergyCounters creates counters with the given plausible increase between two readings in Ws (0 -> unlimited)
+func NewEnergyCounters(maxStep float64) *EnergyCounters {
+	return &EnergyCounters{
+		MaxStep:  maxStep,
+		counters: make(map[energyCounterKey]*energyCounter),
+		resets:   make(map[uint32]int),
+		replaced: make(map[energyCounterKey]float64),
+	}
+}
+
+// Update the counters of the meter with its values (e.g. of GetValues) and
+// return the current totals
+func (c *EnergyCounters) Update(serial uint32, values map[ValueID]interface{}) EnergyTotals {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, id := range []ValueID{ActiveEnergyPlus, ActiveEnergyMinus} {
+		value, ok := ToFloat(values[id])
+		if !ok {
+			continue
+		}
+
+		key := energyCounterKey{serial: serial, id: id}
+		counter, ok := c.counters[key]
+		if ok {
+			c.update(serial, counter, value)
+			continue
+		}
+
+		counter = &energyCounter{last: value}
+		if total, ok := c.replaced[key]; ok {
+			counter.offset = total - value
+			delete(c.replaced, key)
+		}
+		c.counters[key] = counter
+	}
+	return c.totals(serial)
+}
+
+// update the counter with a new reading
+func (c *EnergyCounters) update(serial uint32, counter *energyCounter, value float64) {
+	step := value - counter.last
+	switch {
+	case step >= 0 && (c.MaxStep == 0 || step <= c.MaxStep):
+		counter.last = value
+		return
+	case step < 0 && -step <= c.Tolerance:
+		// keep the higher reading
+		return
+	case step < 0 && c.Modulus > 0 && (c.MaxStep == 0 || c.Modulus+step <= c.MaxStep):
+		// wrap around
+		counter.offset += c.Modulus
+	case step < 0 && (c.MaxStep == 0 || value <= c.MaxStep):
+		// reset to 0, the reading is counted
+		counter.offset += counter.last
+	default:
+		// swapped meter, continue from the last total
+		counter.offset -= step
+	}
+	counter.last = value
+	c.resets[serial]++
+}
+
+// Totals of the meter (zero if not known)
+func (c *EnergyCounters) Totals(serial uint32) EnergyTotals {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.totals(serial)
+}
+
+// totals of the meter, the mutex must be locked
+func (c *EnergyCounters) totals(serial uint32) EnergyTotals {
+	totals := EnergyTotals{Resets: c.resets[serial]}
+	if counter, ok := c.counters[energyCounterKey{serial: serial, id: ActiveEnergyPlus}]; ok {
+		totals.Consumption = counter.last + counter.offset
+		totals.ConsumptionReading = counter.last
+	}
+	if counter, ok := c.counters[energyCounterKey{serial: serial, id: ActiveEnergyMinus}]; ok {
+		totals.FeedIn = counter.last + counter.offset
+		totals.FeedInReading = counter.last
+	}
+	return totals
+}
+
+// Restore the totals of the meter (e.g. saved before a restart), energy
+// measured since the saved readings is counted on the next update
+func (c *EnergyCounters) Restore(serial uint32, totals EnergyTotals) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.counters[energyCounterKey{serial: serial, id: ActiveEnergyPlus}] = &energyCounter{
+		last:   totals.ConsumptionReading,
+		offset: totals.Consumption - totals.ConsumptionReading,
+	}
+	c.counters[energyCounterKey{serial: serial, id: ActiveEnergyMinus}] = &energyCounter{
+		last:   totals.FeedInReading,
+		offset: totals.FeedIn - totals.FeedInReading,
+	}
+	c.resets[serial] = totals.Resets
+}
+
+// Replace the meter oldSerial by newSerial, the totals of the old meter are
+// continued from the first reading of the new one
+func (c *EnergyCounters) Replace(oldSerial, newSerial uint32) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	totals := c.totals(oldSerial)
+	for id, total := range map[ValueID]float64{ActiveEnergyPlus: totals.Consumption, ActiveEnergyMinus: totals.FeedIn} {
+		delete(c.counters, energyCounterKey{serial: oldSerial, id: id})
+		delete(c.counters, energyCounterKey{serial: newSerial, id: id})
+		c.replaced[energyCounterKey{serial: newSerial, id: id}] = total
+	}
+	delete(c.resets, oldSerial)
+	c.resets[newSerial] = totals.Resets + 1
+}
@@ -0,0 +1,88 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnergyCounters_Update(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxStep   float64
+		modulus   float64
+		tolerance float64
+		readings  []float64
+		total     float64
+		resets    int
+		lastValue float64
+	}{
+		{"monotonic", 0, 0, 0, []float64{100, 200, 300}, 300, 0, 300},
+		{"tolerance", 0, 0, 5, []float64{100, 97, 150}, 150, 0, 150},
+		{"wrap", 500, 1000, 0, []float64{900, 100, 200}, 1200, 1, 200},
+		{"reset", 500, 0, 0, []float64{900, 50, 150}, 1050, 1, 150},
+		{"swap with higher reading", 500, 0, 0, []float64{900, 5000, 5100}, 1000, 1, 5100},
+		{"swap with lower reading", 100, 0, 0, []float64{5000, 3000, 3050}, 5050, 1, 3050},
+		{"unlimited step", 0, 0, 0, []float64{100, 1e9}, 1e9, 0, 1e9},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ass := assert.New(t)
+
+			counters := NewEnergyCounters(tt.maxStep)
+			counters.Modulus = tt.modulus
+			counters.Tolerance = tt.tolerance
+
+			var totals EnergyTotals
+			for _, reading := range tt.readings {
+				totals = counters.Update(1234, map[ValueID]interface{}{ActiveEnergyPlus: reading})
+			}
+			ass.Equal(tt.total, totals.Consumption)
+			ass.Equal(tt.lastValue, totals.ConsumptionReading)
+			ass.Equal(tt.resets, totals.Resets)
+			ass.Zero(totals.FeedIn)
+			ass.Equal(totals, counters.Totals(1234))
+		})
+	}
+}
+
+func TestEnergyCounters_Restore(t *testing.T) {
+	ass := assert.New(t)
+
+	counters := NewEnergyCounters(0)
+	counters.Restore(1234, EnergyTotals{Consumption: 1000, ConsumptionReading: 400, FeedIn: 50, FeedInReading: 50, Resets: 2})
+
+	// energy since the saved readings is counted
+	totals := counters.Update(1234, map[ValueID]interface{}{ActiveEnergyPlus: 500.0, ActiveEnergyMinus: uint64(60)})
+	ass.Equal(EnergyTotals{Consumption: 1100, ConsumptionReading: 500, FeedIn: 60, FeedInReading: 60, Resets: 2}, totals)
+}
+
+func TestEnergyCounters_Replace(t *testing.T) {
+	ass := assert.New(t)
+
+	counters := NewEnergyCounters(0)
+	counters.Update(1, map[ValueID]interface{}{ActiveEnergyPlus: 1000.0, ActiveEnergyMinus: 200.0})
+	counters.Replace(1, 2)
+	ass.Equal(EnergyTotals{}, counters.Totals(1))
+
+	// the new meter continues from the totals of the old one
+	totals := counters.Update(2, map[ValueID]interface{}{ActiveEnergyPlus: 10.0, ActiveEnergyMinus: 0.0})
+	ass.Equal(EnergyTotals{Consumption: 1000, ConsumptionReading: 10, FeedIn: 200, FeedInReading: 0, Resets: 1}, totals)
+	totals = counters.Update(2, map[ValueID]interface{}{ActiveEnergyPlus: 30.0, ActiveEnergyMinus: 5.0})
+	ass.Equal(1020.0, totals.Consumption)
+	ass.Equal(205.0, totals.FeedIn)
+}
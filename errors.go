@@ -0,0 +1,106 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Errors returned by the package. Use errors.Is to check for them.
+var (
+	// ErrTimeout no response received from the device in time
+	ErrTimeout = errors.New("timeout")
+	// ErrAuthFailed login rejected by the device (e.g. wrong password)
+	ErrAuthFailed = errors.New("authentication failed")
+	// ErrDeviceBusy device rejected the request (e.g. no free session)
+	ErrDeviceBusy = errors.New("device busy")
+	// ErrUnsupportedValue value can not be read from the device
+	ErrUnsupportedValue = errors.New("unsupported value")
+	// ErrInvalidResponse device sent an unexpected response
+	ErrInvalidResponse = errors.New("invalid response")
+	// ErrCircuitOpen request skipped because the device did not respond recently
+	ErrCircuitOpen = errors.New("circuit breaker open")
+)
+
+// GroupError is the failed request of a value group
+type GroupError struct {
+	// Object of the request
+	Object uint16
+	// Start and End of the requested range
+	Start uint32
+	End   uint32
+	// Values of the group
+	Values []ValueID
+	// Err of the request
+	Err error
+}
+
+// Error message of the failed group
+func (e *GroupError) Error() string {
+	return fmt.Sprintf("values 0x%X 0x%X-0x%X: %v", e.Object, e.Start, e.End, e.Err)
+}
+
+// Unwrap returns the error of the request
+func (e *GroupError) Unwrap() error {
+	return e.Err
+}
+
+// MultiError is returned together with the received values if requests of
+// some value groups failed
+type MultiError struct {
+	// Errors of all failed groups
+	Errors []*GroupError
+}
+
+// Error message with all failed groups
+func (e *MultiError) Error() string {
+	messages := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		messages = append(messages, err.Error())
+	}
+	return fmt.Sprintf("%d value groups failed: %s", len(e.Errors), strings.Join(messages, "; "))
+}
+
+// Unwrap returns the errors of all groups
+func (e *MultiError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// Failed returns the values of all failed groups
+func (e *MultiError) Failed() []ValueID {
+	var ids []ValueID
+	for _, err := range e.Errors {
+		ids = append(ids, err.Values...)
+	}
+	return ids
+}
+
+// partialSuccess returns nil for a MultiError if some values were received
+func partialSuccess(err error, received bool) error {
+	var multi *MultiError
+	if received && errors.As(err, &multi) {
+		return nil
+	}
+	return err
+}
+
+// loginStatusInvalidPassword status of a login response with wrong password
+const loginStatusInvalidPassword = 0x0100
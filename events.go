@@ -0,0 +1,186 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"errors"
+	"maps"
+	"sync"
+	"time"
+)
+
+// DefaultDeviceEventBufferSize is the amount of buffered events of Device.Events
+const DefaultDeviceEventBufferSize = 64
+
+// DeviceEventKind classifies events of a device
+type DeviceEventKind int
+
+// kinds of device events
+const (
+	// DeviceSessionEstablished first successful login
+	DeviceSessionEstablished DeviceEventKind = iota
+	// DeviceSessionLost login or request failed after a successful login
+	DeviceSessionLost
+	// DeviceRelogin successful login after the session was lost
+	DeviceRelogin
+	// DeviceValuesUpdated new values received
+	DeviceValuesUpdated
+	// DeviceRequestFailed a request of the device failed
+	DeviceRequestFailed
+)
+
+// String representation of the kind
+func (k DeviceEventKind) String() string {
+	switch k {
+	case DeviceSessionEstablished:
+		return "session-established"
+	case DeviceSessionLost:
+		return "session-lost"
+	case DeviceRelogin:
+		return "relogin"
+	case DeviceValuesUpdated:
+		return "values-updated"
+	case DeviceRequestFailed:
+		return "request-failed"
+	}
+	return "unknown"
+}
+
+// DeviceEvent in the lifecycle of a device
+type DeviceEvent struct {
+	// Kind of the event
+	Kind DeviceEventKind
+	// Serial of the device
+	Serial uint32
+	// Time of the event
+	Time time.Time
+	// Values of DeviceValuesUpdated
+	Values map[ValueID]interface{}
+	// Err of DeviceSessionLost and DeviceRequestFailed
+	Err error
+}
+
+// deviceEvents of a device
+type deviceEvents struct {
+	mutex  sync.Mutex
+	ch     chan DeviceEvent
+	closed bool
+
+	// session state
+	established bool
+	lost        bool
+}
+
+// Events of the device, the channel is closed by Close.
+// Events are dropped if the channel is not ready to receive.
+func (d *Device) Events() <-chan DeviceEvent {
+	d.events.mutex.Lock()
+	defer d.events.mutex.Unlock()
+
+	if d.events.ch == nil {
+		d.events.ch = make(chan DeviceEvent, DefaultDeviceEventBufferSize)
+		if d.events.closed {
+			close(d.events.ch)
+		}
+	}
+	return d.events.ch
+}
+
+// emit an event if Events was called
+func (d *Device) emit(kind DeviceEventKind, values map[ValueID]interface{}, err error) {
+	d.events.mutex.Lock()
+	defer d.events.mutex.Unlock()
+	d.emitLocked(kind, values, err)
+}
+
+// emitLocked sends the event, the events mutex must be held
+func (d *Device) emitLocked(kind DeviceEventKind, values map[ValueID]interface{}, err error) {
+	if d.events.ch == nil || d.events.closed {
+		return
+	}
+
+	select {
+	case d.events.ch <- DeviceEvent{
+		Kind:   kind,
+		Serial: d.id.SerialNumber,
+		Time:   time.Now(),
+		Values: values,
+		Err:    err,
+	}:
+	default:
+		Log.Printf("event listener busy - drop %s event for %s", kind, d.Address())
+	}
+}
+
+// loginDone updates the session state after a login
+func (d *Device) loginDone(err error) {
+	d.events.mutex.Lock()
+	defer d.events.mutex.Unlock()
+
+	switch {
+	case err == nil && !d.events.established:
+		d.events.established = true
+		if d.events.lost {
+			d.emitLocked(DeviceRelogin, nil, nil)
+		} else {
+			d.emitLocked(DeviceSessionEstablished, nil, nil)
+		}
+	case err != nil && d.events.established:
+		d.sessionLost(err)
+	}
+}
+
+// requestDone emits events for the result of a request
+func (d *Device) requestDone(err error) {
+	if err == nil {
+		return
+	}
+
+	d.events.mutex.Lock()
+	defer d.events.mutex.Unlock()
+	d.emitLocked(DeviceRequestFailed, nil, err)
+	if d.events.established && errors.Is(err, ErrTimeout) {
+		d.sessionLost(err)
+	}
+}
+
+// sessionLost marks the session as lost, the events mutex must be held
+func (d *Device) sessionLost(err error) {
+	d.events.established = false
+	d.events.lost = true
+	d.emitLocked(DeviceSessionLost, nil, err)
+}
+
+// valuesUpdated emits the received values
+func (d *Device) valuesUpdated(values map[ValueID]interface{}) {
+	if len(values) == 0 {
+		return
+	}
+	d.emit(DeviceValuesUpdated, maps.Clone(values), nil)
+}
+
+// closeEvents closes the event channel
+func (d *Device) closeEvents() {
+	d.events.mutex.Lock()
+	defer d.events.mutex.Unlock()
+
+	if d.events.closed {
+		return
+	}
+	d.events.closed = true
+	if d.events.ch != nil {
+		close(d.events.ch)
+	}
+}
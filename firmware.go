@@ -0,0 +1,224 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// releaseTypes of inverter firmware versions
+const releaseTypes = "NEABRS"
+
+// FirmwareVersion of a device (e.g. 3.10.18.R)
+type FirmwareVersion struct {
+	Major   uint8
+	Minor   uint8
+	Build   uint8
+	Release string
+}
+
+// String representation of the version
+func (v FirmwareVersion) String() string {
+	if v.Release == "" {
+		return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Build)
+	}
+	return fmt.Sprintf("%d.%d.%d.%s", v.Major, v.Minor, v.Build, v.Release)
+}
+
+// Compare returns -1, 0 or 1 if v is older, equal or newer than other.
+// The release type is ignored.
+func (v FirmwareVersion) Compare(other FirmwareVersion) int {
+	a := int(v.Major)<<16 | int(v.Minor)<<8 | int(v.Build)
+	b := int(other.Major)<<16 | int(other.Minor)<<8 | int(other.Build)
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// ParseFirmwareVersion from its string representation (e.g. "3.10.18.R")
+func ParseFirmwareVersion(s string) (FirmwareVersion, error) {
+	parts := strings.Split(s, ".")
+	if len(parts) < 3 || len(parts) > 4 {
+		return FirmwareVersion{}, fmt.Errorf("invalid firmware version %q", s)
+	}
+
+	var numbers [3]uint8
+	for i := range numbers {
+		n, err := strconv.ParseUint(parts[i], 10, 8)
+		if err != nil {
+			return FirmwareVersion{}, fmt.Errorf("invalid firmware version %q: %w", s, err)
+		}
+		numbers[i] = uint8(n)
+	}
+
+	version := FirmwareVersion{Major: numbers[0], Minor: numbers[1], Build: numbers[2]}
+	if len(parts) == 4 {
+		version.Release = parts[3]
+	}
+	return version, nil
+}
+
+// inverterFirmwareVersion decodes the version value of inverters
+// (BCD major and minor, binary build, release type index)
+func inverterFirmwareVersion(v uint32) FirmwareVersion {
+	bcd := func(b byte) uint8 {
+		return (b>>4)*10 + b&0x0F
+	}
+
+	version := FirmwareVersion{
+		Major: bcd(byte(v >> 24)),
+		Minor: bcd(byte(v >> 16)),
+		Build: uint8(v >> 8),
+	}
+	if release := int(v & 0xFF); release < len(releaseTypes) {
+		version.Release = string(releaseTypes[release])
+	} else {
+		version.Release = strconv.Itoa(release)
+	}
+	return version
+}
+
+// energyMeterFirmwareVersion decodes the version value of energy meters
+// (binary major, minor and build, release type character)
+func energyMeterFirmwareVersion(v uint32) FirmwareVersion {
+	version := FirmwareVersion{
+		Major: uint8(v >> 24),
+		Minor: uint8(v >> 16),
+		Build: uint8(v >> 8),
+	}
+	if release := byte(v); release != 0 {
+		version.Release = string(rune(release))
+	}
+	return version
+}
+
+// FirmwareVersion reads the firmware version of the device
+func (d *Device) FirmwareVersion(ctx context.Context) (FirmwareVersion, error) {
+	value, err := d.GetValueCtx(ctx, SoftwareVersion)
+	if err != nil {
+		return FirmwareVersion{}, err
+	}
+
+	v, ok := value.(uint32)
+	if !ok {
+		return FirmwareVersion{}, fmt.Errorf("%w: firmware version %v", ErrInvalidResponse, value)
+	}
+	if d.energyMeter {
+		return energyMeterFirmwareVersion(v), nil
+	}
+	return inverterFirmwareVersion(v), nil
+}
+
+// Firmware returns the firmware version of the last received values without a request.
+// Energy meters report it in every broadcast, returns false if no version was received yet.
+func (d *Device) Firmware() (FirmwareVersion, bool) {
+	if version := d.firmware.Load(); version != nil {
+		return *version, true
+	}
+	return FirmwareVersion{}, false
+}
+
+// updateFirmware from received values, changes are logged to diagnose
+// firmware specific decoding issues
+func (d *Device) updateFirmware(values map[ValueID]interface{}) {
+	v, ok := values[SoftwareVersion].(uint32)
+	if !ok {
+		return
+	}
+	version := inverterFirmwareVersion(v)
+	if d.energyMeter {
+		version = energyMeterFirmwareVersion(v)
+	}
+
+	previous := d.firmware.Swap(&version)
+	if previous == nil || *previous != version {
+		Log.Printf("device %d at %s reports firmware %s", d.id.SerialNumber, d.Address().IP, version)
+	}
+}
+
+// FirmwareCatalog provides the latest published firmware per device type
+type FirmwareCatalog interface {
+	// LatestFirmware for devices with the given SUSyID, returns false if unknown
+	LatestFirmware(ctx context.Context, susyID uint16) (FirmwareVersion, bool, error)
+}
+
+// FirmwareList is a static FirmwareCatalog, e.g. maintained from the firmware
+// lists published by SMA
+type FirmwareList map[uint16]FirmwareVersion
+
+// LatestFirmware for devices with the given SUSyID
+func (l FirmwareList) LatestFirmware(_ context.Context, susyID uint16) (FirmwareVersion, bool, error) {
+	version, ok := l[susyID]
+	return version, ok, nil
+}
+
+// ReadFirmwareList from JSON mapping the SUSyID to the latest version,
+// e.g. {"128": "3.10.18.R"}
+func ReadFirmwareList(r io.Reader) (FirmwareList, error) {
+	var raw map[string]string
+	err := json.NewDecoder(r).Decode(&raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid firmware list: %w", err)
+	}
+
+	list := make(FirmwareList, len(raw))
+	for key, value := range raw {
+		susyID, err := strconv.ParseUint(key, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SUSyID %q in firmware list: %w", key, err)
+		}
+		list[uint16(susyID)], err = ParseFirmwareVersion(value)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return list, nil
+}
+
+// FirmwareUpdate is the result of a firmware update check
+type FirmwareUpdate struct {
+	// Current version of the device
+	Current FirmwareVersion
+	// Latest published version (zero if unknown)
+	Latest FirmwareVersion
+	// Available is true if the latest version is newer than the current one
+	Available bool
+}
+
+// CheckFirmwareUpdate compares the firmware of the device with the catalog
+func (d *Device) CheckFirmwareUpdate(ctx context.Context, catalog FirmwareCatalog) (FirmwareUpdate, error) {
+	current, err := d.FirmwareVersion(ctx)
+	if err != nil {
+		return FirmwareUpdate{}, err
+	}
+
+	update := FirmwareUpdate{Current: current}
+	latest, ok, err := catalog.LatestFirmware(ctx, d.id.SusyID)
+	if err != nil || !ok {
+		return update, err
+	}
+	update.Latest = latest
+	update.Available = latest.Compare(current) > 0
+	return update, nil
+}
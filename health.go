@@ -0,0 +1,207 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"cmp"
+	"slices"
+	"sync"
+	"time"
+)
+
+// DeviceHealth is the communication state of a device
+type DeviceHealth struct {
+	// Serial of the device
+	Serial uint32
+	// Healthy is true if the last poll succeeded
+	Healthy bool
+	// LastSuccess time of the last successful poll
+	LastSuccess time.Time
+	// LastFailure time of the last failed poll
+	LastFailure time.Time
+	// LastError of the last failed poll
+	LastError error
+	// ConsecutiveFailures since the last successful poll
+	ConsecutiveFailures int
+	// LastSeen time of the last packet received from the device
+	LastSeen time.Time
+	// SessionValid is true while the device is logged in
+	SessionValid bool
+	// Tripped is true while the circuit breaker is open
+	Tripped bool
+}
+
+// deviceHealth tracks the health of a device
+type deviceHealth struct {
+	mutex               sync.Mutex
+	lastSuccess         time.Time
+	lastFailure         time.Time
+	lastError           error
+	consecutiveFailures int
+	sessionValid        bool
+
+	// circuit breaker state
+	breaker             *CircuitBreaker
+	consecutiveTimeouts int
+	lastProbe           time.Time
+
+	listeners []chan DeviceHealth
+}
+
+// pollDone updates the health after a poll, the lock must be held
+func (h *deviceHealth) pollDone(err error) {
+	if err != nil {
+		h.lastFailure = time.Now()
+		h.lastError = err
+		h.consecutiveFailures++
+	} else {
+		h.lastSuccess = time.Now()
+		h.consecutiveFailures = 0
+	}
+	h.updateBreaker(err)
+}
+
+// setSession updates the login state
+func (h *deviceHealth) setSession(valid bool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.sessionValid != valid {
+		if valid {
+			counters.sessions.Add(1)
+		} else {
+			counters.sessions.Add(-1)
+		}
+	}
+	h.sessionValid = valid
+}
+
+// healthy state of the device
+func (h *deviceHealth) healthy() bool {
+	return !h.lastSuccess.IsZero() && h.consecutiveFailures == 0
+}
+
+// Health of the device
+func (d *Device) Health() DeviceHealth {
+	d.health.mutex.Lock()
+	defer d.health.mutex.Unlock()
+	return d.healthLocked()
+}
+
+// healthLocked returns the health of the device, the lock must be held
+func (d *Device) healthLocked() DeviceHealth {
+	return DeviceHealth{
+		Serial:              d.id.SerialNumber,
+		Healthy:             d.health.healthy(),
+		LastSuccess:         d.health.lastSuccess,
+		LastFailure:         d.health.lastFailure,
+		LastError:           d.health.lastError,
+		ConsecutiveFailures: d.health.consecutiveFailures,
+		LastSeen:            d.conn.seen(d.Address().IP.String()),
+		SessionValid:        d.health.sessionValid,
+		Tripped:             d.health.tripped(),
+	}
+}
+
+// RegisterHealthListener for changes of the healthy state of the device.
+// Events are dropped if the channel is not ready to receive.
+func (d *Device) RegisterHealthListener(ch chan DeviceHealth) {
+	d.health.mutex.Lock()
+	defer d.health.mutex.Unlock()
+	d.health.listeners = append(d.health.listeners, ch)
+}
+
+// UnregisterHealthListener for changes of the healthy state
+func (d *Device) UnregisterHealthListener(ch chan DeviceHealth) {
+	d.health.mutex.Lock()
+	defer d.health.mutex.Unlock()
+	d.health.listeners = slices.DeleteFunc(d.health.listeners, func(c chan DeviceHealth) bool {
+		return c == ch
+	})
+}
+
+// pollDone updates the health of the device and notifies listeners on changes
+func (d *Device) pollDone(err error) {
+	d.requestDone(err)
+
+	// transition and listeners of this poll, notified after unlocking
+	d.health.mutex.Lock()
+	healthy := d.health.healthy()
+	d.health.pollDone(err)
+	health := d.healthLocked()
+	listeners := slices.Clone(d.health.listeners)
+	d.health.mutex.Unlock()
+
+	if health.Healthy == healthy {
+		return
+	}
+	for _, ch := range listeners {
+		select {
+		case ch <- health:
+		default:
+			Log.Printf("health listener busy - drop event for %s", d.Address())
+		}
+	}
+}
+
+// ConnectionHealth is the state of a connection and its devices
+type ConnectionHealth struct {
+	// Closed is true after the connection was closed
+	Closed bool
+	// LastReceived time of the last received packet
+	LastReceived time.Time
+	// LastDiscovery time of the last device found by discovery
+	LastDiscovery time.Time
+	// Devices created with the connection
+	Devices []DeviceHealth
+}
+
+// Health of the connection and its devices
+func (c *Connection) Health() ConnectionHealth {
+	health := ConnectionHealth{
+		Closed:        c.isClosed(),
+		LastReceived:  unixNanoTime(c.lastReceived.Load()),
+		LastDiscovery: unixNanoTime(c.lastDiscovery.Load()),
+	}
+	for _, device := range c.deviceList() {
+		health.Devices = append(health.Devices, device.Health())
+	}
+	slices.SortFunc(health.Devices, func(a, b DeviceHealth) int {
+		return cmp.Compare(a.Serial, b.Serial)
+	})
+	return health
+}
+
+// unixNanoTime converts the stored time, zero stays the zero time
+func unixNanoTime(t int64) time.Time {
+	if t == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, t)
+}
+
+// markSeen stores the receive time for the IP
+func (c *Connection) markSeen(srcIp string) {
+	c.seenMutex.Lock()
+	defer c.seenMutex.Unlock()
+	c.lastSeen[srcIp] = time.Now()
+}
+
+// seen returns the time of the last packet received from the IP
+func (c *Connection) seen(srcIp string) time.Time {
+	c.seenMutex.RLock()
+	defer c.seenMutex.RUnlock()
+	return c.lastSeen[srcIp]
+}
@@ -0,0 +1,57 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pb82/sunny"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDevice_healthListener(t *testing.T) {
+	ass := assert.New(t)
+
+	inverter, device := newTestDevice(t)
+	inverter.SetValue(sunny.ActivePowerPlus, int64(1500))
+	device.SetTimeout(200 * time.Millisecond)
+
+	events := make(chan sunny.DeviceHealth, 16)
+	device.RegisterHealthListener(events)
+
+	// concurrent polls report the transition once
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := device.GetValues()
+			ass.NoError(err)
+		}()
+	}
+	wg.Wait()
+	ass.Len(events, 1)
+	ass.True((<-events).Healthy)
+
+	inverter.SetOffline(true)
+	_, err := device.GetValues()
+	ass.Error(err)
+	ass.Len(events, 1)
+	health := <-events
+	ass.False(health.Healthy)
+	ass.Equal(1, health.ConsecutiveFailures)
+}
@@ -0,0 +1,44 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"context"
+)
+
+// Type of the identified device ("energy meter" or "inverter")
+func (i DeviceInfo) Type() string {
+	if i.EnergyMeter {
+		return "energy meter"
+	}
+	return "inverter"
+}
+
+// Identify the device at the given IP without login.
+// Only the Speedwire ping is sent, so no password is required.
+func (c *Connection) Identify(ip string) (DeviceInfo, error) {
+	return c.IdentifyCtx(context.Background(), ip)
+}
+
+// IdentifyCtx identifies the device at the given IP without login, it stops if ctx is done
+func (c *Connection) IdentifyCtx(ctx context.Context, ip string) (DeviceInfo, error) {
+	device, err := c.NewDeviceWithCredentialsCtx(ctx, ip, nil)
+	if err != nil {
+		return DeviceInfo{}, err
+	}
+	defer device.Close()
+
+	return device.Info(), nil
+}
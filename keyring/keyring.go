@@ -0,0 +1,96 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package keyring provides device passwords from the system keyring
+// (Secret Service, macOS Keychain or Windows Credential Manager), so they are
+// not stored in config files.
+package keyring
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/zalando/go-keyring"
+
+	"github.com/pb82/sunny"
+)
+
+// DefaultService is the keyring service of the secrets
+const DefaultService = "sunny"
+
+// Credentials reads the password of a device from the keyring.
+//
+// Passwords are stored with the account "<group>/<serial>" (e.g.
+// "user/1234567890"), the account "<group>" is used for all other devices.
+type Credentials struct {
+	// Service of the secrets in the keyring (DefaultService if empty)
+	Service string
+	// UserGroup for login
+	UserGroup sunny.UserGroup
+}
+
+// Credentials for the device with the given serial number
+func (c Credentials) Credentials(_ context.Context, serial uint32) (sunny.Credentials, error) {
+	password, err := c.lookup(c.UserGroup.String(), serial)
+	if err != nil {
+		return sunny.Credentials{}, err
+	}
+	return sunny.Credentials{Password: password, UserGroup: c.UserGroup}, nil
+}
+
+// GridGuardCode of the device, stored with the account "gridguard/<serial>" or "gridguard"
+func (c Credentials) GridGuardCode(serial uint32) (string, error) {
+	return c.lookup("gridguard", serial)
+}
+
+// lookup the secret of the device or the default of the prefix
+func (c Credentials) lookup(prefix string, serial uint32) (string, error) {
+	service := c.service()
+	secret, err := keyring.Get(service, account(prefix, serial))
+	if errors.Is(err, keyring.ErrNotFound) {
+		secret, err = keyring.Get(service, prefix)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s secret of %d from keyring: %w", prefix, serial, err)
+	}
+	return secret, nil
+}
+
+// service of the secrets
+func (c Credentials) service() string {
+	if c.Service == "" {
+		return DefaultService
+	}
+	return c.Service
+}
+
+// SetPassword of the device in the keyring, serial 0 sets the password for all devices
+func (c Credentials) SetPassword(serial uint32, password string) error {
+	return keyring.Set(c.service(), account(c.UserGroup.String(), serial), password)
+}
+
+// SetGridGuardCode of the device in the keyring, serial 0 sets the code for all devices
+func (c Credentials) SetGridGuardCode(serial uint32, code string) error {
+	return keyring.Set(c.service(), account("gridguard", serial), code)
+}
+
+// account of the secret
+func account(prefix string, serial uint32) string {
+	if serial == 0 {
+		return prefix
+	}
+	return prefix + "/" + strconv.FormatUint(uint64(serial), 10)
+}
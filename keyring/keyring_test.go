@@ -0,0 +1,80 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keyring
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando/go-keyring"
+
+	"github.com/pb82/sunny"
+	"github.com/pb82/sunny/sunnytest"
+)
+
+func TestCredentials(t *testing.T) {
+	ass := assert.New(t)
+	keyring.MockInit()
+
+	credentials := Credentials{UserGroup: sunny.UserGroupInstaller}
+	require.NoError(t, credentials.SetPassword(0, "default"))
+	require.NoError(t, credentials.SetPassword(1234, "device"))
+	require.NoError(t, credentials.SetGridGuardCode(1234, "98765"))
+
+	actual, err := credentials.Credentials(context.Background(), 1234)
+	ass.NoError(err)
+	ass.Equal(sunny.Credentials{Password: "device", UserGroup: sunny.UserGroupInstaller}, actual)
+
+	// default of the user group
+	actual, err = credentials.Credentials(context.Background(), 5678)
+	ass.NoError(err)
+	ass.Equal("default", actual.Password)
+
+	code, err := credentials.GridGuardCode(1234)
+	ass.NoError(err)
+	ass.Equal("98765", code)
+	_, err = credentials.GridGuardCode(5678)
+	ass.ErrorIs(err, keyring.ErrNotFound)
+
+	// secrets of other services and user groups are separate
+	_, err = Credentials{Service: "other", UserGroup: sunny.UserGroupInstaller}.Credentials(context.Background(), 1234)
+	ass.ErrorIs(err, keyring.ErrNotFound)
+	_, err = Credentials{UserGroup: sunny.UserGroupUser}.Credentials(context.Background(), 1234)
+	ass.ErrorIs(err, keyring.ErrNotFound)
+}
+
+func TestCredentials_login(t *testing.T) {
+	ass := assert.New(t)
+	keyring.MockInit()
+
+	network := sunnytest.NewNetwork()
+	defer network.Close()
+	connection, err := network.Connection()
+	require.NoError(t, err)
+	inverter, err := network.AddInverter("192.168.0.20", 1234, "secret")
+	require.NoError(t, err)
+	inverter.SetValue(sunny.ActivePowerPlus, int64(1500))
+
+	credentials := Credentials{UserGroup: sunny.UserGroupUser}
+	require.NoError(t, credentials.SetPassword(1234, "secret"))
+
+	device, err := connection.NewDeviceWithCredentials("192.168.0.20", credentials)
+	require.NoError(t, err)
+	values, err := device.GetValues()
+	ass.NoError(err)
+	ass.EqualValues(1500, values[sunny.ActivePowerPlus])
+}
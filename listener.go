@@ -0,0 +1,167 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"hash/fnv"
+	"net"
+	"runtime"
+	"sync"
+	"time"
+
+	"golang.org/x/net/ipv4"
+)
+
+const (
+	// readBatchSize is the maximum amount of datagrams read with one system call
+	readBatchSize = 16
+	// maxWorkers decoding received packets
+	maxWorkers = 8
+	// workerQueueSize of received packets per worker
+	workerQueueSize = 64
+)
+
+// bufferPool for received datagrams shared by all connections
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 2048)
+		return &b
+	},
+}
+
+// receivedPacket queued for decoding
+type receivedPacket struct {
+	buffer *[]byte
+	n      int
+	src    *net.UDPAddr
+}
+
+// startWorkers decoding received packets.
+// Packets of one IP are always handled by the same worker to keep their order.
+func (c *Connection) startWorkers() {
+	workers := min(max(runtime.GOMAXPROCS(0), 1), maxWorkers)
+	c.workers = make([]chan receivedPacket, workers)
+	for i := range c.workers {
+		c.workers[i] = make(chan receivedPacket, workerQueueSize)
+		c.running.Add(1)
+		go func(queue chan receivedPacket) {
+			defer c.running.Done()
+			c.worker(queue)
+		}(c.workers[i])
+	}
+}
+
+// stopWorkers after the listen loop is done
+func (c *Connection) stopWorkers() {
+	for _, queue := range c.workers {
+		close(queue)
+	}
+}
+
+// worker handles queued packets
+func (c *Connection) worker(queue chan receivedPacket) {
+	for packet := range queue {
+		b := *packet.buffer
+		_ = c.handle(&RawPacket{Direction: RecordReceive, Address: packet.src, Data: b[:packet.n]}, c.process)
+		bufferPool.Put(packet.buffer)
+	}
+}
+
+// dispatch received datagram to the worker of the source IP
+func (c *Connection) dispatch(buffer *[]byte, n int, src *net.UDPAddr) {
+	now := time.Now()
+	c.lastReceived.Store(now.UnixNano())
+	c.diagnostics.received(now)
+	counters.packetsIn.Add(1)
+	c.record(RecordReceive, src, (*buffer)[:n])
+
+	worker := 0
+	if len(c.workers) > 1 {
+		hash := fnv.New32a()
+		_, _ = hash.Write(src.IP)
+		worker = int(hash.Sum32() % uint32(len(c.workers)))
+	}
+	c.workers[worker] <- receivedPacket{buffer: buffer, n: n, src: src}
+}
+
+// listenLoop for received packets
+// UDP sockets read multiple datagrams per system call where supported (recvmmsg on Linux).
+func (c *Connection) listenLoop() {
+	if udp, ok := c.socket.(*net.UDPConn); ok {
+		c.readBatches(ipv4.NewPacketConn(udp))
+		return
+	}
+
+	for !c.isClosed() {
+		c.receive()
+	}
+}
+
+// receive a single datagram and queue it for decoding
+func (c *Connection) receive() {
+	bp := bufferPool.Get().(*[]byte)
+
+	n, addr, err := c.socket.ReadFrom(*bp)
+	if err != nil {
+		bufferPool.Put(bp)
+		// failed to read from udp -> retry
+		c.diagnostics.failed(err)
+		if DetailedPacketLogging.Load() {
+			Log.Printf("DBG: UDP read failed: %v", err)
+		}
+		return
+	}
+	src, ok := addr.(*net.UDPAddr)
+	if !ok {
+		bufferPool.Put(bp)
+		return
+	}
+	c.dispatch(bp, n, src)
+}
+
+// readBatches of datagrams and queue them for decoding
+func (c *Connection) readBatches(conn *ipv4.PacketConn) {
+	messages := make([]ipv4.Message, readBatchSize)
+	buffers := make([]*[]byte, readBatchSize)
+
+	for !c.isClosed() {
+		for i := range messages {
+			if buffers[i] == nil {
+				buffers[i] = bufferPool.Get().(*[]byte)
+			}
+			messages[i].Buffers = [][]byte{*buffers[i]}
+		}
+
+		count, err := conn.ReadBatch(messages, 0)
+		if err != nil {
+			// failed to read from udp -> retry
+			c.diagnostics.failed(err)
+			if DetailedPacketLogging.Load() {
+				Log.Printf("DBG: UDP read failed: %v", err)
+			}
+			continue
+		}
+
+		for i := 0; i < count; i++ {
+			src, ok := messages[i].Addr.(*net.UDPAddr)
+			if !ok {
+				continue
+			}
+			// buffer is owned by the worker now
+			c.dispatch(buffers[i], messages[i].N, src)
+			buffers[i] = nil
+		}
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pb82/sunny/proto"
+	"github.com/pb82/sunny/proto/net2"
+)
+
+// idleConn blocks all reads
+type idleConn struct {
+	closed chan struct{}
+}
+
+func (c *idleConn) ReadFrom([]byte) (int, net.Addr, error) {
+	<-c.closed
+	return 0, nil, net.ErrClosed
+}
+func (c *idleConn) WriteTo(p []byte, _ net.Addr) (int, error) { return len(p), nil }
+func (c *idleConn) Close() error                              { return nil }
+func (c *idleConn) LocalAddr() net.Addr                       { return nil }
+func (c *idleConn) SetDeadline(time.Time) error               { return nil }
+func (c *idleConn) SetReadDeadline(time.Time) error           { return nil }
+func (c *idleConn) SetWriteDeadline(time.Time) error          { return nil }
+
+// BenchmarkConnection_dispatch measures the receive path of energy meter
+// broadcasts of a plant with 40 devices
+func BenchmarkConnection_dispatch(b *testing.B) {
+	const devices = 40
+
+	conn, err := NewPacketConnection(&idleConn{closed: make(chan struct{})})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	addresses := make([]*net.UDPAddr, devices)
+	for i := range addresses {
+		addresses[i] = &net.UDPAddr{IP: net.ParseIP(fmt.Sprintf("192.168.1.%d", i+1)), Port: 9522}
+
+		receiver := newPacketReceiver(16, Backpressure{})
+		conn.registerReceiver(addresses[i].IP.String(), receiver)
+		go func() {
+			for range receiver.ch {
+			}
+		}()
+	}
+
+	data := proto.NewPacketBuilder().
+		Group(proto.GroupDefault).
+		Net2(&net2.EnergyMeterPacket{
+			Id: net2.DeviceId{SusyID: 349, SerialNumber: 1234567890},
+			Values: []*net2.MeasuredData{
+				{OBIS: net2.OBISIdentifier{MeasurementValue: 1, MeasurementType: 4}, Value: uint32(1234)},
+				{OBIS: net2.OBISIdentifier{MeasurementValue: 1, MeasurementType: 8}, Value: uint64(123456789)},
+			},
+		}).
+		Build().
+		Bytes()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		bp := bufferPool.Get().(*[]byte)
+		n := copy(*bp, data)
+		// unique ticker -> packets are no duplicates
+		binary.BigEndian.PutUint32((*bp)[24:], uint32(i))
+		conn.dispatch(bp, n, addresses[i%devices])
+	}
+
+	// wait for decoding of queued packets
+	for _, worker := range conn.workers {
+		for len(worker) > 0 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"sync/atomic"
+)
+
+// DefaultLocale used for descriptions and status texts
+const DefaultLocale = "en"
+
+//go:embed locales/*.json
+var localeFiles embed.FS
+
+// catalogs contains translations per locale
+var catalogs = make(map[string]map[string]string)
+
+// currentLocale selected by SetLocale
+var currentLocale atomic.Value
+
+func init() {
+	currentLocale.Store(DefaultLocale)
+
+	files, err := localeFiles.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+	for _, file := range files {
+		data, err := localeFiles.ReadFile(path.Join("locales", file.Name()))
+		if err != nil {
+			panic(err)
+		}
+
+		catalog := make(map[string]string)
+		err = json.Unmarshal(data, &catalog)
+		if err != nil {
+			panic(fmt.Errorf("invalid locale catalog %s: %w", file.Name(), err))
+		}
+		catalogs[strings.TrimSuffix(file.Name(), ".json")] = catalog
+	}
+}
+
+// Locales returns all available locales
+func Locales() []string {
+	locales := make([]string, 0, len(catalogs))
+	for l := range catalogs {
+		locales = append(locales, l)
+	}
+	slices.Sort(locales)
+	return locales
+}
+
+// SetLocale for descriptions and status texts (e.g. "en" or "de")
+func SetLocale(locale string) error {
+	if _, ok := catalogs[locale]; !ok {
+		return fmt.Errorf("unknown locale %s", locale)
+	}
+	currentLocale.Store(locale)
+	return nil
+}
+
+// Locale returns the selected locale
+func Locale() string {
+	return currentLocale.Load().(string)
+}
+
+// translate key to the given locale, returns an empty string if no translation exists
+func translate(locale, key string) string {
+	if text, ok := catalogs[locale][key]; ok {
+		return text
+	}
+	return catalogs[DefaultLocale][key]
+}
+
+// GetLocalizedValueDescription for value in the given locale.
+// Falls back to the english description if no translation exists.
+func GetLocalizedValueDescription(id ValueID, locale string) string {
+	if text := translate(locale, "value."+id.String()); text != "" {
+		return text
+	}
+	return valueDescription(id).Description
+}
+
+// GetStatusText for a status code (DeviceStatus, DeviceGridRelay, OperatingMode, ...) in the selected locale
+func GetStatusText(code uint32) string {
+	return GetLocalizedStatusText(code, Locale())
+}
+
+// GetLocalizedStatusText for a status code (DeviceStatus, DeviceGridRelay, OperatingMode, ...) in the given locale
+func GetLocalizedStatusText(code uint32, locale string) string {
+	if text := translate(locale, fmt.Sprintf("status.%d", code)); text != "" {
+		return text
+	}
+	return fmt.Sprintf("Status %d", code)
+}
@@ -0,0 +1,164 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/net/ipv4"
+)
+
+// DefaultMembershipCheckInterval used to check the multicast membership
+const DefaultMembershipCheckInterval = time.Second * 30
+
+// MembershipEvent is sent after the multicast group was joined again
+type MembershipEvent struct {
+	// Interface the group was joined on (empty for system default)
+	Interface string
+	// Reason for the refresh
+	Reason string
+	// Err is set if joining the group failed
+	Err error
+}
+
+// WithMembershipCheckInterval sets the interval to check the multicast membership.
+// The group is joined again if the interface state changed or no packet was
+// received within the interval. A value of 0 disables the check.
+func WithMembershipCheckInterval(interval time.Duration) ConnectionOption {
+	return func(c *connectionConfig) {
+		c.membershipInterval = &interval
+	}
+}
+
+// RegisterMembershipListener channel to receive MembershipEvent
+func (c *Connection) RegisterMembershipListener(ch chan MembershipEvent) {
+	c.membershipMutex.Lock()
+	defer c.membershipMutex.Unlock()
+
+	c.membershipChannels = append(c.membershipChannels, ch)
+}
+
+// UnregisterMembershipListener channel
+func (c *Connection) UnregisterMembershipListener(ch chan MembershipEvent) {
+	c.membershipMutex.Lock()
+	defer c.membershipMutex.Unlock()
+
+	c.membershipChannels = slices.DeleteFunc(c.membershipChannels, func(entry chan MembershipEvent) bool {
+		return entry == ch
+	})
+}
+
+// handleMembershipEvent and forward to registered channels
+func (c *Connection) handleMembershipEvent(event MembershipEvent) {
+	c.membershipMutex.RLock()
+	defer c.membershipMutex.RUnlock()
+
+	for _, ch := range c.membershipChannels {
+		select {
+		case ch <- event:
+		default:
+			if DetailedPacketLogging.Load() {
+				Log.Printf("DBG: membership channel busy -> skip event")
+			}
+		}
+	}
+}
+
+// membershipLoop checks the multicast membership periodically
+func (c *Connection) membershipLoop(inf *net.Interface, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	state := interfaceState(inf)
+	for {
+		select {
+		case <-ticker.C:
+		case <-c.closed:
+			return
+		}
+		newState := interfaceState(inf)
+
+		var reason string
+		if newState != state {
+			reason = "interface changed"
+		} else if time.Since(time.Unix(0, c.lastReceived.Load())) > interval {
+			reason = "no packets received"
+		}
+		state = newState
+
+		if reason == "" || strings.HasPrefix(newState, "down") {
+			continue
+		}
+
+		err := c.rejoin(inf)
+		c.diagnostics.joinDone(err)
+		event := MembershipEvent{
+			Reason: reason,
+			Err:    err,
+		}
+		if inf != nil {
+			event.Interface = inf.Name
+		}
+		Log.Printf("rejoin multicast group (%s): %v", reason, err)
+		c.handleMembershipEvent(event)
+	}
+}
+
+// rejoin the multicast group
+func (c *Connection) rejoin(inf *net.Interface) error {
+	socket, ok := c.socket.(*net.UDPConn)
+	if !ok {
+		return fmt.Errorf("socket does not support multicast")
+	}
+
+	if inf != nil {
+		// reload interface (index may change after re-plug)
+		if current, err := net.InterfaceByName(inf.Name); err == nil {
+			inf = current
+		}
+	}
+
+	packetConn := ipv4.NewPacketConn(socket)
+	group := &net.UDPAddr{IP: c.address.IP}
+	_ = packetConn.LeaveGroup(inf, group)
+	return packetConn.JoinGroup(inf, group)
+}
+
+// interfaceState describes flags and addresses of the interface
+func interfaceState(inf *net.Interface) string {
+	if inf == nil {
+		return ""
+	}
+
+	current, err := net.InterfaceByName(inf.Name)
+	if err != nil {
+		return "down: " + err.Error()
+	}
+
+	state := "up"
+	if current.Flags&net.FlagUp == 0 {
+		state = "down"
+	}
+
+	addresses, _ := current.Addrs()
+	for _, address := range addresses {
+		state += " " + address.String()
+	}
+	return state
+}
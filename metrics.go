@@ -0,0 +1,206 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"slices"
+	"sync"
+)
+
+// Metric identifies a value derived from device values
+type Metric string
+
+// derived metrics
+const (
+	// MetricProduction AC power produced by all PV inverters in W
+	MetricProduction Metric = "production"
+	// MetricConsumption power consumed by the household in W
+	MetricConsumption Metric = "consumption"
+	// MetricGridImport power imported from the grid in W
+	MetricGridImport Metric = "grid_import"
+	// MetricGridExport power exported to the grid in W
+	MetricGridExport Metric = "grid_export"
+	// MetricEfficiency DC to AC efficiency of all PV inverters (0-1)
+	MetricEfficiency Metric = "efficiency"
+	// MetricSelfConsumption share of the production consumed locally (0-1)
+	MetricSelfConsumption Metric = "self_consumption"
+	// MetricAutarky share of the consumption not imported from the grid (0-1)
+	MetricAutarky Metric = "autarky"
+	// MetricBatteryEfficiency round-trip efficiency of all batteries since first update (0-1)
+	MetricBatteryEfficiency Metric = "battery_efficiency"
+)
+
+// Metrics contains derived values, metrics that can't be computed are missing
+type Metrics map[Metric]float64
+
+// MetricsEngine derives metrics from the latest values of inverters, batteries and energy meters.
+// Devices reporting a battery charge are handled as battery inverters, their AC power
+// counts as discharge power.
+type MetricsEngine struct {
+	mutex     sync.Mutex
+	inverters map[uint32]map[ValueID]interface{}
+	batteries map[uint32]map[ValueID]interface{}
+	meters    map[uint32]map[ValueID]interface{}
+	// energy counters (charged, discharged) of batteries at first update
+	batteryStart map[uint32][2]float64
+
+	listenersMutex sync.Mutex
+	listeners      []func(Metrics)
+}
+
+// NewMetricsEngine creates an empty metrics engine
+func NewMetricsEngine() *MetricsEngine {
+	return &MetricsEngine{
+		inverters:    make(map[uint32]map[ValueID]interface{}),
+		batteries:    make(map[uint32]map[ValueID]interface{}),
+		meters:       make(map[uint32]map[ValueID]interface{}),
+		batteryStart: make(map[uint32][2]float64),
+	}
+}
+
+// OnUpdate registers a callback receiving the metrics after each update
+func (e *MetricsEngine) OnUpdate(callback func(Metrics)) {
+	e.listenersMutex.Lock()
+	defer e.listenersMutex.Unlock()
+	e.listeners = append(e.listeners, callback)
+}
+
+// Update the latest values of the device and recalculates the metrics
+func (e *MetricsEngine) Update(device *Device, values map[ValueID]interface{}) Metrics {
+	return e.UpdateValues(device.SerialNumber(), device.IsEnergyMeter(), values)
+}
+
+// UpdateValues of the device with the given serial and recalculates the metrics
+func (e *MetricsEngine) UpdateValues(serial uint32, energyMeter bool, values map[ValueID]interface{}) Metrics {
+	e.mutex.Lock()
+	switch {
+	case energyMeter:
+		e.meters[serial] = values
+	case values[BatteryCharge] != nil:
+		e.batteries[serial] = values
+		if _, ok := e.batteryStart[serial]; !ok {
+			charged, okCharged := ToFloat(values[ActiveEnergyMinus])
+			discharged, okDischarged := ToFloat(values[ActiveEnergyPlus])
+			if okCharged && okDischarged {
+				e.batteryStart[serial] = [2]float64{charged, discharged}
+			}
+		}
+	default:
+		e.inverters[serial] = values
+	}
+	metrics := e.calculate()
+	e.mutex.Unlock()
+
+	e.listenersMutex.Lock()
+	listeners := slices.Clone(e.listeners)
+	e.listenersMutex.Unlock()
+	for _, listener := range listeners {
+		listener(metrics)
+	}
+	return metrics
+}
+
+// Metrics calculated from the latest values
+func (e *MetricsEngine) Metrics() Metrics {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.calculate()
+}
+
+// calculate metrics from latest values
+func (e *MetricsEngine) calculate() Metrics {
+	metrics := make(Metrics)
+
+	var production, dcPower float64
+	pvValid, dcValid := len(e.inverters) > 0, len(e.inverters) > 0
+	for _, values := range e.inverters {
+		ac, ok := ToFloat(values[ActivePowerPlus])
+		pvValid = pvValid && ok
+		production += ac
+
+		s1, ok1 := ToFloat(values[PowerS1])
+		s2, ok2 := ToFloat(values[PowerS2])
+		dcValid = dcValid && (ok1 || ok2)
+		dcPower += s1 + s2
+	}
+	if pvValid {
+		metrics[MetricProduction] = production
+		if dcValid && dcPower > 0 {
+			metrics[MetricEfficiency] = production / dcPower
+		}
+	}
+
+	var batteryPower float64
+	batteryValid := true
+	for _, values := range e.batteries {
+		ac, ok := ToFloat(values[ActivePowerPlus])
+		batteryValid = batteryValid && ok
+		batteryPower += ac
+	}
+
+	var gridImport, gridExport float64
+	gridValid := len(e.meters) > 0
+	for _, values := range e.meters {
+		plus, okPlus := ToFloat(values[ActivePowerPlus])
+		minus, okMinus := ToFloat(values[ActivePowerMinus])
+		gridValid = gridValid && okPlus && okMinus
+		gridImport += plus
+		gridExport += minus
+	}
+	if gridValid {
+		metrics[MetricGridImport] = gridImport
+		metrics[MetricGridExport] = gridExport
+	}
+
+	if pvValid && gridValid && batteryValid {
+		consumption := production + batteryPower + gridImport - gridExport
+		if consumption < 0 {
+			// battery charging not visible in AC power
+			consumption = 0
+		}
+		metrics[MetricConsumption] = consumption
+
+		if production > 0 {
+			metrics[MetricSelfConsumption] = clampRatio((production - gridExport) / production)
+		}
+		if consumption > 0 {
+			metrics[MetricAutarky] = clampRatio((consumption - gridImport) / consumption)
+		}
+	}
+
+	var charged, discharged float64
+	for serial, values := range e.batteries {
+		start, ok := e.batteryStart[serial]
+		if !ok {
+			continue
+		}
+		c, okCharged := ToFloat(values[ActiveEnergyMinus])
+		d, okDischarged := ToFloat(values[ActiveEnergyPlus])
+		if okCharged && okDischarged {
+			charged += c - start[0]
+			discharged += d - start[1]
+		}
+	}
+	if charged > 0 {
+		metrics[MetricBatteryEfficiency] = discharged / charged
+	}
+
+	return metrics
+}
+
+// clampRatio to range 0-1
+func clampRatio(ratio float64) float64 {
+	return min(max(ratio, 0), 1)
+}
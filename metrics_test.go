@@ -0,0 +1,134 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsEngine_UpdateValues(t *testing.T) {
+	type update struct {
+		serial      uint32
+		energyMeter bool
+		values      map[ValueID]interface{}
+	}
+	inverter := func(serial uint32, ac uint32) update {
+		return update{serial, false, map[ValueID]interface{}{ActivePowerPlus: ac}}
+	}
+	meter := func(plus, minus uint32) update {
+		return update{3000, true, map[ValueID]interface{}{ActivePowerPlus: plus, ActivePowerMinus: minus}}
+	}
+	battery := func(ac int32, charged, discharged uint64) update {
+		return update{2000, false, map[ValueID]interface{}{
+			BatteryCharge:     uint32(50),
+			ActivePowerPlus:   ac,
+			ActiveEnergyMinus: charged,
+			ActiveEnergyPlus:  discharged,
+		}}
+	}
+	tests := []struct {
+		name    string
+		updates []update
+		metrics Metrics
+	}{
+		{"no devices", nil, Metrics{}},
+		{"inverter", []update{inverter(1000, 800)}, Metrics{MetricProduction: 800}},
+		{"efficiency", []update{{1000, false, map[ValueID]interface{}{
+			ActivePowerPlus: uint32(800), PowerS1: uint32(500), PowerS2: uint32(500),
+		}}}, Metrics{MetricProduction: 800, MetricEfficiency: 0.8}},
+		{"no dc power", []update{{1000, false, map[ValueID]interface{}{
+			ActivePowerPlus: uint32(0), PowerS1: uint32(0),
+		}}}, Metrics{MetricProduction: 0}},
+		{"inverters summed", []update{inverter(1000, 800), inverter(1001, 200)}, Metrics{MetricProduction: 1000}},
+		{"inverter updated", []update{inverter(1000, 800), inverter(1000, 200)}, Metrics{MetricProduction: 200}},
+		{"meter", []update{meter(200, 0)}, Metrics{MetricGridImport: 200, MetricGridExport: 0}},
+		{"exporting", []update{inverter(1000, 1000), meter(0, 400)}, Metrics{
+			MetricProduction:      1000,
+			MetricGridImport:      0,
+			MetricGridExport:      400,
+			MetricConsumption:     600,
+			MetricSelfConsumption: 0.6,
+			MetricAutarky:         1,
+		}},
+		{"importing", []update{inverter(1000, 500), meter(500, 0)}, Metrics{
+			MetricProduction:      500,
+			MetricGridImport:      500,
+			MetricGridExport:      0,
+			MetricConsumption:     1000,
+			MetricSelfConsumption: 1,
+			MetricAutarky:         0.5,
+		}},
+		{"night", []update{inverter(1000, 0), meter(300, 0)}, Metrics{
+			MetricProduction:  0,
+			MetricGridImport:  300,
+			MetricGridExport:  0,
+			MetricConsumption: 300,
+			MetricAutarky:     0,
+		}},
+		{"missing inverter value", []update{{1000, false, map[ValueID]interface{}{}}, meter(300, 0)}, Metrics{
+			MetricGridImport: 300,
+			MetricGridExport: 0,
+		}},
+		{"battery discharging", []update{inverter(1000, 1000), battery(500, 0, 0), meter(0, 0)}, Metrics{
+			MetricProduction:      1000,
+			MetricGridImport:      0,
+			MetricGridExport:      0,
+			MetricConsumption:     1500,
+			MetricSelfConsumption: 1,
+			MetricAutarky:         1,
+		}},
+		{"consumption clamped", []update{inverter(1000, 0), meter(0, 100)}, Metrics{
+			MetricProduction:  0,
+			MetricGridImport:  0,
+			MetricGridExport:  100,
+			MetricConsumption: 0,
+		}},
+		{"battery efficiency", []update{battery(0, 1000, 0), battery(0, 2000, 900)}, Metrics{
+			MetricBatteryEfficiency: 0.9,
+		}},
+		{"battery not charged", []update{battery(0, 1000, 0), battery(0, 1000, 0)}, Metrics{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ass := assert.New(t)
+
+			engine := NewMetricsEngine()
+			metrics := engine.Metrics()
+			for _, u := range tt.updates {
+				metrics = engine.UpdateValues(u.serial, u.energyMeter, u.values)
+			}
+			ass.InDeltaMapValues(tt.metrics, metrics, 1e-9)
+			ass.InDeltaMapValues(tt.metrics, engine.Metrics(), 1e-9)
+		})
+	}
+}
+
+func TestMetricsEngine_OnUpdate(t *testing.T) {
+	ass := assert.New(t)
+
+	engine := NewMetricsEngine()
+	var updates []Metrics
+	engine.OnUpdate(func(metrics Metrics) {
+		updates = append(updates, metrics)
+	})
+	engine.UpdateValues(1000, false, map[ValueID]interface{}{ActivePowerPlus: uint32(800)})
+	engine.UpdateValues(3000, true, map[ValueID]interface{}{ActivePowerPlus: uint32(0), ActivePowerMinus: uint32(300)})
+
+	ass.Len(updates, 2)
+	ass.Equal(Metrics{MetricProduction: 800}, updates[0])
+	ass.InDelta(500.0, updates[1][MetricConsumption], 1e-9)
+}
@@ -0,0 +1,72 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"context"
+	"net"
+	"slices"
+)
+
+// RawPacket is a packet on the send or receive path of a Connection
+type RawPacket struct {
+	// Direction of the packet (RecordSend or RecordReceive)
+	Direction string
+	// Address of the remote side (destination or source)
+	Address *net.UDPAddr
+	// Data of the packet, must not be retained after the handler returns
+	Data []byte
+	// Priority of sent packets
+	Priority Priority
+
+	// context of the request that sends the packet
+	ctx context.Context
+}
+
+// Context of the request that sends the packet (background for received packets)
+func (p *RawPacket) Context() context.Context {
+	if p.ctx == nil {
+		return context.Background()
+	}
+	return p.ctx
+}
+
+// PacketHandler processes a packet
+type PacketHandler func(packet *RawPacket) error
+
+// Middleware wraps the next handler of the chain. It can observe or mutate the
+// packet before calling next or drop it by returning without calling next.
+type Middleware func(next PacketHandler) PacketHandler
+
+// Use adds middleware to the send and receive path of the connection.
+// Middleware is called in the order it was added.
+func (c *Connection) Use(middleware ...Middleware) {
+	c.middlewareMutex.Lock()
+	defer c.middlewareMutex.Unlock()
+	c.middleware = append(c.middleware, middleware...)
+}
+
+// handle packet with all middleware before passing it to final
+func (c *Connection) handle(packet *RawPacket, final PacketHandler) error {
+	c.middlewareMutex.RLock()
+	middleware := slices.Clone(c.middleware)
+	c.middlewareMutex.RUnlock()
+
+	handler := final
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return handler(packet)
+}
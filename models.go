@@ -0,0 +1,99 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// DeviceModel describes the device family of a SUSyID
+type DeviceModel struct {
+	// First SUSyID of the range
+	First uint16
+	// Last SUSyID of the range (inclusive)
+	Last uint16
+	// Family of the devices (e.g. "Sunny Tripower")
+	Family string
+	// Model name (e.g. "Sunny Tripower 10.0"), empty if the range covers several models
+	Model string
+}
+
+// Name of the model or the family if the model is unknown
+func (m DeviceModel) Name() string {
+	if m.Model != "" {
+		return m.Model
+	}
+	return m.Family
+}
+
+// deviceModels maps SUSyID ranges to device families and models.
+// Later entries take precedence over earlier ones.
+var deviceModels = []DeviceModel{
+	{120, 120, "Speedwire client", ""},
+	{270, 270, "SMA Energy Meter", "SMA Energy Meter 1.0"},
+	{349, 349, "SMA Energy Meter", "SMA Energy Meter 2.0"},
+	{372, 372, "Sunny Home Manager", "Sunny Home Manager 2.0"},
+}
+
+// modelsMutex protects deviceModels
+var modelsMutex sync.RWMutex
+
+// LookupModel of a SUSyID, returns false if the SUSyID is unknown
+func LookupModel(susyID uint16) (DeviceModel, bool) {
+	modelsMutex.RLock()
+	defer modelsMutex.RUnlock()
+
+	for i := len(deviceModels) - 1; i >= 0; i-- {
+		if model := deviceModels[i]; susyID >= model.First && susyID <= model.Last {
+			return model, true
+		}
+	}
+	return DeviceModel{}, false
+}
+
+// RegisterModel adds or overrides the model of a SUSyID range
+func RegisterModel(model DeviceModel) error {
+	if model.First > model.Last {
+		return fmt.Errorf("invalid SUSyID range %d-%d", model.First, model.Last)
+	}
+	if model.Family == "" {
+		return fmt.Errorf("missing family of SUSyID range %d-%d", model.First, model.Last)
+	}
+
+	modelsMutex.Lock()
+	defer modelsMutex.Unlock()
+	deviceModels = append(deviceModels, model)
+	return nil
+}
+
+// Models returns all known SUSyID ranges sorted by SUSyID
+func Models() []DeviceModel {
+	modelsMutex.RLock()
+	defer modelsMutex.RUnlock()
+
+	models := slices.Clone(deviceModels)
+	slices.SortStableFunc(models, func(a, b DeviceModel) int {
+		return cmp.Compare(a.First, b.First)
+	})
+	return models
+}
+
+// Model of the identified device, returns false if the SUSyID is unknown
+func (i DeviceInfo) Model() (DeviceModel, bool) {
+	return LookupModel(i.ID.SusyID)
+}
@@ -0,0 +1,205 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pb82/sunny/proto"
+	"github.com/pb82/sunny/proto/net2"
+)
+
+// MonitorEventKind classifies observed packets
+type MonitorEventKind int
+
+// kinds of monitor events
+const (
+	// EventUnknown packet without known content
+	EventUnknown MonitorEventKind = iota
+	// EventDiscovery discovery request or response
+	EventDiscovery
+	// EventEnergyMeter energy meter broadcast
+	EventEnergyMeter
+	// EventRequest device data request
+	EventRequest
+	// EventResponse device data response
+	EventResponse
+	// EventLogin login request or response
+	EventLogin
+	// EventLogout logout request or response
+	EventLogout
+)
+
+// String representation of the kind
+func (k MonitorEventKind) String() string {
+	switch k {
+	case EventDiscovery:
+		return "discovery"
+	case EventEnergyMeter:
+		return "energy-meter"
+	case EventRequest:
+		return "request"
+	case EventResponse:
+		return "response"
+	case EventLogin:
+		return "login"
+	case EventLogout:
+		return "logout"
+	}
+	return "unknown"
+}
+
+// MonitorEvent is an observed packet
+type MonitorEvent struct {
+	// Time the packet was received
+	Time time.Time
+	// Source IP of the packet
+	Source net.IP
+	// Kind of the packet
+	Kind MonitorEventKind
+	// From sending device (device data and energy meter packets)
+	From net2.DeviceId
+	// To addressed device (device data packets)
+	To net2.DeviceId
+	// Command of device data packets
+	Command uint8
+	// Object of device data packets
+	Object uint16
+	// Parameters of device data requests
+	Parameters []uint32
+	// UserGroup of login requests and responses
+	UserGroup UserGroup
+	// Status of device data responses (e.g. 0x0100 for failed logins)
+	Status uint16
+	// Values of responses and energy meter broadcasts
+	Values map[ValueID]interface{}
+	// Packet as received
+	Packet *proto.Packet
+}
+
+// Monitor decodes all packets observed on a connection without sending any packet.
+// Note: unicast traffic between other hosts is only visible with port mirroring.
+type Monitor struct {
+	mutex   sync.Mutex
+	closed  bool
+	events  chan MonitorEvent
+	remove  func()
+	dropped atomic.Uint64
+}
+
+// NewMonitor starts monitoring the connection, size is the amount of buffered events
+func (c *Connection) NewMonitor(size int) *Monitor {
+	m := &Monitor{
+		events: make(chan MonitorEvent, size),
+	}
+	m.remove = c.OnPacket(m.handle)
+	return m
+}
+
+// Events of observed packets, the channel is closed by Close
+func (m *Monitor) Events() <-chan MonitorEvent {
+	return m.events
+}
+
+// Dropped returns the amount of events dropped because the consumer was busy
+func (m *Monitor) Dropped() uint64 {
+	return m.dropped.Load()
+}
+
+// Close stops monitoring
+func (m *Monitor) Close() {
+	m.remove()
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if !m.closed {
+		m.closed = true
+		close(m.events)
+	}
+}
+
+// handle observed packet
+func (m *Monitor) handle(src net.IP, packet *proto.Packet) {
+	event := newMonitorEvent(src, packet)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.closed {
+		return
+	}
+	select {
+	case m.events <- event:
+	default:
+		m.dropped.Add(1)
+	}
+}
+
+// newMonitorEvent decodes the packet into an event
+func newMonitorEvent(src net.IP, packet *proto.Packet) MonitorEvent {
+	event := MonitorEvent{
+		Time:   time.Now(),
+		Source: src,
+		Packet: packet,
+	}
+
+	if packet.GetEntry(proto.DiscoveryRequestPacketEntryTag) != nil ||
+		packet.GetEntry(proto.DiscoveryIPPacketEntryTag) != nil {
+		event.Kind = EventDiscovery
+		return event
+	}
+
+	entry, ok := packet.GetEntry(proto.SmaNet2PacketEntryTag).(*proto.SmaNet2PacketEntry)
+	if !ok {
+		return event
+	}
+
+	switch content := entry.Content.(type) {
+	case *net2.EnergyMeterPacket:
+		event.Kind = EventEnergyMeter
+		event.From = content.Id
+		event.Values = convertEnergyMeterValues(content.GetValues())
+
+	case *net2.DeviceData:
+		event.From = content.Source
+		event.To = content.Destination
+		event.Command = content.Command
+		event.Object = content.Object
+		event.Parameters = content.Parameters
+		if content.Command&0x01 != 0 {
+			event.Status = content.Status
+		}
+
+		// responses use the command of the request with the lowest bit set
+		// (e.g. 0x0D for logins) or the values command for the session object
+		switch {
+		case content.Command&^0x01 == net2.CommandLogout:
+			event.Kind = EventLogout
+		case content.Command&^0x01 == net2.CommandLogin || content.Object == net2.ObjectSession:
+			event.Kind = EventLogin
+			if len(content.Parameters) > 0 && content.Parameters[0] == UserGroupInstaller.loginID() {
+				event.UserGroup = UserGroupInstaller
+			}
+		case content.Command&0x01 != 0:
+			event.Kind = EventResponse
+			event.Values = parseInverterValues(content.ResponseValues)
+		default:
+			event.Kind = EventRequest
+		}
+	}
+	return event
+}
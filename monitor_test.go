@@ -0,0 +1,126 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"net"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pb82/sunny/proto"
+	"github.com/pb82/sunny/proto/net2"
+)
+
+func TestNewMonitorEvent_recording(t *testing.T) {
+	file, err := os.Open("testdata/inverter.jsonl")
+	require.NoError(t, err)
+	defer file.Close()
+	entries, err := ReadRecording(file)
+	require.NoError(t, err)
+
+	inverter := net2.DeviceId{SusyID: 0x0138, SerialNumber: 1234}
+	tests := []struct {
+		name  string
+		entry int
+		kind  MonitorEventKind
+		// status of responses
+		status uint16
+		// addressed device of requests (inverter if empty)
+		to net2.DeviceId
+	}{
+		{name: "ping", entry: 0, kind: EventRequest, to: net2.DeviceId{SusyID: 0xFFFF, SerialNumber: 0xFFFFFFFF}},
+		{name: "ping response", entry: 1, kind: EventResponse},
+		{name: "login", entry: 2, kind: EventLogin},
+		{name: "login response", entry: 3, kind: EventLogin},
+		{name: "values request", entry: 4, kind: EventRequest},
+		{name: "values response without data", entry: 5, kind: EventResponse, status: 0x15},
+		{name: "logout", entry: len(entries) - 1, kind: EventLogout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ass := assert.New(t)
+
+			entry := entries[tt.entry]
+			var packet proto.Packet
+			require.NoError(t, packet.Read(entry.Data))
+			event := newMonitorEvent(net.IPv4(192, 168, 0, 20), &packet)
+
+			ass.Equal(tt.kind, event.Kind)
+			ass.Equal(tt.status, event.Status)
+			if entry.Direction == RecordSend {
+				to := tt.to
+				if to == (net2.DeviceId{}) {
+					to = inverter
+				}
+				ass.Equal(to, event.To)
+			} else {
+				ass.Equal(inverter, event.From)
+			}
+			if tt.kind == EventLogin {
+				ass.Equal(UserGroupUser, event.UserGroup)
+				ass.Nil(event.Values)
+			}
+		})
+	}
+}
+
+func TestNewMonitorEvent(t *testing.T) {
+	response := func(command uint8, object uint16, status uint16, params ...uint32) *proto.Packet {
+		data := proto.NewDeviceDataBuilder(command, object).
+			Control(net2.ControlArchiveRequest).
+			Parameters(params...).
+			Build()
+		data.Status = status
+		return proto.NewPacketBuilder().Group(proto.GroupDefault).Net2(data).Build()
+	}
+	tests := []struct {
+		name      string
+		packet    *proto.Packet
+		kind      MonitorEventKind
+		status    uint16
+		userGroup UserGroup
+	}{
+		{name: "discovery", packet: proto.NewDiscoveryRequest(), kind: EventDiscovery},
+		{name: "unknown", packet: proto.NewPacketBuilder().Group(proto.GroupDefault).Build(), kind: EventUnknown},
+		{
+			name:      "installer login",
+			packet:    proto.NewDeviceDataBuilder(net2.CommandLogin, net2.ObjectSession).Parameters(10, 900).Packet(),
+			kind:      EventLogin,
+			userGroup: UserGroupInstaller,
+		},
+		{name: "login response", packet: response(net2.CommandLogin|0x01, net2.ObjectSession, 0, 7), kind: EventLogin},
+		{
+			name:   "failed login",
+			packet: response(net2.CommandLogin|0x01, net2.ObjectSession, 0x0100, 10),
+			kind:   EventLogin, status: 0x0100, userGroup: UserGroupInstaller,
+		},
+		{name: "logout response", packet: response(net2.CommandLogout|0x01, net2.ObjectSession, 0), kind: EventLogout},
+		{name: "values response", packet: response(net2.CommandValues, 0x5100, 0x15), kind: EventResponse, status: 0x15},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ass := assert.New(t)
+
+			event := newMonitorEvent(net.IPv4(192, 168, 0, 20), tt.packet)
+			ass.Equal(tt.kind, event.Kind)
+			ass.Equal(tt.status, event.Status)
+			ass.Equal(tt.userGroup, event.UserGroup)
+			ass.Same(tt.packet, event.Packet)
+		})
+	}
+}
@@ -0,0 +1,237 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"runtime"
+	"syscall"
+	"time"
+
+	"github.com/pb82/sunny/proto/net2"
+	"golang.org/x/net/ipv4"
+)
+
+// ConnectionOption configures a new Connection
+type ConnectionOption func(*connectionConfig)
+
+// connectionConfig contains all options of a Connection
+type connectionConfig struct {
+	// index of interface to bind (0 -> not set)
+	interfaceIndex int
+	// local IP to bind
+	localIP net.IP
+	// enable SO_REUSEPORT on the socket
+	reusePort bool
+	// DSCP of sent packets (nil -> system default)
+	dscp *int
+	// interval to check multicast membership (nil -> default)
+	membershipInterval *time.Duration
+	// buffer sizes of channels (nil -> default)
+	receiverBufferSize  *int
+	discoveryBufferSize *int
+	// additional targets of discovery requests
+	discoveryTargets []net.IP
+	// destinations of discovery requests replacing the multicast group (nil -> default)
+	discoveryDestinations []net.IP
+	// devices identified in parallel during discovery (nil -> default)
+	discoveryParallelism *int
+	// size of the asynchronous send queue (nil -> synchronous)
+	sendQueueSize *int
+	// sender of requests (nil -> derived from local IP)
+	sourceID *net2.DeviceId
+	// re-bind devices answering from a new IP
+	addressTracking bool
+	// join the multicast group on all interfaces
+	allInterfaces bool
+}
+
+// key identifies connections with the same options
+func (c *connectionConfig) key() string {
+	dscp := -1
+	if c.dscp != nil {
+		dscp = *c.dscp
+	}
+	return fmt.Sprintf("%d/%s/%t/%d/%t", c.interfaceIndex, c.localIP, c.reusePort, dscp, c.allInterfaces)
+}
+
+// explicitBinding returns true if the socket has to be bound explicitly
+func (c *connectionConfig) explicitBinding() bool {
+	return c.interfaceIndex != 0 || c.localIP != nil || c.reusePort
+}
+
+// WithInterfaceIndex binds the multicast membership explicitly to the interface with the given index
+func WithInterfaceIndex(index int) ConnectionOption {
+	return func(c *connectionConfig) {
+		c.interfaceIndex = index
+	}
+}
+
+// WithLocalIP binds the connection to the interface with the given local IPv4 address.
+// This is the most reliable way to select an adapter on Windows hosts.
+func WithLocalIP(ip net.IP) ConnectionOption {
+	return func(c *connectionConfig) {
+		c.localIP = ip
+	}
+}
+
+// WithReusePort enables SO_REUSEPORT (and SO_REUSEADDR) on the socket, so other
+// Speedwire consumers (e.g. SBFspot) can listen on port 9522 of the same host.
+// Multicast packets are received by all sockets, but unicast responses are only
+// delivered to one of them. Not supported on Windows.
+func WithReusePort() ConnectionOption {
+	return func(c *connectionConfig) {
+		c.reusePort = true
+	}
+}
+
+// WithDSCP marks all sent packets with the given DSCP (0-63), e.g. 46 (EF) to
+// prioritize control traffic on managed networks
+func WithDSCP(dscp int) ConnectionOption {
+	return func(c *connectionConfig) {
+		c.dscp = &dscp
+	}
+}
+
+// setDSCP on the socket
+func setDSCP(socket net.PacketConn, dscp int) error {
+	if dscp < 0 || dscp > 63 {
+		return fmt.Errorf("invalid DSCP %d", dscp)
+	}
+	err := ipv4.NewPacketConn(socket).SetTOS(dscp << 2)
+	if err != nil {
+		return fmt.Errorf("failed to set DSCP: %w", err)
+	}
+	return nil
+}
+
+// interfaceByIP returns the interface with the given address
+func interfaceByIP(ip net.IP) (*net.Interface, error) {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range interfaces {
+		addresses, err := interfaces[i].Addrs()
+		if err != nil {
+			continue
+		}
+		for _, address := range addresses {
+			if network, ok := address.(*net.IPNet); ok && network.IP.Equal(ip) {
+				return &interfaces[i], nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no interface with address %s", ip)
+}
+
+// interfaceByNetwork returns the interface with an address in the given network
+// and this address
+func interfaceByNetwork(network *net.IPNet) (*net.Interface, net.IP, error) {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for i := range interfaces {
+		addresses, err := interfaces[i].Addrs()
+		if err != nil {
+			continue
+		}
+		for _, address := range addresses {
+			if ipNet, ok := address.(*net.IPNet); ok && ipNet.IP.To4() != nil && network.Contains(ipNet.IP) {
+				return &interfaces[i], ipNet.IP, nil
+			}
+		}
+	}
+	return nil, nil, fmt.Errorf("no interface in network %s", network)
+}
+
+// resolveInterface converts a local IP or CIDR passed as interface name into
+// the local IP option and returns the remaining interface name
+func resolveInterface(inf string, config *connectionConfig) (string, error) {
+	if ip := net.ParseIP(inf); ip != nil {
+		config.localIP = ip
+		return "", nil
+	}
+	if _, network, err := net.ParseCIDR(inf); err == nil {
+		_, ip, err := interfaceByNetwork(network)
+		if err != nil {
+			return "", err
+		}
+		config.localIP = ip
+		return "", nil
+	}
+	return inf, nil
+}
+
+// listenMulticastExplicit creates a socket that joins the multicast group
+// on an explicitly selected interface.
+func listenMulticastExplicit(inf *net.Interface, config *connectionConfig, group *net.UDPAddr) (net.PacketConn, error) {
+	var err error
+	if config.interfaceIndex != 0 {
+		inf, err = net.InterfaceByIndex(config.interfaceIndex)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if config.localIP != nil && inf == nil {
+		inf, err = interfaceByIP(config.localIP)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// windows requires to bind the local address to receive on the right adapter,
+	// other systems only receive multicast packets on the unspecified address
+	listen := fmt.Sprintf(":%d", group.Port)
+	if runtime.GOOS == "windows" && config.localIP != nil {
+		listen = net.JoinHostPort(config.localIP.String(), fmt.Sprint(group.Port))
+	}
+
+	socket, err := listenUDP4(config, listen)
+	if err != nil {
+		return nil, err
+	}
+
+	packetConn := ipv4.NewPacketConn(socket)
+	err = packetConn.JoinGroup(inf, &net.UDPAddr{IP: group.IP})
+	if err != nil {
+		_ = socket.Close()
+		return nil, fmt.Errorf("failed to join multicast group: %w", err)
+	}
+	if inf != nil {
+		err = packetConn.SetMulticastInterface(inf)
+		if err != nil {
+			_ = socket.Close()
+			return nil, fmt.Errorf("failed to set multicast interface: %w", err)
+		}
+	}
+	return socket, nil
+}
+
+// listenUDP4 creates an IPv4 UDP socket on the given address
+func listenUDP4(config *connectionConfig, listen string) (net.PacketConn, error) {
+	var listenConfig net.ListenConfig
+	if config.reusePort {
+		listenConfig.Control = func(_, _ string, conn syscall.RawConn) error {
+			return setReusePort(conn)
+		}
+	}
+	return listenConfig.ListenPacket(context.Background(), "udp4", listen)
+}
@@ -0,0 +1,67 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"net"
+	"slices"
+
+	"github.com/pb82/sunny/proto"
+)
+
+// PacketObserver is called for every decoded packet
+type PacketObserver func(src net.IP, packet *proto.Packet)
+
+// packetObserver registration
+type packetObserver struct {
+	fn PacketObserver
+}
+
+// OnPacket registers an observer for every decoded packet, independent of
+// registered devices. Observers are called on the receive path and must not block.
+// The returned function removes the observer.
+func (c *Connection) OnPacket(observer PacketObserver) func() {
+	registration := &packetObserver{fn: observer}
+
+	c.observerMutex.Lock()
+	defer c.observerMutex.Unlock()
+	c.observers = append(slices.Clone(c.observers), registration)
+
+	return func() {
+		c.observerMutex.Lock()
+		defer c.observerMutex.Unlock()
+		c.observers = slices.DeleteFunc(slices.Clone(c.observers), func(o *packetObserver) bool {
+			return o == registration
+		})
+	}
+}
+
+// hasObservers checks if any observer is registered
+func (c *Connection) hasObservers() bool {
+	c.observerMutex.RLock()
+	defer c.observerMutex.RUnlock()
+	return len(c.observers) > 0
+}
+
+// observe packet with all registered observers
+func (c *Connection) observe(src net.IP, packet *proto.Packet) {
+	c.observerMutex.RLock()
+	observers := c.observers
+	c.observerMutex.RUnlock()
+
+	for _, observer := range observers {
+		observer.fn(src, packet)
+	}
+}
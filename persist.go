@@ -0,0 +1,123 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/pb82/sunny/proto/net2"
+)
+
+// DeviceRecord is the persisted identity of a device
+type DeviceRecord struct {
+	// Serial number of the device
+	Serial uint32 `json:"serial"`
+	// SusyID of the device
+	SusyID uint16 `json:"susyId"`
+	// Address (IP) of the device
+	Address string `json:"address"`
+	// EnergyMeter is true for energy meters
+	EnergyMeter bool `json:"energyMeter,omitempty"`
+}
+
+// SaveDevices writes the identity of all devices of the connection as JSON.
+// Passwords are not written, devices get their credentials on restore.
+func (c *Connection) SaveDevices(w io.Writer) error {
+	records := make([]DeviceRecord, 0)
+	for _, device := range c.deviceList() {
+		if device.id.SerialNumber == 0 {
+			continue // not identified
+		}
+		records = append(records, DeviceRecord{
+			Serial:      device.id.SerialNumber,
+			SusyID:      device.id.SusyID,
+			Address:     device.Address().IP.String(),
+			EnergyMeter: device.energyMeter,
+		})
+	}
+	slices.SortFunc(records, func(a, b DeviceRecord) int {
+		return cmp.Compare(a.Serial, b.Serial)
+	})
+	records = slices.CompactFunc(records, func(a, b DeviceRecord) bool {
+		return a.Serial == b.Serial && a.EnergyMeter == b.EnergyMeter
+	})
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(records)
+}
+
+// SaveDevicesFile writes the identity of all devices to the file (see SaveDevices).
+// The file is replaced atomically.
+func (c *Connection) SaveDevicesFile(path string) error {
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	err = c.SaveDevices(file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+// RestoreDevices creates the devices written by SaveDevices without waiting for
+// their identification, so polling can resume immediately
+func (c *Connection) RestoreDevices(r io.Reader, credentials CredentialProvider, options ...DeviceOption) ([]*Device, error) {
+	var records []DeviceRecord
+	err := json.NewDecoder(r).Decode(&records)
+	if err != nil {
+		return nil, fmt.Errorf("invalid device records: %w", err)
+	}
+
+	devices := make([]*Device, 0, len(records))
+	for _, record := range records {
+		info := DeviceInfo{
+			ID:          net2.DeviceId{SusyID: record.SusyID, SerialNumber: record.Serial},
+			EnergyMeter: record.EnergyMeter,
+		}
+		device, err := c.NewDeviceWithCredentials(record.Address, credentials, append(slices.Clone(options), WithDeviceInfo(info))...)
+		if err != nil {
+			for _, d := range devices {
+				d.Close()
+			}
+			return nil, fmt.Errorf("failed to restore device %d: %w", record.Serial, err)
+		}
+		devices = append(devices, device)
+	}
+	return devices, nil
+}
+
+// RestoreDevicesFile creates the devices of the file written by SaveDevicesFile
+func (c *Connection) RestoreDevicesFile(path string, credentials CredentialProvider, options ...DeviceOption) ([]*Device, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return c.RestoreDevices(file, credentials, options...)
+}
@@ -0,0 +1,92 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny_test
+
+import (
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pb82/sunny"
+	"github.com/pb82/sunny/proto/net2"
+	"github.com/pb82/sunny/sunnytest"
+)
+
+func TestConnection_SaveDevicesFile(t *testing.T) {
+	ass := assert.New(t)
+
+	network := sunnytest.NewNetwork()
+	defer network.Close()
+	inverter, err := network.AddInverter("192.168.0.20", 1234, "0000")
+	require.NoError(t, err)
+	inverter.SetValue(sunny.ActivePowerPlus, int64(1500))
+	_, err = network.AddEnergyMeter("192.168.0.30", net2.DeviceId{SusyID: 0x015D, SerialNumber: 1000})
+	require.NoError(t, err)
+
+	connection, err := network.Connection()
+	require.NoError(t, err)
+	_, err = connection.NewDevice("192.168.0.20", "0000")
+	require.NoError(t, err)
+	_, err = connection.NewDevice("192.168.0.30", "")
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "devices.json")
+	require.NoError(t, connection.SaveDevicesFile(path))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var records []sunny.DeviceRecord
+	require.NoError(t, json.Unmarshal(data, &records))
+	ass.Equal([]sunny.DeviceRecord{
+		{Serial: 1000, SusyID: 0x015D, Address: "192.168.0.30", EnergyMeter: true},
+		{Serial: 1234, SusyID: sunnytest.DefaultSusyID, Address: "192.168.0.20"},
+	}, records)
+	ass.NotContains(string(data), "0000", "passwords are not saved")
+
+	// restored without identification of the offline inverter
+	restoring, err := network.ConnectionAt(net.IPv4(192, 168, 0, 3))
+	require.NoError(t, err)
+	inverter.SetOffline(true)
+	devices, err := restoring.RestoreDevicesFile(path, sunny.StaticCredentials("0000"))
+	require.NoError(t, err)
+	require.Len(t, devices, 2)
+	ass.True(devices[0].IsEnergyMeter())
+	ass.Equal(uint32(1234), devices[1].SerialNumber())
+	ass.False(devices[1].IsEnergyMeter())
+
+	inverter.SetOffline(false)
+	values, err := devices[1].GetValues()
+	ass.NoError(err)
+	ass.EqualValues(1500, values[sunny.ActivePowerPlus])
+}
+
+func TestConnection_RestoreDevices_invalid(t *testing.T) {
+	ass := assert.New(t)
+
+	network := sunnytest.NewNetwork()
+	defer network.Close()
+	connection, err := network.Connection()
+	require.NoError(t, err)
+
+	_, err = connection.RestoreDevices(strings.NewReader("{"), sunny.StaticCredentials("0000"))
+	ass.ErrorContains(err, "invalid device records")
+	_, err = connection.RestoreDevicesFile(filepath.Join(t.TempDir(), "missing.json"), sunny.StaticCredentials("0000"))
+	ass.ErrorIs(err, os.ErrNotExist)
+}
@@ -0,0 +1,49 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"context"
+)
+
+// Priority of sent requests, packets with higher priority are sent first if
+// the connection is rate limited
+type Priority int
+
+// priority levels
+const (
+	// PriorityLow for bulk requests (e.g. archive downloads)
+	PriorityLow Priority = -1
+	// PriorityNormal default priority
+	PriorityNormal Priority = 0
+	// PriorityHigh for control commands (e.g. power limits)
+	PriorityHigh Priority = 1
+)
+
+// priorityKey is the context key of the request priority
+type priorityKey struct{}
+
+// WithPriority returns a context whose requests are sent with the given priority
+func WithPriority(ctx context.Context, priority Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, priority)
+}
+
+// priorityFrom returns the priority of the context (PriorityNormal if not set)
+func priorityFrom(ctx context.Context) Priority {
+	if priority, ok := ctx.Value(priorityKey{}).(Priority); ok {
+		return priority
+	}
+	return PriorityNormal
+}
@@ -0,0 +1,84 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPriorityFrom(t *testing.T) {
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		priority Priority
+	}{
+		{"default", context.Background(), PriorityNormal},
+		{"low", WithPriority(context.Background(), PriorityLow), PriorityLow},
+		{"high", WithPriority(context.Background(), PriorityHigh), PriorityHigh},
+		{"overridden", WithPriority(WithPriority(context.Background(), PriorityHigh), PriorityLow), PriorityLow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.priority, priorityFrom(tt.ctx))
+		})
+	}
+}
+
+func TestRateLimiter_preempted(t *testing.T) {
+	tests := []struct {
+		name      string
+		waiting   map[Priority]int
+		priority  Priority
+		preempted bool
+	}{
+		{"no waiting senders", nil, PriorityLow, false},
+		{"higher priority waiting", map[Priority]int{PriorityHigh: 1}, PriorityNormal, true},
+		{"same priority waiting", map[Priority]int{PriorityNormal: 2}, PriorityNormal, false},
+		{"lower priority waiting", map[Priority]int{PriorityLow: 1}, PriorityHigh, false},
+		{"higher priority done", map[Priority]int{PriorityHigh: 0}, PriorityLow, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := rateLimiter{waiting: tt.waiting}
+			assert.Equal(t, tt.preempted, limiter.preempted(tt.priority))
+		})
+	}
+}
+
+func TestRateLimiter_wait_priority(t *testing.T) {
+	ass := assert.New(t)
+
+	var limiter rateLimiter
+	limiter.set(20, 1)
+	ass.NoError(limiter.wait(context.Background(), PriorityNormal))
+
+	// the low priority sender waits first, but the high priority one is served first
+	order := make(chan Priority, 2)
+	go func() {
+		ass.NoError(limiter.wait(context.Background(), PriorityLow))
+		order <- PriorityLow
+	}()
+	time.Sleep(10 * time.Millisecond)
+	go func() {
+		ass.NoError(limiter.wait(context.Background(), PriorityHigh))
+		order <- PriorityHigh
+	}()
+	ass.Equal(PriorityHigh, <-order)
+	ass.Equal(PriorityLow, <-order)
+}
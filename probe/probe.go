@@ -0,0 +1,166 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package probe provides HTTP liveness (/healthz) and readiness (/readyz)
+// handlers reflecting the state of connections and devices, e.g. for
+// Kubernetes probes of services built on this library.
+package probe
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/pb82/sunny"
+)
+
+// Checker evaluates the health of connections and their devices
+type Checker struct {
+	// Connections to check
+	Connections []*sunny.Connection
+	// MaxReceiveAge fails readiness if no packet was received within the duration (0 -> not checked)
+	MaxReceiveAge time.Duration
+	// MaxDiscoveryAge fails readiness if no device was discovered within the duration (0 -> not checked)
+	MaxDiscoveryAge time.Duration
+	// RequireAllDevices fails readiness if any device is unhealthy,
+	// otherwise at least one healthy device is required (if devices exist)
+	RequireAllDevices bool
+}
+
+// Status is the JSON body of the probe responses
+type Status struct {
+	// OK is true if the probe succeeded
+	OK bool `json:"ok"`
+	// Reasons of a failed probe
+	Reasons []string `json:"reasons,omitempty"`
+	// Connections state
+	Connections []ConnectionStatus `json:"connections"`
+}
+
+// ConnectionStatus is the state of a connection in the probe response
+type ConnectionStatus struct {
+	Closed        bool           `json:"closed"`
+	LastReceived  time.Time      `json:"lastReceived"`
+	LastDiscovery time.Time      `json:"lastDiscovery"`
+	Devices       []DeviceStatus `json:"devices"`
+}
+
+// DeviceStatus is the state of a device in the probe response
+type DeviceStatus struct {
+	Serial              uint32    `json:"serial"`
+	Healthy             bool      `json:"healthy"`
+	LastSuccess         time.Time `json:"lastSuccess"`
+	LastError           string    `json:"lastError,omitempty"`
+	ConsecutiveFailures int       `json:"consecutiveFailures"`
+	Tripped             bool      `json:"tripped"`
+}
+
+// Handler serving /healthz and /readyz
+func (c *Checker) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", c.Healthz)
+	mux.HandleFunc("/readyz", c.Readyz)
+	return mux
+}
+
+// Healthz reports liveness: all connections are open
+func (c *Checker) Healthz(w http.ResponseWriter, _ *http.Request) {
+	write(w, c.Live())
+}
+
+// Readyz reports readiness: connections are live, packets and discoveries are
+// recent and enough devices are healthy
+func (c *Checker) Readyz(w http.ResponseWriter, _ *http.Request) {
+	write(w, c.Ready())
+}
+
+// Live evaluates the liveness
+func (c *Checker) Live() Status {
+	status := c.status()
+	for _, conn := range status.Connections {
+		if conn.Closed {
+			status.Reasons = append(status.Reasons, "connection closed")
+		}
+	}
+	status.OK = len(status.Reasons) == 0
+	return status
+}
+
+// Ready evaluates the readiness
+func (c *Checker) Ready() Status {
+	status := c.Live()
+	now := time.Now()
+
+	devices, healthy := 0, 0
+	for _, conn := range status.Connections {
+		if c.MaxReceiveAge > 0 && now.Sub(conn.LastReceived) > c.MaxReceiveAge {
+			status.Reasons = append(status.Reasons, "no packet received within "+c.MaxReceiveAge.String())
+		}
+		if c.MaxDiscoveryAge > 0 && now.Sub(conn.LastDiscovery) > c.MaxDiscoveryAge {
+			status.Reasons = append(status.Reasons, "no device discovered within "+c.MaxDiscoveryAge.String())
+		}
+		for _, device := range conn.Devices {
+			devices++
+			if device.Healthy {
+				healthy++
+			}
+		}
+	}
+	if c.RequireAllDevices && healthy < devices {
+		status.Reasons = append(status.Reasons, "unhealthy devices")
+	} else if devices > 0 && healthy == 0 {
+		status.Reasons = append(status.Reasons, "no healthy device")
+	}
+
+	status.OK = len(status.Reasons) == 0
+	return status
+}
+
+// status of all connections
+func (c *Checker) status() Status {
+	var status Status
+	for _, conn := range c.Connections {
+		health := conn.Health()
+		connStatus := ConnectionStatus{
+			Closed:        health.Closed,
+			LastReceived:  health.LastReceived,
+			LastDiscovery: health.LastDiscovery,
+			Devices:       make([]DeviceStatus, 0, len(health.Devices)),
+		}
+		for _, device := range health.Devices {
+			deviceStatus := DeviceStatus{
+				Serial:              device.Serial,
+				Healthy:             device.Healthy,
+				LastSuccess:         device.LastSuccess,
+				ConsecutiveFailures: device.ConsecutiveFailures,
+				Tripped:             device.Tripped,
+			}
+			if device.LastError != nil {
+				deviceStatus.LastError = device.LastError.Error()
+			}
+			connStatus.Devices = append(connStatus.Devices, deviceStatus)
+		}
+		status.Connections = append(status.Connections, connStatus)
+	}
+	return status
+}
+
+// write the status as JSON, failed probes are answered with 503
+func write(w http.ResponseWriter, status Status) {
+	w.Header().Set("Content-Type", "application/json")
+	if !status.OK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(status)
+}
@@ -0,0 +1,132 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package probe
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pb82/sunny"
+	"github.com/pb82/sunny/sunnytest"
+)
+
+// get the probe status of the path
+func get(t *testing.T, server *httptest.Server, path string) (int, Status) {
+	response, err := http.Get(server.URL + path)
+	require.NoError(t, err)
+	defer response.Body.Close()
+
+	var status Status
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&status))
+	return response.StatusCode, status
+}
+
+func TestChecker_Handler(t *testing.T) {
+	ass := assert.New(t)
+
+	network := sunnytest.NewNetwork()
+	defer network.Close()
+	connection, err := network.Connection()
+	require.NoError(t, err)
+
+	var devices []*sunny.Device
+	for i, ip := range []string{"192.168.0.20", "192.168.0.21"} {
+		inverter, err := network.AddInverter(ip, uint32(1000+i), "0000")
+		require.NoError(t, err)
+		inverter.SetValue(sunny.ActivePowerPlus, int64(1500))
+		device, err := connection.NewDevice(ip, "0000")
+		require.NoError(t, err)
+		device.SetTimeout(100 * time.Millisecond)
+		inverter.SetOffline(i == 1)
+		devices = append(devices, device)
+	}
+
+	checker := &Checker{Connections: []*sunny.Connection{connection}, MaxReceiveAge: time.Minute}
+	server := httptest.NewServer(checker.Handler())
+	defer server.Close()
+
+	// devices not polled yet
+	code, status := get(t, server, "/readyz")
+	ass.Equal(http.StatusServiceUnavailable, code)
+	ass.Equal([]string{"no healthy device"}, status.Reasons)
+
+	_, err = devices[0].GetValues()
+	ass.NoError(err)
+	_, err = devices[1].GetValues()
+	ass.Error(err)
+
+	code, status = get(t, server, "/readyz")
+	ass.Equal(http.StatusOK, code)
+	require.Len(t, status.Connections, 1)
+	require.Len(t, status.Connections[0].Devices, 2)
+	ass.True(status.Connections[0].Devices[0].Healthy)
+	ass.False(status.Connections[0].Devices[1].Healthy)
+	ass.NotEmpty(status.Connections[0].Devices[1].LastError)
+	ass.Equal(1, status.Connections[0].Devices[1].ConsecutiveFailures)
+
+	checker.RequireAllDevices = true
+	code, status = get(t, server, "/readyz")
+	ass.Equal(http.StatusServiceUnavailable, code)
+	ass.False(status.OK)
+	ass.Equal([]string{"unhealthy devices"}, status.Reasons)
+
+	code, status = get(t, server, "/healthz")
+	ass.Equal(http.StatusOK, code)
+	ass.True(status.OK)
+
+	connection.Close()
+	code, status = get(t, server, "/healthz")
+	ass.Equal(http.StatusServiceUnavailable, code)
+	ass.Equal([]string{"connection closed"}, status.Reasons)
+}
+
+func TestChecker_Ready(t *testing.T) {
+	ass := assert.New(t)
+
+	network := sunnytest.NewNetwork()
+	defer network.Close()
+	connection, err := network.Connection()
+	require.NoError(t, err)
+
+	// nothing received or discovered yet
+	checker := &Checker{
+		Connections:     []*sunny.Connection{connection},
+		MaxReceiveAge:   time.Minute,
+		MaxDiscoveryAge: time.Minute,
+	}
+	status := checker.Ready()
+	ass.False(status.OK)
+	ass.Equal([]string{"no packet received within 1m0s", "no device discovered within 1m0s"}, status.Reasons)
+
+	inverter, err := network.AddInverter("192.168.0.20", 1000, "0000")
+	require.NoError(t, err)
+	device, err := connection.NewDevice("192.168.0.20", "0000")
+	require.NoError(t, err)
+	device.SetTimeout(100 * time.Millisecond)
+	inverter.SetOffline(true)
+	_, err = device.GetValues()
+	ass.Error(err)
+
+	checker = &Checker{Connections: []*sunny.Connection{connection}}
+	status = checker.Ready()
+	ass.False(status.OK)
+	ass.Equal([]string{"no healthy device"}, status.Reasons)
+}
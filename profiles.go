@@ -0,0 +1,269 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// DeviceProfile extends the library for devices of a SUSyID range.
+// External modules register profiles in init, so support for rare devices
+// can live outside of this module and is enabled by importing the module
+// (e.g. in a file with a build tag):
+//
+//	import _ "example.com/sunny-profiles/hybrid"
+type DeviceProfile struct {
+	// Name of the profile, must be unique (e.g. the module path)
+	Name string
+	// First and Last SUSyID of the devices (inclusive)
+	First uint16
+	Last  uint16
+	// EnergyMeter selects energy meters instead of inverters
+	EnergyMeter bool
+	// Family and Model of the devices, registered with RegisterModel if Family is set
+	Family string
+	Model  string
+	// Values requested from devices of the profile in addition to the built-in ones
+	Values []ProfileValue
+	// Decode adjusts the decoded values of a device (optional), e.g. to fix the
+	// scaling of a firmware. It is called before the values are validated.
+	Decode func(info DeviceInfo, values map[ValueID]interface{})
+}
+
+// ProfileValue is a value of a device profile
+type ProfileValue struct {
+	// Object, Start, End and Code of inverter values (see RegisterInverterValue)
+	Object uint16
+	Start  uint32
+	End    uint32
+	Code   uint16
+	// OBIS channel of energy meter values (see RegisterEnergyMeterValue)
+	OBIS string
+	// Decoder of the value
+	Decoder ValueDecoder
+}
+
+// registered device profiles
+var (
+	profilesMutex sync.RWMutex
+	profiles      []registeredProfile
+)
+
+// registeredProfile with the definitions of its inverter values
+type registeredProfile struct {
+	DeviceProfile
+	values   []InverterValuesDef
+	requests []InverterValuesDef
+}
+
+// matches returns true if the profile applies to the device
+func (p *registeredProfile) matches(info DeviceInfo) bool {
+	return p.EnergyMeter == info.EnergyMeter && info.ID.SusyID >= p.First && info.ID.SusyID <= p.Last
+}
+
+// RegisterProfile adds the device profile and registers its values and model.
+// Inverter values of a profile are only requested from matching devices.
+// Register profiles before devices are created (e.g. in init).
+func RegisterProfile(profile DeviceProfile) ([]ValueID, error) {
+	if profile.Name == "" {
+		return nil, fmt.Errorf("name of device profile missing")
+	}
+	if profile.First > profile.Last {
+		return nil, fmt.Errorf("invalid SUSyID range %d-%d of profile %s", profile.First, profile.Last, profile.Name)
+	}
+
+	profilesMutex.Lock()
+	defer profilesMutex.Unlock()
+
+	if slices.ContainsFunc(profiles, func(p registeredProfile) bool { return p.Name == profile.Name }) {
+		return nil, fmt.Errorf("device profile %s already registered", profile.Name)
+	}
+
+	ids, values, err := registerProfileValues(profile)
+	if err != nil {
+		return nil, fmt.Errorf("profile %s: %w", profile.Name, err)
+	}
+	registered := registeredProfile{
+		DeviceProfile: profile,
+		values:        values,
+		requests:      getInverterRequests(values),
+	}
+
+	// the range is validated above -> registration does not fail
+	if profile.Family != "" {
+		_ = RegisterModel(DeviceModel{First: profile.First, Last: profile.Last, Family: profile.Family, Model: profile.Model})
+	}
+
+	profiles = append(profiles, registered)
+	return ids, nil
+}
+
+// registerProfileValues validates all values of the profile and registers
+// them, so a profile is either registered completely or not at all. Inverter
+// values are not requested from all devices.
+func registerProfileValues(profile DeviceProfile) ([]ValueID, []InverterValuesDef, error) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	names := make(map[string]bool)
+	keys := make(map[string]bool)
+	for _, value := range profile.Values {
+		name := value.Decoder.Name
+		if name == "" {
+			return nil, nil, fmt.Errorf("name of custom value missing")
+		}
+		if _, err := lookupValueID(name); err == nil || names[name] {
+			return nil, nil, fmt.Errorf("value %s already registered", name)
+		}
+		names[name] = true
+
+		if profile.EnergyMeter {
+			if _, ok := emObisMap[value.OBIS]; ok || keys[value.OBIS] {
+				return nil, nil, fmt.Errorf("OBIS channel %s already registered", value.OBIS)
+			}
+			keys[value.OBIS] = true
+		} else {
+			code := fmt.Sprint(value.Code)
+			if _, ok := inverterResponseValues[uint32(value.Code)<<16]; ok || keys[code] {
+				return nil, nil, fmt.Errorf("inverter value code 0x%X already registered", value.Code)
+			}
+			keys[code] = true
+		}
+	}
+
+	ids := make([]ValueID, 0, len(profile.Values))
+	var defs []InverterValuesDef
+	for _, value := range profile.Values {
+		id, err := registerValue(value.Decoder)
+		if err != nil {
+			return nil, nil, err // validated above
+		}
+		ids = append(ids, id)
+
+		if profile.EnergyMeter {
+			def := energyMeterValuesDef{OBIS: value.OBIS, ID: id, Factor: value.Decoder.Factor}
+			emValues = append(emValues, def)
+			emObisMap[value.OBIS] = def
+			emIDMap[id] = def
+			continue
+		}
+		def := InverterValuesDef{
+			Object: value.Object,
+			Start:  value.Start,
+			End:    value.End,
+			Code:   value.Code,
+			ID:     id,
+			Factor: value.Decoder.Factor,
+		}
+		inverterResponseValues[uint32(value.Code)<<16] = id
+		inverterValueMap[id] = def
+		defs = append(defs, def)
+	}
+	return ids, defs, nil
+}
+
+// Profiles returns all registered device profiles
+func Profiles() []DeviceProfile {
+	profilesMutex.RLock()
+	defer profilesMutex.RUnlock()
+
+	list := make([]DeviceProfile, 0, len(profiles))
+	for _, profile := range profiles {
+		list = append(list, profile.DeviceProfile)
+	}
+	return list
+}
+
+// Profiles of the identified device
+func (i DeviceInfo) Profiles() []DeviceProfile {
+	profilesMutex.RLock()
+	defer profilesMutex.RUnlock()
+
+	var list []DeviceProfile
+	for _, profile := range profiles {
+		if profile.matches(i) {
+			list = append(list, profile.DeviceProfile)
+		}
+	}
+	return list
+}
+
+// Profiles of the device
+func (d *Device) Profiles() []DeviceProfile {
+	return d.info().Profiles()
+}
+
+// info of the device for profile lookups
+func (d *Device) info() DeviceInfo {
+	return DeviceInfo{ID: d.id, EnergyMeter: d.energyMeter}
+}
+
+// inverterRequests of the built-in values and the values of matching profiles
+func (d *Device) inverterRequests() []InverterValuesDef {
+	requests := getAllInverterRequests()
+
+	profilesMutex.RLock()
+	defer profilesMutex.RUnlock()
+
+	info := d.info()
+	for _, profile := range profiles {
+		if !profile.matches(info) {
+			continue
+		}
+		for _, request := range profile.requests {
+			if !slices.ContainsFunc(requests, func(def InverterValuesDef) bool {
+				return def.Object == request.Object && def.Start == request.Start && def.End == request.End
+			}) {
+				requests = append(slices.Clip(requests), request)
+			}
+		}
+	}
+	return requests
+}
+
+// profileGroupValues returns the profile values contained in the response of the request
+func profileGroupValues(request InverterValuesDef) []ValueID {
+	profilesMutex.RLock()
+	defer profilesMutex.RUnlock()
+
+	var ids []ValueID
+	for _, profile := range profiles {
+		for _, def := range profile.values {
+			if def.Object == request.Object && def.Start == request.Start && def.End == request.End {
+				ids = append(ids, def.ID)
+			}
+		}
+	}
+	return ids
+}
+
+// applyProfiles calls the decode functions of matching profiles
+func (d *Device) applyProfiles(values map[ValueID]interface{}) {
+	if len(values) == 0 {
+		return
+	}
+
+	profilesMutex.RLock()
+	defer profilesMutex.RUnlock()
+
+	info := d.info()
+	for _, profile := range profiles {
+		if profile.Decode != nil && profile.matches(info) {
+			profile.Decode(info, values)
+		}
+	}
+}
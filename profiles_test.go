@@ -0,0 +1,105 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"testing"
+
+	"github.com/pb82/sunny/proto/net2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegisterProfile_invalid(t *testing.T) {
+	ass := assert.New(t)
+
+	ok := ProfileValue{Object: 0x5100, Start: 0x00731000, End: 0x007310FF, Code: 0x7310, Decoder: ValueDecoder{Name: "ProfileInvalidFirst"}}
+	tests := []struct {
+		name    string
+		profile DeviceProfile
+	}{
+		{"missing name", DeviceProfile{}},
+		{"invalid range", DeviceProfile{Name: "range", First: 2, Last: 1}},
+		{"built-in code", DeviceProfile{Name: "code", Values: []ProfileValue{ok, {Code: 0x263F, Decoder: ValueDecoder{Name: "ProfileInvalidCode"}}}}},
+		{"duplicate code", DeviceProfile{Name: "duplicate", Values: []ProfileValue{ok, {Code: ok.Code, Decoder: ValueDecoder{Name: "ProfileInvalidDuplicate"}}}}},
+		{"built-in name", DeviceProfile{Name: "builtin", Values: []ProfileValue{ok, {Code: 0x7311, Decoder: ValueDecoder{Name: "ActivePowerPlus"}}}}},
+		{"missing value name", DeviceProfile{Name: "value", Values: []ProfileValue{ok, {Code: 0x7311}}}},
+		{"built-in OBIS", DeviceProfile{Name: "obis", EnergyMeter: true, Values: []ProfileValue{{OBIS: "0:1.4.0", Decoder: ValueDecoder{Name: "ProfileInvalidOBIS"}}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ids, err := RegisterProfile(tt.profile)
+			assert.Error(t, err)
+			assert.Nil(t, ids)
+		})
+	}
+
+	// nothing of the invalid profiles was registered -> retry works
+	_, err := LookupValueID("ProfileInvalidFirst")
+	ass.Error(err)
+	ids, err := RegisterProfile(DeviceProfile{Name: "code", Values: []ProfileValue{ok}})
+	ass.NoError(err)
+	ass.Len(ids, 1)
+	_, err = RegisterProfile(DeviceProfile{Name: "code"})
+	ass.Error(err)
+}
+
+func TestRegisterProfile(t *testing.T) {
+	ass := assert.New(t)
+
+	ids, err := RegisterProfile(DeviceProfile{
+		Name:   "test-hybrid",
+		First:  9900,
+		Last:   9901,
+		Family: "Test Hybrid",
+		Values: []ProfileValue{
+			{Object: 0x5100, Start: 0x00732000, End: 0x007321FF, Code: 0x7320, Decoder: ValueDecoder{Name: "ProfileCycles", Factor: 0.1}},
+			{Object: 0x5100, Start: 0x00732000, End: 0x007321FF, Code: 0x7321, Decoder: ValueDecoder{Name: "ProfileHealth"}},
+		},
+		Decode: func(_ DeviceInfo, values map[ValueID]interface{}) {
+			values[DeviceName] = "hybrid"
+		},
+	})
+	ass.NoError(err)
+	ass.Len(ids, 2)
+
+	matching := &Device{id: net2.DeviceId{SusyID: 9900, SerialNumber: 1}}
+	other := &Device{id: net2.DeviceId{SusyID: 9902, SerialNumber: 2}}
+	meter := &Device{id: net2.DeviceId{SusyID: 9900, SerialNumber: 3}, energyMeter: true}
+
+	ass.Len(matching.Profiles(), 1)
+	ass.Empty(other.Profiles())
+	ass.Empty(meter.Profiles())
+
+	// one request for both values, only for matching devices
+	profileRequest := InverterValuesDef{Object: 0x5100, Start: 0x00732000, End: 0x007321FF}
+	ass.Len(matching.inverterRequests(), len(getAllInverterRequests())+1)
+	ass.Len(other.inverterRequests(), len(getAllInverterRequests()))
+	ass.ElementsMatch(ids, getInverterGroupValues(profileRequest))
+
+	// decoded with factor
+	parsed := parseInverterValues([]*net2.ResponseValue{{Code: 0x7320, Values: []interface{}{uint32(15)}}})
+	ass.Equal(map[ValueID]interface{}{ids[0]: 1.5}, parsed)
+
+	values := map[ValueID]interface{}{ids[0]: 1.5}
+	matching.applyProfiles(values)
+	ass.Equal("hybrid", values[DeviceName])
+	values = map[ValueID]interface{}{ActivePowerPlus: 1.0}
+	other.applyProfiles(values)
+	ass.NotContains(values, DeviceName)
+
+	model, ok := LookupModel(9901)
+	ass.True(ok)
+	ass.Equal("Test Hybrid", model.Family)
+}
@@ -17,9 +17,11 @@ package proto
 import (
 	"bytes"
 	"encoding/binary"
-	"fmt"
 	"reflect"
 	"strings"
+	"sync"
+
+	"github.com/pb82/sunny/proto/net2"
 )
 
 // identifier of speedwire packets
@@ -48,12 +50,60 @@ type PacketEntry interface {
 // Packet with multiple packet entries
 type Packet struct {
 	entries []PacketEntry
+
+	// undecoded entries of a lazy read packet
+	lazy *lazyEntries
+}
+
+// lazyEntries are decoded on first access
+type lazyEntries struct {
+	once sync.Once
+	raw  []rawEntry
+
+	entries []PacketEntry
+	err     error
+}
+
+// rawEntry is the undecoded data of an entry
+type rawEntry struct {
+	tag  uint16
+	data []byte
+}
+
+// getEntries returns all entries and decodes lazy read entries if required
+func (p *Packet) getEntries() []PacketEntry {
+	if p.lazy == nil {
+		return p.entries
+	}
+
+	p.lazy.once.Do(func() {
+		for _, raw := range p.lazy.raw {
+			entry, err := readEntry(raw.tag, raw.data)
+			if err != nil {
+				p.lazy.err = err
+				return
+			}
+			p.lazy.entries = append(p.lazy.entries, entry)
+		}
+	})
+	return p.lazy.entries
+}
+
+// Decode all entries of a packet created by ReadLazy.
+// Returns the first decoding error.
+func (p *Packet) Decode() error {
+	p.getEntries()
+	if p.lazy == nil {
+		return nil
+	}
+	return p.lazy.err
 }
 
 // String representation of this packet
 func (p Packet) String() string {
-	names := make([]string, 0, len(p.entries))
-	for _, e := range p.entries {
+	entries := p.getEntries()
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
 		names = append(names, reflect.TypeOf(e).Elem().String())
 	}
 	return strings.Join(names, ", ")
@@ -61,7 +111,7 @@ func (p Packet) String() string {
 
 // GetEntry from packet by tag id
 func (p *Packet) GetEntry(tag uint16) PacketEntry {
-	for _, e := range p.entries {
+	for _, e := range p.getEntries() {
 		if e.Tag() == tag {
 			return e
 		}
@@ -71,75 +121,110 @@ func (p *Packet) GetEntry(tag uint16) PacketEntry {
 
 // AddEntry to this packet
 func (p *Packet) AddEntry(entry PacketEntry) {
+	if p.lazy != nil {
+		p.entries = append(p.getEntries(), entry)
+		p.lazy = nil
+		return
+	}
 	p.entries = append(p.entries, entry)
 }
 
 // Bytes returns binary data
 func (p *Packet) Bytes() []byte {
-	var buffer bytes.Buffer
-	// packet header
-	buffer.Write(packetHeader)
-
-	b := make([]byte, 2)
-	for _, e := range p.entries {
-		binary.BigEndian.PutUint16(b, uint16(len(e.Bytes())))
-		buffer.Write(b)
+	all := p.getEntries()
+	entries := make([][]byte, len(all))
+	length := len(packetHeader) + 4
+	for i, e := range all {
+		entries[i] = e.Bytes()
+		length += 4 + len(entries[i])
+	}
 
-		binary.BigEndian.PutUint16(b, e.Tag())
-		buffer.Write(b)
+	data := make([]byte, 0, length)
+	// packet header
+	data = append(data, packetHeader...)
 
-		buffer.Write(e.Bytes())
+	for i, e := range all {
+		data = binary.BigEndian.AppendUint16(data, uint16(len(entries[i])))
+		data = binary.BigEndian.AppendUint16(data, e.Tag())
+		data = append(data, entries[i]...)
 	}
 
 	// add 4 empty bytes to the end
-	buffer.Write(make([]byte, 4))
-
-	return buffer.Bytes()
+	return append(data, 0, 0, 0, 0)
 }
 
 // Read packet from binary data
+// The packet does not reference data after returning, so the buffer can be reused.
 func (p *Packet) Read(data []byte) error {
-	buffer := bytes.NewBuffer(data)
+	err := p.ReadLazy(bytes.Clone(data))
+	if err != nil {
+		return err
+	}
+	err = p.Decode()
+	if err != nil {
+		return err
+	}
 
-	if buffer.Len() < 20 {
-		return fmt.Errorf("invalid packet - to small: %d", len(data))
+	// decoded -> no lazy handling required anymore
+	p.entries = append(p.entries, p.lazy.entries...)
+	p.lazy = nil
+	return nil
+}
+
+// ReadLazy validates the packet structure of the binary data, but decodes
+// the entries on first access (GetEntry, String, Decode, ...).
+// The packet and its entries reference data, so the buffer must not be reused
+// while the packet is in use (see Read).
+func (p *Packet) ReadLazy(data []byte) error {
+	if len(data) < 20 {
+		return net2.NewParseError(ErrTruncated, "invalid packet - to small: %d", len(data))
 	}
 
-	head := buffer.Next(4)
-	if !bytes.Equal(packetHeader, head[:4]) {
-		return fmt.Errorf("invalid packet - header: %s", string(head[:3]))
+	if !bytes.Equal(packetHeader, data[:4]) {
+		return net2.NewParseError(ErrBadTag, "invalid packet - header: %s", string(data[:3]))
 	}
 
-	for buffer.Len() >= 4 {
-		length := binary.BigEndian.Uint16(buffer.Next(2))
-		tag := binary.BigEndian.Uint16(buffer.Next(2)) // including version
+	lazy := &lazyEntries{
+		entries: p.getEntries(),
+	}
 
-		if length == 0 {
+	index := 4
+	for len(data)-index >= 4 {
+		length := int(binary.BigEndian.Uint16(data[index:]))
+		tag := binary.BigEndian.Uint16(data[index+2:]) // including version
+		index += 4
+
+		if length == 0 && tag == 0 {
 			// last packet
 			break
 		}
+		if length > len(data)-index {
+			return net2.NewParseError(ErrTruncated,
+				"invalid packet - entry 0x%04X length %d exceeds %d", tag, length, len(data)-index)
+		}
+		lazy.raw = append(lazy.raw, rawEntry{
+			tag:  tag,
+			data: data[index : index+length : index+length],
+		})
+		index += length
+	}
 
-		found := false
-		for _, packet := range packets {
-			if packet.Tag() == tag {
-				entry, err := packet.Read(buffer.Next(int(length)))
-				if err != nil {
-					return err
-				}
-				p.entries = append(p.entries, entry)
-				found = true
-				break
-			}
+	p.entries = nil
+	p.lazy = lazy
+	return nil
+}
 
-		}
-		if !found {
-			p.entries = append(p.entries, &UnknownPacketEntry{
-				Data: buffer.Next(int(length)),
-				T:    tag,
-			})
+// readEntry decodes an entry with the matching known packet
+func readEntry(tag uint16, data []byte) (PacketEntry, error) {
+	for _, packet := range packets {
+		if packet.Tag() == tag {
+			return packet.Read(data)
 		}
 	}
-	return nil
+	return &UnknownPacketEntry{
+		Data: data,
+		T:    tag,
+	}, nil
 }
 
 // GroupPacketEntryTag identifier for group entries
@@ -168,7 +253,7 @@ func (e *GroupPacketEntry) Bytes() []byte {
 // Read packet from the given binary data
 func (e *GroupPacketEntry) Read(data []byte) (PacketEntry, error) {
 	if len(data) < 4 {
-		return nil, fmt.Errorf("invalid GroupPacketEntry - length %d", len(data))
+		return nil, net2.NewParseError(ErrTruncated, "invalid GroupPacketEntry - length %d", len(data))
 	}
 
 	return &GroupPacketEntry{
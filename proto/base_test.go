@@ -175,3 +175,140 @@ func TestUnknownPacketEntry(t *testing.T) {
 	ass.Nil(e)
 	ass.Nil(err)
 }
+
+func TestPacket_Read_errors(t *testing.T) {
+	ass := assert.New(t)
+
+	packet := new(Packet)
+	ass.ErrorIs(packet.Read([]byte{0x12, 0x34}), ErrTruncated)
+
+	ass.ErrorIs(packet.Read([]byte{
+		0x52, 0x4d, 0x41, 0x00, // header
+		0x00, 0x08, // packet data length
+		0x12, 0x34, // packet id
+		0x12, 0x34, 0x56, 0x78, // packet data
+		0x12, 0x34, 0x56, 0x78, // packet data
+		0x00, 0x00, 0x00, 0x00, // packet end
+	}), ErrBadTag)
+
+	err := packet.Read([]byte{
+		0x53, 0x4d, 0x41, 0x00, // header
+		0x00, 0x10, // packet data length (exceeds packet)
+		0x12, 0x34, // packet id
+		0x12, 0x34, 0x56, 0x78, // packet data
+		0x12, 0x34, 0x56, 0x78, // packet data
+		0x00, 0x00, 0x00, 0x00, // packet end
+	})
+	ass.ErrorIs(err, ErrTruncated)
+	ass.EqualError(err, "invalid packet - entry 0x1234 length 16 exceeds 12")
+}
+
+func FuzzPacket_Read(f *testing.F) {
+	f.Add([]byte{
+		0x53, 0x4d, 0x41, 0x00, // header
+		0x00, 0x04, // packet data length
+		0x02, 0xa0, // packet id (GroupPacketEntry)
+		0x12, 0x34, 0x56, 0x78, // packet data
+		0x00, 0x00, 0x00, 0x00, // packet end
+		0x00, 0x00, 0x00, 0x00,
+	})
+	f.Add(NewDiscoveryRequest().Bytes())
+	for _, sample := range readCorpus(f) {
+		f.Add(sample.data)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		packet := new(Packet)
+		if packet.Read(data) != nil {
+			return
+		}
+		_ = packet.String()
+	})
+}
+
+func TestPacket_Read_noAlias(t *testing.T) {
+	ass := assert.New(t)
+
+	data := []byte{
+		0x53, 0x4d, 0x41, 0x00, // header
+		0x00, 0x04, // packet data length
+		0x12, 0x34, // packet id
+		0x12, 0x34, 0x56, 0x78, // packet data
+		0x00, 0x04, // packet data length
+		0x00, 0x30, // packet id (DiscoveryIPPacketEntry)
+		0xc0, 0xa8, 0x01, 0x02, // packet data
+		0x00, 0x00, 0x00, 0x00, // packet end
+	}
+	packet := new(Packet)
+	ass.NoError(packet.Read(data))
+
+	// reuse buffer
+	for i := range data {
+		data[i] = 0
+	}
+
+	ass.Equal([]byte{0x12, 0x34, 0x56, 0x78}, packet.GetEntry(0x1234).Bytes())
+	ass.Equal("192.168.1.2", packet.GetEntry(DiscoveryIPPacketEntryTag).(*DiscoveryIPPacketEntry).IP.String())
+}
+
+func BenchmarkPacket_Read(b *testing.B) {
+	data := NewPacketBuilder().
+		Group(GroupDefault).
+		Entry(new(TestEntry)).
+		Build().
+		Bytes()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		packet := new(Packet)
+		if err := packet.Read(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPacket_Bytes(b *testing.B) {
+	packet := NewPacketBuilder().
+		Group(GroupDefault).
+		Entry(new(TestEntry)).
+		Build()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = packet.Bytes()
+	}
+}
+
+func TestPacket_ReadLazy(t *testing.T) {
+	ass := assert.New(t)
+
+	packet := new(Packet)
+	ass.ErrorIs(packet.ReadLazy([]byte{0x12, 0x34}), ErrTruncated)
+
+	ass.NoError(packet.ReadLazy([]byte{
+		0x53, 0x4d, 0x41, 0x00, // header
+		0x00, 0x04, // packet data length
+		0x02, 0xa0, // packet id (GroupPacketEntry)
+		0x12, 0x34, 0x56, 0x78, // packet data
+		0x00, 0x00, 0x00, 0x00, // packet end
+		0x00, 0x00, 0x00, 0x00,
+	}))
+	ass.Nil(packet.lazy.entries)
+	ass.Equal(&GroupPacketEntry{Group: 0x12345678}, packet.GetEntry(GroupPacketEntryTag))
+	ass.Equal("proto.GroupPacketEntry", packet.String())
+	ass.NoError(packet.Decode())
+
+	// decoding errors are reported on Decode
+	packet = new(Packet)
+	ass.NoError(packet.ReadLazy([]byte{
+		0x53, 0x4d, 0x41, 0x00, // header
+		0x00, 0x02, // packet data length
+		0x02, 0xa0, // packet id (GroupPacketEntry)
+		0x12, 0x34, // packet data
+		0x00, 0x00, 0x00, 0x00, // packet end
+		0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00,
+	}))
+	ass.EqualError(packet.Decode(), "invalid GroupPacketEntry - length 2")
+	ass.Nil(packet.GetEntry(GroupPacketEntryTag))
+}
@@ -0,0 +1,151 @@
+// Copyright 2019 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proto
+
+import "github.com/pb82/sunny/proto/net2"
+
+// known groups of GroupPacketEntry
+const (
+	// GroupDefault used for device communication
+	GroupDefault uint32 = 0x00000001
+	// GroupBroadcast used for discovery
+	GroupBroadcast uint32 = 0xFFFFFFFF
+)
+
+// PacketBuilder constructs Speedwire packets.
+//
+// A packet starts with the SMA net header followed by the added entries:
+//
+//	packet := proto.NewPacketBuilder().
+//		Group(proto.GroupDefault).
+//		Net2(data).
+//		Build()
+type PacketBuilder struct {
+	entries []PacketEntry
+}
+
+// NewPacketBuilder creates an empty packet builder
+func NewPacketBuilder() *PacketBuilder {
+	return new(PacketBuilder)
+}
+
+// Group adds a GroupPacketEntry with the given group
+func (b *PacketBuilder) Group(group uint32) *PacketBuilder {
+	return b.Entry(&GroupPacketEntry{
+		Group: group,
+	})
+}
+
+// Net2 adds a SmaNet2PacketEntry with the given content.
+// The protocol ID is taken from the content.
+func (b *PacketBuilder) Net2(content SmaNet2SubPacket) *PacketBuilder {
+	return b.Entry(&SmaNet2PacketEntry{
+		Content: content,
+	})
+}
+
+// Entry adds any entry to the packet
+func (b *PacketBuilder) Entry(entry PacketEntry) *PacketBuilder {
+	b.entries = append(b.entries, entry)
+	return b
+}
+
+// Build returns the packet with all added entries
+func (b *PacketBuilder) Build() *Packet {
+	var pack Packet
+	for _, e := range b.entries {
+		pack.AddEntry(e)
+	}
+	return &pack
+}
+
+// DeviceDataBuilder constructs net2 device data commands.
+//
+// The packet ID and source are assigned like for all requests of this library:
+//
+//	data := proto.NewDeviceDataBuilder(net2.CommandGetValues, 0x5100).
+//		Destination(id).
+//		Parameters(0x00263F00, 0x00263FFF).
+//		Build()
+type DeviceDataBuilder struct {
+	data *net2.DeviceData
+}
+
+// NewDeviceDataBuilder creates a builder for the given command and object
+func NewDeviceDataBuilder(command uint8, object uint16) *DeviceDataBuilder {
+	data := net2.NewDeviceData(net2.ControlRequest)
+	data.Command = command
+	data.Object = object
+
+	return &DeviceDataBuilder{
+		data: data,
+	}
+}
+
+// Control sets the control byte (default net2.ControlRequest)
+func (b *DeviceDataBuilder) Control(control uint8) *DeviceDataBuilder {
+	b.data.Control = control
+	return b
+}
+
+// Destination sets the addressed device
+func (b *DeviceDataBuilder) Destination(id net2.DeviceId) *DeviceDataBuilder {
+	b.data.Destination = id
+	return b
+}
+
+// Broadcast addresses all devices
+func (b *DeviceDataBuilder) Broadcast() *DeviceDataBuilder {
+	return b.Destination(net2.BroadcastDeviceId)
+}
+
+// Source sets the sender (default net2.LocalDeviceId)
+func (b *DeviceDataBuilder) Source(id net2.DeviceId) *DeviceDataBuilder {
+	b.data.Source = id
+	return b
+}
+
+// JobNumber sets the job number
+func (b *DeviceDataBuilder) JobNumber(job uint8) *DeviceDataBuilder {
+	b.data.JobNumber = job
+	return b
+}
+
+// Parameters appends the given parameters
+func (b *DeviceDataBuilder) Parameters(params ...uint32) *DeviceDataBuilder {
+	for _, p := range params {
+		b.data.AddParameter(p)
+	}
+	return b
+}
+
+// Data sets additional data sent after the parameters
+func (b *DeviceDataBuilder) Data(data []byte) *DeviceDataBuilder {
+	b.data.Data = data
+	return b
+}
+
+// Build returns the device data sub packet
+func (b *DeviceDataBuilder) Build() *net2.DeviceData {
+	return b.data
+}
+
+// Packet returns a complete packet containing the device data
+func (b *DeviceDataBuilder) Packet() *Packet {
+	return NewPacketBuilder().
+		Group(GroupDefault).
+		Net2(b.data).
+		Build()
+}
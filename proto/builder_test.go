@@ -0,0 +1,81 @@
+// Copyright 2019 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proto
+
+import (
+	"testing"
+
+	"github.com/pb82/sunny/proto/net2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPacketBuilder_Build(t *testing.T) {
+	ass := assert.New(t)
+
+	entry := new(TestEntry)
+	packet := NewPacketBuilder().
+		Group(GroupBroadcast).
+		Entry(entry).
+		Build()
+
+	ass.Equal([]PacketEntry{
+		&GroupPacketEntry{Group: 0xFFFFFFFF},
+		entry,
+	}, packet.entries)
+}
+
+func TestDeviceDataBuilder_Packet(t *testing.T) {
+	ass := assert.New(t)
+
+	builder := NewDeviceDataBuilder(net2.CommandLogin, net2.ObjectSession).
+		Destination(net2.DeviceId{SusyID: 0x1234, SerialNumber: 0x12345678}).
+		Source(net2.DeviceId{SusyID: 0x4321, SerialNumber: 0x87654321}).
+		JobNumber(0x01).
+		Parameters(0x12345678, 0x87654321).
+		Data([]byte{0x12, 0x34, 0x56, 0x78})
+
+	data := builder.Build()
+	ass.Equal(net2.ControlRequest, data.Control)
+	ass.Equal(net2.CommandLogin, data.Command)
+	ass.Equal(net2.ObjectSession, data.Object)
+	ass.Equal(uint8(0x01), data.JobNumber)
+	ass.Equal([]uint32{0x12345678, 0x87654321}, data.Parameters)
+	ass.Equal([]byte{0x12, 0x34, 0x56, 0x78}, data.Data)
+
+	packet := builder.Packet()
+	ass.Equal(GroupDefault, packet.GetEntry(GroupPacketEntryTag).(*GroupPacketEntry).Group)
+	ass.Equal(data, packet.GetEntry(SmaNet2PacketEntryTag).(*SmaNet2PacketEntry).Content)
+
+	// round trip
+	var read Packet
+	ass.NoError(read.Read(packet.Bytes()))
+	readData := read.GetEntry(SmaNet2PacketEntryTag).(*SmaNet2PacketEntry).Content.(*net2.DeviceData)
+	ass.Equal(data.Destination, readData.Destination)
+	ass.Equal(data.Source, readData.Source)
+	ass.Equal(data.PacketID, readData.PacketID)
+	ass.Equal(data.Parameters, readData.Parameters)
+}
+
+func TestDeviceDataBuilder_Broadcast(t *testing.T) {
+	ass := assert.New(t)
+
+	data := NewDeviceDataBuilder(net2.CommandGetValues, 0).
+		Broadcast().
+		Control(0xe0).
+		Build()
+
+	ass.Equal(uint8(0xe0), data.Control)
+	ass.Equal(net2.DeviceId{SusyID: 0xFFFF, SerialNumber: 0xFFFFFFFF}, data.Destination)
+}
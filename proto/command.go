@@ -0,0 +1,59 @@
+// Copyright 2019 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proto
+
+import "github.com/pb82/sunny/proto/net2"
+
+// Command is a generic device data request, e.g. for experimental commands
+type Command struct {
+	// Command code (e.g. net2.CommandGetValues)
+	Command uint8
+	// Object addressed by the command
+	Object uint16
+	// JobNumber of the request
+	JobNumber uint8
+	// Parameters of the request
+	Parameters []uint32
+	// Data sent after the parameters
+	Data []byte
+}
+
+// DeviceData builds the request with a new packet ID
+func (c Command) DeviceData() *net2.DeviceData {
+	return NewDeviceDataBuilder(c.Command, c.Object).
+		JobNumber(c.JobNumber).
+		Parameters(c.Parameters...).
+		Data(c.Data).
+		Build()
+}
+
+// Response to a Command
+type Response struct {
+	// Status of the response (0 -> success)
+	Status uint16
+	// Values returned by the device
+	Values []*net2.ResponseValue
+	// DeviceData as received
+	DeviceData *net2.DeviceData
+}
+
+// NewResponse from received device data
+func NewResponse(data *net2.DeviceData) Response {
+	return Response{
+		Status:     data.Status,
+		Values:     data.ResponseValues,
+		DeviceData: data,
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2019 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proto
+
+import (
+	"testing"
+
+	"github.com/pb82/sunny/proto/net2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommand_DeviceData(t *testing.T) {
+	ass := assert.New(t)
+
+	command := Command{
+		Command:    net2.CommandGetValues,
+		Object:     0x5100,
+		JobNumber:  0x01,
+		Parameters: []uint32{0x00263F00, 0x00263FFF},
+	}
+
+	data := command.DeviceData()
+	ass.Equal(net2.ControlRequest, data.Control)
+	ass.Equal(net2.CommandGetValues, data.Command)
+	ass.Equal(uint16(0x5100), data.Object)
+	ass.Equal(uint8(0x01), data.JobNumber)
+	ass.Equal([]uint32{0x00263F00, 0x00263FFF}, data.Parameters)
+
+	// new packet ID for each request
+	ass.NotEqual(data.PacketID, command.DeviceData().PacketID)
+}
+
+func TestNewResponse(t *testing.T) {
+	ass := assert.New(t)
+
+	data := &net2.DeviceData{
+		Status: 0x15,
+		ResponseValues: []*net2.ResponseValue{
+			{Class: 0x01, Code: 0x263F, Values: []interface{}{uint32(1234)}},
+		},
+	}
+
+	response := NewResponse(data)
+	ass.Equal(uint16(0x15), response.Status)
+	ass.Equal(data.ResponseValues, response.Values)
+	ass.Same(data, response.DeviceData)
+}
@@ -0,0 +1,128 @@
+// Copyright 2019 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var updateGolden = flag.Bool("update", false, "update golden files of the packet corpus")
+
+// corpusSample is a packet of the corpus in testdata/corpus/<version>/<name>.hex
+type corpusSample struct {
+	name string
+	path string
+	data []byte
+}
+
+// readCorpus loads all packet samples of all corpus versions
+func readCorpus(tb testing.TB) []corpusSample {
+	paths, err := filepath.Glob(filepath.Join("testdata", "corpus", "*", "*.hex"))
+	require.NoError(tb, err)
+	require.NotEmpty(tb, paths)
+
+	samples := make([]corpusSample, 0, len(paths))
+	for _, path := range paths {
+		file, err := os.Open(path)
+		require.NoError(tb, err)
+
+		// hex data, lines starting with # are comments
+		var data strings.Builder
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if strings.HasPrefix(line, "#") {
+				continue
+			}
+			data.WriteString(strings.Join(strings.Fields(line), ""))
+		}
+		require.NoError(tb, scanner.Err())
+		require.NoError(tb, file.Close())
+
+		raw, err := hex.DecodeString(data.String())
+		require.NoError(tb, err, path)
+
+		rel, _ := filepath.Rel(filepath.Join("testdata", "corpus"), path)
+		samples = append(samples, corpusSample{
+			name: strings.TrimSuffix(filepath.ToSlash(rel), ".hex"),
+			path: path,
+			data: raw,
+		})
+	}
+	return samples
+}
+
+// describePacket returns the decoded packet as JSON
+func describePacket(packet *Packet) ([]byte, error) {
+	data, err := json.MarshalIndent(packet, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+func TestCorpus_golden(t *testing.T) {
+	for _, sample := range readCorpus(t) {
+		t.Run(sample.name, func(t *testing.T) {
+			ass := assert.New(t)
+
+			packet := new(Packet)
+			require.NoError(t, packet.Read(sample.data))
+			actual, err := describePacket(packet)
+			require.NoError(t, err)
+
+			golden := strings.TrimSuffix(sample.path, ".hex") + ".golden"
+			if *updateGolden {
+				require.NoError(t, os.WriteFile(golden, actual, 0644))
+				return
+			}
+			expected, err := os.ReadFile(golden)
+			require.NoError(t, err, "golden file missing - run: go test ./proto -run TestCorpus_golden -update")
+			ass.Equal(string(expected), string(actual))
+		})
+	}
+}
+
+func TestCorpus_readLazy(t *testing.T) {
+	for _, sample := range readCorpus(t) {
+		t.Run(sample.name, func(t *testing.T) {
+			ass := assert.New(t)
+
+			eager := new(Packet)
+			require.NoError(t, eager.Read(sample.data))
+
+			lazy := new(Packet)
+			require.NoError(t, lazy.ReadLazy(bytes.Clone(sample.data)))
+			require.NoError(t, lazy.Decode())
+
+			expected, err := describePacket(eager)
+			require.NoError(t, err)
+			actual, err := describePacket(lazy)
+			require.NoError(t, err)
+			ass.Equal(string(expected), string(actual))
+		})
+	}
+}
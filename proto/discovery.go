@@ -15,17 +15,16 @@
 package proto
 
 import (
+	"bytes"
 	"net"
 )
 
 // NewDiscoveryRequest creates a new discovery request packet
 func NewDiscoveryRequest() *Packet {
-	var pack Packet
-	pack.AddEntry(&GroupPacketEntry{
-		Group: 0xFFFFFFFF,
-	})
-	pack.AddEntry(&DiscoveryRequestPacketEntry{})
-	return &pack
+	return NewPacketBuilder().
+		Group(GroupBroadcast).
+		Entry(&DiscoveryRequestPacketEntry{}).
+		Build()
 }
 
 // DiscoveryRequestPacketEntryTag identifier for discovery request entries
@@ -71,6 +70,6 @@ func (e *DiscoveryIPPacketEntry) Bytes() []byte {
 // Read packet from the given binary data
 func (e *DiscoveryIPPacketEntry) Read(data []byte) (PacketEntry, error) {
 	return &DiscoveryIPPacketEntry{
-		IP: data,
+		IP: bytes.Clone(data),
 	}, nil
 }
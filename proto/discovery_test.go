@@ -31,6 +31,14 @@ func TestNewDiscoveryRequest(t *testing.T) {
 	ass.NotNil(packet.GetEntry(0x0020))
 }
 
+func TestNewDiscoveryRequest_Read(t *testing.T) {
+	ass := assert.New(t)
+
+	packet := new(Packet)
+	ass.NoError(packet.Read(NewDiscoveryRequest().Bytes()))
+	ass.NotNil(packet.GetEntry(DiscoveryRequestPacketEntryTag))
+}
+
 func TestDiscoveryRequestPacketEntry_Tag(t *testing.T) {
 	ass := assert.New(t)
 
@@ -0,0 +1,30 @@
+// Copyright 2019 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proto
+
+import "github.com/pb82/sunny/proto/net2"
+
+// kinds of parse errors (shared with net2)
+var (
+	// ErrTruncated data is shorter than required
+	ErrTruncated = net2.ErrTruncated
+	// ErrBadTag unknown or invalid identifier
+	ErrBadTag = net2.ErrBadTag
+	// ErrBadChecksum integrity check (e.g. length field) of data failed
+	ErrBadChecksum = net2.ErrBadChecksum
+)
+
+// ParseError describes failed parsing of binary data
+type ParseError = net2.ParseError
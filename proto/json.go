@@ -0,0 +1,173 @@
+// Copyright 2019 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proto
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/pb82/sunny/proto/net2"
+)
+
+// packetJSON is the JSON representation of a packet
+type packetJSON struct {
+	Header  string      `json:"header"`
+	Entries []entryJSON `json:"entries"`
+}
+
+// entryJSON is the JSON representation of a packet entry
+type entryJSON struct {
+	Tag      string      `json:"tag"`
+	Type     string      `json:"type"`
+	Protocol string      `json:"protocol,omitempty"`
+	Content  interface{} `json:"content,omitempty"`
+}
+
+// deviceIDJSON is the JSON representation of a device ID
+type deviceIDJSON struct {
+	SusyID       uint16 `json:"susyID"`
+	SerialNumber uint32 `json:"serialNumber"`
+}
+
+// deviceDataJSON is the JSON representation of net2.DeviceData
+type deviceDataJSON struct {
+	Control     string              `json:"control"`
+	Destination deviceIDJSON        `json:"destination"`
+	JobNumber   uint8               `json:"jobNumber"`
+	Source      deviceIDJSON        `json:"source"`
+	Status      string              `json:"status"`
+	PacketCount uint16              `json:"packetCount"`
+	PacketID    uint16              `json:"packetID"`
+	Fragment    bool                `json:"fragment,omitempty"`
+	Command     string              `json:"command"`
+	Object      string              `json:"object"`
+	Parameters  []string            `json:"parameters"`
+	Values      []responseValueJSON `json:"values,omitempty"`
+	Data        string              `json:"data,omitempty"`
+}
+
+// responseValueJSON is the JSON representation of net2.ResponseValue
+type responseValueJSON struct {
+	Class     uint8         `json:"class"`
+	Code      string        `json:"code"`
+	Type      string        `json:"type"`
+	Timestamp uint32        `json:"timestamp"`
+	Values    []interface{} `json:"values"`
+}
+
+// energyMeterJSON is the JSON representation of net2.EnergyMeterPacket
+type energyMeterJSON struct {
+	ID     deviceIDJSON        `json:"id"`
+	Ticker uint32              `json:"ticker"`
+	Values []measuredValueJSON `json:"values"`
+}
+
+// measuredValueJSON is the JSON representation of net2.MeasuredData
+type measuredValueJSON struct {
+	OBIS  string      `json:"obis"`
+	Value interface{} `json:"value"`
+}
+
+// MarshalJSON returns the header and all decoded entries of the packet
+func (p *Packet) MarshalJSON() ([]byte, error) {
+	entries := p.getEntries()
+	if p.lazy != nil && p.lazy.err != nil {
+		return nil, p.lazy.err
+	}
+
+	packet := packetJSON{
+		Header:  string(packetHeader[:3]),
+		Entries: make([]entryJSON, 0, len(entries)),
+	}
+	for _, e := range entries {
+		packet.Entries = append(packet.Entries, marshalEntry(e))
+	}
+	return json.Marshal(packet)
+}
+
+// marshalEntry converts the entry to its JSON representation
+func marshalEntry(e PacketEntry) entryJSON {
+	entry := entryJSON{
+		Tag:  fmt.Sprintf("0x%04X", e.Tag()),
+		Type: reflect.TypeOf(e).Elem().Name(),
+	}
+
+	switch e := e.(type) {
+	case *GroupPacketEntry:
+		entry.Content = map[string]uint32{"group": e.Group}
+	case *DiscoveryIPPacketEntry:
+		entry.Content = map[string]string{"ip": e.IP.String()}
+	case *UnknownPacketEntry:
+		entry.Content = map[string]string{"data": hex.EncodeToString(e.Data)}
+	case *SmaNet2PacketEntry:
+		if e.Content == nil {
+			break
+		}
+		entry.Protocol = fmt.Sprintf("0x%04X", e.Content.ProtocolID())
+		entry.Content = marshalNet2(e.Content)
+	}
+	return entry
+}
+
+// marshalNet2 converts the sub packet to its JSON representation
+func marshalNet2(content SmaNet2SubPacket) interface{} {
+	switch c := content.(type) {
+	case *net2.DeviceData:
+		data := deviceDataJSON{
+			Control:     fmt.Sprintf("0x%02X", c.Control),
+			Destination: deviceIDJSON(c.Destination),
+			JobNumber:   c.JobNumber,
+			Source:      deviceIDJSON(c.Source),
+			Status:      fmt.Sprintf("0x%04X", c.Status),
+			PacketCount: c.PacketCount,
+			PacketID:    c.PacketID,
+			Fragment:    c.Fragment,
+			Command:     fmt.Sprintf("0x%02X", c.Command),
+			Object:      fmt.Sprintf("0x%04X", c.Object),
+			Parameters:  make([]string, 0, len(c.Parameters)),
+			Data:        hex.EncodeToString(c.Data),
+		}
+		for _, param := range c.Parameters {
+			data.Parameters = append(data.Parameters, fmt.Sprintf("0x%08X", param))
+		}
+		for _, value := range c.ResponseValues {
+			data.Values = append(data.Values, responseValueJSON{
+				Class:     value.Class,
+				Code:      fmt.Sprintf("0x%04X", value.Code),
+				Type:      fmt.Sprintf("0x%02X", value.Type),
+				Timestamp: value.Timestamp,
+				Values:    value.Values,
+			})
+		}
+		return data
+
+	case *net2.EnergyMeterPacket:
+		meter := energyMeterJSON{
+			ID:     deviceIDJSON(c.Id),
+			Ticker: c.Ticker,
+			Values: make([]measuredValueJSON, 0, len(c.Values)),
+		}
+		for _, value := range c.Values {
+			meter.Values = append(meter.Values, measuredValueJSON{
+				OBIS:  value.OBIS.String(),
+				Value: value.Value,
+			})
+		}
+		return meter
+	}
+	return map[string]string{"data": hex.EncodeToString(content.Bytes())}
+}
@@ -0,0 +1,98 @@
+// Copyright 2019 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proto
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+
+	"github.com/pb82/sunny/proto/net2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPacket_MarshalJSON(t *testing.T) {
+	ass := assert.New(t)
+
+	packet := NewPacketBuilder().
+		Group(GroupDefault).
+		Net2(&net2.DeviceData{
+			Control:     0xa0,
+			Destination: net2.DeviceId{SusyID: 0x1234, SerialNumber: 0x12345678},
+			Source:      net2.DeviceId{SusyID: 0x007D, SerialNumber: 0x87654321},
+			PacketID:    0x0123,
+			Command:     net2.CommandGetValues,
+			Object:      0x5100,
+			Parameters:  []uint32{0x00263F00, 0x00263FFF},
+		}).
+		Build()
+
+	data, err := json.Marshal(packet)
+	ass.NoError(err)
+	ass.JSONEq(`{
+		"header": "SMA",
+		"entries": [
+			{"tag": "0x02A0", "type": "GroupPacketEntry", "content": {"group": 1}},
+			{"tag": "0x0010", "type": "SmaNet2PacketEntry", "protocol": "0x6065", "content": {
+				"control": "0xA0",
+				"destination": {"susyID": 4660, "serialNumber": 305419896},
+				"jobNumber": 0,
+				"source": {"susyID": 125, "serialNumber": 2271560481},
+				"status": "0x0000",
+				"packetCount": 0,
+				"packetID": 291,
+				"command": "0x00",
+				"object": "0x5100",
+				"parameters": ["0x00263F00", "0x00263FFF"]
+			}}
+		]
+	}`, string(data))
+}
+
+func TestPacket_MarshalJSON_entries(t *testing.T) {
+	ass := assert.New(t)
+
+	packet := NewPacketBuilder().
+		Entry(&DiscoveryIPPacketEntry{IP: net.IPv4(192, 168, 1, 20).To4()}).
+		Entry(&UnknownPacketEntry{T: 0x1234, Data: []byte{0xab, 0xcd}}).
+		Build()
+
+	data, err := json.Marshal(packet)
+	ass.NoError(err)
+	ass.JSONEq(`{
+		"header": "SMA",
+		"entries": [
+			{"tag": "0x0030", "type": "DiscoveryIPPacketEntry", "content": {"ip": "192.168.1.20"}},
+			{"tag": "0x1234", "type": "UnknownPacketEntry", "content": {"data": "abcd"}}
+		]
+	}`, string(data))
+}
+
+func TestPacket_MarshalJSON_lazyError(t *testing.T) {
+	ass := assert.New(t)
+
+	packet := new(Packet)
+	ass.NoError(packet.ReadLazy([]byte{
+		0x53, 0x4d, 0x41, 0x00, // header
+		0x00, 0x04, // packet data length
+		0x00, 0x10, // packet id (SmaNet2PacketEntry)
+		0x60, 0x65, 0x00, 0x00, // truncated device data
+		0x00, 0x00, 0x00, 0x00, // packet end
+		0x00, 0x00, 0x00, 0x00,
+	}))
+
+	_, err := json.Marshal(packet)
+	ass.ErrorIs(err, ErrTruncated)
+}
@@ -16,7 +16,6 @@ package net2
 
 import (
 	"encoding/binary"
-	"fmt"
 	"net"
 )
 
@@ -26,6 +25,14 @@ type DeviceId struct {
 	SerialNumber uint32
 }
 
+// BroadcastDeviceId addresses all devices
+var BroadcastDeviceId = DeviceId{SusyID: 0xFFFF, SerialNumber: 0xFFFFFFFF}
+
+// IsBroadcast checks if the ID addresses all devices
+func (d *DeviceId) IsBroadcast() bool {
+	return *d == BroadcastDeviceId
+}
+
 // Bytes returns binary data
 func (d *DeviceId) Bytes(byteOrder binary.ByteOrder) []byte {
 	data := make([]byte, 6)
@@ -37,7 +44,7 @@ func (d *DeviceId) Bytes(byteOrder binary.ByteOrder) []byte {
 // Read binary representation
 func (d *DeviceId) Read(data []byte, byteOrder binary.ByteOrder) error {
 	if len(data) < 6 {
-		return fmt.Errorf("invalid DeviceId - length %d", len(data))
+		return NewParseError(ErrTruncated, "invalid DeviceId - length %d", len(data))
 	}
 
 	d.SusyID = byteOrder.Uint16(data)
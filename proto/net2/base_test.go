@@ -120,3 +120,12 @@ func TestLocalDeviceId(t *testing.T) {
 	// we only test if the value are set
 	ass.True(id.SerialNumber != 0)
 }
+
+func TestDeviceId_IsBroadcast(t *testing.T) {
+	ass := assert.New(t)
+
+	ass.True(BroadcastDeviceId.IsBroadcast())
+	ass.False((&DeviceId{SusyID: 0xFFFF, SerialNumber: 1234}).IsBroadcast())
+	ass.False((&DeviceId{SusyID: 0x0138, SerialNumber: 0xFFFFFFFF}).IsBroadcast())
+	ass.False(new(DeviceId).IsBroadcast())
+}
@@ -16,7 +16,6 @@ package net2
 
 import (
 	"encoding/binary"
-	"fmt"
 	"strings"
 	"sync/atomic"
 )
@@ -24,6 +23,40 @@ import (
 // DeviceDataProtocolID protocol ID used for DeviceData sub packets
 const DeviceDataProtocolID uint16 = 0x6065
 
+// known control values of DeviceData
+const (
+	// ControlRequest default control of requests
+	ControlRequest uint8 = 0xa0
+	// ControlArchiveRequest control of archive requests
+	ControlArchiveRequest uint8 = 0xe0
+	// ControlResponse control of device data sent by devices
+	ControlResponse uint8 = 0xe0
+)
+
+// known commands of DeviceData
+const (
+	// CommandGetValues requests values of an object
+	CommandGetValues uint8 = 0x00
+	// CommandValues response with values
+	CommandValues uint8 = 0x01
+	// CommandLogin login request
+	CommandLogin uint8 = 0x0c
+	// CommandLogout logout request
+	CommandLogout uint8 = 0x0e
+)
+
+// known objects of DeviceData
+const (
+	// ObjectSession used for login and logout
+	ObjectSession uint16 = 0xfffd
+	// ObjectDayArchive of the energy counter in 5 minute intervals,
+	// responses contain DayArchiveRecordSize records in Data
+	ObjectDayArchive uint16 = 0x7000
+)
+
+// DayArchiveRecordSize of a record of the day archive (timestamp and energy counter in Wh)
+const DayArchiveRecordSize = 12
+
 // ResponseValue of device data packet response
 type ResponseValue struct {
 	Class     uint8
@@ -136,7 +169,7 @@ func (v *ResponseValue) Bytes(object uint16) []byte {
 // Read binary representation
 func (v *ResponseValue) Read(data []byte, object uint16) (int, error) {
 	if len(data) < 8 {
-		return 0, fmt.Errorf("invalid ResponseValue - length %d", len(data))
+		return 0, NewParseError(ErrTruncated, "invalid ResponseValue - length %d", len(data))
 	}
 
 	v.Class = data[0]
@@ -146,6 +179,9 @@ func (v *ResponseValue) Read(data []byte, object uint16) (int, error) {
 
 	// string value
 	if v.Type == 0x10 {
+		if len(data) < 40 {
+			return 8, NewParseError(ErrTruncated, "invalid ResponseValue - length %d", len(data))
+		}
 		v.Values = []interface{}{
 			strings.Trim(string(data[8:40]), "\x00"),
 		}
@@ -176,7 +212,7 @@ func (v *ResponseValue) Read(data []byte, object uint16) (int, error) {
 		// large integer value
 	} else if object == 0x5400 {
 		if len(data) < 16 {
-			return 8, fmt.Errorf("invalid ResponseValue - length %d", len(data))
+			return 8, NewParseError(ErrTruncated, "invalid ResponseValue - length %d", len(data))
 		}
 		v.Values = []interface{}{
 			binary.LittleEndian.Uint64(data[8:16]),
@@ -223,20 +259,25 @@ var packetIDCounter uint32
 // more or less unique ID of the current system
 var systemID *DeviceId
 
+// PacketIDMask of the packet ID, the highest bit is a flag
+const PacketIDMask = 0x7FFF
+
+// NextPacketID returns the next packet ID of the system
+func NextPacketID() uint16 {
+	return uint16(atomic.AddUint32(&packetIDCounter, 1) & PacketIDMask)
+}
+
 // NewDeviceData creates a device data request
 func NewDeviceData(control uint8) *DeviceData {
-	pkgId := atomic.AddUint32(&packetIDCounter, 1)
-
 	// initialize system id on first call
 	if systemID == nil {
 		systemID = LocalDeviceId()
 	}
 
 	return &DeviceData{
-		Control: control,
-		Source:  *systemID,
-		// count up only last byte
-		PacketID: uint16(pkgId & 0xFF),
+		Control:  control,
+		Source:   *systemID,
+		PacketID: NextPacketID(),
 	}
 }
 
@@ -251,6 +292,9 @@ type DeviceData struct {
 	Status      uint16
 	PacketCount uint16
 	PacketID    uint16
+	// Fragment marks following frames of a multi-frame response, their packet
+	// ID is sent without the first frame flag (0x8000)
+	Fragment bool
 
 	Command uint8
 	Object  uint16
@@ -260,7 +304,7 @@ type DeviceData struct {
 	// used for responses
 	ResponseValues []*ResponseValue
 
-	// used for requests
+	// used for requests and archive responses
 	Data []byte
 }
 
@@ -296,7 +340,11 @@ func (d *DeviceData) Bytes() []byte {
 
 	binary.LittleEndian.PutUint16(data[18:], d.Status)
 	binary.LittleEndian.PutUint16(data[20:], d.PacketCount)
-	binary.LittleEndian.PutUint16(data[22:], d.PacketID|0x8000)
+	if d.Fragment {
+		binary.LittleEndian.PutUint16(data[22:], d.PacketID&PacketIDMask)
+	} else {
+		binary.LittleEndian.PutUint16(data[22:], d.PacketID|0x8000)
+	}
 
 	data[24] = d.Command
 	data[25] = uint8(parameterCount)
@@ -316,13 +364,13 @@ func (d *DeviceData) Bytes() []byte {
 // Read binary representation
 func (d *DeviceData) Read(data []byte) error {
 	if len(data) < 30 {
-		return fmt.Errorf("invalid DeviceData - length %d", len(data))
+		return NewParseError(ErrTruncated, "invalid DeviceData - length %d", len(data))
 	}
 
 	// validate data size
 	length := int(data[0]) * 4
 	if len(data) != length {
-		return fmt.Errorf(
+		return NewParseError(ErrBadChecksum,
 			"invalid sma net2 data size. expected %d - get %d",
 			length, len(data))
 	}
@@ -348,12 +396,18 @@ func (d *DeviceData) Read(data []byte) error {
 
 	d.Status = binary.LittleEndian.Uint16(data[18:])
 	d.PacketCount = binary.LittleEndian.Uint16(data[20:])
-	d.PacketID = binary.LittleEndian.Uint16(data[22:]) & ^uint16(0x8000)
+	d.PacketID = binary.LittleEndian.Uint16(data[22:]) & PacketIDMask
+	d.Fragment = binary.LittleEndian.Uint16(data[22:])&0x8000 == 0
 
 	d.Command = uint8(data[24])
 	parameterCount := int(data[25])
 	d.Object = binary.LittleEndian.Uint16(data[26:])
 
+	if len(data) < 28+parameterCount*4 {
+		return NewParseError(ErrTruncated,
+			"invalid DeviceData - %d parameters exceed length %d", parameterCount, len(data))
+	}
+
 	d.Parameters = make([]uint32, parameterCount)
 	index := 28
 	// parse parameters
@@ -364,7 +418,12 @@ func (d *DeviceData) Read(data []byte) error {
 
 	// no data or response
 	dataLength := len(data)
-	if dataLength-index <= 0 || d.Command != 0x01 {
+	if dataLength-index <= 0 {
+		return nil
+	}
+	// data of requests (e.g. login password) and archive records
+	if d.Command != CommandValues || d.Object == ObjectDayArchive {
+		d.Data = append([]byte(nil), data[index:]...)
 		return nil
 	}
 
@@ -599,6 +599,41 @@ func TestDeviceData_Read(t *testing.T) {
 	ass.Equal(uint32(0x12345678), data.ResponseValues[0].Timestamp)
 }
 
+func TestDeviceData_Read_requestData(t *testing.T) {
+	ass := assert.New(t)
+
+	request := NewDeviceData(ControlRequest)
+	request.Command = CommandLogin
+	request.Object = ObjectSession
+	request.AddParameter(0x07)
+	request.Data = []byte{0x88, 0x88, 0x88, 0x88}
+
+	data := new(DeviceData)
+	ass.NoError(data.Read(request.Bytes()))
+	ass.Equal([]uint32{0x07}, data.Parameters)
+	ass.Equal([]byte{0x88, 0x88, 0x88, 0x88}, data.Data)
+	ass.Nil(data.ResponseValues)
+}
+
+func TestDeviceData_Read_dayArchive(t *testing.T) {
+	ass := assert.New(t)
+
+	records := []byte{
+		0x2C, 0x01, 0x00, 0x00, 0x10, 0x27, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x58, 0x02, 0x00, 0x00, 0x20, 0x27, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	}
+	response := NewDeviceData(ControlArchiveRequest)
+	response.Command = CommandValues
+	response.Object = ObjectDayArchive
+	response.Parameters = []uint32{0, 1}
+	response.Data = records
+
+	data := new(DeviceData)
+	ass.NoError(data.Read(response.Bytes()))
+	ass.Equal(records, data.Data)
+	ass.Nil(data.ResponseValues)
+}
+
 func TestDeviceData_AddParameter(t *testing.T) {
 	ass := assert.New(t)
 
@@ -612,3 +647,101 @@ func TestDeviceData_AddParameter(t *testing.T) {
 		0x87654321,
 	}, data.Parameters)
 }
+
+func TestDeviceData_Read_errors(t *testing.T) {
+	ass := assert.New(t)
+
+	data := new(DeviceData)
+	ass.ErrorIs(data.Read([]byte{0x09, 0x12}), ErrTruncated)
+
+	err := data.Read([]byte{
+		0x05,       // length (invalid)
+		0x12,       // control
+		0x34, 0x12, // DstSusyID
+		0x78, 0x56, 0x34, 0x12, // DstSerialNumber
+		0x00,       // unknown
+		0x12,       // JobNumber
+		0x34, 0x12, // SrcSusyID
+		0x78, 0x56, 0x34, 0x12, // SrcSerialNumber
+		0x00,       // unknown
+		0x12,       // JobNumber
+		0x34, 0x12, // Status
+		0x43, 0x21, // PacketCount
+		0x23, 0x81, // PacketID | 0x8000
+		0x12,       // Command
+		0x02,       // Parameter count
+		0x34, 0x12, // Object
+		0x78, 0x56, 0x34, 0x12, // parameter 1
+		0x78, 0x56, 0x34, 0x12, // parameter 2
+	})
+	ass.ErrorIs(err, ErrBadChecksum)
+
+	err = data.Read([]byte{
+		0x08,       // length
+		0x12,       // control
+		0x34, 0x12, // DstSusyID
+		0x78, 0x56, 0x34, 0x12, // DstSerialNumber
+		0x00,       // unknown
+		0x12,       // JobNumber
+		0x34, 0x12, // SrcSusyID
+		0x78, 0x56, 0x34, 0x12, // SrcSerialNumber
+		0x00,       // unknown
+		0x12,       // JobNumber
+		0x34, 0x12, // Status
+		0x43, 0x21, // PacketCount
+		0x23, 0x81, // PacketID | 0x8000
+		0x12,       // Command
+		0x05,       // Parameter count (exceeds data)
+		0x34, 0x12, // Object
+		0x78, 0x56, 0x34, 0x12, // parameter 1
+	})
+	ass.ErrorIs(err, ErrTruncated)
+	ass.EqualError(err, "invalid DeviceData - 5 parameters exceed length 32")
+}
+
+func TestResponseValue_Read_truncatedString(t *testing.T) {
+	ass := assert.New(t)
+
+	value := new(ResponseValue)
+	_, err := value.Read([]byte{
+		0x12,       // class
+		0x34, 0x12, // code
+		0x10,                   // type (string)
+		0x78, 0x56, 0x34, 0x12, // timestamp
+		0x41, 0x42, // truncated string
+	}, 0x5800)
+	ass.ErrorIs(err, ErrTruncated)
+}
+
+func FuzzDeviceData_Read(f *testing.F) {
+	request := NewDeviceData(0xa0)
+	request.Command = 0x01
+	request.Object = 0x5800
+	request.AddParameter(0x00821E00)
+	request.AddParameter(0x008220FF)
+	request.Data = make([]byte, 40)
+	f.Add(request.Bytes())
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		packet := new(DeviceData)
+		_ = packet.Read(data)
+	})
+}
+
+func TestDeviceData_fragment(t *testing.T) {
+	ass := assert.New(t)
+
+	data := &DeviceData{PacketID: 0x0123, PacketCount: 1, Parameters: []uint32{0}, Fragment: true}
+	raw := data.Bytes()
+	ass.Equal([]byte{0x23, 0x01}, raw[22:24])
+
+	read := new(DeviceData)
+	ass.NoError(read.Read(raw))
+	ass.Equal(uint16(0x0123), read.PacketID)
+	ass.True(read.Fragment)
+
+	data.Fragment = false
+	ass.NoError(read.Read(data.Bytes()))
+	ass.Equal(uint16(0x0123), read.PacketID)
+	ass.False(read.Fragment)
+}
@@ -43,7 +43,7 @@ func (o *OBISIdentifier) Bytes() []byte {
 // Read binary representation
 func (o *OBISIdentifier) Read(data []byte) error {
 	if len(data) < 4 {
-		return fmt.Errorf("invalid OBISIdentifier - length %d", len(data))
+		return NewParseError(ErrTruncated, "invalid OBISIdentifier - length %d", len(data))
 	}
 
 	o.Channel = data[0]
@@ -83,7 +83,7 @@ func (e *MeasuredData) Bytes() []byte {
 // Read binary representation
 func (e *MeasuredData) Read(data []byte) error {
 	if len(data) < 8 {
-		return fmt.Errorf("invalid MeasuredData - length %d", len(data))
+		return NewParseError(ErrTruncated, "invalid MeasuredData - length %d", len(data))
 	}
 
 	err := e.OBIS.Read(data)
@@ -93,7 +93,7 @@ func (e *MeasuredData) Read(data []byte) error {
 
 	if e.OBIS.MeasurementType == 8 {
 		if len(data) < 12 {
-			return fmt.Errorf("invalid large MeasuredData - length %d", len(data))
+			return NewParseError(ErrTruncated, "invalid large MeasuredData - length %d", len(data))
 		}
 		e.Value = binary.BigEndian.Uint64(data[4:])
 	} else {
@@ -134,7 +134,7 @@ func (e *EnergyMeterPacket) Bytes() []byte {
 // Read binary representation
 func (e *EnergyMeterPacket) Read(data []byte) error {
 	if len(data) < 10 {
-		return fmt.Errorf("invalid EnergyMeterPacket - length %d", len(data))
+		return NewParseError(ErrTruncated, "invalid EnergyMeterPacket - length %d", len(data))
 	}
 
 	err := e.Id.Read(data, binary.BigEndian)
@@ -243,3 +243,33 @@ func TestEnergyMeterPacket_GetValues(t *testing.T) {
 	ass.Equal(uint32(0x12345678), values["1:2.3.4"])
 	ass.Equal(uint64(0x1234567812345678), values["1:2.8.4"])
 }
+
+func TestEnergyMeterPacket_Read_errors(t *testing.T) {
+	ass := assert.New(t)
+
+	packet := new(EnergyMeterPacket)
+	ass.ErrorIs(packet.Read([]byte{0x12, 0x34}), ErrTruncated)
+
+	ass.ErrorIs(packet.Read([]byte{
+		0x12, 0x34, 0x12, 0x34, 0x56, 0x78, // id
+		0x21, 0x43, 0x65, 0x87, // ticker
+		0x01, 0x02, 0x08, 0x04, 0x12, 0x34, 0x56, 0x78, // truncated large value
+	}), ErrTruncated)
+}
+
+func FuzzEnergyMeterPacket_Read(f *testing.F) {
+	f.Add([]byte{
+		0x12, 0x34, 0x12, 0x34, 0x56, 0x78, // id
+		0x21, 0x43, 0x65, 0x87, // ticker
+		0x01, 0x02, 0x03, 0x04, 0x12, 0x34, 0x56, 0x78, // value 1
+		0x01, 0x02, 0x08, 0x04, 0x12, 0x34, 0x56, 0x78, 0x12, 0x34, 0x56, 0x78, // value 2
+	})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		packet := new(EnergyMeterPacket)
+		if packet.Read(data) != nil {
+			return
+		}
+		_ = packet.GetValues()
+	})
+}
@@ -0,0 +1,57 @@
+// Copyright 2019 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package net2
+
+import (
+	"errors"
+	"fmt"
+)
+
+// kinds of parse errors
+var (
+	// ErrTruncated data is shorter than required
+	ErrTruncated = errors.New("truncated data")
+	// ErrBadTag unknown or invalid identifier
+	ErrBadTag = errors.New("bad tag")
+	// ErrBadChecksum integrity check (e.g. length field) of data failed
+	ErrBadChecksum = errors.New("bad checksum")
+)
+
+// ParseError describes failed parsing of binary data.
+// Use errors.Is with ErrTruncated, ErrBadTag or ErrBadChecksum to check the kind.
+type ParseError struct {
+	// Kind of the error
+	Kind error
+	// Msg with details
+	Msg string
+}
+
+// Error returns the detailed message
+func (e *ParseError) Error() string {
+	return e.Msg
+}
+
+// Unwrap returns the kind of the error
+func (e *ParseError) Unwrap() error {
+	return e.Kind
+}
+
+// NewParseError creates a new ParseError of the given kind
+func NewParseError(kind error, format string, args ...interface{}) error {
+	return &ParseError{
+		Kind: kind,
+		Msg:  fmt.Sprintf(format, args...),
+	}
+}
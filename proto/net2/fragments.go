@@ -0,0 +1,95 @@
+// Copyright 2019 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package net2
+
+import "time"
+
+// FragmentTimeout after which frames of an incomplete response are discarded
+const FragmentTimeout = 5 * time.Second
+
+// Fragments reassembles device data responses which span multiple frames.
+//
+// All frames of a response share the packet ID. The packet count of the
+// frames counts down to 0, which marks the last frame. Only the first frame
+// carries the first frame flag, so its packet count defines the amount of frames.
+type Fragments struct {
+	frames map[uint16]*DeviceData
+	// amount of frames, 0 until the first frame is received
+	total int
+	// reception of the first received frame
+	started time.Time
+}
+
+// Add a received frame. Returns the reassembled response as soon as all
+// frames are received, otherwise nil. Frames of a response not completed
+// within FragmentTimeout are discarded.
+func (f *Fragments) Add(data *DeviceData) *DeviceData {
+	now := time.Now()
+	if len(f.frames) > 0 && now.Sub(f.started) > FragmentTimeout {
+		f.reset()
+	}
+
+	// single frame response
+	if !data.Fragment && data.PacketCount == 0 && len(f.frames) == 0 {
+		return data
+	}
+
+	if f.frames == nil {
+		f.frames = make(map[uint16]*DeviceData)
+		f.started = now
+	}
+	if _, ok := f.frames[data.PacketCount]; ok {
+		return nil // duplicate frame
+	}
+	f.frames[data.PacketCount] = data
+	if !data.Fragment {
+		f.total = int(data.PacketCount) + 1
+		// frames of another response
+		for count := range f.frames {
+			if int(count) >= f.total {
+				delete(f.frames, count)
+			}
+		}
+	}
+
+	// wait for the first and missing frames
+	if f.total == 0 || len(f.frames) != f.total {
+		return nil
+	}
+
+	// join values and data of all frames (starting with the first one)
+	result := *f.frames[uint16(f.total-1)]
+	result.PacketCount = 0
+	result.ResponseValues = nil
+	result.Data = nil
+	for i := f.total - 1; i >= 0; i-- {
+		result.ResponseValues = append(result.ResponseValues, f.frames[uint16(i)].ResponseValues...)
+		result.Data = append(result.Data, f.frames[uint16(i)].Data...)
+	}
+
+	f.reset()
+	return &result
+}
+
+// reset discards all received frames
+func (f *Fragments) reset() {
+	f.frames = nil
+	f.total = 0
+}
+
+// Pending returns the amount of already received frames of an incomplete response
+func (f *Fragments) Pending() int {
+	return len(f.frames)
+}
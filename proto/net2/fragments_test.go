@@ -0,0 +1,120 @@
+// Copyright 2019 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package net2
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFragments_Add_single(t *testing.T) {
+	ass := assert.New(t)
+
+	data := &DeviceData{PacketID: 0x12}
+	fragments := new(Fragments)
+	ass.Equal(data, fragments.Add(data))
+	ass.Equal(0, fragments.Pending())
+}
+
+func TestFragments_Add(t *testing.T) {
+	ass := assert.New(t)
+
+	value1 := &ResponseValue{Code: 0x1}
+	value2 := &ResponseValue{Code: 0x2}
+	value3 := &ResponseValue{Code: 0x3}
+
+	fragments := new(Fragments)
+	ass.Nil(fragments.Add(&DeviceData{PacketID: 0x12, PacketCount: 2, ResponseValues: []*ResponseValue{value1}}))
+	// out of order and duplicate
+	ass.Nil(fragments.Add(&DeviceData{PacketID: 0x12, PacketCount: 0, Fragment: true, ResponseValues: []*ResponseValue{value3}}))
+	ass.Nil(fragments.Add(&DeviceData{PacketID: 0x12, PacketCount: 0, Fragment: true, ResponseValues: []*ResponseValue{value3}}))
+	ass.Equal(2, fragments.Pending())
+
+	result := fragments.Add(&DeviceData{PacketID: 0x12, PacketCount: 1, Fragment: true, ResponseValues: []*ResponseValue{value2}})
+	ass.NotNil(result)
+	ass.Equal(uint16(0x12), result.PacketID)
+	ass.Equal(uint16(0), result.PacketCount)
+	ass.Equal([]*ResponseValue{value1, value2, value3}, result.ResponseValues)
+	ass.Equal(0, fragments.Pending())
+}
+
+func TestFragments_Add_data(t *testing.T) {
+	ass := assert.New(t)
+
+	fragments := new(Fragments)
+	ass.Nil(fragments.Add(&DeviceData{PacketID: 0x12, PacketCount: 1, Data: []byte{1, 2}}))
+	result := fragments.Add(&DeviceData{PacketID: 0x12, PacketCount: 0, Fragment: true, Data: []byte{3}})
+	ass.NotNil(result)
+	ass.Equal([]byte{1, 2, 3}, result.Data)
+}
+
+func TestFragments_Add_lastFrameFirst(t *testing.T) {
+	ass := assert.New(t)
+
+	value1 := &ResponseValue{Code: 0x1}
+	value2 := &ResponseValue{Code: 0x2}
+
+	fragments := new(Fragments)
+	ass.Nil(fragments.Add(&DeviceData{PacketID: 0x12, PacketCount: 0, Fragment: true, ResponseValues: []*ResponseValue{value2}}))
+	ass.Equal(1, fragments.Pending())
+
+	result := fragments.Add(&DeviceData{PacketID: 0x12, PacketCount: 1, ResponseValues: []*ResponseValue{value1}})
+	ass.NotNil(result)
+	ass.False(result.Fragment)
+	ass.Equal([]*ResponseValue{value1, value2}, result.ResponseValues)
+}
+
+func TestFragments_Add_lostFirstFrame(t *testing.T) {
+	ass := assert.New(t)
+
+	value1 := &ResponseValue{Code: 0x1}
+	value2 := &ResponseValue{Code: 0x2}
+	value3 := &ResponseValue{Code: 0x3}
+
+	// first frame (count 2) lost -> no truncated response
+	fragments := new(Fragments)
+	ass.Nil(fragments.Add(&DeviceData{PacketID: 0x12, PacketCount: 1, Fragment: true, ResponseValues: []*ResponseValue{value2}}))
+	ass.Nil(fragments.Add(&DeviceData{PacketID: 0x12, PacketCount: 0, Fragment: true, ResponseValues: []*ResponseValue{value3}}))
+	ass.Equal(2, fragments.Pending())
+
+	// resent response completes it
+	result := fragments.Add(&DeviceData{PacketID: 0x12, PacketCount: 2, ResponseValues: []*ResponseValue{value1}})
+	ass.NotNil(result)
+	ass.Equal([]*ResponseValue{value1, value2, value3}, result.ResponseValues)
+}
+
+func TestFragments_Add_lostMiddleFrame(t *testing.T) {
+	ass := assert.New(t)
+
+	fragments := new(Fragments)
+	ass.Nil(fragments.Add(&DeviceData{PacketID: 0x12, PacketCount: 2}))
+	ass.Nil(fragments.Add(&DeviceData{PacketID: 0x12, PacketCount: 0, Fragment: true}))
+	ass.Equal(2, fragments.Pending())
+}
+
+func TestFragments_Add_timeout(t *testing.T) {
+	ass := assert.New(t)
+
+	fragments := new(Fragments)
+	ass.Nil(fragments.Add(&DeviceData{PacketID: 0x12, PacketCount: 0, Fragment: true}))
+	fragments.started = time.Now().Add(-FragmentTimeout - time.Second)
+
+	// outdated frames are discarded -> single frame response
+	data := &DeviceData{PacketID: 0x12}
+	ass.Equal(data, fragments.Add(data))
+	ass.Equal(0, fragments.Pending())
+}
@@ -16,7 +16,6 @@ package proto
 
 import (
 	"encoding/binary"
-	"fmt"
 
 	"github.com/pb82/sunny/proto/net2"
 )
@@ -54,7 +53,7 @@ func (e *SmaNet2PacketEntry) Bytes() []byte {
 // Read packet from the given binary data
 func (e *SmaNet2PacketEntry) Read(data []byte) (PacketEntry, error) {
 	if len(data) < 4 {
-		return nil, fmt.Errorf("invalid SmaNet2PacketEntry - length %d", len(data))
+		return nil, net2.NewParseError(ErrTruncated, "invalid SmaNet2PacketEntry - length %d", len(data))
 	}
 
 	protoID := binary.BigEndian.Uint16(data[0:2])
@@ -0,0 +1,157 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/pb82/sunny"
+	"github.com/pb82/sunny/sunnytest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serveSOCKS5 accepts SOCKS5 connections with user/password authentication and
+// connects them with the dialer
+func serveSOCKS5(listener net.Listener, user, password string, dialer sunny.Dialer) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			target, err := socks5Handshake(conn, user, password, dialer)
+			if err != nil {
+				return
+			}
+			defer target.Close()
+			go func() {
+				_, _ = io.Copy(target, conn)
+				_ = target.Close()
+			}()
+			_, _ = io.Copy(conn, target)
+		}()
+	}
+}
+
+// socks5Handshake of RFC 1928 and RFC 1929, returns the connected target
+func socks5Handshake(conn net.Conn, user, password string, dialer sunny.Dialer) (net.Conn, error) {
+	// greeting -> user/password authentication
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(conn, make([]byte, header[1])); err != nil {
+		return nil, err
+	}
+	if _, err := conn.Write([]byte{5, 2}); err != nil {
+		return nil, err
+	}
+
+	// authentication
+	credentials := make([][]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return nil, err
+	}
+	credentials[0] = make([]byte, header[1])
+	if _, err := io.ReadFull(conn, credentials[0]); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(conn, header[:1]); err != nil {
+		return nil, err
+	}
+	credentials[1] = make([]byte, header[0])
+	if _, err := io.ReadFull(conn, credentials[1]); err != nil {
+		return nil, err
+	}
+	if string(credentials[0]) != user || string(credentials[1]) != password {
+		_, _ = conn.Write([]byte{1, 1})
+		return nil, io.ErrUnexpectedEOF
+	}
+	if _, err := conn.Write([]byte{1, 0}); err != nil {
+		return nil, err
+	}
+
+	// connect to the target (domain names only)
+	request := make([]byte, 5)
+	if _, err := io.ReadFull(conn, request); err != nil {
+		return nil, err
+	}
+	host := make([]byte, int(request[4])+2)
+	if _, err := io.ReadFull(conn, host); err != nil {
+		return nil, err
+	}
+	target, err := dialer.DialContext(context.Background(), "tcp", string(host[:len(host)-2]))
+	if err != nil {
+		_, _ = conn.Write([]byte{5, 4, 0, 1, 0, 0, 0, 0, 0, 0})
+		return nil, err
+	}
+	if _, err := conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0}); err != nil {
+		_ = target.Close()
+		return nil, err
+	}
+	return target, nil
+}
+
+func TestSOCKS5Dialer(t *testing.T) {
+	network := sunnytest.NewNetwork()
+	defer network.Close()
+	inverter, err := network.AddInverter("192.168.0.20", 1234, "0000")
+	require.NoError(t, err)
+	inverter.SetValue(sunny.ActivePowerPlus, uint32(1500))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	relay, _ := serveTunnel(t, ctx, network)
+
+	proxy, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer proxy.Close()
+	go serveSOCKS5(proxy, "user", "secret", relay)
+
+	tests := []struct {
+		name     string
+		password string
+		err      bool
+	}{
+		{name: "authenticated", password: "secret"},
+		{name: "wrong password", password: "wrong", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ass := assert.New(t)
+
+			dialer, err := sunny.SOCKS5Dialer(proxy.Addr().String(), "user", tt.password)
+			require.NoError(t, err)
+			connection, err := sunny.NewTunnelConnectionVia(ctx, dialer, "relay:9522", nil)
+			if tt.err {
+				ass.Error(err)
+				return
+			}
+			require.NoError(t, err)
+			defer connection.Close()
+
+			device, err := connection.NewDevice("192.168.0.20", "0000")
+			require.NoError(t, err)
+			values, err := device.GetValues()
+			ass.NoError(err)
+			ass.Equal(uint32(1500), values[sunny.ActivePowerPlus])
+		})
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// rateLimiter is a token bucket limiting sent packets
+type rateLimiter struct {
+	mutex sync.Mutex
+
+	// tokens added per second (0 -> unlimited)
+	rate float64
+	// maximum amount of tokens
+	burst float64
+
+	tokens float64
+	last   time.Time
+
+	// amount of waiting senders per priority
+	waiting map[Priority]int
+}
+
+// set rate and burst of the limiter
+func (l *rateLimiter) set(rate float64, burst int) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if burst < 1 {
+		burst = 1
+	}
+	l.rate = rate
+	l.burst = float64(burst)
+	l.tokens = l.burst
+	l.last = time.Now()
+}
+
+// wait until a token is available and take it.
+// Senders with higher priority take the tokens first.
+// The error of ctx is returned if it is done before.
+func (l *rateLimiter) wait(ctx context.Context, priority Priority) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.rate <= 0 {
+		return nil
+	}
+
+	if l.waiting == nil {
+		l.waiting = make(map[Priority]int)
+	}
+	l.waiting[priority]++
+	defer func() {
+		l.waiting[priority]--
+	}()
+
+	for {
+		now := time.Now()
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+		l.last = now
+
+		if l.tokens >= 1 && !l.preempted(priority) {
+			l.tokens--
+			return nil
+		}
+
+		// wait for missing token or until senders with higher priority are done
+		delay := time.Duration(1 / l.rate * float64(time.Second))
+		if l.tokens < 1 {
+			delay = time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+		}
+		l.mutex.Unlock()
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			l.mutex.Lock()
+			return ctx.Err()
+		}
+		l.mutex.Lock()
+	}
+}
+
+// preempted returns true if senders with higher priority are waiting
+func (l *rateLimiter) preempted(priority Priority) bool {
+	for p, count := range l.waiting {
+		if p > priority && count > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// SetRateLimit for sent packets of this connection.
+// At most rate packets per second are sent with bursts of up to burst packets.
+// A rate of 0 disables the limit.
+func (c *Connection) SetRateLimit(rate float64, burst int) {
+	c.limiter.set(rate, burst)
+}
@@ -0,0 +1,67 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter_wait(t *testing.T) {
+	tests := []struct {
+		name  string
+		rate  float64
+		burst int
+		// amount of waits and the minimum duration of all of them
+		waits   int
+		minimum time.Duration
+	}{
+		{"unlimited", 0, 0, 100, 0},
+		{"burst", 10, 3, 3, 0},
+		{"rate after burst", 20, 2, 4, 100 * time.Millisecond},
+		{"burst below 1", 20, 0, 2, 50 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ass := assert.New(t)
+
+			var limiter rateLimiter
+			limiter.set(tt.rate, tt.burst)
+			start := time.Now()
+			for range tt.waits {
+				ass.NoError(limiter.wait(context.Background(), PriorityNormal))
+			}
+			elapsed := time.Since(start)
+			ass.GreaterOrEqual(elapsed, tt.minimum-5*time.Millisecond)
+			ass.Less(elapsed, tt.minimum+time.Second)
+		})
+	}
+}
+
+func TestRateLimiter_wait_ctx(t *testing.T) {
+	ass := assert.New(t)
+
+	var limiter rateLimiter
+	limiter.set(0.1, 1)
+	ass.NoError(limiter.wait(context.Background(), PriorityNormal))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	ass.ErrorIs(limiter.wait(ctx, PriorityNormal), context.DeadlineExceeded)
+	ass.Zero(limiter.waiting[PriorityNormal])
+}
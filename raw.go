@@ -0,0 +1,49 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pb82/sunny/proto"
+	"github.com/pb82/sunny/proto/net2"
+)
+
+// ReadRaw reads the untouched records of an LRI range from the inverter.
+// object is the LRI (object ID) of the range, e.g. 0x00263F00 for all records
+// with code 0x263F, class is the object class of the request, e.g. 0x5100.
+func (d *Device) ReadRaw(ctx context.Context, object uint32, class uint32) ([]*net2.ResponseValue, error) {
+	if class > 0xFFFF {
+		return nil, fmt.Errorf("%w: invalid object class 0x%X", ErrUnsupportedValue, class)
+	}
+
+	response, err := d.SendCommand(ctx, proto.Command{
+		Command:    net2.CommandGetValues,
+		Object:     uint16(class),
+		Parameters: []uint32{object &^ 0xFF, object | 0xFF},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if response.Status == 0x15 {
+		return nil, fmt.Errorf("%w: 0x%X 0x%X", ErrUnsupportedValue, class, object)
+	}
+	if response.Status != 0 {
+		return nil, fmt.Errorf("failed to read raw values: %w (status 0x%X)", ErrDeviceBusy, response.Status)
+	}
+	return response.Values, nil
+}
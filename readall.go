@@ -0,0 +1,72 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"context"
+	"sync"
+)
+
+// maxParallelDevices limits the amount of devices read at the same time by ReadAll
+const maxParallelDevices = 8
+
+// ReadAll reads the values of all devices concurrently and returns the result per device.
+// Only the values with the given names (e.g. "ActivePowerPlus") are returned, all if keys is empty.
+// Sent packets are limited by the rate limit of the connection (see SetRateLimit).
+func (c *Connection) ReadAll(ctx context.Context, devices []*Device, keys []string) (map[*Device]Result, error) {
+	ids := make(map[ValueID]bool, len(keys))
+	for _, key := range keys {
+		id, err := LookupValueID(key)
+		if err != nil {
+			return nil, err
+		}
+		ids[id] = true
+	}
+
+	results := make(map[*Device]Result, len(devices))
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	limit := make(chan struct{}, maxParallelDevices)
+	for _, device := range devices {
+		wg.Add(1)
+		limit <- struct{}{}
+		go func(device *Device) {
+			defer func() {
+				<-limit
+				wg.Done()
+			}()
+
+			values, err := device.GetValuesCtx(ctx)
+			if len(ids) > 0 {
+				for id := range values {
+					if !ids[id] {
+						delete(values, id)
+					}
+				}
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			results[device] = Result{
+				Device: device,
+				Values: values,
+				Err:    err,
+			}
+		}(device)
+	}
+	wg.Wait()
+
+	return results, nil
+}
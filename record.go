@@ -0,0 +1,357 @@
+// Copyright 2019 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/pb82/sunny/proto"
+	"github.com/pb82/sunny/proto/net2"
+)
+
+// directions of recorded packets
+const (
+	// RecordSend marks a packet sent by the library
+	RecordSend = "send"
+	// RecordReceive marks a packet received from the network
+	RecordReceive = "recv"
+)
+
+// RecordEntry is a single packet of a recorded session
+type RecordEntry struct {
+	// Direction of the packet (RecordSend or RecordReceive)
+	Direction string `json:"dir"`
+	// Address of the remote side
+	Address string `json:"addr"`
+	// Offset since start of the recording
+	Offset time.Duration `json:"offset"`
+	// Data of the packet (hex encoded in fixture)
+	Data HexData `json:"data"`
+}
+
+// HexData is a byte slice which is hex encoded in JSON
+type HexData []byte
+
+// MarshalJSON encodes the data as hex string
+func (h HexData) MarshalJSON() ([]byte, error) {
+	return json.Marshal(hex.EncodeToString(h))
+}
+
+// UnmarshalJSON decodes the data from a hex string
+func (h *HexData) UnmarshalJSON(data []byte) error {
+	var s string
+	err := json.Unmarshal(data, &s)
+	if err != nil {
+		return err
+	}
+	*h, err = hex.DecodeString(s)
+	return err
+}
+
+// Recorder writes all packets of a Connection into a fixture.
+// The fixture contains one JSON encoded RecordEntry per line.
+type Recorder struct {
+	w     io.Writer
+	start time.Time
+}
+
+// NewRecorder creates a recorder writing the fixture to w
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{
+		w:     w,
+		start: time.Now(),
+	}
+}
+
+// add packet to the recording
+func (r *Recorder) add(direction string, address net.Addr, data []byte) error {
+	line, err := json.Marshal(RecordEntry{
+		Direction: direction,
+		Address:   address.String(),
+		Offset:    time.Since(r.start),
+		Data:      data,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = r.w.Write(append(line, '\n'))
+	return err
+}
+
+// ReadRecording loads all entries of a fixture
+func ReadRecording(r io.Reader) ([]RecordEntry, error) {
+	var entries []RecordEntry
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var entry RecordEntry
+		err := json.Unmarshal(scanner.Bytes(), &entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid recording entry %d: %w", len(entries)+1, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// NewReplayConnection creates a Connection that replays a recorded session
+// instead of using the network. Recorded device responses are delivered after
+// the library sent the matching request; their packet IDs are updated to the
+// ones of the replayed requests. Other received packets are delivered in the
+// recorded order.
+func NewReplayConnection(recording io.Reader) (*Connection, error) {
+	entries, err := ReadRecording(recording)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewPacketConnection(newReplayConn(entries))
+}
+
+// replayConn implements net.PacketConn based on a recording
+type replayConn struct {
+	mutex   sync.Mutex
+	entries []*replayEntry
+	// maps recorded to replayed packet IDs of requests
+	packetIDs map[uint16]uint16
+
+	pending chan replayPacket
+	closed  chan struct{}
+	once    sync.Once
+}
+
+// replayEntry is a recorded packet with its replay state
+type replayEntry struct {
+	RecordEntry
+	data     *net2.DeviceData
+	done     bool
+	response bool
+}
+
+// replayPacket is a received packet ready for delivery
+type replayPacket struct {
+	address *net.UDPAddr
+	data    []byte
+}
+
+// newReplayConn creates a replayConn and queues all packets received before the first send
+func newReplayConn(entries []RecordEntry) *replayConn {
+	conn := &replayConn{
+		packetIDs: make(map[uint16]uint16),
+		pending:   make(chan replayPacket, len(entries)),
+		closed:    make(chan struct{}),
+	}
+
+	for _, e := range entries {
+		entry := &replayEntry{
+			RecordEntry: e,
+			data:        parseDeviceData(e.Data),
+		}
+		entry.response = e.Direction == RecordReceive &&
+			entry.data != nil && entry.data.Command == net2.CommandValues
+		conn.entries = append(conn.entries, entry)
+	}
+
+	conn.mutex.Lock()
+	conn.queueReceived()
+	conn.mutex.Unlock()
+	return conn
+}
+
+// queueReceived packets that are ready for delivery:
+// responses of replayed requests and other packets not preceded by
+// recorded requests which were not replayed yet.
+func (r *replayConn) queueReceived() {
+	blocked := false
+	for _, entry := range r.entries {
+		if entry.done {
+			continue
+		}
+		if entry.Direction == RecordSend {
+			blocked = true
+			continue
+		}
+
+		data := append([]byte(nil), entry.Data...)
+		if entry.response {
+			packetID, ok := r.packetIDs[entry.data.PacketID]
+			if !ok {
+				continue
+			}
+			setDeviceDataPacketID(data, packetID)
+		} else if blocked {
+			continue
+		}
+
+		address, err := net.ResolveUDPAddr("udp", entry.Address)
+		entry.done = true
+		if err != nil {
+			Log.Printf("replay - skip entry with invalid address %s: %v", entry.Address, err)
+			continue
+		}
+		r.pending <- replayPacket{address: address, data: data}
+	}
+}
+
+// ReadFrom returns the next replayed packet and blocks if none is available
+func (r *replayConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	select {
+	case packet := <-r.pending:
+		return copy(p, packet.data), packet.address, nil
+	case <-r.closed:
+		return 0, nil, net.ErrClosed
+	}
+}
+
+// WriteTo consumes the matching recorded request and releases its responses
+func (r *replayConn) WriteTo(p []byte, _ net.Addr) (int, error) {
+	select {
+	case <-r.closed:
+		return 0, net.ErrClosed
+	default:
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	written := parseDeviceData(p)
+	for _, entry := range r.entries {
+		if entry.done || entry.Direction != RecordSend || !sameRequest(entry.data, written) {
+			continue
+		}
+
+		entry.done = true
+		if entry.data == nil {
+			break
+		}
+
+		// consume resends of the same request
+		r.packetIDs[entry.data.PacketID] = written.PacketID
+		for _, resend := range r.entries {
+			if !resend.done && resend.Direction == RecordSend && resend.data != nil &&
+				resend.data.PacketID == entry.data.PacketID && sameRequest(resend.data, written) {
+				resend.done = true
+			}
+		}
+		break
+	}
+
+	r.queueReceived()
+	return len(p), nil
+}
+
+// Close stops the replay
+func (r *replayConn) Close() error {
+	r.once.Do(func() {
+		close(r.closed)
+	})
+	return nil
+}
+
+// LocalAddr returns the listen address
+func (r *replayConn) LocalAddr() net.Addr {
+	address, _ := net.ResolveUDPAddr("udp", listenAddress)
+	return address
+}
+
+// SetDeadline is not supported for replays
+func (r *replayConn) SetDeadline(time.Time) error {
+	return errors.ErrUnsupported
+}
+
+// SetReadDeadline is not supported for replays
+func (r *replayConn) SetReadDeadline(time.Time) error {
+	return errors.ErrUnsupported
+}
+
+// SetWriteDeadline is not supported for replays
+func (r *replayConn) SetWriteDeadline(time.Time) error {
+	return errors.ErrUnsupported
+}
+
+// parseDeviceData from raw packet data
+func parseDeviceData(data []byte) *net2.DeviceData {
+	var pack proto.Packet
+	if pack.Read(data) != nil {
+		return nil
+	}
+	entry, ok := pack.GetEntry(proto.SmaNet2PacketEntryTag).(*proto.SmaNet2PacketEntry)
+	if !ok {
+		return nil
+	}
+	deviceData, _ := entry.Content.(*net2.DeviceData)
+	return deviceData
+}
+
+// sameRequest checks if both requests are equal, ignoring packet ID, source
+// and login parameters (timestamp)
+func sameRequest(recorded, written *net2.DeviceData) bool {
+	if recorded == nil || written == nil {
+		return recorded == written
+	}
+	if recorded.Command != written.Command || recorded.Object != written.Object {
+		return false
+	}
+	if recorded.Command == net2.CommandLogin {
+		return true
+	}
+	return slices.Equal(recorded.Parameters, written.Parameters)
+}
+
+// deviceDataOffset returns the offset of the device data sub packet in raw packet data
+func deviceDataOffset(data []byte) (int, bool) {
+	index := 4
+	for len(data)-index >= 4 {
+		length := int(binary.BigEndian.Uint16(data[index:]))
+		tag := binary.BigEndian.Uint16(data[index+2:])
+		index += 4
+
+		if length == 0 || len(data)-index < length {
+			return 0, false
+		}
+		if tag == proto.SmaNet2PacketEntryTag && length >= 2+24 &&
+			binary.BigEndian.Uint16(data[index:]) == net2.DeviceDataProtocolID {
+			return index + 2, true
+		}
+		index += length
+	}
+	return 0, false
+}
+
+// setDeviceDataPacketID in raw packet data
+func setDeviceDataPacketID(data []byte, packetID uint16) {
+	offset, ok := deviceDataOffset(data)
+	if !ok {
+		return
+	}
+	flags := binary.LittleEndian.Uint16(data[offset+22:]) & 0x8000
+	binary.LittleEndian.PutUint16(data[offset+22:], packetID|flags)
+}
@@ -0,0 +1,97 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny_test
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pb82/sunny"
+	"github.com/pb82/sunny/sunnytest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var updateRecording = flag.Bool("update", false, "record the replay fixtures with a fake inverter")
+
+// inverterRecording is the fixture of a recorded GetValues of a fake inverter
+var inverterRecording = filepath.Join("testdata", "inverter.jsonl")
+
+// recordedValues of the fake inverter
+var recordedValues = map[sunny.ValueID]interface{}{
+	sunny.ActivePowerPlus:  uint32(1500),
+	sunny.ActiveEnergyPlus: float64(3600 * 1000),
+	sunny.DeviceName:       "SN: 1234",
+}
+
+// recordInverter writes the fixture of a GetValues of a fake inverter
+func recordInverter(t *testing.T) {
+	network := sunnytest.NewNetwork()
+	defer network.Close()
+
+	inverter, err := network.AddInverter("192.168.0.20", 1234, "0000")
+	require.NoError(t, err)
+	inverter.SetValues(recordedValues)
+
+	conn, err := network.Connection()
+	require.NoError(t, err)
+	var recording bytes.Buffer
+	conn.Record(sunny.NewRecorder(&recording))
+
+	device, err := conn.NewDevice("192.168.0.20", "0000")
+	require.NoError(t, err)
+	_, err = device.GetValues()
+	require.NoError(t, err)
+	device.Close()
+	conn.Record(nil)
+
+	require.NoError(t, os.MkdirAll(filepath.Dir(inverterRecording), 0o755))
+	require.NoError(t, os.WriteFile(inverterRecording, recording.Bytes(), 0o644))
+}
+
+func TestNewReplayConnection(t *testing.T) {
+	ass := assert.New(t)
+	if *updateRecording {
+		recordInverter(t)
+	}
+
+	recording, err := os.Open(inverterRecording)
+	require.NoError(t, err)
+	defer recording.Close()
+
+	conn, err := sunny.NewReplayConnection(recording)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	device, err := conn.NewDevice("192.168.0.20", "0000")
+	require.NoError(t, err)
+	defer device.Close()
+	ass.Equal(uint32(1234), device.SerialNumber())
+
+	// value groups registered by other tests are not recorded
+	device.SetRetryPolicy(sunny.RetryPolicy{MaxAttempts: 1, InitialDelay: 100 * time.Millisecond})
+	values, err := device.GetValues()
+	var multi *sunny.MultiError
+	if err != nil {
+		ass.ErrorAs(err, &multi)
+	}
+	for id, value := range recordedValues {
+		ass.Equal(value, values[id], id.String())
+	}
+}
@@ -0,0 +1,198 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// ValueDecoder describes a value without built-in support
+type ValueDecoder struct {
+	// Name of the value, must be unique (e.g. "BatteryCycles")
+	Name string
+	// Description, Unit and Type of the value (see ValueDescription)
+	Description string
+	Unit        string
+	Type        string
+	// Factor the raw value is multiplied with (0 -> none)
+	Factor float64
+}
+
+// registry of custom values, also guards the value tables of values.go
+var (
+	registryMutex sync.RWMutex
+	// custom value names
+	customNames = make(map[ValueID]string)
+	customIDs   = make(map[string]ValueID)
+	// next ID of a custom value
+	nextCustomID ValueID
+)
+
+func init() {
+	for id := range valueDesc {
+		nextCustomID = max(nextCustomID, id+1)
+	}
+}
+
+// RegisterInverterValue adds a decoder for the inverter value code which is
+// requested with the given object and range, e.g. for new device models.
+// Decoders can be registered while devices are polled, they are used for the next requests.
+func RegisterInverterValue(object uint16, start, end uint32, code uint16, decoder ValueDecoder) (ValueID, error) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	if _, ok := inverterResponseValues[uint32(code)<<16]; ok {
+		return 0, fmt.Errorf("inverter value code 0x%X already registered", code)
+	}
+	id, err := registerValue(decoder)
+	if err != nil {
+		return 0, err
+	}
+
+	def := InverterValuesDef{
+		Object: object,
+		Start:  start,
+		End:    end,
+		Code:   code,
+		ID:     id,
+		Factor: decoder.Factor,
+	}
+	inverterValues = append(inverterValues, def)
+	inverterResponseValues[uint32(code)<<16] = id
+	inverterValueMap[id] = def
+	inverterAllRequests = getInverterRequests(inverterValues)
+	return id, nil
+}
+
+// RegisterEnergyMeterValue adds a decoder for the OBIS channel (e.g. "0:1.8.1").
+// Decoders can be registered while devices are polled, they are used for the next requests.
+func RegisterEnergyMeterValue(obis string, decoder ValueDecoder) (ValueID, error) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	if _, ok := emObisMap[obis]; ok {
+		return 0, fmt.Errorf("OBIS channel %s already registered", obis)
+	}
+	id, err := registerValue(decoder)
+	if err != nil {
+		return 0, err
+	}
+
+	def := energyMeterValuesDef{
+		OBIS:   obis,
+		ID:     id,
+		Factor: decoder.Factor,
+	}
+	emValues = append(emValues, def)
+	emObisMap[obis] = def
+	emIDMap[id] = def
+	return id, nil
+}
+
+// registerValue assigns a new ID to the decoder
+func registerValue(decoder ValueDecoder) (ValueID, error) {
+	if decoder.Name == "" {
+		return 0, fmt.Errorf("name of custom value missing")
+	}
+	if _, err := lookupValueID(decoder.Name); err == nil {
+		return 0, fmt.Errorf("value %s already registered", decoder.Name)
+	}
+
+	id := nextCustomID
+	nextCustomID++
+
+	customNames[id] = decoder.Name
+	customIDs[decoder.Name] = id
+	valueDesc[id] = ValueDescription{
+		Description: decoder.Description,
+		Unit:        decoder.Unit,
+		Type:        decoder.Type,
+	}
+	return id, nil
+}
+
+// ValueName returns the name of built-in and custom values
+func ValueName(id ValueID) string {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+
+	if name, ok := customNames[id]; ok {
+		return name
+	}
+	return id.String()
+}
+
+// LookupValueID of built-in and custom values by name
+func LookupValueID(name string) (ValueID, error) {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+	return lookupValueID(name)
+}
+
+// lookupValueID by name, the registry mutex must be held
+func lookupValueID(name string) (ValueID, error) {
+	if id, ok := customIDs[name]; ok {
+		return id, nil
+	}
+	id, err := ValueIDString(name)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s", ErrUnsupportedValue, name)
+	}
+	return id, nil
+}
+
+// valueDescription of built-in and custom values
+func valueDescription(id ValueID) ValueDescription {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+	return valueDesc[id]
+}
+
+// responseValueID returns the value of an inverter response code and class
+func responseValueID(code uint16, class uint8) (ValueID, bool) {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+
+	if id, ok := inverterResponseValues[uint32(code)<<16+uint32(class)]; ok {
+		return id, true
+	}
+	id, ok := inverterResponseValues[uint32(code)<<16]
+	return id, ok
+}
+
+// lookupEnergyMeterValue returns the definition of an energy meter value
+func lookupEnergyMeterValue(id ValueID) (energyMeterValuesDef, bool) {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+	def, ok := emIDMap[id]
+	return def, ok
+}
+
+// lookupOBIS returns the definition of an energy meter channel
+func lookupOBIS(obis string) (energyMeterValuesDef, bool) {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+	def, ok := emObisMap[obis]
+	return def, ok
+}
+
+// energyMeterValues returns the definitions of all energy meter values
+func energyMeterValues() []energyMeterValuesDef {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+	return slices.Clone(emValues)
+}
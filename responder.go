@@ -0,0 +1,87 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"net"
+
+	"github.com/pb82/sunny/proto"
+	"github.com/pb82/sunny/proto/net2"
+)
+
+// ResponderIdentity the connection uses to answer discovery requests
+type ResponderIdentity struct {
+	// ID of the simulated device
+	ID net2.DeviceId
+	// IP announced in discovery responses
+	IP net.IP
+}
+
+// EnableDiscoveryResponder answers discovery requests and pings with the given identity,
+// so the connection appears as Speedwire device on the network
+func (c *Connection) EnableDiscoveryResponder(identity ResponderIdentity) {
+	c.responder.Store(&identity)
+}
+
+// DisableDiscoveryResponder stops answering discovery requests
+func (c *Connection) DisableDiscoveryResponder() {
+	c.responder.Store(nil)
+}
+
+// respond to discovery requests and pings if the responder is enabled
+func (c *Connection) respond(address *net.UDPAddr, packet *proto.Packet) {
+	identity := c.responder.Load()
+	if identity == nil {
+		return
+	}
+
+	if packet.GetEntry(proto.DiscoveryRequestPacketEntryTag) != nil {
+		response := proto.NewPacketBuilder().
+			Group(proto.GroupDefault).
+			Entry(&proto.DiscoveryIPPacketEntry{IP: identity.IP.To4()}).
+			Build()
+		err := c.sendPacket(address, response)
+		if err != nil {
+			Log.Printf("failed to send discovery response to %s: %v", address, err)
+		}
+		return
+	}
+
+	entry, ok := packet.GetEntry(proto.SmaNet2PacketEntryTag).(*proto.SmaNet2PacketEntry)
+	if !ok {
+		return
+	}
+	request, ok := entry.Content.(*net2.DeviceData)
+	if !ok || request.Command != net2.CommandGetValues || request.Object != 0 {
+		return
+	}
+	if request.Destination != identity.ID && !request.Destination.IsBroadcast() {
+		return
+	}
+
+	data := proto.NewDeviceDataBuilder(net2.CommandValues, request.Object).
+		Control(net2.ControlResponse).
+		Source(identity.ID).
+		Destination(request.Source).
+		JobNumber(request.JobNumber).
+		Parameters(request.Parameters...).
+		Build()
+	data.PacketID = request.PacketID
+
+	err := c.sendPacket(address, proto.NewPacketBuilder().Group(proto.GroupDefault).Net2(data).Build())
+	if err != nil {
+		Log.Printf("failed to send ping response to %s: %v", address, err)
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pb82/sunny"
+	"github.com/pb82/sunny/proto/net2"
+	"github.com/pb82/sunny/sunnytest"
+)
+
+func TestConnection_EnableDiscoveryResponder(t *testing.T) {
+	ass := assert.New(t)
+
+	network := sunnytest.NewNetwork()
+	defer network.Close()
+	ip := net.IPv4(192, 168, 0, 50)
+	responder, err := network.ConnectionAt(ip)
+	require.NoError(t, err)
+	responder.EnableDiscoveryResponder(sunny.ResponderIdentity{
+		ID: net2.DeviceId{SusyID: 0x0080, SerialNumber: 5000},
+		IP: ip,
+	})
+	connection, err := network.Connection()
+	require.NoError(t, err)
+
+	// discovered and identified like a device
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	var found []*sunny.Device
+	err = connection.DiscoverFunc(ctx, "0000", func(device *sunny.Device) bool {
+		found = append(found, device)
+		return false
+	})
+	ass.NoError(err)
+	require.Len(t, found, 1)
+	ass.Equal(uint32(5000), found[0].SerialNumber())
+	ass.True(ip.Equal(found[0].Address().IP))
+	found[0].Close()
+
+	// no ping responses after disabling
+	responder.DisableDiscoveryResponder()
+	ctx, cancel = context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	_, err = connection.NewDeviceCtx(ctx, ip.String(), "0000")
+	ass.Error(err)
+}
@@ -0,0 +1,64 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// DefaultRetryPolicy used by new connections
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:   3,
+	InitialDelay:  time.Millisecond * 500,
+	BackoffFactor: 1,
+}
+
+// RetryPolicy defines how requests are resent if no response is received
+type RetryPolicy struct {
+	// MaxAttempts is the amount of sent requests including the first one
+	MaxAttempts int
+	// InitialDelay to wait for a response before the request is sent again
+	InitialDelay time.Duration
+	// BackoffFactor the delay is multiplied with after every attempt (values < 1 are handled as 1)
+	BackoffFactor float64
+	// Jitter randomizes every delay by the given fraction (e.g. 0.1 for ±10%)
+	Jitter float64
+}
+
+// attempts returns the amount of attempts (at least one)
+func (p RetryPolicy) attempts() int {
+	if p.MaxAttempts < 1 {
+		return 1
+	}
+	return p.MaxAttempts
+}
+
+// delay to wait for a response of the given attempt (starting at 0)
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	delay := float64(p.InitialDelay)
+	if p.BackoffFactor > 1 {
+		for i := 0; i < attempt; i++ {
+			delay *= p.BackoffFactor
+		}
+	}
+	if p.Jitter > 0 {
+		delay += delay * p.Jitter * (rand.Float64()*2 - 1)
+	}
+	if delay < 0 {
+		return 0
+	}
+	return time.Duration(delay)
+}
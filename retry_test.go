@@ -0,0 +1,66 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryPolicy_attempts(t *testing.T) {
+	tests := []struct {
+		maxAttempts int
+		attempts    int
+	}{
+		{-1, 1},
+		{0, 1},
+		{1, 1},
+		{3, 3},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.attempts, RetryPolicy{MaxAttempts: tt.maxAttempts}.attempts(), "MaxAttempts %d", tt.maxAttempts)
+	}
+}
+
+func TestRetryPolicy_delay(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  RetryPolicy
+		attempt int
+		delay   time.Duration
+	}{
+		{"constant", RetryPolicy{InitialDelay: time.Second, BackoffFactor: 1}, 3, time.Second},
+		{"first attempt", RetryPolicy{InitialDelay: time.Second, BackoffFactor: 2}, 0, time.Second},
+		{"backoff", RetryPolicy{InitialDelay: time.Second, BackoffFactor: 2}, 3, 8 * time.Second},
+		{"factor below 1", RetryPolicy{InitialDelay: time.Second, BackoffFactor: 0.5}, 2, time.Second},
+		{"negative delay", RetryPolicy{InitialDelay: -time.Second}, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.delay, tt.policy.delay(tt.attempt))
+		})
+	}
+}
+
+func TestRetryPolicy_delay_jitter(t *testing.T) {
+	policy := RetryPolicy{InitialDelay: time.Second, BackoffFactor: 1, Jitter: 0.1}
+	for range 100 {
+		delay := policy.delay(0)
+		assert.GreaterOrEqual(t, delay, 900*time.Millisecond)
+		assert.LessOrEqual(t, delay, 1100*time.Millisecond)
+	}
+}
@@ -0,0 +1,231 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"net"
+	"slices"
+	"sync"
+
+	"github.com/pb82/sunny/proto"
+	"github.com/pb82/sunny/proto/net2"
+)
+
+// AddressRewriter is a middleware for bridged setups, where Speedwire packets
+// of devices are relayed (e.g. NAT or a UDP relay between networks). Devices
+// are created with their own IP; sent packets are redirected to the relay and
+// packets received from the relay are associated with the device again.
+type AddressRewriter struct {
+	mutex sync.RWMutex
+	// relay address of device IPs
+	relays map[string]*net.UDPAddr
+	// device IPs behind a relay address
+	devices map[string][]net.IP
+	// device IPs of serial numbers, used if devices share a relay
+	serials map[uint32]net.IP
+	// device IPs of requests sent via a shared relay by packet ID
+	requests map[uint16]net.IP
+}
+
+// maxRewriteRequests limits the tracked requests of shared relays
+const maxRewriteRequests = 1024
+
+// NewAddressRewriter creates an empty AddressRewriter, add it with Connection.Use
+func NewAddressRewriter() *AddressRewriter {
+	return &AddressRewriter{
+		relays:   make(map[string]*net.UDPAddr),
+		devices:  make(map[string][]net.IP),
+		serials:  make(map[uint32]net.IP),
+		requests: make(map[uint16]net.IP),
+	}
+}
+
+// Map packets of the device IP to the relay address. With port 0 the port
+// of the packets is kept and packets from any port of the relay are matched.
+// If multiple devices share a relay address, received packets are associated
+// by the serial number of the source (learned from sent requests and their
+// responses or MapSerial).
+func (r *AddressRewriter) Map(device net.IP, relay *net.UDPAddr) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.unmap(device)
+	key := relay.String()
+	r.relays[device.String()] = relay
+	r.devices[key] = append(r.devices[key], device)
+}
+
+// MapSerial associates packets of the serial number with the device IP,
+// e.g. for energy meters behind a shared relay which are never addressed
+func (r *AddressRewriter) MapSerial(serial uint32, device net.IP) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.serials[serial] = device
+}
+
+// Unmap removes the rewriting of the device IP
+func (r *AddressRewriter) Unmap(device net.IP) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.unmap(device)
+}
+
+// unmap the device IP, the mutex must be held
+func (r *AddressRewriter) unmap(device net.IP) {
+	relay, ok := r.relays[device.String()]
+	if !ok {
+		return
+	}
+	delete(r.relays, device.String())
+
+	key := relay.String()
+	r.devices[key] = slices.DeleteFunc(r.devices[key], device.Equal)
+	if len(r.devices[key]) == 0 {
+		delete(r.devices, key)
+	}
+	for serial, ip := range r.serials {
+		if ip.Equal(device) {
+			delete(r.serials, serial)
+		}
+	}
+	for packetID, ip := range r.requests {
+		if ip.Equal(device) {
+			delete(r.requests, packetID)
+		}
+	}
+}
+
+// Mappings returns the relay addresses of all mapped device IPs
+func (r *AddressRewriter) Mappings() map[string]*net.UDPAddr {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	mappings := make(map[string]*net.UDPAddr, len(r.relays))
+	for device, relay := range r.relays {
+		mappings[device] = relay
+	}
+	return mappings
+}
+
+// Middleware rewrites the addresses of sent and received packets
+func (r *AddressRewriter) Middleware() Middleware {
+	return func(next PacketHandler) PacketHandler {
+		return func(packet *RawPacket) error {
+			if packet.Direction == RecordSend {
+				r.rewriteSend(packet)
+			} else {
+				r.rewriteReceive(packet)
+			}
+			return next(packet)
+		}
+	}
+}
+
+// rewriteSend redirects packets of mapped devices to their relay
+func (r *AddressRewriter) rewriteSend(packet *RawPacket) {
+	r.mutex.RLock()
+	relay, ok := r.relays[packet.Address.IP.String()]
+	shared := ok && len(r.devices[relay.String()]) > 1
+	r.mutex.RUnlock()
+	if !ok {
+		return
+	}
+
+	// remember the device of the request for responses via a shared relay
+	if shared {
+		if data := parseDeviceData(packet.Data); data != nil {
+			r.mutex.Lock()
+			if len(r.requests) >= maxRewriteRequests {
+				clear(r.requests)
+			}
+			r.requests[data.PacketID&0x7FFF] = packet.Address.IP
+			if serial := data.Destination.SerialNumber; serial != 0 && serial != 0xFFFFFFFF {
+				r.serials[serial] = packet.Address.IP
+			}
+			r.mutex.Unlock()
+		}
+	}
+
+	address := &net.UDPAddr{IP: relay.IP, Port: relay.Port, Zone: relay.Zone}
+	if address.Port == 0 {
+		address.Port = packet.Address.Port
+	}
+	if DetailedPacketLogging.Load() {
+		Log.Printf("DBG: rewrite destination %s -> %s", packet.Address, address)
+	}
+	packet.Address = address
+}
+
+// rewriteReceive associates packets received from a relay with the device
+func (r *AddressRewriter) rewriteReceive(packet *RawPacket) {
+	r.mutex.RLock()
+	devices, ok := r.devices[packet.Address.String()]
+	if !ok {
+		devices, ok = r.devices[(&net.UDPAddr{IP: packet.Address.IP, Zone: packet.Address.Zone}).String()]
+	}
+	var device net.IP
+	if len(devices) == 1 {
+		device = devices[0]
+	}
+	r.mutex.RUnlock()
+	if ok && device == nil {
+		device = r.sharedDevice(packet.Data)
+	}
+	if device == nil {
+		if ok {
+			Log.Printf("rewrite - unknown device behind relay %s", packet.Address)
+		}
+		return
+	}
+
+	address := &net.UDPAddr{IP: device, Port: packet.Address.Port}
+	if DetailedPacketLogging.Load() {
+		Log.Printf("DBG: rewrite source %s -> %s", packet.Address, address)
+	}
+	packet.Address = address
+}
+
+// sharedDevice returns the device IP of a packet received via a shared relay
+// by its serial number or the request it answers (nil if unknown)
+func (r *AddressRewriter) sharedDevice(data []byte) net.IP {
+	var pack proto.Packet
+	if pack.Read(data) != nil {
+		return nil
+	}
+	entry, ok := pack.GetEntry(proto.SmaNet2PacketEntryTag).(*proto.SmaNet2PacketEntry)
+	if !ok {
+		return nil
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	switch content := entry.Content.(type) {
+	case *net2.EnergyMeterPacket:
+		return r.serials[content.Id.SerialNumber]
+	case *net2.DeviceData:
+		serial := content.Source.SerialNumber
+		if device, ok := r.serials[serial]; ok {
+			return device
+		}
+		device, ok := r.requests[content.PacketID&0x7FFF]
+		if ok && serial != 0 {
+			delete(r.requests, content.PacketID&0x7FFF)
+			r.serials[serial] = device
+		}
+		return device
+	}
+	return nil
+}
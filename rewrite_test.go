@@ -0,0 +1,117 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"net"
+	"testing"
+
+	"github.com/pb82/sunny/proto"
+	"github.com/pb82/sunny/proto/net2"
+	"github.com/stretchr/testify/assert"
+)
+
+// rewritePacket encodes a values request as Speedwire packet
+func rewritePacket(packetID uint16, source, destination uint32) []byte {
+	data := net2.NewDeviceData(net2.ControlRequest)
+	data.Command = net2.CommandGetValues
+	data.Object = 0x5100
+	data.Parameters = []uint32{0x00263F00, 0x00263FFF}
+	data.PacketID = packetID
+	data.Source.SerialNumber = source
+	data.Destination.SerialNumber = destination
+	return proto.NewPacketBuilder().Group(proto.GroupDefault).Net2(data).Build().Bytes()
+}
+
+// rewrite the packet with the middleware and returns the resulting address
+func rewrite(rewriter *AddressRewriter, direction string, address string, data []byte) string {
+	var result string
+	handler := rewriter.Middleware()(func(packet *RawPacket) error {
+		result = packet.Address.String()
+		return nil
+	})
+	_ = handler(&RawPacket{Direction: direction, Address: udpAddr(address), Data: data})
+	return result
+}
+
+func udpAddr(address string) *net.UDPAddr {
+	addr, err := net.ResolveUDPAddr("udp4", address)
+	if err != nil {
+		panic(err)
+	}
+	return addr
+}
+
+func TestAddressRewriter(t *testing.T) {
+	tests := []struct {
+		name      string
+		relay     string
+		direction string
+		address   string
+		rewritten string
+	}{
+		{"send", "10.0.0.1:9530", RecordSend, "192.168.1.10:9522", "10.0.0.1:9530"},
+		{"send keeps port", "10.0.0.1:0", RecordSend, "192.168.1.10:9522", "10.0.0.1:9522"},
+		{"send unmapped", "10.0.0.1:9530", RecordSend, "192.168.1.11:9522", "192.168.1.11:9522"},
+		{"receive", "10.0.0.1:9530", RecordReceive, "10.0.0.1:9530", "192.168.1.10:9530"},
+		{"receive any port", "10.0.0.1:0", RecordReceive, "10.0.0.1:40000", "192.168.1.10:40000"},
+		{"receive other port", "10.0.0.1:9530", RecordReceive, "10.0.0.1:40000", "10.0.0.1:40000"},
+		{"receive unmapped", "10.0.0.1:9530", RecordReceive, "192.168.1.11:9522", "192.168.1.11:9522"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ass := assert.New(t)
+
+			rewriter := NewAddressRewriter()
+			rewriter.Map(net.ParseIP("192.168.1.10"), udpAddr(tt.relay))
+			ass.Equal(tt.rewritten, rewrite(rewriter, tt.direction, tt.address, rewritePacket(1, 0, 0)))
+
+			// without mapping packets are passed unchanged
+			rewriter.Unmap(net.ParseIP("192.168.1.10"))
+			ass.Empty(rewriter.Mappings())
+			ass.Equal(tt.address, rewrite(rewriter, tt.direction, tt.address, rewritePacket(1, 0, 0)))
+		})
+	}
+}
+
+func TestAddressRewriter_sharedRelay(t *testing.T) {
+	ass := assert.New(t)
+
+	relay := udpAddr("10.0.0.1:9530")
+	rewriter := NewAddressRewriter()
+	rewriter.Map(net.ParseIP("192.168.1.10"), relay)
+	rewriter.Map(net.ParseIP("192.168.1.11"), relay)
+	rewriter.MapSerial(3000, net.ParseIP("192.168.1.12"))
+	ass.Len(rewriter.Mappings(), 2)
+
+	// unknown devices behind the relay are not rewritten
+	ass.Equal("10.0.0.1:9530", rewrite(rewriter, RecordReceive, "10.0.0.1:9530", rewritePacket(7, 1000, 0)))
+	ass.Equal("10.0.0.1:9530", rewrite(rewriter, RecordReceive, "10.0.0.1:9530", []byte{1, 2, 3}))
+
+	// responses are associated by the packet ID of the request, later by the serial number
+	ass.Equal("10.0.0.1:9530", rewrite(rewriter, RecordSend, "192.168.1.10:9522", rewritePacket(7, 0, 0xFFFFFFFF)))
+	ass.Equal("192.168.1.10:9530", rewrite(rewriter, RecordReceive, "10.0.0.1:9530", rewritePacket(7|0x8000, 1000, 0)))
+	ass.Equal("192.168.1.10:9530", rewrite(rewriter, RecordReceive, "10.0.0.1:9530", rewritePacket(8, 1000, 0)))
+
+	// requests to a known serial number
+	ass.Equal("10.0.0.1:9530", rewrite(rewriter, RecordSend, "192.168.1.11:9522", rewritePacket(9, 0, 2000)))
+	ass.Equal("192.168.1.11:9530", rewrite(rewriter, RecordReceive, "10.0.0.1:9530", rewritePacket(10, 2000, 0)))
+	ass.Equal("192.168.1.12:9530", rewrite(rewriter, RecordReceive, "10.0.0.1:9530", rewritePacket(11, 3000, 0)))
+
+	// unmapped devices are forgotten
+	rewriter.Unmap(net.ParseIP("192.168.1.11"))
+	ass.Len(rewriter.Mappings(), 1)
+	ass.Equal("192.168.1.10:9530", rewrite(rewriter, RecordReceive, "10.0.0.1:9530", rewritePacket(12, 2000, 0)))
+}
@@ -0,0 +1,237 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sbfspot writes values in the CSV layout of SBFspot, so existing
+// tooling based on SBFspot exports can be used with this library.
+package sbfspot
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pb82/sunny"
+)
+
+// Options for the CSV layout (defaults match SBFspot)
+type Options struct {
+	// Delimiter of fields ("semicolon" or "comma" in SBFspot config)
+	Delimiter rune
+	// DecimalPoint of numbers ("comma" or "point" in SBFspot config)
+	DecimalPoint rune
+	// Precision of numbers
+	Precision int
+	// DateTimeFormat of timestamps (Go layout)
+	DateTimeFormat string
+	// Header enables the SBFspot header lines
+	Header bool
+}
+
+// DefaultOptions matching the default SBFspot configuration
+var DefaultOptions = Options{
+	Delimiter:      ';',
+	DecimalPoint:   ',',
+	Precision:      3,
+	DateTimeFormat: "02/01/2006 15:04:05",
+	Header:         true,
+}
+
+// spotColumns of SBFspot spot data exports
+var spotColumns = []string{
+	"TimeStamp", "DeviceName", "DeviceType", "Serial",
+	"Pdc1", "Pdc2", "Idc1", "Idc2", "Udc1", "Udc2",
+	"Pac1", "Pac2", "Pac3", "Iac1", "Iac2", "Iac3", "Uac1", "Uac2", "Uac3",
+	"PdcTot", "PacTot", "Efficiency", "EToday", "ETotal", "Frequency",
+	"OperatingTime", "FeedInTime", "BT_Signal", "Condition", "GridRelay", "Temperature",
+}
+
+// spotUnits of SBFspot spot data exports
+var spotUnits = []string{
+	"", "", "", "",
+	"Watt", "Watt", "Amp", "Amp", "Volt", "Volt",
+	"Watt", "Watt", "Watt", "Amp", "Amp", "Amp", "Volt", "Volt", "Volt",
+	"Watt", "Watt", "%", "kWh", "kWh", "Hz",
+	"Hours", "Hours", "%", "", "", "degC",
+}
+
+// SpotRecord are the spot values of a device at a time
+type SpotRecord struct {
+	Time       time.Time
+	DeviceName string
+	DeviceType string
+	Serial     uint32
+	Values     map[sunny.ValueID]interface{}
+}
+
+// ArchiveRecord is a record of the day archive of a device
+type ArchiveRecord = sunny.ArchiveRecord
+
+// Writer writes SBFspot compatible CSV files
+type Writer struct {
+	w       io.Writer
+	options Options
+	header  bool
+}
+
+// NewWriter creates a writer with the given options
+func NewWriter(w io.Writer, options Options) *Writer {
+	return &Writer{
+		w:       w,
+		options: options,
+	}
+}
+
+// WriteSpot writes spot data records, the header is written before the first record
+func (w *Writer) WriteSpot(records ...SpotRecord) error {
+	if !w.header {
+		w.header = true
+		if w.options.Header {
+			err := w.writeHeader()
+			if err != nil {
+				return err
+			}
+			err = w.writeLine(spotColumns...)
+			if err != nil {
+				return err
+			}
+			err = w.writeLine(spotUnits...)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, r := range records {
+		v := func(id sunny.ValueID) float64 {
+			f, _ := sunny.ToFloat(r.Values[id])
+			return f
+		}
+
+		pdc := v(sunny.PowerS1) + v(sunny.PowerS2)
+		pac := v(sunny.ActivePowerPlus)
+		efficiency := 0.0
+		if pdc > 0 {
+			efficiency = pac / pdc * 100
+		}
+
+		err := w.writeLine(
+			r.Time.Format(w.options.DateTimeFormat), r.DeviceName, r.DeviceType, strconv.FormatUint(uint64(r.Serial), 10),
+			w.number(v(sunny.PowerS1)), w.number(v(sunny.PowerS2)),
+			w.number(v(sunny.CurrentS1)), w.number(v(sunny.CurrentS2)),
+			w.number(v(sunny.VoltageS1)), w.number(v(sunny.VoltageS2)),
+			w.number(v(sunny.ActivePowerPlusL1)), w.number(v(sunny.ActivePowerPlusL2)), w.number(v(sunny.ActivePowerPlusL3)),
+			w.number(v(sunny.CurrentL1)), w.number(v(sunny.CurrentL2)), w.number(v(sunny.CurrentL3)),
+			w.number(v(sunny.VoltageL1)), w.number(v(sunny.VoltageL2)), w.number(v(sunny.VoltageL3)),
+			w.number(pdc), w.number(pac), w.number(efficiency),
+			w.number(v(sunny.ActiveEnergyPlusToday)/3600/1000), w.number(v(sunny.ActiveEnergyPlus)/3600/1000),
+			w.number(v(sunny.UtilityFrequency)),
+			w.number(v(sunny.TimeOperating)/3600), w.number(v(sunny.TimeFeed)/3600),
+			w.number(0), status(r.Values[sunny.DeviceStatus]), status(r.Values[sunny.DeviceGridRelay]),
+			w.number(v(sunny.DeviceTemperature)),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteArchive writes day archive records of a device
+func (w *Writer) WriteArchive(deviceName string, serial uint32, records []ArchiveRecord) error {
+	if w.options.Header {
+		err := w.writeHeader()
+		if err != nil {
+			return err
+		}
+		for _, line := range [][]string{
+			{"", fmt.Sprintf("SN: %d", serial)},
+			{"", deviceName},
+			{"", "Total yield", "Power"},
+			{"", "Counter", "Analog"},
+			{w.options.DateTimeFormat, "kWh", "kW"},
+		} {
+			err = w.writeLine(line...)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, r := range records {
+		err := w.writeLine(
+			r.Time.Format(w.options.DateTimeFormat),
+			w.number(r.TotalYield/3600/1000),
+			w.number(r.Power/1000),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeHeader with format description
+func (w *Writer) writeHeader() error {
+	delimiter, decimal := "semicolon", "comma"
+	if w.options.Delimiter == ',' {
+		delimiter = "comma"
+	}
+	if w.options.DecimalPoint == '.' {
+		decimal = "point"
+	}
+
+	_, err := fmt.Fprintf(w.w, "sep=%c\r\nVersion CSV1|Tool SBFspot|Linebreaks CR/LF|Delimiter %s|Decimalpoint %s|Precision %d\r\n\r\n",
+		w.options.Delimiter, delimiter, decimal, w.options.Precision)
+	return err
+}
+
+// writeLine with the configured delimiter
+func (w *Writer) writeLine(fields ...string) error {
+	quoted := make([]string, len(fields))
+	for i, field := range fields {
+		quoted[i] = w.quote(field)
+	}
+	_, err := io.WriteString(w.w, strings.Join(quoted, string(w.options.Delimiter))+"\r\n")
+	return err
+}
+
+// quote the field if it contains the delimiter, quotes or line breaks
+func (w *Writer) quote(field string) string {
+	if !strings.ContainsRune(field, w.options.Delimiter) && !strings.ContainsAny(field, "\"\r\n") {
+		return field
+	}
+	return `"` + strings.ReplaceAll(field, `"`, `""`) + `"`
+}
+
+// number formatted with precision and decimal point
+func (w *Writer) number(value float64) string {
+	s := strconv.FormatFloat(value, 'f', w.options.Precision, 64)
+	if w.options.DecimalPoint != '.' {
+		s = strings.Replace(s, ".", string(w.options.DecimalPoint), 1)
+	}
+	return s
+}
+
+// status value as text
+func status(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	if code, ok := value.(uint32); ok {
+		return sunny.GetStatusText(code)
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,147 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sbfspot
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pb82/sunny"
+)
+
+var updateGolden = flag.Bool("update", false, "update golden files of the CSV exports")
+
+func TestWriter_golden(t *testing.T) {
+	at := time.Date(2024, 6, 15, 12, 30, 0, 0, time.UTC)
+	archive := []ArchiveRecord{
+		{Time: time.Date(2024, 6, 15, 5, 0, 0, 0, time.UTC), TotalYield: 12345.678 * 3600 * 1000},
+		{Time: time.Date(2024, 6, 15, 5, 5, 0, 0, time.UTC), TotalYield: 12345.703 * 3600 * 1000, Power: 300},
+	}
+
+	comma := DefaultOptions
+	comma.Delimiter = ','
+
+	tests := []struct {
+		name    string
+		options Options
+		write   func(w *Writer) error
+	}{
+		{
+			name:    "spot",
+			options: DefaultOptions,
+			write: func(w *Writer) error {
+				return w.WriteSpot(
+					SpotRecord{
+						Time:       at,
+						DeviceName: "Roof; east",
+						DeviceType: "SB 3000TL-21",
+						Serial:     2130012345,
+						Values: map[sunny.ValueID]interface{}{
+							sunny.PowerS1:               int64(1500),
+							sunny.PowerS2:               int64(1000),
+							sunny.CurrentS1:             4.2,
+							sunny.CurrentS2:             3.1,
+							sunny.VoltageS1:             350.0,
+							sunny.VoltageS2:             320.0,
+							sunny.ActivePowerPlus:       int64(2400),
+							sunny.ActivePowerPlusL1:     int64(800),
+							sunny.ActivePowerPlusL2:     int64(800),
+							sunny.ActivePowerPlusL3:     int64(800),
+							sunny.CurrentL1:             3.5,
+							sunny.CurrentL2:             3.5,
+							sunny.CurrentL3:             3.5,
+							sunny.VoltageL1:             230.1,
+							sunny.VoltageL2:             230.1,
+							sunny.VoltageL3:             230.1,
+							sunny.ActiveEnergyPlusToday: uint64(12.5 * 3600 * 1000),
+							sunny.ActiveEnergyPlus:      uint64(12345.678 * 3600 * 1000),
+							sunny.UtilityFrequency:      50.01,
+							sunny.TimeOperating:         uint64(1000.5 * 3600),
+							sunny.TimeFeed:              uint64(900.25 * 3600),
+							sunny.DeviceStatus:          uint32(307),
+							sunny.DeviceGridRelay:       uint32(51),
+							sunny.DeviceTemperature:     45.3,
+						},
+					},
+					SpotRecord{
+						Time:       at,
+						DeviceName: `Garage "west"`,
+						DeviceType: "SB 1.5-1VL-40",
+						Serial:     3010054321,
+					},
+				)
+			},
+		},
+		{
+			name:    "archive",
+			options: DefaultOptions,
+			write: func(w *Writer) error {
+				return w.WriteArchive("SB 3000TL-21", 2130012345, archive)
+			},
+		},
+		{
+			// decimal commas are quoted
+			name:    "archive_comma",
+			options: comma,
+			write: func(w *Writer) error {
+				return w.WriteArchive("SB 3000TL-21", 2130012345, archive)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, tt.write(NewWriter(&buf, tt.options)))
+
+			golden := filepath.Join("testdata", tt.name+".csv")
+			if *updateGolden {
+				require.NoError(t, os.WriteFile(golden, buf.Bytes(), 0644))
+				return
+			}
+			expected, err := os.ReadFile(golden)
+			require.NoError(t, err, "golden file missing - run: go test ./sbfspot -run TestWriter_golden -update")
+			assert.Equal(t, string(expected), buf.String())
+		})
+	}
+}
+
+func TestWriter_quote(t *testing.T) {
+	tests := []struct {
+		field     string
+		delimiter rune
+		expected  string
+	}{
+		{"SB 3000TL-21", ';', "SB 3000TL-21"},
+		{"Roof; east", ';', `"Roof; east"`},
+		{"Roof; east", ',', "Roof; east"},
+		{"12,5", ',', `"12,5"`},
+		{`Garage "west"`, ';', `"Garage ""west"""`},
+		{"two\r\nlines", ';', "\"two\r\nlines\""},
+		{"", ';', ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.field, func(t *testing.T) {
+			w := NewWriter(nil, Options{Delimiter: tt.delimiter})
+			assert.Equal(t, tt.expected, w.quote(tt.field))
+		})
+	}
+}
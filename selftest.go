@@ -0,0 +1,178 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"time"
+
+	"github.com/pb82/sunny/proto"
+)
+
+// DefaultSelfTestTimeout is used by SelfTest if ctx has no deadline
+const DefaultSelfTestTimeout = 3 * time.Second
+
+// SelfTestCheck is the result of a single check of SelfTest
+type SelfTestCheck struct {
+	// Name of the check
+	Name string
+	// OK is true if the check succeeded
+	OK bool
+	// Problem is the likely cause if the check failed
+	Problem string
+	// Err of the check
+	Err error
+}
+
+// SelfTestReport is the result of SelfTest
+type SelfTestReport struct {
+	// Checks in the order they were performed
+	Checks []SelfTestCheck
+	// Responders are the IPs of devices that answered the discovery request
+	Responders []net.IP
+}
+
+// OK is true if all checks succeeded
+func (r SelfTestReport) OK() bool {
+	for _, check := range r.Checks {
+		if !check.OK {
+			return false
+		}
+	}
+	return true
+}
+
+// Problems of all failed checks
+func (r SelfTestReport) Problems() []string {
+	var problems []string
+	for _, check := range r.Checks {
+		if !check.OK {
+			problems = append(problems, fmt.Sprintf("%s: %s", check.Name, check.Problem))
+		}
+	}
+	return problems
+}
+
+// SelfTest checks the network setup of the connection: multicast flags of the
+// interface, the group membership, the reception of an own multicast packet
+// (loopback) and any response to a discovery request.
+func (c *Connection) SelfTest(ctx context.Context) SelfTestReport {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultSelfTestTimeout)
+		defer cancel()
+	}
+
+	var report SelfTestReport
+	diagnostics := c.Diagnostics()
+	report.Checks = append(report.Checks, checkInterface(diagnostics.Interface))
+
+	membership := SelfTestCheck{Name: "membership", OK: diagnostics.Multicast && diagnostics.Joined, Err: diagnostics.JoinError}
+	if !membership.OK {
+		membership.Problem = "socket is not a member of the multicast group " + diagnostics.Group
+	}
+	report.Checks = append(report.Checks, membership)
+
+	// collect all sources of packets after the discovery request
+	sources := make(chan string, c.discoveryBufferSize.Load())
+	c.registerDiscoverer(sources)
+	defer c.unregisterDiscoverer(sources)
+
+	discovery := SelfTestCheck{Name: "discovery"}
+	loopback := SelfTestCheck{Name: "loopback"}
+	local := localIPs()
+	err := c.writeCtx(ctx, proto.NewDiscoveryRequest().Bytes(), c.address)
+	if err != nil {
+		discovery.Err = err
+		loopback.Err = err
+	} else {
+	collect:
+		for {
+			select {
+			case <-ctx.Done():
+				break collect
+			case src := <-sources:
+				ip := net.ParseIP(src)
+				if slices.ContainsFunc(local, ip.Equal) {
+					loopback.OK = true
+				} else if !slices.ContainsFunc(report.Responders, ip.Equal) {
+					report.Responders = append(report.Responders, ip)
+				}
+			}
+		}
+	}
+
+	if !loopback.OK {
+		loopback.Problem = "own multicast packet not received: firewall blocks UDP port 9522 or multicast loopback is disabled"
+	}
+	discovery.OK = len(report.Responders) > 0
+	if !discovery.OK {
+		discovery.Problem = "no device answered: firewall, IGMP snooping without querier or wrong interface"
+	}
+	report.Checks = append(report.Checks, loopback, discovery)
+	return report
+}
+
+// checkInterface for multicast support, without name any suitable interface is required
+func checkInterface(name string) SelfTestCheck {
+	check := SelfTestCheck{Name: "interface"}
+
+	var interfaces []net.Interface
+	if name != "" {
+		inf, err := net.InterfaceByName(name)
+		if err != nil {
+			check.Err = err
+			check.Problem = "interface " + name + " not found"
+			return check
+		}
+		interfaces = append(interfaces, *inf)
+	} else {
+		var err error
+		interfaces, err = net.Interfaces()
+		if err != nil {
+			check.Err = err
+			check.Problem = "failed to list interfaces"
+			return check
+		}
+	}
+
+	for _, inf := range interfaces {
+		if inf.Flags&net.FlagUp != 0 && inf.Flags&net.FlagMulticast != 0 && inf.Flags&net.FlagLoopback == 0 {
+			check.OK = true
+			return check
+		}
+	}
+	if name != "" {
+		check.Problem = "interface " + name + " is down or has multicast disabled"
+	} else {
+		check.Problem = "no interface is up with multicast enabled"
+	}
+	return check
+}
+
+// localIPs of all interfaces
+func localIPs() []net.IP {
+	addresses, _ := net.InterfaceAddrs()
+	ips := make([]net.IP, 0, len(addresses))
+	for _, address := range addresses {
+		if network, ok := address.(*net.IPNet); ok {
+			ips = append(ips, network.IP)
+		}
+	}
+	return ips
+}
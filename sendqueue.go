@@ -0,0 +1,273 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultSendDeadline of queued packets whose request has no deadline
+const DefaultSendDeadline = 5 * time.Second
+
+// WithSendQueue sends packets asynchronously by an internal worker with a
+// queue of the given size instead of on the goroutine of the caller
+func WithSendQueue(size int) ConnectionOption {
+	return func(c *connectionConfig) {
+		c.sendQueueSize = &size
+	}
+}
+
+// SendQueueStats of the asynchronous send queue
+type SendQueueStats struct {
+	// Size of the queue (0 -> packets are sent synchronously)
+	Size int
+	// Queued packets waiting to be sent
+	Queued int
+	// Overflows of packets rejected because the queue was full
+	Overflows uint64
+	// Expired packets dropped because their deadline passed before they were sent
+	Expired uint64
+}
+
+// sendQueue of packets waiting for the send worker, ordered by priority
+type sendQueue struct {
+	mutex    sync.Mutex
+	size     int
+	packets  []*queuedPacket
+	detached bool
+	wake     chan struct{}
+	// closed after the send worker exited
+	done chan struct{}
+
+	overflows atomic.Uint64
+	expired   atomic.Uint64
+}
+
+// queuedPacket is a sent packet with the time it has to be written until
+type queuedPacket struct {
+	*RawPacket
+	deadline time.Time
+}
+
+// newSendQueue with the given size
+func newSendQueue(size int) *sendQueue {
+	return &sendQueue{
+		size: size,
+		wake: make(chan struct{}, 1),
+		done: make(chan struct{}),
+	}
+}
+
+// push the packet into the queue.
+// Returns false if the queue was detached and the packet has to be sent synchronously.
+func (q *sendQueue) push(packet *RawPacket) (bool, error) {
+	deadline, ok := packet.Context().Deadline()
+	if !ok {
+		deadline = time.Now().Add(DefaultSendDeadline)
+	}
+	queued := &queuedPacket{
+		RawPacket: &RawPacket{
+			Direction: packet.Direction,
+			Address:   packet.Address,
+			Data:      slices.Clone(packet.Data),
+			Priority:  packet.Priority,
+			ctx:       packet.ctx,
+		},
+		deadline: deadline,
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.detached {
+		return false, nil
+	}
+	if len(q.packets) >= q.size {
+		q.overflows.Add(1)
+		counters.sendOverflows.Add(1)
+		return true, fmt.Errorf("%w: send queue full", ErrTimeout)
+	}
+
+	// behind all packets with the same or a higher priority
+	index := len(q.packets)
+	for index > 0 && q.packets[index-1].Priority < packet.Priority {
+		index--
+	}
+	q.packets = slices.Insert(q.packets, index, queued)
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return true, nil
+}
+
+// pop the next packet, done is true if the queue was detached and is empty
+func (q *sendQueue) pop() (packet *queuedPacket, done bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if len(q.packets) == 0 {
+		return nil, q.detached
+	}
+	packet = q.packets[0]
+	q.packets[0] = nil
+	q.packets = q.packets[1:]
+	return packet, false
+}
+
+// detach the queue from the connection, remaining packets are still sent
+func (q *sendQueue) detach() {
+	q.mutex.Lock()
+	q.detached = true
+	q.mutex.Unlock()
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// resize the queue, already queued packets are kept
+func (q *sendQueue) resize(size int) {
+	q.mutex.Lock()
+	q.size = size
+	q.mutex.Unlock()
+}
+
+// stats of the queue
+func (q *sendQueue) stats() SendQueueStats {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	return SendQueueStats{
+		Size:      q.size,
+		Queued:    len(q.packets),
+		Overflows: q.overflows.Load(),
+		Expired:   q.expired.Load(),
+	}
+}
+
+// SetSendQueue sends packets asynchronously with a queue of the given size.
+// A size of 0 sends packets synchronously again, already queued packets are still sent.
+func (c *Connection) SetSendQueue(size int) {
+	c.sendQueueMutex.Lock()
+	defer c.sendQueueMutex.Unlock()
+
+	queue := c.sendQueue.Load()
+	if size <= 0 {
+		if queue != nil {
+			c.sendQueue.Store(nil)
+			queue.detach()
+		}
+		return
+	}
+	if queue != nil {
+		queue.resize(size)
+		return
+	}
+
+	select {
+	case <-c.closed:
+		return
+	default:
+	}
+
+	queue = newSendQueue(size)
+	c.sendQueue.Store(queue)
+	c.running.Add(1)
+	go func() {
+		defer c.running.Done()
+		c.sendLoop(queue)
+	}()
+}
+
+// stopSendQueue sends the queued packets and waits until the send worker exited or ctx is done
+func (c *Connection) stopSendQueue(ctx context.Context) {
+	c.sendQueueMutex.Lock()
+	queue := c.sendQueue.Swap(nil)
+	c.sendQueueMutex.Unlock()
+	if queue == nil {
+		return
+	}
+
+	queue.detach()
+	select {
+	case <-queue.done:
+	case <-ctx.Done():
+	}
+}
+
+// SendQueueStats returns the state of the send queue (zero if disabled)
+func (c *Connection) SendQueueStats() SendQueueStats {
+	queue := c.sendQueue.Load()
+	if queue == nil {
+		return SendQueueStats{}
+	}
+	return queue.stats()
+}
+
+// sendLoop writes the queued packets until the connection or the queue is closed
+func (c *Connection) sendLoop(queue *sendQueue) {
+	defer close(queue.done)
+	for {
+		packet, done := queue.pop()
+		if done {
+			return
+		}
+		if packet == nil {
+			select {
+			case <-queue.wake:
+			case <-c.closed:
+				return
+			}
+			continue
+		}
+
+		select {
+		case <-c.closed:
+			return
+		default:
+		}
+		c.sendQueued(queue, packet)
+	}
+}
+
+// sendQueued writes the packet if its deadline did not pass before a token of the rate limiter is available
+func (c *Connection) sendQueued(queue *sendQueue, packet *queuedPacket) {
+	ctx, cancel := context.WithDeadline(packet.Context(), packet.deadline)
+	defer cancel()
+
+	err := ctx.Err()
+	if err == nil {
+		err = c.limiter.wait(ctx, packet.Priority)
+	}
+	if err != nil {
+		queue.expired.Add(1)
+		counters.sendExpired.Add(1)
+		Log.Printf("send queue - drop packet to %s: %v", packet.Address, err)
+		return
+	}
+
+	err = c.send(packet.RawPacket)
+	if err != nil {
+		Log.Printf("send queue - failed to send packet to %s: %v", packet.Address, err)
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writtenConn records the written packets
+type writtenConn struct {
+	idleConn
+	once    sync.Once
+	mutex   sync.Mutex
+	written [][]byte
+}
+
+func (c *writtenConn) Close() error {
+	c.once.Do(func() {
+		close(c.closed)
+	})
+	return nil
+}
+
+func (c *writtenConn) WriteTo(p []byte, _ net.Addr) (int, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.written = append(c.written, append([]byte(nil), p...))
+	return len(p), nil
+}
+
+func (c *writtenConn) packets() [][]byte {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return append([][]byte(nil), c.written...)
+}
+
+// newQueuedConnection with a send queue and a rate limit of one packet per interval
+func newQueuedConnection(t *testing.T, interval time.Duration) (*Connection, *writtenConn) {
+	socket := &writtenConn{idleConn: idleConn{closed: make(chan struct{})}}
+	conn, err := NewPacketConnection(socket)
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+	conn.SetRateLimit(float64(time.Second)/float64(interval), 1)
+	conn.SetSendQueue(16)
+	return conn, socket
+}
+
+var queueAddress = &net.UDPAddr{IP: net.IPv4(192, 168, 0, 20), Port: 9522}
+
+func TestSendQueue_push(t *testing.T) {
+	tests := []struct {
+		name       string
+		priorities []Priority
+		// indexes of the pushed packets in order of pop
+		order []byte
+	}{
+		{"same priority", []Priority{PriorityNormal, PriorityNormal, PriorityNormal}, []byte{0, 1, 2}},
+		{"higher first", []Priority{PriorityLow, PriorityNormal, PriorityHigh}, []byte{2, 1, 0}},
+		{"stable", []Priority{PriorityNormal, PriorityHigh, PriorityNormal, PriorityHigh}, []byte{1, 3, 0, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ass := assert.New(t)
+
+			queue := newSendQueue(len(tt.priorities))
+			for i, priority := range tt.priorities {
+				queued, err := queue.push(&RawPacket{Address: queueAddress, Data: []byte{byte(i)}, Priority: priority})
+				ass.True(queued)
+				ass.NoError(err)
+			}
+
+			var order []byte
+			for {
+				packet, done := queue.pop()
+				ass.False(done)
+				if packet == nil {
+					break
+				}
+				order = append(order, packet.Data[0])
+			}
+			ass.Equal(tt.order, order)
+		})
+	}
+}
+
+func TestSendQueue_push_full(t *testing.T) {
+	ass := assert.New(t)
+
+	queue := newSendQueue(2)
+	for range 2 {
+		_, err := queue.push(&RawPacket{Address: queueAddress})
+		ass.NoError(err)
+	}
+	queued, err := queue.push(&RawPacket{Address: queueAddress})
+	ass.True(queued)
+	ass.ErrorIs(err, ErrTimeout)
+	ass.Equal(SendQueueStats{Size: 2, Queued: 2, Overflows: 1}, queue.stats())
+}
+
+func TestSendQueue_detach(t *testing.T) {
+	ass := assert.New(t)
+
+	queue := newSendQueue(2)
+	_, err := queue.push(&RawPacket{Address: queueAddress, Data: []byte{1}})
+	ass.NoError(err)
+	queue.detach()
+
+	// new packets are sent synchronously, queued ones are still returned
+	queued, err := queue.push(&RawPacket{Address: queueAddress, Data: []byte{2}})
+	ass.False(queued)
+	ass.NoError(err)
+	packet, done := queue.pop()
+	ass.False(done)
+	ass.Equal([]byte{1}, packet.Data)
+	packet, done = queue.pop()
+	ass.Nil(packet)
+	ass.True(done)
+}
+
+func TestConnection_SetSendQueue_deadline(t *testing.T) {
+	ass := assert.New(t)
+
+	conn, socket := newQueuedConnection(t, time.Second)
+
+	// second packet waits for the rate limit longer than its deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	for i := range 2 {
+		ass.NoError(conn.writeCtx(ctx, []byte{byte(i)}, queueAddress))
+	}
+	ass.Eventually(func() bool {
+		return conn.SendQueueStats().Expired == 1
+	}, time.Second, time.Millisecond)
+	ass.Equal([][]byte{{0}}, socket.packets())
+}
+
+func TestConnection_SetSendQueue_disable(t *testing.T) {
+	ass := assert.New(t)
+
+	conn, socket := newQueuedConnection(t, 20*time.Millisecond)
+	for i := range 3 {
+		ass.NoError(conn.write([]byte{byte(i)}, queueAddress))
+	}
+
+	// queued packets are still sent, new ones synchronously
+	conn.SetSendQueue(0)
+	ass.Equal(SendQueueStats{}, conn.SendQueueStats())
+	ass.Eventually(func() bool {
+		return len(socket.packets()) == 3
+	}, time.Second, time.Millisecond)
+	ass.NoError(conn.write([]byte{3}, queueAddress))
+	ass.Equal([][]byte{{0}, {1}, {2}, {3}}, socket.packets())
+}
+
+func TestConnection_Shutdown_sendQueue(t *testing.T) {
+	ass := assert.New(t)
+
+	conn, socket := newQueuedConnection(t, 20*time.Millisecond)
+	for i := range 3 {
+		ass.NoError(conn.write([]byte{byte(i)}, queueAddress))
+	}
+
+	// queued packets are sent before the socket is closed
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	ass.NoError(conn.Shutdown(ctx))
+	ass.Equal([][]byte{{0}, {1}, {2}}, socket.packets())
+}
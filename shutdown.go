@@ -0,0 +1,135 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Shutdown closes all connections created by NewConnection. Logged in devices
+// are logged out and internal goroutines are stopped; it waits until they
+// exited or ctx is done.
+func Shutdown(ctx context.Context) error {
+	connectionMutex.Lock()
+	cached := make([]*Connection, 0, len(connections))
+	for _, conn := range connections {
+		cached = append(cached, conn)
+	}
+	connectionMutex.Unlock()
+
+	var errs []error
+	for _, conn := range cached {
+		err := conn.Shutdown(ctx)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close the connection, see Shutdown
+func (c *Connection) Close() error {
+	return c.Shutdown(context.Background())
+}
+
+// Shutdown logs out all devices with a valid session, closes the socket and
+// waits until the internal goroutines exited or ctx is done.
+// The connection can't be used afterwards.
+func (c *Connection) Shutdown(ctx context.Context) error {
+	var err error
+	c.closeOnce.Do(func() {
+		for _, device := range c.deviceList() {
+			if device.Health().SessionValid {
+				device.logout()
+			}
+			device.Close()
+		}
+
+		// the logouts may still be queued
+		c.stopSendQueue(ctx)
+		close(c.closed)
+		err = c.socket.Close()
+
+		if c.key != "" {
+			connectionMutex.Lock()
+			if connections[c.key] == c {
+				delete(connections, c.key)
+			}
+			connectionMutex.Unlock()
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("failed to close socket: %w", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		c.running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("shutdown: %w", ctx.Err())
+	}
+}
+
+// isClosed returns true after shutdown
+func (c *Connection) isClosed() bool {
+	select {
+	case <-c.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// addDevice created with this connection
+func (c *Connection) addDevice(device *Device) {
+	c.devicesMutex.Lock()
+	defer c.devicesMutex.Unlock()
+	c.devices[device] = struct{}{}
+}
+
+// removeDevice after it was closed
+func (c *Connection) removeDevice(device *Device) {
+	c.devicesMutex.Lock()
+	defer c.devicesMutex.Unlock()
+	delete(c.devices, device)
+}
+
+// hasDevice checks if the device was not closed yet
+func (c *Connection) hasDevice(device *Device) bool {
+	c.devicesMutex.Lock()
+	defer c.devicesMutex.Unlock()
+	_, ok := c.devices[device]
+	return ok
+}
+
+// deviceList returns all devices of the connection
+func (c *Connection) deviceList() []*Device {
+	c.devicesMutex.Lock()
+	defer c.devicesMutex.Unlock()
+
+	devices := make([]*Device, 0, len(c.devices))
+	for device := range c.devices {
+		devices = append(devices, device)
+	}
+	return devices
+}
@@ -0,0 +1,63 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/pb82/sunny"
+	"github.com/pb82/sunny/sunnytest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnection_Shutdown_logout(t *testing.T) {
+	for _, queue := range []int{0, 16} {
+		t.Run(fmt.Sprintf("queue %d", queue), func(t *testing.T) {
+			ass := assert.New(t)
+
+			network := sunnytest.NewNetwork()
+			defer network.Close()
+			inverter, err := network.AddInverter("192.168.0.20", 1234, "0000")
+			ass.NoError(err)
+			inverter.SetValue(sunny.ActivePowerPlus, uint32(1500))
+			inverter.SetLatency(200 * time.Millisecond)
+
+			connection, err := network.Connection()
+			ass.NoError(err)
+			connection.SetSendQueue(queue)
+			device, err := connection.NewDevice("192.168.0.20", "0000")
+			ass.NoError(err)
+
+			// shutdown while values are requested
+			go func() {
+				_, _ = device.GetValues()
+			}()
+			ass.Eventually(func() bool {
+				return device.Health().SessionValid
+			}, time.Second, time.Millisecond)
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			ass.NoError(connection.Shutdown(ctx))
+			ass.False(device.Health().SessionValid)
+			ass.Eventually(func() bool {
+				return inverter.Logouts() == 1
+			}, time.Second, time.Millisecond)
+		})
+	}
+}
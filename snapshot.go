@@ -0,0 +1,71 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"context"
+	"slices"
+	"time"
+)
+
+// Snapshot of all values of a device
+type Snapshot struct {
+	// Serial of the device
+	Serial uint32
+	// Captured is the time the snapshot was completed
+	Captured time.Time
+	// Values with their timestamps
+	Values map[ValueID]Value
+}
+
+// GetSnapshot of all values of the device. Values contain the timestamp reported
+// by the device if available, otherwise the time they were received.
+// If some value groups fail, the snapshot is returned together with a *MultiError.
+func (d *Device) GetSnapshot(ctx context.Context) (snapshot *Snapshot, err error) {
+	values, times, err := d.getValues(ctx)
+	defer func() {
+		d.pollDone(partialSuccess(err, len(values) > 0))
+	}()
+	if values == nil && err != nil {
+		return nil, err
+	}
+
+	return &Snapshot{
+		Serial:   d.id.SerialNumber,
+		Captured: time.Now(),
+		Values:   newValuesAt(values, times),
+	}, err
+}
+
+// Age of the value at the capture time, returns false if the value does not exist
+func (s *Snapshot) Age(id ValueID) (time.Duration, bool) {
+	value, ok := s.Values[id]
+	if !ok {
+		return 0, false
+	}
+	return s.Captured.Sub(value.Timestamp), true
+}
+
+// Stale returns all values older than maxAge at the capture time (sorted by ID)
+func (s *Snapshot) Stale(maxAge time.Duration) []ValueID {
+	var stale []ValueID
+	for id, value := range s.Values {
+		if s.Captured.Sub(value.Timestamp) > maxAge {
+			stale = append(stale, id)
+		}
+	}
+	slices.Sort(stale)
+	return stale
+}
@@ -0,0 +1,41 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"github.com/pb82/sunny/proto/net2"
+)
+
+// WithSourceID sets the SUSyID and serial number used as sender of requests.
+// Processes on the same network should use different IDs, by default the ID
+// is derived from the first local IPv4 address.
+func WithSourceID(id net2.DeviceId) ConnectionOption {
+	return func(c *connectionConfig) {
+		c.sourceID = &id
+	}
+}
+
+// SetSourceID used as sender of requests sent afterwards
+func (c *Connection) SetSourceID(id net2.DeviceId) {
+	c.sourceID.Store(&id)
+}
+
+// SourceID used as sender of requests
+func (c *Connection) SourceID() net2.DeviceId {
+	if id := c.sourceID.Load(); id != nil {
+		return *id
+	}
+	return *net2.LocalDeviceId()
+}
@@ -0,0 +1,251 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sqlite stores readings of devices in a SQLite database.
+//
+// The database is opened by the application with the SQLite driver of its
+// choice (e.g. modernc.org/sqlite or github.com/mattn/go-sqlite3), so this
+// package does not pull in a driver. The schema is:
+//
+//	CREATE TABLE devices (
+//		serial       INTEGER PRIMARY KEY, -- serial number of the device
+//		energy_meter INTEGER NOT NULL,    -- 1 for energy meters
+//		address      TEXT NOT NULL,       -- last known IP
+//		last_seen    INTEGER NOT NULL     -- unix time in ms of last reading
+//	);
+//	CREATE TABLE readings (
+//		time   INTEGER NOT NULL, -- unix time in ms
+//		serial INTEGER NOT NULL, -- serial number of the device
+//		value  TEXT NOT NULL,    -- name of the value (sunny.ValueName)
+//		number REAL,             -- numeric values
+//		text   TEXT              -- other values
+//	);
+//	CREATE INDEX readings_serial_value_time ON readings (serial, value, time);
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pb82/sunny"
+)
+
+// schema of the database
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS devices (
+		serial       INTEGER PRIMARY KEY,
+		energy_meter INTEGER NOT NULL,
+		address      TEXT NOT NULL,
+		last_seen    INTEGER NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS readings (
+		time   INTEGER NOT NULL,
+		serial INTEGER NOT NULL,
+		value  TEXT NOT NULL,
+		number REAL,
+		text   TEXT
+	)`,
+	`CREATE INDEX IF NOT EXISTS readings_serial_value_time ON readings (serial, value, time)`,
+}
+
+// Reading is a stored value
+type Reading struct {
+	Time   time.Time
+	Serial uint32
+	ID     sunny.ValueID
+	// Value is a float64 for numeric values, otherwise a string
+	Value interface{}
+}
+
+// pruneInterval in which Append deletes readings older than the retention
+const pruneInterval = 10 * time.Minute
+
+// Store of readings
+type Store struct {
+	db *sql.DB
+
+	mutex     sync.Mutex
+	retention time.Duration
+	lastPrune time.Time
+}
+
+// Open the store in the database and creates the schema if needed
+func Open(ctx context.Context, db *sql.DB) (*Store, error) {
+	for _, statement := range schema {
+		_, err := db.ExecContext(ctx, statement)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create schema: %w", err)
+		}
+	}
+	return &Store{db: db}, nil
+}
+
+// SetRetention of readings (0 -> keep all). Older readings are deleted by
+// Append at most every 10 minutes or by calling Prune.
+func (s *Store) SetRetention(retention time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.retention = retention
+	s.lastPrune = time.Time{}
+}
+
+// AppendDevice stores the values read from the device
+func (s *Store) AppendDevice(ctx context.Context, device *sunny.Device, values map[sunny.ValueID]interface{}) error {
+	now := time.Now()
+	_, err := s.db.ExecContext(ctx,
+		`INSERT OR REPLACE INTO devices (serial, energy_meter, address, last_seen) VALUES (?, ?, ?, ?)`,
+		device.SerialNumber(), device.IsEnergyMeter(), device.Address().IP.String(), now.UnixMilli())
+	if err != nil {
+		return fmt.Errorf("failed to store device: %w", err)
+	}
+	return s.Append(ctx, device.SerialNumber(), now, values)
+}
+
+// Append values of the device with the given serial
+func (s *Store) Append(ctx context.Context, serial uint32, t time.Time, values map[sunny.ValueID]interface{}) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO readings (time, serial, value, number, text) VALUES (?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for id, value := range values {
+		var number sql.NullFloat64
+		var text sql.NullString
+		if f, ok := sunny.ToFloat(value); ok {
+			number = sql.NullFloat64{Float64: f, Valid: true}
+		} else {
+			text = sql.NullString{String: fmt.Sprint(value), Valid: true}
+		}
+
+		_, err = stmt.ExecContext(ctx, t.UnixMilli(), serial, sunny.ValueName(id), number, text)
+		if err != nil {
+			return fmt.Errorf("failed to store %s: %w", id, err)
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	if s.pruneDue(time.Now()) {
+		err = s.Prune(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to prune readings: %w", err)
+		}
+	}
+	return nil
+}
+
+// pruneDue returns true if the readings should be pruned
+func (s *Store) pruneDue(now time.Time) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.retention <= 0 || now.Sub(s.lastPrune) < pruneInterval {
+		return false
+	}
+	s.lastPrune = now
+	return true
+}
+
+// Prune readings older than the retention
+func (s *Store) Prune(ctx context.Context) error {
+	s.mutex.Lock()
+	retention := s.retention
+	s.mutex.Unlock()
+
+	if retention <= 0 {
+		return nil
+	}
+	_, err := s.db.ExecContext(ctx, `DELETE FROM readings WHERE time < ?`,
+		time.Now().Add(-retention).UnixMilli())
+	return err
+}
+
+// Query readings of a value of the device in the time range [from, to)
+func (s *Store) Query(ctx context.Context, serial uint32, id sunny.ValueID, from, to time.Time) ([]Reading, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT time, serial, value, number, text FROM readings
+		WHERE serial = ? AND value = ? AND time >= ? AND time < ? ORDER BY time`,
+		serial, sunny.ValueName(id), from.UnixMilli(), to.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	return scanReadings(rows)
+}
+
+// Latest values of the device
+func (s *Store) Latest(ctx context.Context, serial uint32) (map[sunny.ValueID]Reading, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT r.time, r.serial, r.value, r.number, r.text FROM readings r
+		JOIN (SELECT value, MAX(time) AS time FROM readings WHERE serial = ? GROUP BY value) l
+		ON r.value = l.value AND r.time = l.time
+		WHERE r.serial = ?`,
+		serial, serial)
+	if err != nil {
+		return nil, err
+	}
+
+	readings, err := scanReadings(rows)
+	if err != nil {
+		return nil, err
+	}
+	latest := make(map[sunny.ValueID]Reading, len(readings))
+	for _, r := range readings {
+		latest[r.ID] = r
+	}
+	return latest, nil
+}
+
+// scanReadings from rows and closes them
+func scanReadings(rows *sql.Rows) ([]Reading, error) {
+	defer rows.Close()
+
+	var readings []Reading
+	for rows.Next() {
+		var t int64
+		var serial uint32
+		var name string
+		var number sql.NullFloat64
+		var text sql.NullString
+		err := rows.Scan(&t, &serial, &name, &number, &text)
+		if err != nil {
+			return nil, err
+		}
+
+		id, err := sunny.LookupValueID(name)
+		if err != nil {
+			// value of newer library version or not registered custom value
+			continue
+		}
+		r := Reading{Time: time.UnixMilli(t), Serial: serial, ID: id}
+		if number.Valid {
+			r.Value = number.Float64
+		} else {
+			r.Value = text.String
+		}
+		readings = append(readings, r)
+	}
+	return readings, rows.Err()
+}
@@ -0,0 +1,143 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/pb82/sunny"
+	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
+)
+
+// openTestStore in an in-memory database
+func openTestStore(t *testing.T) *Store {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every connection has its own in-memory database
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+
+	store, err := Open(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestStore_Query(t *testing.T) {
+	ass := assert.New(t)
+	ctx := context.Background()
+	store := openTestStore(t)
+
+	start := time.UnixMilli(time.Now().UnixMilli())
+	for i := range 3 {
+		ass.NoError(store.Append(ctx, 1234, start.Add(time.Duration(i)*time.Minute), map[sunny.ValueID]interface{}{
+			sunny.ActivePowerPlus: int64(100 * i),
+			sunny.DeviceName:      "SN: 1234",
+		}))
+	}
+	ass.NoError(store.Append(ctx, 5678, start, map[sunny.ValueID]interface{}{sunny.ActivePowerPlus: 999.0}))
+
+	readings, err := store.Query(ctx, 1234, sunny.ActivePowerPlus, start, start.Add(2*time.Minute))
+	ass.NoError(err)
+	ass.Equal([]Reading{
+		{Time: start, Serial: 1234, ID: sunny.ActivePowerPlus, Value: 0.0},
+		{Time: start.Add(time.Minute), Serial: 1234, ID: sunny.ActivePowerPlus, Value: 100.0},
+	}, readings)
+
+	latest, err := store.Latest(ctx, 1234)
+	ass.NoError(err)
+	ass.Len(latest, 2)
+	ass.Equal(200.0, latest[sunny.ActivePowerPlus].Value)
+	ass.Equal(start.Add(2*time.Minute), latest[sunny.ActivePowerPlus].Time)
+	ass.Equal("SN: 1234", latest[sunny.DeviceName].Value)
+}
+
+func TestStore_customValue(t *testing.T) {
+	ass := assert.New(t)
+	ctx := context.Background()
+	store := openTestStore(t)
+
+	id, err := sunny.RegisterInverterValue(0x5100, 0x00491E00, 0x00491EFF, 0x491E, sunny.ValueDecoder{Name: "SqliteTestCycles"})
+	ass.NoError(err)
+
+	now := time.UnixMilli(time.Now().UnixMilli())
+	ass.NoError(store.Append(ctx, 1234, now, map[sunny.ValueID]interface{}{id: uint32(17)}))
+
+	// stored by name, so the value is independent of the registration order
+	var name string
+	ass.NoError(store.db.QueryRowContext(ctx, `SELECT value FROM readings`).Scan(&name))
+	ass.Equal("SqliteTestCycles", name)
+
+	readings, err := store.Query(ctx, 1234, id, now, now.Add(time.Second))
+	ass.NoError(err)
+	ass.Equal([]Reading{{Time: now, Serial: 1234, ID: id, Value: 17.0}}, readings)
+}
+
+func TestStore_Prune(t *testing.T) {
+	ass := assert.New(t)
+	ctx := context.Background()
+	store := openTestStore(t)
+
+	now := time.UnixMilli(time.Now().UnixMilli())
+	values := map[sunny.ValueID]interface{}{sunny.ActivePowerPlus: int64(100)}
+	ass.NoError(store.Append(ctx, 1234, now.Add(-2*time.Hour), values))
+	ass.NoError(store.Append(ctx, 1234, now, values))
+
+	// without retention all readings are kept
+	ass.NoError(store.Prune(ctx))
+	readings, err := store.Query(ctx, 1234, sunny.ActivePowerPlus, now.Add(-3*time.Hour), now.Add(time.Second))
+	ass.NoError(err)
+	ass.Len(readings, 2)
+
+	store.SetRetention(time.Hour)
+	ass.NoError(store.Prune(ctx))
+	readings, err = store.Query(ctx, 1234, sunny.ActivePowerPlus, now.Add(-3*time.Hour), now.Add(time.Second))
+	ass.NoError(err)
+	ass.Equal([]Reading{{Time: now, Serial: 1234, ID: sunny.ActivePowerPlus, Value: 100.0}}, readings)
+}
+
+func TestStore_Append_prune(t *testing.T) {
+	ass := assert.New(t)
+	ctx := context.Background()
+	store := openTestStore(t)
+
+	now := time.UnixMilli(time.Now().UnixMilli())
+	values := map[sunny.ValueID]interface{}{sunny.ActivePowerPlus: int64(100)}
+	ass.NoError(store.Append(ctx, 1234, now.Add(-2*time.Hour), values))
+
+	// outdated readings are deleted on write
+	store.SetRetention(time.Hour)
+	ass.NoError(store.Append(ctx, 1234, now, values))
+	readings, err := store.Query(ctx, 1234, sunny.ActivePowerPlus, now.Add(-3*time.Hour), now.Add(time.Second))
+	ass.NoError(err)
+	ass.Len(readings, 1)
+
+	// not pruned again within the interval
+	ass.NoError(store.Append(ctx, 1234, now.Add(-2*time.Hour), values))
+	readings, err = store.Query(ctx, 1234, sunny.ActivePowerPlus, now.Add(-3*time.Hour), now.Add(time.Second))
+	ass.NoError(err)
+	ass.Len(readings, 2)
+}
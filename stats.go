@@ -0,0 +1,121 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// statsWindow is the amount of requests used for rolling statistics
+const statsWindow = 100
+
+// RequestStats are rolling statistics of the requests of a device
+type RequestStats struct {
+	// Samples of round-trip times in the window
+	Samples int
+	// MinRTT minimum round-trip time
+	MinRTT time.Duration
+	// AvgRTT average round-trip time
+	AvgRTT time.Duration
+	// P95RTT 95th percentile of the round-trip time
+	P95RTT time.Duration
+	// Loss of sent requests in the window (0-1)
+	Loss float64
+	// Sent requests in total (including resends)
+	Sent uint64
+	// Lost requests in total (without response)
+	Lost uint64
+}
+
+// requestStats collects round-trip times and losses
+type requestStats struct {
+	mutex sync.Mutex
+	// round-trip times of last requests
+	rtt []time.Duration
+	// loss result of last sent requests
+	lost      []bool
+	sent      uint64
+	lostTotal uint64
+}
+
+// sentLost records a request sent without response
+func (s *requestStats) sentLost() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.sent++
+	s.lostTotal++
+	s.lost = appendWindow(s.lost, true)
+}
+
+// received records a request with response
+// The round-trip time is only used if the request was not resent.
+func (s *requestStats) received(rtt time.Duration, resent bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.sent++
+	s.lost = appendWindow(s.lost, false)
+	if !resent {
+		s.rtt = appendWindow(s.rtt, rtt)
+	}
+}
+
+// appendWindow adds the value and drops the oldest values outside of the window
+func appendWindow[T any](values []T, value T) []T {
+	values = append(values, value)
+	if len(values) > statsWindow {
+		values = slices.Delete(values, 0, len(values)-statsWindow)
+	}
+	return values
+}
+
+// Stats returns the request statistics of the device
+func (d *Device) Stats() RequestStats {
+	d.stats.mutex.Lock()
+	defer d.stats.mutex.Unlock()
+
+	stats := RequestStats{
+		Samples: len(d.stats.rtt),
+		Sent:    d.stats.sent,
+		Lost:    d.stats.lostTotal,
+	}
+
+	if len(d.stats.lost) > 0 {
+		lost := 0
+		for _, l := range d.stats.lost {
+			if l {
+				lost++
+			}
+		}
+		stats.Loss = float64(lost) / float64(len(d.stats.lost))
+	}
+
+	if len(d.stats.rtt) > 0 {
+		sorted := slices.Clone(d.stats.rtt)
+		slices.Sort(sorted)
+
+		var sum time.Duration
+		for _, rtt := range sorted {
+			sum += rtt
+		}
+		stats.MinRTT = sorted[0]
+		stats.AvgRTT = sum / time.Duration(len(sorted))
+		stats.P95RTT = sorted[(len(sorted)*95+99)/100-1]
+	}
+	return stats
+}
@@ -0,0 +1,515 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunnytest
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/pb82/sunny"
+	"github.com/pb82/sunny/proto"
+	"github.com/pb82/sunny/proto/net2"
+)
+
+// status codes of responses
+const (
+	// StatusNoData is returned for requests without values
+	StatusNoData uint16 = 0x15
+	// StatusInvalidPassword is returned for failed logins
+	StatusInvalidPassword uint16 = 0x0100
+)
+
+// archiveFrameRecords is the amount of archive records per response frame
+const archiveFrameRecords = 60
+
+// DefaultSusyID of fake inverters
+const DefaultSusyID uint16 = 0x0138
+
+// Inverter is a fake inverter answering discovery, ping, login and value requests
+type Inverter struct {
+	endpoint *Endpoint
+	id       net2.DeviceId
+	// parent the child device is connected to (nil -> own endpoint)
+	parent *Inverter
+
+	mutex     sync.Mutex
+	children  []*Inverter
+	passwords map[sunny.UserGroup]string
+	values    map[sunny.ValueID]interface{}
+	archive   []sunny.ArchiveRecord
+	latency   time.Duration
+	status    uint16
+	drop      int
+	offline   bool
+	requests  int
+	logouts   int
+}
+
+// AddInverter attaches a fake inverter with the given IP, serial and user password to the network
+func (n *Network) AddInverter(ip string, serial uint32, password string) (*Inverter, error) {
+	address := net.ParseIP(ip)
+	if address == nil {
+		return nil, fmt.Errorf("invalid IP %s", ip)
+	}
+	endpoint, err := n.Endpoint(address)
+	if err != nil {
+		return nil, err
+	}
+
+	inverter := &Inverter{
+		endpoint:  endpoint,
+		id:        net2.DeviceId{SusyID: DefaultSusyID, SerialNumber: serial},
+		passwords: map[sunny.UserGroup]string{sunny.UserGroupUser: password},
+		values:    make(map[sunny.ValueID]interface{}),
+	}
+	go inverter.serve()
+	return inverter, nil
+}
+
+// AddChild attaches a fake inverter behind this device (e.g. a Data Manager),
+// it shares the IP (Move and Close apply to both) and answers requests addressed to its ID
+func (i *Inverter) AddChild(serial uint32, password string) *Inverter {
+	child := &Inverter{
+		endpoint:  i.endpoint,
+		id:        net2.DeviceId{SusyID: DefaultSusyID, SerialNumber: serial},
+		parent:    i,
+		passwords: map[sunny.UserGroup]string{sunny.UserGroupUser: password},
+		values:    make(map[sunny.ValueID]interface{}),
+	}
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.children = append(i.children, child)
+	return child
+}
+
+// ID of the inverter
+func (i *Inverter) ID() net2.DeviceId {
+	return i.id
+}
+
+// SetPassword required for logins of the user group
+func (i *Inverter) SetPassword(group sunny.UserGroup, password string) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.passwords[group] = password
+}
+
+// SetValue returned by the inverter. Values use the same types and units as
+// values read from devices, e.g. float64 for values with a factor.
+func (i *Inverter) SetValue(id sunny.ValueID, value interface{}) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.values[id] = value
+}
+
+// SetValues returned by the inverter, replaces all previous values
+func (i *Inverter) SetValues(values map[sunny.ValueID]interface{}) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	i.values = make(map[sunny.ValueID]interface{}, len(values))
+	for id, value := range values {
+		i.values[id] = value
+	}
+}
+
+// SetDayArchive records returned by day archive requests (sorted by time, TotalYield in Ws)
+func (i *Inverter) SetDayArchive(records []sunny.ArchiveRecord) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.archive = slices.Clone(records)
+}
+
+// SetLatency before each response is sent
+func (i *Inverter) SetLatency(latency time.Duration) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.latency = latency
+}
+
+// SetStatus of value responses, e.g. to simulate a busy device (0 -> success)
+func (i *Inverter) SetStatus(status uint16) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.status = status
+}
+
+// SetOffline drops all requests while enabled
+func (i *Inverter) SetOffline(offline bool) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.offline = offline
+}
+
+// DropNext requests without response, e.g. to simulate packet loss
+func (i *Inverter) DropNext(count int) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.drop = count
+}
+
+// Requests returns the amount of received device data requests
+func (i *Inverter) Requests() int {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	return i.requests
+}
+
+// Logouts returns the amount of received logout requests
+func (i *Inverter) Logouts() int {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	return i.logouts
+}
+
+// Move the inverter to a new IP, e.g. to simulate a changed DHCP lease
+func (i *Inverter) Move(ip string) error {
+	address := net.ParseIP(ip)
+	if address == nil {
+		return fmt.Errorf("invalid IP %s", ip)
+	}
+	return i.endpoint.Move(address)
+}
+
+// Close detaches the inverter from the network
+func (i *Inverter) Close() {
+	_ = i.endpoint.Close()
+}
+
+// serve requests until the endpoint is closed
+func (i *Inverter) serve() {
+	buffer := make([]byte, 0xFFFF)
+	for {
+		n, address, err := i.endpoint.ReadFrom(buffer)
+		if err != nil {
+			return
+		}
+
+		var pack proto.Packet
+		if pack.Read(buffer[:n]) != nil {
+			continue
+		}
+
+		i.mutex.Lock()
+		devices := append([]*Inverter{i}, i.children...)
+		i.mutex.Unlock()
+		for _, device := range devices {
+			responses := device.handle(&pack)
+
+			device.mutex.Lock()
+			latency := device.latency
+			device.mutex.Unlock()
+			for _, response := range responses {
+				device.send(address, response, latency)
+			}
+		}
+	}
+}
+
+// send the response after the latency
+func (i *Inverter) send(address net.Addr, response *proto.Packet, latency time.Duration) {
+	data := response.Bytes()
+	if latency <= 0 {
+		_, _ = i.endpoint.WriteTo(data, address)
+		return
+	}
+	time.AfterFunc(latency, func() {
+		_, _ = i.endpoint.WriteTo(data, address)
+	})
+}
+
+// handle a received packet and return the response frames (nil -> no response)
+func (i *Inverter) handle(pack *proto.Packet) []*proto.Packet {
+	if pack.GetEntry(proto.DiscoveryRequestPacketEntryTag) != nil {
+		if i.parent != nil {
+			return nil
+		}
+		return []*proto.Packet{proto.NewPacketBuilder().
+			Group(proto.GroupDefault).
+			Entry(&proto.DiscoveryIPPacketEntry{IP: i.endpoint.address.Load().IP.To4()}).
+			Build()}
+	}
+
+	entry, ok := pack.GetEntry(proto.SmaNet2PacketEntryTag).(*proto.SmaNet2PacketEntry)
+	if !ok {
+		return nil
+	}
+	request, ok := entry.Content.(*net2.DeviceData)
+	// responses of other devices (archive requests use the response control)
+	if !ok || request.Command == net2.CommandValues || !i.addressed(request) {
+		return nil
+	}
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	i.requests++
+	if i.offline {
+		return nil
+	}
+	if i.drop > 0 {
+		i.drop--
+		return nil
+	}
+
+	var response *net2.DeviceData
+	switch {
+	case request.Command == net2.CommandLogin:
+		response = i.response(request)
+		if !i.validLogin(request) {
+			response.Status = StatusInvalidPassword
+		}
+	case request.Command == net2.CommandLogout:
+		i.logouts++
+		return nil
+	case request.Command == net2.CommandGetValues && request.Object == 0:
+		response = i.response(request)
+	case request.Command == net2.CommandGetValues && request.Object == net2.ObjectDayArchive:
+		var packets []*proto.Packet
+		for _, frame := range i.archiveResponse(request) {
+			packets = append(packets, proto.NewPacketBuilder().Group(proto.GroupDefault).Net2(frame).Build())
+		}
+		return packets
+	case request.Command == net2.CommandGetValues:
+		response = i.valuesResponse(request)
+	default:
+		return nil
+	}
+	return []*proto.Packet{proto.NewPacketBuilder().Group(proto.GroupDefault).Net2(response).Build()}
+}
+
+// addressed checks if the request is sent to the inverter or broadcast
+func (i *Inverter) addressed(request *net2.DeviceData) bool {
+	return request.Destination == i.id || request.Destination.IsBroadcast()
+}
+
+// response to the request without values
+func (i *Inverter) response(request *net2.DeviceData) *net2.DeviceData {
+	data := proto.NewDeviceDataBuilder(net2.CommandValues, request.Object).
+		Control(net2.ControlResponse).
+		Source(i.id).
+		Destination(request.Source).
+		JobNumber(request.JobNumber).
+		Parameters(request.Parameters...).
+		Build()
+	data.PacketID = request.PacketID
+	return data
+}
+
+// validLogin checks the password of a login request
+func (i *Inverter) validLogin(request *net2.DeviceData) bool {
+	if len(request.Parameters) == 0 || len(request.Data) < 12 {
+		return false
+	}
+
+	group, key := sunny.UserGroupUser, byte(0x88)
+	if request.Parameters[0] == 10 {
+		group, key = sunny.UserGroupInstaller, 0xBB
+	}
+	password, ok := i.passwords[group]
+	if !ok {
+		return false
+	}
+
+	for index, b := range request.Data[:12] {
+		expected := key
+		if index < len(password) {
+			expected = password[index] + key
+		}
+		if b != expected {
+			return false
+		}
+	}
+	return true
+}
+
+// valuesResponse with all values in the requested range
+func (i *Inverter) valuesResponse(request *net2.DeviceData) *net2.DeviceData {
+	response := i.response(request)
+	if i.status != 0 {
+		response.Status = i.status
+		return response
+	}
+	if len(request.Parameters) < 2 {
+		response.Status = StatusNoData
+		return response
+	}
+
+	start, end := request.Parameters[0], request.Parameters[1]
+	timestamp := uint32(time.Now().Unix())
+	for id, value := range i.values {
+		def, ok := sunny.LookupInverterValue(id)
+		if !ok || def.Object != request.Object {
+			continue
+		}
+		if code := uint32(def.Code) << 8; code < start || code > end {
+			continue
+		}
+
+		responseValue, err := encodeValue(def, value, timestamp)
+		if err != nil {
+			sunny.Log.Printf("fake inverter - skip %s: %v", id, err)
+			continue
+		}
+		response.Data = append(response.Data, responseValue.Bytes(request.Object)...)
+	}
+	if response.Data == nil {
+		response.Status = StatusNoData
+	}
+	return response
+}
+
+// archiveResponse frames with the archive records in the requested time range
+func (i *Inverter) archiveResponse(request *net2.DeviceData) []*net2.DeviceData {
+	response := i.response(request)
+	if i.status != 0 {
+		response.Status = i.status
+		return []*net2.DeviceData{response}
+	}
+	if len(request.Parameters) < 2 {
+		response.Status = StatusNoData
+		return []*net2.DeviceData{response}
+	}
+
+	var records []byte
+	for _, record := range i.archive {
+		if t := record.Time.Unix(); t < int64(request.Parameters[0]) || t > int64(request.Parameters[1]) {
+			continue
+		}
+		records = binary.LittleEndian.AppendUint32(records, uint32(record.Time.Unix()))
+		records = binary.LittleEndian.AppendUint64(records, uint64(math.Round(record.TotalYield/3600)))
+	}
+	if records == nil {
+		response.Status = StatusNoData
+		return []*net2.DeviceData{response}
+	}
+
+	// frames count down to 0, only the first one is sent with the first frame flag
+	frameSize := archiveFrameRecords * net2.DayArchiveRecordSize
+	count := (len(records) + frameSize - 1) / frameSize
+	frames := make([]*net2.DeviceData, 0, count)
+	for index := 0; index < len(records); index += frameSize {
+		frame := *response
+		frame.PacketCount = uint16(count - 1 - len(frames))
+		frame.Fragment = len(frames) > 0
+		frame.Data = records[index:min(index+frameSize, len(records))]
+		frames = append(frames, &frame)
+	}
+	return frames
+}
+
+// encodeValue to its raw representation
+func encodeValue(def sunny.InverterValuesDef, value interface{}, timestamp uint32) (*net2.ResponseValue, error) {
+	responseValue := &net2.ResponseValue{
+		Class:     def.Class,
+		Code:      def.Code,
+		Timestamp: timestamp,
+	}
+
+	switch v := value.(type) {
+	case string:
+		responseValue.Type = 0x10
+		responseValue.Values = []interface{}{v}
+		return responseValue, nil
+	case []uint32:
+		responseValue.Type = 0x08
+		for _, attribute := range v {
+			responseValue.Values = append(responseValue.Values, attribute)
+		}
+		return responseValue, nil
+	}
+
+	f, ok := sunny.ToFloat(value)
+	if !ok {
+		return nil, fmt.Errorf("unsupported type %T", value)
+	}
+	if def.Factor != 0 {
+		f /= def.Factor
+	}
+	f = math.Round(f)
+
+	switch {
+	case def.Object == 0x5400:
+		if f < 0 {
+			return nil, fmt.Errorf("negative value %v", value)
+		}
+		responseValue.Values = []interface{}{uint64(f)}
+	case f < 0:
+		responseValue.Type = 0x40
+		responseValue.Values = []interface{}{int32(f)}
+	default:
+		responseValue.Values = []interface{}{uint32(f)}
+	}
+	return responseValue, nil
+}
+
+// EnergyMeter is a fake energy meter broadcasting its values
+type EnergyMeter struct {
+	meter  *sunny.VirtualEnergyMeter
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// DefaultEnergyMeterInterval between broadcasts of fake energy meters
+const DefaultEnergyMeterInterval = 100 * time.Millisecond
+
+// AddEnergyMeter attaches a fake energy meter with the given IP and ID to the network
+func (n *Network) AddEnergyMeter(ip string, id net2.DeviceId) (*EnergyMeter, error) {
+	address := net.ParseIP(ip)
+	if address == nil {
+		return nil, fmt.Errorf("invalid IP %s", ip)
+	}
+	conn, err := n.ConnectionAt(address)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	meter := &EnergyMeter{
+		meter:  conn.NewVirtualEnergyMeter(id),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	meter.meter.SetInterval(DefaultEnergyMeterInterval)
+	go func() {
+		defer close(meter.done)
+		_ = meter.meter.Run(ctx)
+	}()
+	n.onClose(meter.Close)
+	return meter, nil
+}
+
+// SetValue broadcasted by the energy meter
+func (m *EnergyMeter) SetValue(id sunny.ValueID, value interface{}) {
+	m.meter.SetValue(id, value)
+}
+
+// SetValues broadcasted by the energy meter, replaces all previous values
+func (m *EnergyMeter) SetValues(values map[sunny.ValueID]interface{}) {
+	m.meter.SetValues(values)
+}
+
+// Close stops the broadcasts
+func (m *EnergyMeter) Close() {
+	m.cancel()
+	<-m.done
+}
@@ -0,0 +1,251 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sunnytest provides an in-memory Speedwire network with fake devices
+// for unit tests of applications using sunny, no sockets or hardware required.
+package sunnytest
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pb82/sunny"
+)
+
+// port used by all endpoints of the network
+const port = 9522
+
+// endpointBufferSize of received packets per endpoint, further packets are dropped
+const endpointBufferSize = 1024
+
+// DefaultClientIP of the connection created by Network.Connection
+var DefaultClientIP = net.IPv4(192, 168, 0, 1)
+
+// Network is an in-memory Speedwire network. Packets sent to the multicast
+// group are delivered to all other endpoints, other packets to the endpoint
+// with the destination IP.
+type Network struct {
+	mutex     sync.Mutex
+	endpoints map[string]*Endpoint
+	closers   []func()
+}
+
+// NewNetwork creates an empty network
+func NewNetwork() *Network {
+	return &Network{
+		endpoints: make(map[string]*Endpoint),
+	}
+}
+
+// Connection creates a sunny.Connection attached to the network with DefaultClientIP
+func (n *Network) Connection() (*sunny.Connection, error) {
+	return n.ConnectionAt(DefaultClientIP)
+}
+
+// ConnectionAt creates a sunny.Connection attached to the network with the given IP
+func (n *Network) ConnectionAt(ip net.IP) (*sunny.Connection, error) {
+	endpoint, err := n.Endpoint(ip)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := sunny.NewPacketConnection(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	n.onClose(func() {
+		_ = conn.Close()
+	})
+	return conn, nil
+}
+
+// Endpoint attaches a new socket with the given IP to the network
+func (n *Network) Endpoint(ip net.IP) (*Endpoint, error) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	key := ip.String()
+	if _, ok := n.endpoints[key]; ok {
+		return nil, fmt.Errorf("IP %s already used in network", key)
+	}
+	endpoint := &Endpoint{
+		network: n,
+		packets: make(chan packet, endpointBufferSize),
+		closed:  make(chan struct{}),
+	}
+	endpoint.address.Store(&net.UDPAddr{IP: ip, Port: port})
+	n.endpoints[key] = endpoint
+	return endpoint, nil
+}
+
+// Close all connections, devices and endpoints of the network
+func (n *Network) Close() {
+	n.mutex.Lock()
+	closers := n.closers
+	n.closers = nil
+	endpoints := n.endpoints
+	n.endpoints = make(map[string]*Endpoint)
+	n.mutex.Unlock()
+
+	for i := len(closers) - 1; i >= 0; i-- {
+		closers[i]()
+	}
+	for _, endpoint := range endpoints {
+		_ = endpoint.Close()
+	}
+}
+
+// onClose registers a function called on Close
+func (n *Network) onClose(f func()) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.closers = append(n.closers, f)
+}
+
+// deliver the packet to the destination endpoints
+func (n *Network) deliver(src *Endpoint, dst *net.UDPAddr, data []byte) {
+	n.mutex.Lock()
+	var targets []*Endpoint
+	if dst.IP.IsMulticast() || dst.IP.Equal(net.IPv4bcast) {
+		for _, endpoint := range n.endpoints {
+			if endpoint != src {
+				targets = append(targets, endpoint)
+			}
+		}
+	} else if endpoint, ok := n.endpoints[dst.IP.String()]; ok {
+		targets = append(targets, endpoint)
+	}
+	n.mutex.Unlock()
+
+	for _, endpoint := range targets {
+		endpoint.receive(src.address.Load(), data)
+	}
+}
+
+// remove the endpoint from the network
+func (n *Network) remove(endpoint *Endpoint) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	key := endpoint.address.Load().IP.String()
+	if n.endpoints[key] == endpoint {
+		delete(n.endpoints, key)
+	}
+}
+
+// move the endpoint to a new IP
+func (n *Network) move(endpoint *Endpoint, ip net.IP) error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	key := ip.String()
+	if _, ok := n.endpoints[key]; ok {
+		return fmt.Errorf("IP %s already used in network", key)
+	}
+	old := endpoint.address.Load().IP.String()
+	if n.endpoints[old] == endpoint {
+		delete(n.endpoints, old)
+	}
+	n.endpoints[key] = endpoint
+	endpoint.address.Store(&net.UDPAddr{IP: ip, Port: port})
+	return nil
+}
+
+// packet received by an endpoint
+type packet struct {
+	address *net.UDPAddr
+	data    []byte
+}
+
+// Endpoint is a socket of the network, it implements net.PacketConn
+type Endpoint struct {
+	network *Network
+	address atomic.Pointer[net.UDPAddr]
+	packets chan packet
+
+	closed chan struct{}
+	once   sync.Once
+}
+
+// receive a packet, drops it if the buffer is full
+func (e *Endpoint) receive(address *net.UDPAddr, data []byte) {
+	select {
+	case <-e.closed:
+	case e.packets <- packet{address: address, data: append([]byte(nil), data...)}:
+	default:
+	}
+}
+
+// ReadFrom returns the next received packet and blocks if none is available
+func (e *Endpoint) ReadFrom(p []byte) (int, net.Addr, error) {
+	select {
+	case packet := <-e.packets:
+		return copy(p, packet.data), packet.address, nil
+	case <-e.closed:
+		return 0, nil, net.ErrClosed
+	}
+}
+
+// WriteTo sends the packet to the network
+func (e *Endpoint) WriteTo(p []byte, address net.Addr) (int, error) {
+	select {
+	case <-e.closed:
+		return 0, net.ErrClosed
+	default:
+	}
+
+	dst, ok := address.(*net.UDPAddr)
+	if !ok {
+		return 0, fmt.Errorf("unsupported address %s", address)
+	}
+	e.network.deliver(e, dst, p)
+	return len(p), nil
+}
+
+// Close detaches the endpoint from the network
+func (e *Endpoint) Close() error {
+	e.once.Do(func() {
+		close(e.closed)
+		e.network.remove(e)
+	})
+	return nil
+}
+
+// Move the endpoint to a new IP, e.g. to simulate a changed DHCP lease
+func (e *Endpoint) Move(ip net.IP) error {
+	return e.network.move(e, ip)
+}
+
+// LocalAddr returns the address of the endpoint
+func (e *Endpoint) LocalAddr() net.Addr {
+	return e.address.Load()
+}
+
+// SetDeadline is not supported by endpoints
+func (e *Endpoint) SetDeadline(time.Time) error {
+	return errors.ErrUnsupported
+}
+
+// SetReadDeadline is not supported by endpoints
+func (e *Endpoint) SetReadDeadline(time.Time) error {
+	return errors.ErrUnsupported
+}
+
+// SetWriteDeadline is not supported by endpoints
+func (e *Endpoint) SetWriteDeadline(time.Time) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,115 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"net"
+	"time"
+
+	"github.com/pb82/sunny/proto"
+	"github.com/pb82/sunny/proto/net2"
+)
+
+// locateInterval limits the broadcast pings sent to find devices with a changed IP
+const locateInterval = 30 * time.Second
+
+// WithAddressTracking keeps devices bound to their serial number instead of
+// their IP, see SetAddressTracking
+func WithAddressTracking() ConnectionOption {
+	return func(c *connectionConfig) {
+		c.addressTracking = true
+	}
+}
+
+// SetAddressTracking enables the tracking of device addresses (e.g. after DHCP
+// changes). Packets of unknown IPs are decoded and if a known serial number
+// answers from a new IP, the device is re-bound to it. Inverters not responding
+// anymore are searched with a broadcast ping.
+func (c *Connection) SetAddressTracking(enabled bool) {
+	c.addressTracking.Store(enabled)
+}
+
+// trackAddress re-binds the device with the serial number of the packet to the source address
+func (c *Connection) trackAddress(address *net.UDPAddr, packet *proto.Packet) {
+	entry, ok := packet.GetEntry(proto.SmaNet2PacketEntryTag).(*proto.SmaNet2PacketEntry)
+	if !ok {
+		return
+	}
+
+	var id net2.DeviceId
+	energyMeter := false
+	switch content := entry.Content.(type) {
+	case *net2.EnergyMeterPacket:
+		id = content.Id
+		energyMeter = true
+	case *net2.DeviceData:
+		id = content.Source
+	default:
+		return
+	}
+	if id.SerialNumber == 0 {
+		return
+	}
+
+	for _, device := range c.deviceList() {
+		// known addresses of devices with multiple interfaces are kept
+		if device.id.SerialNumber == id.SerialNumber && device.energyMeter == energyMeter &&
+			!device.hasAddress(address.IP) {
+			Log.Printf("device %d answers from new address %s", id.SerialNumber, address.IP)
+			device.addAddress(&net.UDPAddr{IP: address.IP, Port: device.Address().Port}, true)
+		}
+	}
+}
+
+// hasAddress checks if the device is known at the IP
+func (d *Device) hasAddress(ip net.IP) bool {
+	for _, address := range d.Addresses() {
+		if address.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// locate an inverter not responding at its address, the answer is handled by trackAddress
+func (d *Device) locate() {
+	if !d.conn.addressTracking.Load() || d.energyMeter {
+		return
+	}
+	last := d.conn.lastLocate.Load()
+	now := time.Now().UnixNano()
+	if time.Duration(now-last) < locateInterval || !d.conn.lastLocate.CompareAndSwap(last, now) {
+		return
+	}
+
+	// ping with broadcast destination -> all inverters answer via unicast
+	ping := proto.NewDeviceDataBuilder(net2.CommandGetValues, 0).
+		Parameters(0, 0).
+		Build()
+	ping.Destination = net2.BroadcastDeviceId
+	if id := d.conn.sourceID.Load(); id != nil {
+		ping.Source = *id
+	}
+	pack := proto.NewPacketBuilder().
+		Group(proto.GroupDefault).
+		Net2(ping).
+		Build()
+
+	Log.Printf("device %d does not respond at %s -> broadcast ping", d.id.SerialNumber, d.Address().IP)
+	err := d.conn.sendPacket(d.conn.address, pack)
+	if err != nil {
+		Log.Printf("failed to send broadcast ping: %v", err)
+	}
+}
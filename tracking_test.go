@@ -0,0 +1,55 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pb82/sunny"
+	"github.com/pb82/sunny/sunnytest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnection_SetAddressTracking_pendingRequest(t *testing.T) {
+	ass := assert.New(t)
+
+	network := sunnytest.NewNetwork()
+	defer network.Close()
+	inverter, err := network.AddInverter("192.168.0.20", 1234, "0000")
+	ass.NoError(err)
+	inverter.SetValue(sunny.ActivePowerPlus, uint32(1500))
+
+	connection, err := network.Connection()
+	ass.NoError(err)
+	connection.SetAddressTracking(true)
+	device, err := connection.NewDevice("192.168.0.20", "0000")
+	ass.NoError(err)
+
+	// the answer of the pending login arrives from the new IP
+	inverter.SetLatency(100 * time.Millisecond)
+	requests := inverter.Requests()
+	go func() {
+		ass.Eventually(func() bool {
+			return inverter.Requests() > requests
+		}, time.Second, time.Millisecond)
+		ass.NoError(inverter.Move("192.168.0.21"))
+	}()
+
+	values, err := device.GetValues()
+	ass.NoError(err)
+	ass.Equal(uint32(1500), values[sunny.ActivePowerPlus])
+	ass.Equal("192.168.0.21", device.Address().IP.String())
+}
@@ -0,0 +1,317 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+// maxTunnelFrame limits the size of a tunnel frame
+const maxTunnelFrame = 0xFFFF
+
+// tunnelClientQueue is the amount of packets buffered per client of a relay,
+// further packets are dropped for slow clients
+const tunnelClientQueue = 64
+
+// speedwirePort is the only port tunnel clients may send to
+const speedwirePort = 9522
+
+// speedwireGroup is the multicast group of Speedwire devices
+var speedwireGroup = net.IPv4(239, 12, 255, 254)
+
+// NewTunnelConnection creates a Connection that sends all Speedwire packets via
+// TCP to a relay at the remote site (see ServeTunnel). With tlsConfig the TCP
+// connection is encrypted. Device addresses are those of the remote network.
+func NewTunnelConnection(ctx context.Context, address string, tlsConfig *tls.Config) (*Connection, error) {
+	return NewTunnelConnectionVia(ctx, &net.Dialer{}, address, tlsConfig)
+}
+
+// NewTunnelConnectionVia creates a tunnel Connection (see NewTunnelConnection)
+// with a TCP connection opened by the dialer, e.g. a SOCKS5 proxy or SSH client
+func NewTunnelConnectionVia(ctx context.Context, dialer Dialer, address string, tlsConfig *tls.Config) (*Connection, error) {
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect tunnel: %w", err)
+	}
+
+	if tlsConfig != nil {
+		if tlsConfig.ServerName == "" {
+			tlsConfig = tlsConfig.Clone()
+			tlsConfig.ServerName, _, _ = net.SplitHostPort(address)
+		}
+		tlsConn := tls.Client(conn, tlsConfig)
+		err = tlsConn.HandshakeContext(ctx)
+		if err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("failed to connect tunnel: %w", err)
+		}
+		conn = tlsConn
+	}
+
+	return NewPacketConnection(newTunnelConn(conn))
+}
+
+// ServeTunnel relays Speedwire packets between the clients connecting to the
+// listener and the socket of the local network (e.g. a socket that joined the
+// Speedwire multicast group on port 9522). It stops if ctx is done.
+// Clients can only send to port 9522 of the multicast group and of private or
+// link-local addresses, other packets are dropped.
+func ServeTunnel(ctx context.Context, listener net.Listener, socket net.PacketConn) error {
+	relay := &tunnelRelay{
+		socket:  socket,
+		clients: make(map[*tunnelClient]struct{}),
+	}
+
+	go func() {
+		<-ctx.Done()
+		_ = listener.Close()
+	}()
+	go relay.forwardReceived()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			relay.closeClients()
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		client := &tunnelClient{
+			tunnelConn: newTunnelConn(conn),
+			packets:    make(chan tunnelPacket, tunnelClientQueue),
+		}
+		relay.addClient(client)
+		go client.write()
+		go relay.forwardSent(client)
+	}
+}
+
+// tunnelRelay forwards packets between tunnel clients and the local network
+type tunnelRelay struct {
+	socket  net.PacketConn
+	mutex   sync.Mutex
+	clients map[*tunnelClient]struct{}
+}
+
+// tunnelClient of a relay with the packets to write to it
+type tunnelClient struct {
+	*tunnelConn
+	packets chan tunnelPacket
+}
+
+// tunnelPacket received from the local network
+type tunnelPacket struct {
+	data    []byte
+	address net.Addr
+}
+
+// write the packets to the client until it is removed
+func (c *tunnelClient) write() {
+	failed := false
+	for packet := range c.packets {
+		if failed {
+			continue
+		}
+		_, err := c.WriteTo(packet.data, packet.address)
+		if err != nil {
+			Log.Printf("tunnel - failed to forward packet to %s: %v", c.RemoteAddr(), err)
+			// stops forwardSent which removes the client
+			_ = c.Close()
+			failed = true
+		}
+	}
+}
+
+// addClient to the relay
+func (r *tunnelRelay) addClient(client *tunnelClient) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.clients[client] = struct{}{}
+}
+
+// removeClient from the relay and close it
+func (r *tunnelRelay) removeClient(client *tunnelClient) {
+	r.mutex.Lock()
+	if _, ok := r.clients[client]; ok {
+		delete(r.clients, client)
+		close(client.packets)
+	}
+	r.mutex.Unlock()
+	_ = client.Close()
+}
+
+// closeClients closes all clients
+func (r *tunnelRelay) closeClients() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for client := range r.clients {
+		close(client.packets)
+		_ = client.Close()
+	}
+	clear(r.clients)
+}
+
+// tunnelDestination checks if clients may send to the address
+func tunnelDestination(address *net.UDPAddr) bool {
+	if address.Port != speedwirePort {
+		return false
+	}
+	ip := address.IP
+	return ip.Equal(speedwireGroup) || ip.IsPrivate() || ip.IsLinkLocalUnicast()
+}
+
+// forwardSent packets of the client to the local network
+func (r *tunnelRelay) forwardSent(client *tunnelClient) {
+	defer r.removeClient(client)
+
+	buffer := make([]byte, maxTunnelFrame)
+	for {
+		n, address, err := client.ReadFrom(buffer)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) && !errors.Is(err, io.EOF) {
+				Log.Printf("tunnel - client %s failed: %v", client.RemoteAddr(), err)
+			}
+			return
+		}
+		if !tunnelDestination(address.(*net.UDPAddr)) {
+			Log.Printf("tunnel - client %s: drop packet to %s", client.RemoteAddr(), address)
+			continue
+		}
+
+		_, err = r.socket.WriteTo(buffer[:n], address)
+		if err != nil {
+			Log.Printf("tunnel - failed to send packet to %s: %v", address, err)
+		}
+	}
+}
+
+// forwardReceived packets of the local network to all clients
+func (r *tunnelRelay) forwardReceived() {
+	buffer := make([]byte, maxTunnelFrame)
+	for {
+		n, address, err := r.socket.ReadFrom(buffer)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				Log.Printf("tunnel - failed to read packet: %v", err)
+			}
+			r.closeClients()
+			return
+		}
+
+		packet := tunnelPacket{data: bytes.Clone(buffer[:n]), address: address}
+		r.mutex.Lock()
+		for client := range r.clients {
+			select {
+			case client.packets <- packet:
+			default:
+				// client too slow -> drop packet
+				counters.drops.Add(1)
+				if DetailedPacketLogging.Load() {
+					Log.Printf("DBG: tunnel client %s busy -> drop packet from %s", client.RemoteAddr(), address)
+				}
+			}
+		}
+		r.mutex.Unlock()
+	}
+}
+
+// tunnelConn implements net.PacketConn on top of a stream connection.
+// Each frame contains: length (uint16), address length (uint8), IP, port (uint16) and packet data.
+type tunnelConn struct {
+	net.Conn
+	reader     *bufio.Reader
+	writeMutex sync.Mutex
+	readMutex  sync.Mutex
+}
+
+// newTunnelConn for the stream connection
+func newTunnelConn(conn net.Conn) *tunnelConn {
+	return &tunnelConn{
+		Conn:   conn,
+		reader: bufio.NewReader(conn),
+	}
+}
+
+// ReadFrom reads the next frame
+func (t *tunnelConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	t.readMutex.Lock()
+	defer t.readMutex.Unlock()
+
+	var header [2]byte
+	_, err := io.ReadFull(t.reader, header[:])
+	if err != nil {
+		return 0, nil, err
+	}
+	frame := make([]byte, binary.BigEndian.Uint16(header[:]))
+	_, err = io.ReadFull(t.reader, frame)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if len(frame) < 1 {
+		return 0, nil, fmt.Errorf("%w: empty tunnel frame", ErrInvalidResponse)
+	}
+	ipLength := int(frame[0])
+	if (ipLength != net.IPv4len && ipLength != net.IPv6len) || len(frame) < 1+ipLength+2 {
+		return 0, nil, fmt.Errorf("%w: invalid tunnel frame address", ErrInvalidResponse)
+	}
+	address := &net.UDPAddr{
+		IP:   append(net.IP(nil), frame[1:1+ipLength]...),
+		Port: int(binary.BigEndian.Uint16(frame[1+ipLength:])),
+	}
+	return copy(p, frame[1+ipLength+2:]), address, nil
+}
+
+// WriteTo sends the packet as frame
+func (t *tunnelConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	address, ok := addr.(*net.UDPAddr)
+	if !ok {
+		return 0, fmt.Errorf("unsupported tunnel address %s", addr)
+	}
+	ip := address.IP
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+
+	length := 1 + len(ip) + 2 + len(p)
+	if length > maxTunnelFrame {
+		return 0, fmt.Errorf("packet too large for tunnel: %d bytes", len(p))
+	}
+	frame := make([]byte, 2+length)
+	binary.BigEndian.PutUint16(frame, uint16(length))
+	frame[2] = byte(len(ip))
+	copy(frame[3:], ip)
+	binary.BigEndian.PutUint16(frame[3+len(ip):], uint16(address.Port))
+	copy(frame[3+len(ip)+2:], p)
+
+	t.writeMutex.Lock()
+	defer t.writeMutex.Unlock()
+	_, err := t.Conn.Write(frame)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
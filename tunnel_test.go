@@ -0,0 +1,198 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny_test
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pb82/sunny"
+	"github.com/pb82/sunny/sunnytest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pipeListener accepts the connections dialed with DialContext, it implements
+// net.Listener and sunny.Dialer
+type pipeListener struct {
+	conns  chan net.Conn
+	closed chan struct{}
+}
+
+func newPipeListener() *pipeListener {
+	return &pipeListener{conns: make(chan net.Conn), closed: make(chan struct{})}
+}
+
+func (l *pipeListener) DialContext(ctx context.Context, _, _ string) (net.Conn, error) {
+	client, server := net.Pipe()
+	select {
+	case l.conns <- server:
+		return client, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *pipeListener) Close() error {
+	select {
+	case <-l.closed:
+	default:
+		close(l.closed)
+	}
+	return nil
+}
+
+func (l *pipeListener) Addr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 9522}
+}
+
+// serveTunnel starts a relay in the network, the returned channel receives the result of ServeTunnel
+func serveTunnel(t *testing.T, ctx context.Context, network *sunnytest.Network) (*pipeListener, chan error) {
+	socket, err := network.Endpoint(net.IPv4(192, 168, 0, 2))
+	assert.NoError(t, err)
+	listener := newPipeListener()
+	done := make(chan error, 1)
+	go func() {
+		done <- sunny.ServeTunnel(ctx, listener, socket)
+	}()
+	return listener, done
+}
+
+// tunnelFrame of a packet to the address
+func tunnelFrame(ip net.IP, port int, data []byte) []byte {
+	frame := []byte{0, 0, net.IPv4len}
+	frame = append(frame, ip.To4()...)
+	frame = binary.BigEndian.AppendUint16(frame, uint16(port))
+	frame = append(frame, data...)
+	binary.BigEndian.PutUint16(frame, uint16(len(frame)-2))
+	return frame
+}
+
+// receive the next packet of the endpoint or nil after the timeout
+func receive(endpoint *sunnytest.Endpoint, timeout time.Duration) []byte {
+	received := make(chan []byte, 1)
+	go func() {
+		buffer := make([]byte, 1024)
+		n, _, err := endpoint.ReadFrom(buffer)
+		if err == nil {
+			received <- buffer[:n]
+		}
+	}()
+	select {
+	case data := <-received:
+		return data
+	case <-time.After(timeout):
+		return nil
+	}
+}
+
+func TestServeTunnel(t *testing.T) {
+	ass := assert.New(t)
+
+	network := sunnytest.NewNetwork()
+	defer network.Close()
+	inverter, err := network.AddInverter("192.168.0.20", 1234, "0000")
+	ass.NoError(err)
+	inverter.SetValue(sunny.ActivePowerPlus, uint32(1500))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	listener, done := serveTunnel(t, ctx, network)
+
+	connection, err := sunny.NewTunnelConnectionVia(ctx, listener, "relay:9522", nil)
+	require.NoError(t, err)
+	defer connection.Close()
+	device, err := connection.NewDevice("192.168.0.20", "0000")
+	require.NoError(t, err)
+	ass.Equal(uint32(1234), device.SerialNumber())
+	values, err := device.GetValues()
+	ass.NoError(err)
+	ass.Equal(uint32(1500), values[sunny.ActivePowerPlus])
+
+	cancel()
+	ass.NoError(<-done)
+}
+
+func TestServeTunnel_destinations(t *testing.T) {
+	ass := assert.New(t)
+
+	network := sunnytest.NewNetwork()
+	defer network.Close()
+	public, err := network.Endpoint(net.IPv4(8, 8, 8, 8))
+	ass.NoError(err)
+	local, err := network.Endpoint(net.IPv4(192, 168, 0, 30))
+	ass.NoError(err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	listener, _ := serveTunnel(t, ctx, network)
+	client, err := listener.DialContext(ctx, "tcp", "relay:9522")
+	require.NoError(t, err)
+	defer client.Close()
+
+	// only the Speedwire port of local devices is reachable
+	for _, frame := range [][]byte{
+		tunnelFrame(net.IPv4(8, 8, 8, 8), 9522, []byte("public")),
+		tunnelFrame(net.IPv4(192, 168, 0, 30), 53, []byte("port")),
+		tunnelFrame(net.IPv4(192, 168, 0, 30), 9522, []byte("local")),
+	} {
+		_, err = client.Write(frame)
+		ass.NoError(err)
+	}
+	ass.Equal([]byte("local"), receive(local, time.Second))
+	ass.Nil(receive(public, 50*time.Millisecond))
+}
+
+func TestServeTunnel_slowClient(t *testing.T) {
+	ass := assert.New(t)
+
+	network := sunnytest.NewNetwork()
+	defer network.Close()
+	inverter, err := network.AddInverter("192.168.0.20", 1234, "0000")
+	ass.NoError(err)
+	inverter.SetValue(sunny.ActivePowerPlus, uint32(1500))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	listener, _ := serveTunnel(t, ctx, network)
+
+	// client which never reads the forwarded packets
+	slow, err := listener.DialContext(ctx, "tcp", "relay:9522")
+	require.NoError(t, err)
+	defer slow.Close()
+
+	connection, err := sunny.NewTunnelConnectionVia(ctx, listener, "relay:9522", nil)
+	require.NoError(t, err)
+	defer connection.Close()
+	device, err := connection.NewDevice("192.168.0.20", "0000")
+	require.NoError(t, err)
+	for range 3 {
+		_, err = device.GetValues()
+		ass.NoError(err)
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// unitScale relates a unit to its base unit
+type unitScale struct {
+	base   string
+	factor float64
+}
+
+// unitScales of all convertible units
+var unitScales = map[string]unitScale{
+	"W": {"W", 1}, "kW": {"W", 1e3}, "MW": {"W", 1e6}, "GW": {"W", 1e9},
+	"VA": {"VA", 1}, "kVA": {"VA", 1e3}, "MVA": {"VA", 1e6},
+	"var": {"var", 1}, "kvar": {"var", 1e3}, "Mvar": {"var", 1e6},
+	"Ws": {"Wh", 1.0 / 3600}, "Wh": {"Wh", 1}, "kWh": {"Wh", 1e3}, "MWh": {"Wh", 1e6}, "GWh": {"Wh", 1e9},
+	"VAs": {"VAh", 1.0 / 3600}, "VAh": {"VAh", 1}, "kVAh": {"VAh", 1e3}, "MVAh": {"VAh", 1e6},
+	"vars": {"varh", 1.0 / 3600}, "varh": {"varh", 1}, "kvarh": {"varh", 1e3}, "Mvarh": {"varh", 1e6},
+	"mA": {"A", 1e-3}, "A": {"A", 1},
+	"mV": {"V", 1e-3}, "V": {"V", 1}, "kV": {"V", 1e3},
+	"s": {"s", 1}, "min": {"s", 60}, "h": {"s", 3600},
+}
+
+// unitPrefixes used to format values of a base unit (largest first)
+var unitPrefixes = map[string][]string{
+	"W":    {"GW", "MW", "kW", "W"},
+	"VA":   {"MVA", "kVA", "VA"},
+	"var":  {"Mvar", "kvar", "var"},
+	"Wh":   {"GWh", "MWh", "kWh", "Wh"},
+	"VAh":  {"MVAh", "kVAh", "VAh"},
+	"varh": {"Mvarh", "kvarh", "varh"},
+}
+
+// ConvertUnit converts the value between units of the same quantity (e.g. "Ws" to "kWh")
+func ConvertUnit(value float64, from, to string) (float64, error) {
+	fromScale, ok := unitScales[from]
+	if !ok {
+		return 0, fmt.Errorf("unknown unit %q", from)
+	}
+	toScale, ok := unitScales[to]
+	if !ok {
+		return 0, fmt.Errorf("unknown unit %q", to)
+	}
+	if fromScale.base != toScale.base {
+		return 0, fmt.Errorf("can not convert %s to %s", from, to)
+	}
+	return value * fromScale.factor / toScale.factor, nil
+}
+
+// WireFactor returns the factor applied to the raw value sent by the device
+// (e.g. 0.01 for inverter voltages), 1 if the value is not scaled
+func WireFactor(id ValueID, energyMeter bool) float64 {
+	factor := getInverterRequest(id).Factor
+	if energyMeter {
+		def, _ := lookupEnergyMeterValue(id)
+		factor = def.Factor
+	}
+	if factor == 0 {
+		return 1
+	}
+	return factor
+}
+
+// FormatValue with its unit in the selected locale, e.g. "1.25 kW" or "3.4 MWh".
+// Power and energy values are scaled to a readable unit.
+func FormatValue(id ValueID, value interface{}) string {
+	return FormatLocalizedValue(id, value, Locale())
+}
+
+// FormatLocalizedValue with its unit in the given locale (see FormatValue)
+func FormatLocalizedValue(id ValueID, value interface{}, locale string) string {
+	unit := valueDescription(id).Unit
+	f, ok := ToFloat(value)
+	if !ok {
+		if unit == "" {
+			return fmt.Sprintf("%v", value)
+		}
+		return fmt.Sprintf("%v %s", value, unit)
+	}
+
+	if scale, ok := unitScales[unit]; ok {
+		if prefixes, ok := unitPrefixes[scale.base]; ok {
+			base := f * scale.factor
+			unit = prefixes[len(prefixes)-1]
+			for _, prefix := range prefixes {
+				if math.Abs(base) >= unitScales[prefix].factor {
+					unit = prefix
+					break
+				}
+			}
+			f = base / unitScales[unit].factor
+		}
+	}
+
+	text := FormatNumber(f, 2, locale)
+	if unit == "" {
+		return text
+	}
+	return text + " " + unit
+}
+
+// FormatNumber with at most precision decimals and the decimal separator of the locale
+func FormatNumber(value float64, precision int, locale string) string {
+	text := strconv.FormatFloat(value, 'f', precision, 64)
+	if strings.Contains(text, ".") {
+		text = strings.TrimRight(strings.TrimRight(text, "0"), ".")
+	}
+	if separator := translate(locale, "format.decimal"); separator != "" && separator != "." {
+		text = strings.Replace(text, ".", separator, 1)
+	}
+	return text
+}
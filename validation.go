@@ -0,0 +1,153 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"fmt"
+	"math"
+)
+
+// sentinelLimit magnitude of values handled as "not available" marker
+const sentinelLimit = 1e15
+
+// ValueRange of plausible values
+type ValueRange struct {
+	Min float64
+	Max float64
+}
+
+// ImplausibleValue found by a Validator
+type ImplausibleValue struct {
+	ID     ValueID
+	Value  interface{}
+	Reason string
+}
+
+// Validator checks decoded values for plausibility
+type Validator struct {
+	// Ranges of plausible values per value
+	Ranges map[ValueID]ValueRange
+	// MaxPower rating of the device in W (0 -> use ActivePowerMax of the device if available)
+	MaxPower float64
+	// Drop implausible values from results, otherwise they are only reported
+	Drop bool
+	// OnImplausible is called for each implausible value (optional)
+	OnImplausible func(id ValueID, value interface{}, reason string)
+}
+
+// NewValidator creates a validator with default ranges
+func NewValidator() *Validator {
+	return &Validator{
+		Ranges: map[ValueID]ValueRange{
+			BatteryCharge:      {0, 100},
+			BatteryTemperature: {-40, 100},
+			DeviceTemperature:  {-40, 150},
+			UtilityFrequency:   {40, 70},
+			PowerFactor:        {-1, 1},
+			PowerFactorL1:      {-1, 1},
+			PowerFactorL2:      {-1, 1},
+			PowerFactorL3:      {-1, 1},
+			VoltageL1:          {0, 500},
+			VoltageL2:          {0, 500},
+			VoltageL3:          {0, 500},
+			VoltageS1:          {0, 1500},
+			VoltageS2:          {0, 1500},
+		},
+	}
+}
+
+// ratedPowerValues are limited by the device rating
+var ratedPowerValues = []ValueID{
+	ActivePowerPlus, ActivePowerPlusL1, ActivePowerPlusL2, ActivePowerPlusL3,
+}
+
+// Validate values and returns all implausible ones.
+// If Drop is set implausible values are removed from the map.
+func (v *Validator) Validate(values map[ValueID]interface{}) []ImplausibleValue {
+	var result []ImplausibleValue
+	report := func(id ValueID, value interface{}, reason string) {
+		result = append(result, ImplausibleValue{ID: id, Value: value, Reason: reason})
+		if v.OnImplausible != nil {
+			v.OnImplausible(id, value, reason)
+		}
+		if v.Drop {
+			delete(values, id)
+		}
+	}
+
+	rating := v.MaxPower
+	if rating == 0 {
+		if max, ok := ToFloat(values[ActivePowerMax]); ok && max > 0 {
+			rating = max
+		}
+	}
+
+	for id, value := range values {
+		f, ok := ToFloat(value)
+		if !ok {
+			continue
+		}
+
+		if isSentinel(value, f) {
+			report(id, value, "value not available (sentinel)")
+			continue
+		}
+		if r, ok := v.Ranges[id]; ok && (f < r.Min || f > r.Max) {
+			report(id, value, fmt.Sprintf("outside of range [%g, %g]", r.Min, r.Max))
+			continue
+		}
+		if rating > 0 {
+			for _, rated := range ratedPowerValues {
+				if id == rated && f > rating {
+					report(id, value, fmt.Sprintf("exceeds device rating %g W", rating))
+					break
+				}
+			}
+		}
+	}
+	return result
+}
+
+// validate values with the validator of the device (if any)
+func (d *Device) validate(values map[ValueID]interface{}) {
+	validator := d.validator.Load()
+	if validator == nil || values == nil {
+		return
+	}
+	for _, implausible := range validator.Validate(values) {
+		Log.Printf("implausible value from %s: %s=%v (%s)",
+			d.Address(), implausible.ID, implausible.Value, implausible.Reason)
+	}
+}
+
+// SetValidator used to check values of this device, nil disables validation
+func (d *Device) SetValidator(validator *Validator) {
+	d.validator.Store(validator)
+}
+
+// isSentinel checks for "not available" markers used by devices
+func isSentinel(value interface{}, f float64) bool {
+	switch v := value.(type) {
+	case uint32:
+		return v == math.MaxUint32 || v == 0x80000000
+	case int32:
+		return v == math.MinInt32
+	case uint64:
+		return v == math.MaxUint64 || v == 0x8000000000000000
+	case int64:
+		return v == math.MinInt64
+	}
+	return math.IsNaN(f) || math.IsInf(f, 0) || math.Abs(f) >= sentinelLimit
+}
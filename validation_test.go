@@ -0,0 +1,93 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidator_Validate(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxPower float64
+		values   map[ValueID]interface{}
+		// implausible values by reason
+		implausible map[ValueID]string
+	}{
+		{"plausible", 0, map[ValueID]interface{}{
+			BatteryCharge: uint32(50), VoltageL1: 230.5, ActivePowerPlus: uint32(5000), DeviceName: "SN: 1",
+		}, nil},
+		{"sentinel uint32", 0, map[ValueID]interface{}{ActivePowerPlus: uint32(math.MaxUint32)},
+			map[ValueID]string{ActivePowerPlus: "value not available (sentinel)"}},
+		{"sentinel uint32 msb", 0, map[ValueID]interface{}{ActivePowerPlus: uint32(0x80000000)},
+			map[ValueID]string{ActivePowerPlus: "value not available (sentinel)"}},
+		{"sentinel int32", 0, map[ValueID]interface{}{DeviceTemperature: int32(math.MinInt32)},
+			map[ValueID]string{DeviceTemperature: "value not available (sentinel)"}},
+		{"sentinel uint64", 0, map[ValueID]interface{}{ActiveEnergyPlus: uint64(math.MaxUint64)},
+			map[ValueID]string{ActiveEnergyPlus: "value not available (sentinel)"}},
+		{"sentinel int64", 0, map[ValueID]interface{}{ActiveEnergyPlus: int64(math.MinInt64)},
+			map[ValueID]string{ActiveEnergyPlus: "value not available (sentinel)"}},
+		{"nan", 0, map[ValueID]interface{}{VoltageL1: math.NaN()},
+			map[ValueID]string{VoltageL1: "value not available (sentinel)"}},
+		{"huge float", 0, map[ValueID]interface{}{VoltageL1: 1e16},
+			map[ValueID]string{VoltageL1: "value not available (sentinel)"}},
+		{"below range", 0, map[ValueID]interface{}{UtilityFrequency: 10.0},
+			map[ValueID]string{UtilityFrequency: "outside of range [40, 70]"}},
+		{"above range", 0, map[ValueID]interface{}{BatteryCharge: uint32(101)},
+			map[ValueID]string{BatteryCharge: "outside of range [0, 100]"}},
+		{"rated power", 5000, map[ValueID]interface{}{ActivePowerPlus: uint32(5001), ActivePowerPlusL1: uint32(2000)},
+			map[ValueID]string{ActivePowerPlus: "exceeds device rating 5000 W"}},
+		{"device rating", 0, map[ValueID]interface{}{ActivePowerMax: uint32(3000), ActivePowerPlusL2: uint32(3500)},
+			map[ValueID]string{ActivePowerPlusL2: "exceeds device rating 3000 W"}},
+		{"rating overrides device", 4000, map[ValueID]interface{}{ActivePowerMax: uint32(3000), ActivePowerPlus: uint32(3500)}, nil},
+		{"unrated value", 1000, map[ValueID]interface{}{ActivePowerMinus: uint32(3500)}, nil},
+	}
+	for _, tt := range tests {
+		for _, drop := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s drop %v", tt.name, drop), func(t *testing.T) {
+				ass := assert.New(t)
+
+				validator := NewValidator()
+				validator.MaxPower = tt.maxPower
+				validator.Drop = drop
+				callbacks := 0
+				validator.OnImplausible = func(id ValueID, value interface{}, reason string) {
+					callbacks++
+					ass.Equal(tt.implausible[id], reason)
+				}
+
+				values := maps.Clone(tt.values)
+				implausible := validator.Validate(values)
+				ass.Len(implausible, len(tt.implausible))
+				ass.Equal(len(tt.implausible), callbacks)
+				for _, value := range implausible {
+					ass.Equal(tt.implausible[value.ID], value.Reason)
+					_, kept := values[value.ID]
+					ass.Equal(!drop, kept)
+				}
+				dropped := 0
+				if drop {
+					dropped = len(tt.implausible)
+				}
+				ass.Len(values, len(tt.values)-dropped)
+			})
+		}
+	}
+}
@@ -0,0 +1,248 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"math"
+	"time"
+)
+
+// Value read from a device
+type Value struct {
+	// ID of the value
+	ID ValueID
+	// Unit of the value (empty if unknown)
+	Unit string
+	// Timestamp reported by the device or the time the value was received
+	Timestamp time.Time
+	// Reported is true if the timestamp was reported by the device
+	Reported bool
+	// Raw value as returned by GetValues
+	Raw interface{}
+}
+
+// newValue for the raw value received now
+func newValue(id ValueID, raw interface{}) Value {
+	return Value{
+		ID:        id,
+		Unit:      valueDescription(id).Unit,
+		Timestamp: time.Now(),
+		Raw:       raw,
+	}
+}
+
+// newValuesAt converts a value map to typed values with the timestamps reported by the device
+func newValuesAt(values map[ValueID]interface{}, times map[ValueID]time.Time) map[ValueID]Value {
+	typed := make(map[ValueID]Value, len(values))
+	for id, raw := range values {
+		value := newValue(id, raw)
+		if t, ok := times[id]; ok {
+			value.Timestamp = t
+			value.Reported = true
+		}
+		typed[id] = value
+	}
+	return typed
+}
+
+// AsFloat returns numeric values as float64
+func (v Value) AsFloat() (float64, bool) {
+	return ToFloat(v.Raw)
+}
+
+// ToFloat converts numeric raw values (e.g. of GetValues) to float64
+func ToFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case int8:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+// AsInt returns numeric values as int64, floating point values are rounded
+func (v Value) AsInt() (int64, bool) {
+	switch raw := v.Raw.(type) {
+	case int64:
+		return raw, true
+	case uint64:
+		if raw > math.MaxInt64 {
+			return 0, false
+		}
+		return int64(raw), true
+	case int32:
+		return int64(raw), true
+	case uint32:
+		return int64(raw), true
+	case int:
+		return int64(raw), true
+	}
+	if f, ok := ToFloat(v.Raw); ok && !math.IsNaN(f) && !math.IsInf(f, 0) {
+		return int64(math.Round(f)), true
+	}
+	return 0, false
+}
+
+// AsString returns string values, other values are formatted without unit
+func (v Value) AsString() string {
+	if s, ok := v.Raw.(string); ok {
+		return s
+	}
+	return fmt.Sprint(v.Raw)
+}
+
+// AsTime returns time values, integers are handled as unix timestamp in seconds
+func (v Value) AsTime() (time.Time, bool) {
+	if t, ok := v.Raw.(time.Time); ok {
+		return t, true
+	}
+	switch v.Raw.(type) {
+	case int64, uint64, int32, uint32, int:
+		seconds, ok := v.AsInt()
+		return time.Unix(seconds, 0), ok
+	}
+	return time.Time{}, false
+}
+
+// String representation of the value with unit
+func (v Value) String() string {
+	if v.Unit == "" {
+		return fmt.Sprint(v.Raw)
+	}
+	return fmt.Sprintf("%v %s", v.Raw, v.Unit)
+}
+
+// Values of the device, yielded as responses arrive of inverters without value cache.
+// A failed request is yielded as error with an empty value after the received values
+// (a *MultiError if some value groups failed). Stopping the iteration cancels pending requests.
+func (d *Device) Values(ctx context.Context) iter.Seq2[Value, error] {
+	return func(yield func(Value, error) bool) {
+		if d.energyMeter || d.cache.Load() != nil {
+			values, times, err := d.fetchValues(ctx)
+			for _, value := range newValuesAt(values, times) {
+				if !yield(value, nil) {
+					return
+				}
+			}
+			if err != nil {
+				yield(Value{}, err)
+			}
+			return
+		}
+
+		err := d.health.allow()
+		if err != nil {
+			d.pollDone(err)
+			yield(Value{}, err)
+			return
+		}
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		// received is written by the request goroutine and read after done
+		received := false
+		responses := make(chan map[ValueID]Value)
+		done := make(chan error, 1)
+		go func() {
+			defer close(responses)
+			d.clearReceiver()
+			send := func(values map[ValueID]interface{}, times map[ValueID]time.Time) {
+				received = received || len(values) > 0
+				d.processValues(values)
+				select {
+				case responses <- newValuesAt(d.filterDelta(values), times):
+				case <-ctx.Done():
+				}
+			}
+			err := d.streamInverterValues(ctx, send)
+			source := SourceSpeedwire
+			if !received && d.webConnect.Load() != nil {
+				if err == nil {
+					err = fmt.Errorf("%w: no values received", ErrTimeout)
+				}
+				var values map[ValueID]interface{}
+				values, err = d.webConnectFallback(ctx, err)
+				if err == nil {
+					source = SourceWebConnect
+					send(values, nil)
+				}
+			}
+			d.source.Store(int32(source))
+			done <- err
+		}()
+
+		stopped := false
+		for values := range responses {
+			for _, value := range values {
+				if stopped {
+					break
+				}
+				if !yield(value, nil) {
+					stopped = true
+					cancel()
+				}
+			}
+		}
+		err = <-done
+		d.pollDone(partialSuccess(err, received))
+		if err != nil && !stopped {
+			yield(Value{}, err)
+		}
+	}
+}
+
+// GetTypedValue from device, returns false if the value does not exist
+func (d *Device) GetTypedValue(ctx context.Context, id ValueID) (Value, bool, error) {
+	raw, err := d.GetValueCtx(ctx, id)
+	if err != nil || raw == nil {
+		return Value{}, false, err
+	}
+	return newValue(id, raw), true, nil
+}
+
+// GetTypedValues from device with the timestamps reported by the device (if available),
+// received values are also returned on a *MultiError
+func (d *Device) GetTypedValues(ctx context.Context) (map[ValueID]Value, error) {
+	values, times, err := d.fetchValues(ctx)
+	if values == nil && err != nil {
+		return nil, err
+	}
+	return newValuesAt(values, times), err
+}
@@ -0,0 +1,46 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToFloat(t *testing.T) {
+	tests := []struct {
+		value    interface{}
+		expected float64
+		ok       bool
+	}{
+		{1.5, 1.5, true},
+		{float32(2.5), 2.5, true},
+		{uint64(3), 3, true},
+		{int64(-4), -4, true},
+		{uint32(5), 5, true},
+		{int32(-6), -6, true},
+		{uint16(7), 7, true},
+		{int8(-8), -8, true},
+		{9, 9, true},
+		{"10", 0, false},
+		{nil, 0, false},
+	}
+	for _, tt := range tests {
+		f, ok := ToFloat(tt.value)
+		assert.Equal(t, tt.ok, ok, "%T", tt.value)
+		assert.Equal(t, tt.expected, f, "%T", tt.value)
+	}
+}
@@ -14,7 +14,11 @@
 
 package sunny
 
-import "github.com/pb82/sunny/proto/net2"
+import (
+	"time"
+
+	"github.com/pb82/sunny/proto/net2"
+)
 
 //go:generate go run github.com/dmarkham/enumer -type ValueID -output values_enumer.go
 
@@ -184,6 +188,25 @@ const (
 	DeviceType
 	// SoftwareVersion Software version of device
 	SoftwareVersion
+
+	// values added later are appended to keep the IDs of existing values
+
+	// BatteryCapacity Nominal capacity of battery
+	BatteryCapacity
+	// BatteryChargeMode Active charge phase of battery (e.g. absorption)
+	BatteryChargeMode
+
+	// OperatingMode Operating mode of battery inverter (grid-tied or island)
+	OperatingMode
+	// GeneratorStatus Status of generator
+	GeneratorStatus
+	// ExternalPower Power of external source (generator or grid)
+	ExternalPower
+
+	// ClusterAddress Address of the cluster of the device
+	ClusterAddress
+	// ClusterRole Role of the device in its cluster (1 master, 2 and 3 slaves)
+	ClusterRole
 )
 
 // ValueDescription describes a value
@@ -271,6 +294,15 @@ var valueDesc = map[ValueID]ValueDescription{
 
 	BatteryCharge:      {"Charge state of battery", "%", ""},
 	BatteryTemperature: {"Temperature of battery", "°C", "temperature"},
+	BatteryCapacity:    {"Nominal capacity of battery", "Ah", ""},
+	BatteryChargeMode:  {"Charge phase of battery", "", ""},
+
+	OperatingMode:   {"Operating mode of battery inverter", "", ""},
+	GeneratorStatus: {"Status of generator", "", ""},
+	ExternalPower:   {"Power of external source", "W", "power"},
+
+	ClusterAddress: {"Address of cluster", "", ""},
+	ClusterRole:    {"Role in cluster", "", ""},
 
 	DeviceClass:       {"ID of device class", "", ""},
 	DeviceGridRelay:   {"Status of grid relay", "", ""},
@@ -281,14 +313,16 @@ var valueDesc = map[ValueID]ValueDescription{
 	SoftwareVersion:   {"Software version of device", "", ""},
 }
 
-// GetValueDescription for value
+// GetValueDescription for value in the selected locale
 func GetValueDescription(id ValueID) string {
-	return valueDesc[id].Description
+	return GetLocalizedValueDescription(id, Locale())
 }
 
-// GetValueInfo for value
+// GetValueInfo for value with description in the selected locale
 func GetValueInfo(id ValueID) ValueDescription {
-	return valueDesc[id]
+	info := valueDescription(id)
+	info.Description = GetValueDescription(id)
+	return info
 }
 
 // cache for responses and requests
@@ -361,11 +395,18 @@ var inverterValues = []InverterValuesDef{
 	{0x5100, 0x00464800, 0x004655FF, 0x00, 0x4655, CurrentL3, 0.001},
 	{0x5100, 0x00465700, 0x004657FF, 0x00, 0x4657, UtilityFrequency, 0.01},
 	{0x5100, 0x00491E00, 0x00495DFF, 0x00, 0x495B, BatteryTemperature, 0.1},
+	{0x5100, 0x00468C00, 0x00468CFF, 0x00, 0x468C, ExternalPower, 0},
+	{0x5100, 0x00702E00, 0x00702EFF, 0x00, 0x702E, BatteryCapacity, 0},
 
 	// TODO more decoding for device_status & device_grid_relay
 	{0x5180, 0x00214800, 0x002148FF, 0x00, 0x2148, DeviceStatus, 0},
 	{0x5180, 0x00416400, 0x004164FF, 0x00, 0x4164, DeviceGridRelay, 0},
 
+	// Sunny Island status codes
+	{0x5180, 0x00468800, 0x004689FF, 0x00, 0x4688, OperatingMode, 0},
+	{0x5180, 0x00468800, 0x004689FF, 0x00, 0x4689, GeneratorStatus, 0},
+	{0x5180, 0x00495E00, 0x00495EFF, 0x00, 0x495E, BatteryChargeMode, 0},
+
 	{0x5200, 0x00237700, 0x002377FF, 0x00, 0x2377, DeviceTemperature, 0.01},
 
 	{0x5380, 0x00251E00, 0x00251EFF, 0x01, 0x251E, PowerS1, 0},
@@ -384,27 +425,49 @@ var inverterValues = []InverterValuesDef{
 	{0x5800, 0x00821E00, 0x008220FF, 0x00, 0x821E, DeviceName, 0},
 	{0x5800, 0x00821E00, 0x008220FF, 0x00, 0x821F, DeviceClass, 0},
 	{0x5800, 0x00821E00, 0x008220FF, 0x00, 0x8220, DeviceType, 0},
+	{0x5800, 0x00823400, 0x008234FF, 0x00, 0x8234, SoftwareVersion, 0},
+	{0x5800, 0x00893400, 0x008935FF, 0x00, 0x8934, ClusterAddress, 0},
+	{0x5800, 0x00893400, 0x008935FF, 0x00, 0x8935, ClusterRole, 0},
 }
 
 // checkInverterValue checks if response is a known value
 func checkInverterValue(value *net2.ResponseValue) ValueID {
-	if def, ok := inverterResponseValues[uint32(value.Code)<<16+uint32(value.Class)]; ok {
-		return def
-	}
-	if def, ok := inverterResponseValues[uint32(value.Code)<<16]; ok {
-		return def
-	}
-	return 0
+	id, _ := responseValueID(value.Code, value.Class)
+	return id
 }
 
 // getAllInverterRequests to receive all values
 func getAllInverterRequests() []InverterValuesDef {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
 	return inverterAllRequests
 }
 
+// getInverterGroupValues returns the values contained in the response of the request
+func getInverterGroupValues(request InverterValuesDef) []ValueID {
+	var ids []ValueID
+	registryMutex.RLock()
+	for _, def := range inverterValues {
+		if def.Object == request.Object && def.Start == request.Start && def.End == request.End {
+			ids = append(ids, def.ID)
+		}
+	}
+	registryMutex.RUnlock()
+	return append(ids, profileGroupValues(request)...)
+}
+
+// LookupInverterValue returns the request definition and response code of an inverter value
+func LookupInverterValue(id ValueID) (InverterValuesDef, bool) {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+	def, ok := inverterValueMap[id]
+	return def, ok
+}
+
 // getInverterRequest for given ID
 func getInverterRequest(id ValueID) InverterValuesDef {
-	return inverterValueMap[id]
+	def, _ := LookupInverterValue(id)
+	return def
 }
 
 // getInverterRequests to receive all of the given values (reduce request amount)
@@ -441,16 +504,20 @@ func parseInverterValues(values []*net2.ResponseValue) map[ValueID]interface{} {
 
 		if id := checkInverterValue(val); id != 0 {
 			value := val.Values[0]
+			// version is stored in the last field
+			if id == SoftwareVersion {
+				value = val.Values[len(val.Values)-1]
+			}
 			// handle correction factor
-			if inverterValueMap[id].Factor != 0 {
+			if factor := getInverterRequest(id).Factor; factor != 0 {
 				if v, ok := value.(uint64); ok {
-					value = float64(v) * inverterValueMap[id].Factor
+					value = float64(v) * factor
 				} else if v, ok := value.(uint32); ok {
-					value = float64(v) * inverterValueMap[id].Factor
+					value = float64(v) * factor
 				} else if v, ok := value.(int64); ok {
-					value = float64(v) * inverterValueMap[id].Factor
+					value = float64(v) * factor
 				} else if v, ok := value.(int32); ok {
-					value = float64(v) * inverterValueMap[id].Factor
+					value = float64(v) * factor
 				}
 			}
 			data[id] = value
@@ -459,6 +526,28 @@ func parseInverterValues(values []*net2.ResponseValue) map[ValueID]interface{} {
 	return data
 }
 
+// minReportedTime is the oldest plausible timestamp reported by a device
+var minReportedTime = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// parseInverterTimestamps of the values in the response
+func parseInverterTimestamps(values []*net2.ResponseValue) map[ValueID]time.Time {
+	times := make(map[ValueID]time.Time, len(values))
+
+	for _, val := range values {
+		if len(val.Values) == 0 || val.Timestamp == 0 {
+			continue
+		}
+		t := time.Unix(int64(val.Timestamp), 0)
+		if t.Before(minReportedTime) {
+			continue
+		}
+		if id := checkInverterValue(val); id != 0 {
+			times[id] = t
+		}
+	}
+	return times
+}
+
 // energyMeterValuesDef defines a value of an energy meter value
 type energyMeterValuesDef struct {
 	OBIS   string
@@ -538,7 +627,7 @@ var emValues = []energyMeterValuesDef{
 func convertEnergyMeterValues(values map[string]interface{}) map[ValueID]interface{} {
 	data := make(map[ValueID]interface{}, len(values))
 	for obis, value := range values {
-		if def, ok := emObisMap[obis]; ok {
+		if def, ok := lookupOBIS(obis); ok {
 			// handle correction factor
 			if def.Factor != 0 {
 				if v, ok := value.(uint64); ok {
@@ -7,11 +7,11 @@ import (
 	"strings"
 )
 
-const _ValueIDName = "ActivePowerMaxActivePowerMinusActivePowerMinusL1ActivePowerMinusL2ActivePowerMinusL3ActivePowerPlusActivePowerPlusL1ActivePowerPlusL2ActivePowerPlusL3ApparentPowerMinusApparentPowerMinusL1ApparentPowerMinusL2ApparentPowerMinusL3ApparentPowerPlusApparentPowerPlusL1ApparentPowerPlusL2ApparentPowerPlusL3ReactivePowerMinusReactivePowerMinusL1ReactivePowerMinusL2ReactivePowerMinusL3ReactivePowerPlusReactivePowerPlusL1ReactivePowerPlusL2ReactivePowerPlusL3PowerS1PowerS2PowerFactorPowerFactorL1PowerFactorL2PowerFactorL3ActiveEnergyMinusActiveEnergyMinusL1ActiveEnergyMinusL2ActiveEnergyMinusL3ActiveEnergyPlusActiveEnergyPlusL1ActiveEnergyPlusL2ActiveEnergyPlusL3ActiveEnergyPlusTodayApparentEnergyMinusApparentEnergyMinusL1ApparentEnergyMinusL2ApparentEnergyMinusL3ApparentEnergyPlusApparentEnergyPlusL1ApparentEnergyPlusL2ApparentEnergyPlusL3ReactiveEnergyMinusReactiveEnergyMinusL1ReactiveEnergyMinusL2ReactiveEnergyMinusL3ReactiveEnergyPlusReactiveEnergyPlusL1ReactiveEnergyPlusL2ReactiveEnergyPlusL3CurrentL1CurrentL2CurrentL3CurrentS1CurrentS2VoltageL1VoltageL2VoltageL3VoltageS1VoltageS2TimeFeedTimeOperatingUtilityFrequencyBatteryChargeBatteryTemperatureDeviceClassDeviceGridRelayDeviceNameDeviceStatusDeviceTemperatureDeviceTypeSoftwareVersion"
+const _ValueIDName = "ActivePowerMaxActivePowerMinusActivePowerMinusL1ActivePowerMinusL2ActivePowerMinusL3ActivePowerPlusActivePowerPlusL1ActivePowerPlusL2ActivePowerPlusL3ApparentPowerMinusApparentPowerMinusL1ApparentPowerMinusL2ApparentPowerMinusL3ApparentPowerPlusApparentPowerPlusL1ApparentPowerPlusL2ApparentPowerPlusL3ReactivePowerMinusReactivePowerMinusL1ReactivePowerMinusL2ReactivePowerMinusL3ReactivePowerPlusReactivePowerPlusL1ReactivePowerPlusL2ReactivePowerPlusL3PowerS1PowerS2PowerFactorPowerFactorL1PowerFactorL2PowerFactorL3ActiveEnergyMinusActiveEnergyMinusL1ActiveEnergyMinusL2ActiveEnergyMinusL3ActiveEnergyPlusActiveEnergyPlusL1ActiveEnergyPlusL2ActiveEnergyPlusL3ActiveEnergyPlusTodayApparentEnergyMinusApparentEnergyMinusL1ApparentEnergyMinusL2ApparentEnergyMinusL3ApparentEnergyPlusApparentEnergyPlusL1ApparentEnergyPlusL2ApparentEnergyPlusL3ReactiveEnergyMinusReactiveEnergyMinusL1ReactiveEnergyMinusL2ReactiveEnergyMinusL3ReactiveEnergyPlusReactiveEnergyPlusL1ReactiveEnergyPlusL2ReactiveEnergyPlusL3CurrentL1CurrentL2CurrentL3CurrentS1CurrentS2VoltageL1VoltageL2VoltageL3VoltageS1VoltageS2TimeFeedTimeOperatingUtilityFrequencyBatteryChargeBatteryTemperatureDeviceClassDeviceGridRelayDeviceNameDeviceStatusDeviceTemperatureDeviceTypeSoftwareVersionBatteryCapacityBatteryChargeModeOperatingModeGeneratorStatusExternalPowerClusterAddressClusterRole"
 
-var _ValueIDIndex = [...]uint16{0, 14, 30, 48, 66, 84, 99, 116, 133, 150, 168, 188, 208, 228, 245, 264, 283, 302, 320, 340, 360, 380, 397, 416, 435, 454, 461, 468, 479, 492, 505, 518, 535, 554, 573, 592, 608, 626, 644, 662, 683, 702, 723, 744, 765, 783, 803, 823, 843, 862, 883, 904, 925, 943, 963, 983, 1003, 1012, 1021, 1030, 1039, 1048, 1057, 1066, 1075, 1084, 1093, 1101, 1114, 1130, 1143, 1161, 1172, 1187, 1197, 1209, 1226, 1236, 1251}
+var _ValueIDIndex = [...]uint16{0, 14, 30, 48, 66, 84, 99, 116, 133, 150, 168, 188, 208, 228, 245, 264, 283, 302, 320, 340, 360, 380, 397, 416, 435, 454, 461, 468, 479, 492, 505, 518, 535, 554, 573, 592, 608, 626, 644, 662, 683, 702, 723, 744, 765, 783, 803, 823, 843, 862, 883, 904, 925, 943, 963, 983, 1003, 1012, 1021, 1030, 1039, 1048, 1057, 1066, 1075, 1084, 1093, 1101, 1114, 1130, 1143, 1161, 1172, 1187, 1197, 1209, 1226, 1236, 1251, 1266, 1283, 1296, 1311, 1324, 1338, 1349}
 
-const _ValueIDLowerName = "activepowermaxactivepowerminusactivepowerminusl1activepowerminusl2activepowerminusl3activepowerplusactivepowerplusl1activepowerplusl2activepowerplusl3apparentpowerminusapparentpowerminusl1apparentpowerminusl2apparentpowerminusl3apparentpowerplusapparentpowerplusl1apparentpowerplusl2apparentpowerplusl3reactivepowerminusreactivepowerminusl1reactivepowerminusl2reactivepowerminusl3reactivepowerplusreactivepowerplusl1reactivepowerplusl2reactivepowerplusl3powers1powers2powerfactorpowerfactorl1powerfactorl2powerfactorl3activeenergyminusactiveenergyminusl1activeenergyminusl2activeenergyminusl3activeenergyplusactiveenergyplusl1activeenergyplusl2activeenergyplusl3activeenergyplustodayapparentenergyminusapparentenergyminusl1apparentenergyminusl2apparentenergyminusl3apparentenergyplusapparentenergyplusl1apparentenergyplusl2apparentenergyplusl3reactiveenergyminusreactiveenergyminusl1reactiveenergyminusl2reactiveenergyminusl3reactiveenergyplusreactiveenergyplusl1reactiveenergyplusl2reactiveenergyplusl3currentl1currentl2currentl3currents1currents2voltagel1voltagel2voltagel3voltages1voltages2timefeedtimeoperatingutilityfrequencybatterychargebatterytemperaturedeviceclassdevicegridrelaydevicenamedevicestatusdevicetemperaturedevicetypesoftwareversion"
+const _ValueIDLowerName = "activepowermaxactivepowerminusactivepowerminusl1activepowerminusl2activepowerminusl3activepowerplusactivepowerplusl1activepowerplusl2activepowerplusl3apparentpowerminusapparentpowerminusl1apparentpowerminusl2apparentpowerminusl3apparentpowerplusapparentpowerplusl1apparentpowerplusl2apparentpowerplusl3reactivepowerminusreactivepowerminusl1reactivepowerminusl2reactivepowerminusl3reactivepowerplusreactivepowerplusl1reactivepowerplusl2reactivepowerplusl3powers1powers2powerfactorpowerfactorl1powerfactorl2powerfactorl3activeenergyminusactiveenergyminusl1activeenergyminusl2activeenergyminusl3activeenergyplusactiveenergyplusl1activeenergyplusl2activeenergyplusl3activeenergyplustodayapparentenergyminusapparentenergyminusl1apparentenergyminusl2apparentenergyminusl3apparentenergyplusapparentenergyplusl1apparentenergyplusl2apparentenergyplusl3reactiveenergyminusreactiveenergyminusl1reactiveenergyminusl2reactiveenergyminusl3reactiveenergyplusreactiveenergyplusl1reactiveenergyplusl2reactiveenergyplusl3currentl1currentl2currentl3currents1currents2voltagel1voltagel2voltagel3voltages1voltages2timefeedtimeoperatingutilityfrequencybatterychargebatterytemperaturedeviceclassdevicegridrelaydevicenamedevicestatusdevicetemperaturedevicetypesoftwareversionbatterycapacitybatterychargemodeoperatingmodegeneratorstatusexternalpowerclusteraddressclusterrole"
 
 func (i ValueID) String() string {
 	i -= 1
@@ -103,9 +103,16 @@ func _ValueIDNoOp() {
 	_ = x[DeviceTemperature-(76)]
 	_ = x[DeviceType-(77)]
 	_ = x[SoftwareVersion-(78)]
+	_ = x[BatteryCapacity-(79)]
+	_ = x[BatteryChargeMode-(80)]
+	_ = x[OperatingMode-(81)]
+	_ = x[GeneratorStatus-(82)]
+	_ = x[ExternalPower-(83)]
+	_ = x[ClusterAddress-(84)]
+	_ = x[ClusterRole-(85)]
 }
 
-var _ValueIDValues = []ValueID{ActivePowerMax, ActivePowerMinus, ActivePowerMinusL1, ActivePowerMinusL2, ActivePowerMinusL3, ActivePowerPlus, ActivePowerPlusL1, ActivePowerPlusL2, ActivePowerPlusL3, ApparentPowerMinus, ApparentPowerMinusL1, ApparentPowerMinusL2, ApparentPowerMinusL3, ApparentPowerPlus, ApparentPowerPlusL1, ApparentPowerPlusL2, ApparentPowerPlusL3, ReactivePowerMinus, ReactivePowerMinusL1, ReactivePowerMinusL2, ReactivePowerMinusL3, ReactivePowerPlus, ReactivePowerPlusL1, ReactivePowerPlusL2, ReactivePowerPlusL3, PowerS1, PowerS2, PowerFactor, PowerFactorL1, PowerFactorL2, PowerFactorL3, ActiveEnergyMinus, ActiveEnergyMinusL1, ActiveEnergyMinusL2, ActiveEnergyMinusL3, ActiveEnergyPlus, ActiveEnergyPlusL1, ActiveEnergyPlusL2, ActiveEnergyPlusL3, ActiveEnergyPlusToday, ApparentEnergyMinus, ApparentEnergyMinusL1, ApparentEnergyMinusL2, ApparentEnergyMinusL3, ApparentEnergyPlus, ApparentEnergyPlusL1, ApparentEnergyPlusL2, ApparentEnergyPlusL3, ReactiveEnergyMinus, ReactiveEnergyMinusL1, ReactiveEnergyMinusL2, ReactiveEnergyMinusL3, ReactiveEnergyPlus, ReactiveEnergyPlusL1, ReactiveEnergyPlusL2, ReactiveEnergyPlusL3, CurrentL1, CurrentL2, CurrentL3, CurrentS1, CurrentS2, VoltageL1, VoltageL2, VoltageL3, VoltageS1, VoltageS2, TimeFeed, TimeOperating, UtilityFrequency, BatteryCharge, BatteryTemperature, DeviceClass, DeviceGridRelay, DeviceName, DeviceStatus, DeviceTemperature, DeviceType, SoftwareVersion}
+var _ValueIDValues = []ValueID{ActivePowerMax, ActivePowerMinus, ActivePowerMinusL1, ActivePowerMinusL2, ActivePowerMinusL3, ActivePowerPlus, ActivePowerPlusL1, ActivePowerPlusL2, ActivePowerPlusL3, ApparentPowerMinus, ApparentPowerMinusL1, ApparentPowerMinusL2, ApparentPowerMinusL3, ApparentPowerPlus, ApparentPowerPlusL1, ApparentPowerPlusL2, ApparentPowerPlusL3, ReactivePowerMinus, ReactivePowerMinusL1, ReactivePowerMinusL2, ReactivePowerMinusL3, ReactivePowerPlus, ReactivePowerPlusL1, ReactivePowerPlusL2, ReactivePowerPlusL3, PowerS1, PowerS2, PowerFactor, PowerFactorL1, PowerFactorL2, PowerFactorL3, ActiveEnergyMinus, ActiveEnergyMinusL1, ActiveEnergyMinusL2, ActiveEnergyMinusL3, ActiveEnergyPlus, ActiveEnergyPlusL1, ActiveEnergyPlusL2, ActiveEnergyPlusL3, ActiveEnergyPlusToday, ApparentEnergyMinus, ApparentEnergyMinusL1, ApparentEnergyMinusL2, ApparentEnergyMinusL3, ApparentEnergyPlus, ApparentEnergyPlusL1, ApparentEnergyPlusL2, ApparentEnergyPlusL3, ReactiveEnergyMinus, ReactiveEnergyMinusL1, ReactiveEnergyMinusL2, ReactiveEnergyMinusL3, ReactiveEnergyPlus, ReactiveEnergyPlusL1, ReactiveEnergyPlusL2, ReactiveEnergyPlusL3, CurrentL1, CurrentL2, CurrentL3, CurrentS1, CurrentS2, VoltageL1, VoltageL2, VoltageL3, VoltageS1, VoltageS2, TimeFeed, TimeOperating, UtilityFrequency, BatteryCharge, BatteryTemperature, DeviceClass, DeviceGridRelay, DeviceName, DeviceStatus, DeviceTemperature, DeviceType, SoftwareVersion, BatteryCapacity, BatteryChargeMode, OperatingMode, GeneratorStatus, ExternalPower, ClusterAddress, ClusterRole}
 
 var _ValueIDNameToValueMap = map[string]ValueID{
 	_ValueIDName[0:14]:           ActivePowerMax,
@@ -264,6 +271,20 @@ var _ValueIDNameToValueMap = map[string]ValueID{
 	_ValueIDLowerName[1226:1236]: DeviceType,
 	_ValueIDName[1236:1251]:      SoftwareVersion,
 	_ValueIDLowerName[1236:1251]: SoftwareVersion,
+	_ValueIDName[1251:1266]:      BatteryCapacity,
+	_ValueIDLowerName[1251:1266]: BatteryCapacity,
+	_ValueIDName[1266:1283]:      BatteryChargeMode,
+	_ValueIDLowerName[1266:1283]: BatteryChargeMode,
+	_ValueIDName[1283:1296]:      OperatingMode,
+	_ValueIDLowerName[1283:1296]: OperatingMode,
+	_ValueIDName[1296:1311]:      GeneratorStatus,
+	_ValueIDLowerName[1296:1311]: GeneratorStatus,
+	_ValueIDName[1311:1324]:      ExternalPower,
+	_ValueIDLowerName[1311:1324]: ExternalPower,
+	_ValueIDName[1324:1338]:      ClusterAddress,
+	_ValueIDLowerName[1324:1338]: ClusterAddress,
+	_ValueIDName[1338:1349]:      ClusterRole,
+	_ValueIDLowerName[1338:1349]: ClusterRole,
 }
 
 var _ValueIDNames = []string{
@@ -345,6 +366,13 @@ var _ValueIDNames = []string{
 	_ValueIDName[1209:1226],
 	_ValueIDName[1226:1236],
 	_ValueIDName[1236:1251],
+	_ValueIDName[1251:1266],
+	_ValueIDName[1266:1283],
+	_ValueIDName[1283:1296],
+	_ValueIDName[1296:1311],
+	_ValueIDName[1311:1324],
+	_ValueIDName[1324:1338],
+	_ValueIDName[1338:1349],
 }
 
 // ValueIDString retrieves an enum value from the enum constants string name.
@@ -353,8 +381,8 @@ func ValueIDString(s string) (ValueID, error) {
 	if val, ok := _ValueIDNameToValueMap[s]; ok {
 		return val, nil
 	}
-	s = strings.ToLower(s)
-	if val, ok := _ValueIDNameToValueMap[s]; ok {
+
+	if val, ok := _ValueIDNameToValueMap[strings.ToLower(s)]; ok {
 		return val, nil
 	}
 	return 0, fmt.Errorf("%s does not belong to ValueID values", s)
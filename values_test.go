@@ -0,0 +1,55 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValueID_stable(t *testing.T) {
+	// numeric IDs may be persisted by applications, new values are appended
+	tests := []struct {
+		id       ValueID
+		expected int
+	}{
+		{ActivePowerMax, 1},
+		{ActivePowerPlus, 6},
+		{ActiveEnergyPlus, 36},
+		{UtilityFrequency, 69},
+		{BatteryTemperature, 71},
+		{DeviceClass, 72},
+		{SoftwareVersion, 78},
+		{BatteryCapacity, 79},
+		{ClusterRole, 85},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id.String(), func(t *testing.T) {
+			assert.Equal(t, tt.expected, int(tt.id))
+		})
+	}
+}
+
+func TestValueIDString(t *testing.T) {
+	ass := assert.New(t)
+
+	for _, id := range ValueIDValues() {
+		parsed, err := ValueIDString(id.String())
+		ass.NoError(err)
+		ass.Equal(id, parsed)
+		ass.Contains(valueDesc, id)
+	}
+}
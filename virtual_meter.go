@@ -0,0 +1,156 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/pb82/sunny/proto"
+	"github.com/pb82/sunny/proto/net2"
+)
+
+// DefaultEnergyMeterInterval between broadcasts of a virtual energy meter
+const DefaultEnergyMeterInterval = time.Second
+
+// VirtualEnergyMeter broadcasts energy meter packets with the given values
+type VirtualEnergyMeter struct {
+	conn     *Connection
+	id       net2.DeviceId
+	interval time.Duration
+	start    time.Time
+
+	mutex  sync.Mutex
+	values map[ValueID]interface{}
+}
+
+// NewVirtualEnergyMeter creates a virtual energy meter with the given ID
+func (c *Connection) NewVirtualEnergyMeter(id net2.DeviceId) *VirtualEnergyMeter {
+	return &VirtualEnergyMeter{
+		conn:     c,
+		id:       id,
+		interval: DefaultEnergyMeterInterval,
+		start:    time.Now(),
+		values:   make(map[ValueID]interface{}),
+	}
+}
+
+// SetInterval between broadcasts, must be set before Run
+func (m *VirtualEnergyMeter) SetInterval(interval time.Duration) {
+	m.interval = interval
+}
+
+// SetValues broadcasted by the energy meter.
+// Values use the same IDs and units as values read from energy meters;
+// unsupported values are ignored.
+func (m *VirtualEnergyMeter) SetValues(values map[ValueID]interface{}) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.values = make(map[ValueID]interface{}, len(values))
+	for id, value := range values {
+		m.values[id] = value
+	}
+}
+
+// SetValue broadcasted by the energy meter
+func (m *VirtualEnergyMeter) SetValue(id ValueID, value interface{}) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.values[id] = value
+}
+
+// Run broadcasts the values until the context is done
+func (m *VirtualEnergyMeter) Run(ctx context.Context) error {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		err := m.Broadcast()
+		if err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Broadcast the current values once
+func (m *VirtualEnergyMeter) Broadcast() error {
+	return m.conn.sendPacket(m.conn.address, m.packet())
+}
+
+// packet with the current values
+func (m *VirtualEnergyMeter) packet() *proto.Packet {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	meter := &net2.EnergyMeterPacket{
+		Id:     m.id,
+		Ticker: uint32(time.Since(m.start).Milliseconds()),
+	}
+	for _, def := range energyMeterValues() {
+		value, ok := m.values[def.ID]
+		if !ok {
+			continue
+		}
+		data, err := def.measuredData(value)
+		if err != nil {
+			Log.Printf("virtual energy meter - skip %s: %v", def.ID, err)
+			continue
+		}
+		meter.Values = append(meter.Values, data)
+	}
+
+	return proto.NewPacketBuilder().
+		Group(proto.GroupDefault).
+		Net2(meter).
+		Build()
+}
+
+// measuredData converts the value to its raw representation
+func (def energyMeterValuesDef) measuredData(value interface{}) (*net2.MeasuredData, error) {
+	data := new(net2.MeasuredData)
+	_, err := fmt.Sscanf(def.OBIS, "%d:%d.%d.%d",
+		&data.OBIS.Channel, &data.OBIS.MeasurementValue, &data.OBIS.MeasurementType, &data.OBIS.Tariff)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OBIS %s: %w", def.OBIS, err)
+	}
+
+	f, ok := ToFloat(value)
+	if !ok {
+		return nil, fmt.Errorf("unsupported type %T", value)
+	}
+	if def.Factor != 0 {
+		f /= def.Factor
+	}
+	if f < 0 {
+		return nil, fmt.Errorf("negative value %v", value)
+	}
+
+	if data.OBIS.MeasurementType == 8 {
+		data.Value = uint64(math.Round(f))
+	} else {
+		data.Value = uint32(math.Round(f))
+	}
+	return data, nil
+}
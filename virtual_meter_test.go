@@ -0,0 +1,74 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pb82/sunny"
+	"github.com/pb82/sunny/proto/net2"
+	"github.com/pb82/sunny/sunnytest"
+)
+
+func TestVirtualEnergyMeter_Run(t *testing.T) {
+	ass := assert.New(t)
+
+	network := sunnytest.NewNetwork()
+	defer network.Close()
+	conn, err := network.ConnectionAt(net.IPv4(192, 168, 0, 30))
+	require.NoError(t, err)
+	meter := conn.NewVirtualEnergyMeter(net2.DeviceId{SusyID: 0x015D, SerialNumber: 3000})
+	meter.SetInterval(50 * time.Millisecond)
+	meter.SetValues(map[sunny.ValueID]interface{}{
+		sunny.ActivePowerPlus:  1234.5,
+		sunny.ActiveEnergyPlus: uint64(3600000),
+		sunny.VoltageL1:        230.1,
+		// not encodable values are skipped
+		sunny.VoltageL2: -1.0,
+		sunny.VoltageL3: "230",
+	})
+	meter.SetValue(sunny.CurrentL1, 5.25)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- meter.Run(ctx)
+	}()
+
+	connection, err := network.Connection()
+	require.NoError(t, err)
+	device, err := connection.NewDevice("192.168.0.30", "")
+	require.NoError(t, err)
+	ass.True(device.IsEnergyMeter())
+	ass.Equal(uint32(3000), device.SerialNumber())
+
+	values, err := device.GetValues()
+	ass.NoError(err)
+	ass.Equal(map[sunny.ValueID]interface{}{
+		sunny.ActivePowerPlus:  1234.5,
+		sunny.ActiveEnergyPlus: uint64(3600000),
+		sunny.VoltageL1:        230.1,
+		sunny.CurrentL1:        5.25,
+	}, values)
+
+	cancel()
+	ass.NoError(<-done)
+}
@@ -0,0 +1,303 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// ValueReader reads values from a device
+type ValueReader interface {
+	// GetValueCtx reads a single value and returns nil if it does not exist
+	GetValueCtx(ctx context.Context, id ValueID) (interface{}, error)
+	// GetValuesCtx reads all values
+	GetValuesCtx(ctx context.Context) (map[ValueID]interface{}, error)
+}
+
+// WebConnectClient reads values from the local WebConnect (HTTPS/JSON) interface of an inverter
+type WebConnectClient struct {
+	// address of the inverter, resolved per request
+	address     func() string
+	serial      uint32
+	credentials CredentialProvider
+	client      *http.Client
+}
+
+// WebConnectOption configures the TLS connection of a WebConnect client
+type WebConnectOption func(*tls.Config)
+
+// WithInsecureSkipVerify accepts any certificate of the inverter.
+// Inverters use self-signed certificates, prefer WithPinnedCertificate.
+func WithInsecureSkipVerify() WebConnectOption {
+	return func(c *tls.Config) {
+		c.InsecureSkipVerify = true
+	}
+}
+
+// WithRootCAs verifies the certificate of the inverter with the given CAs
+func WithRootCAs(pool *x509.CertPool) WebConnectOption {
+	return func(c *tls.Config) {
+		c.RootCAs = pool
+	}
+}
+
+// WithPinnedCertificate accepts only the certificate with the given SHA-256
+// fingerprint (e.g. the self-signed certificate of the inverter)
+func WithPinnedCertificate(fingerprint [sha256.Size]byte) WebConnectOption {
+	return func(c *tls.Config) {
+		// the chain of self-signed certificates can't be verified, the pin replaces it
+		c.InsecureSkipVerify = true
+		c.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 || sha256.Sum256(rawCerts[0]) != fingerprint {
+				return fmt.Errorf("certificate does not match pinned fingerprint %x", fingerprint)
+			}
+			return nil
+		}
+	}
+}
+
+// NewWebConnectClient for the inverter at the given address.
+// Certificates are verified with the system CAs unless configured otherwise by the options,
+// inverters use self-signed certificates (see WithPinnedCertificate).
+func NewWebConnectClient(address string, serial uint32, credentials CredentialProvider, options ...WebConnectOption) *WebConnectClient {
+	config := &tls.Config{}
+	for _, option := range options {
+		option(config)
+	}
+	return &WebConnectClient{
+		address:     func() string { return address },
+		serial:      serial,
+		credentials: credentials,
+		client: &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: config,
+			},
+		},
+	}
+}
+
+// baseURL of the inverter
+func (w *WebConnectClient) baseURL() string {
+	return "https://" + w.address()
+}
+
+// SetHTTPClient used for requests
+func (w *WebConnectClient) SetHTTPClient(client *http.Client) {
+	w.client = client
+}
+
+// GetValueCtx from inverter and returns nil if value does not exist
+func (w *WebConnectClient) GetValueCtx(ctx context.Context, id ValueID) (interface{}, error) {
+	values, err := w.GetValuesCtx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return values[id], nil
+}
+
+// GetValuesCtx from inverter
+func (w *WebConnectClient) GetValuesCtx(ctx context.Context) (map[ValueID]interface{}, error) {
+	sid, err := w.login(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer w.logout(sid)
+
+	var response struct {
+		Result map[string]map[string]map[string][]webConnectValue `json:"result"`
+	}
+	err = w.post(ctx, "/dyn/getAllOnlValues.json", sid, map[string]interface{}{"destDev": []string{}}, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[ValueID]interface{})
+	for _, device := range response.Result {
+		for key, channels := range device {
+			// keys are <object>_<type><code>00, e.g. 6100_40263F00
+			if len(key) != 13 {
+				continue
+			}
+			code, err := strconv.ParseUint(key[7:11], 16, 16)
+			if err != nil {
+				continue
+			}
+			for _, channel := range channels {
+				for i, v := range channel {
+					value := &webConnectResponseValue{code: uint16(code), class: uint8(i + 1), value: v}
+					if id, converted, ok := value.convert(); ok {
+						values[id] = converted
+					}
+				}
+			}
+		}
+	}
+	return values, nil
+}
+
+// login to WebConnect and returns the session ID
+func (w *WebConnectClient) login(ctx context.Context) (string, error) {
+	credentials, err := w.credentials.Credentials(ctx, w.serial)
+	if err != nil {
+		return "", fmt.Errorf("login failed - no credentials: %w", err)
+	}
+
+	right := "usr"
+	if credentials.UserGroup == UserGroupInstaller {
+		right = "istl"
+	}
+
+	var response struct {
+		Result struct {
+			Sid string `json:"sid"`
+		} `json:"result"`
+		Err int `json:"err"`
+	}
+	err = w.post(ctx, "/dyn/login.json", "", map[string]string{"right": right, "pass": credentials.Password}, &response)
+	if err != nil {
+		return "", fmt.Errorf("login failed: %w", err)
+	}
+	if response.Err != 0 {
+		return "", fmt.Errorf("login failed: %w (error %d)", ErrDeviceBusy, response.Err)
+	}
+	if response.Result.Sid == "" {
+		return "", fmt.Errorf("login failed: %w", ErrAuthFailed)
+	}
+	return response.Result.Sid, nil
+}
+
+// logout of the WebConnect session
+func (w *WebConnectClient) logout(sid string) {
+	err := w.post(context.Background(), "/dyn/logout.json", sid, struct{}{}, nil)
+	if err != nil {
+		Log.Printf("WebConnect logout for %s failed: %v", w.address(), err)
+	}
+}
+
+// post JSON request and decode response
+func (w *WebConnectClient) post(ctx context.Context, path, sid string, request, response interface{}) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	target := w.baseURL() + path
+	if sid != "" {
+		target += "?sid=" + url.QueryEscape(sid)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("%w: %v", ErrTimeout, err)
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: HTTP status %d", ErrInvalidResponse, resp.StatusCode)
+	}
+	if response == nil {
+		return nil
+	}
+	err = json.NewDecoder(resp.Body).Decode(response)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+	return nil
+}
+
+// webConnectValue of a channel
+type webConnectValue struct {
+	Val interface{} `json:"val"`
+}
+
+// webConnectResponseValue with its Speedwire code
+type webConnectResponseValue struct {
+	code  uint16
+	class uint8
+	value webConnectValue
+}
+
+// convert value to ValueID and value as returned by Speedwire
+func (v *webConnectResponseValue) convert() (ValueID, interface{}, bool) {
+	id, ok := responseValueID(v.code, v.class)
+	if !ok || v.value.Val == nil {
+		return 0, nil, false
+	}
+
+	switch val := v.value.Val.(type) {
+	case float64:
+		if factor := getInverterRequest(id).Factor; factor != 0 {
+			return id, val * factor, true
+		}
+		return id, val, true
+	case string:
+		return id, val, true
+	case []interface{}:
+		// status values contain tags
+		for _, tag := range val {
+			if t, ok := tag.(map[string]interface{}); ok {
+				if code, ok := t["tag"].(float64); ok {
+					return id, uint32(code), true
+				}
+			}
+		}
+	}
+	return 0, nil, false
+}
+
+// EnableWebConnectFallback reads values via WebConnect if Speedwire requests of the inverter fail.
+// The options configure the certificate verification (see NewWebConnectClient).
+func (d *Device) EnableWebConnectFallback(enable bool, options ...WebConnectOption) {
+	if !enable || d.energyMeter {
+		d.webConnect.Store(nil)
+		return
+	}
+	client := NewWebConnectClient("", d.id.SerialNumber, d.credentialProvider(), options...)
+	// follow address changes of the device
+	client.address = func() string { return d.Address().IP.String() }
+	d.webConnect.Store(client)
+}
+
+// webConnectFallback reads values via WebConnect after a failed Speedwire request
+func (d *Device) webConnectFallback(ctx context.Context, err error) (map[ValueID]interface{}, error) {
+	client := d.webConnect.Load()
+	if client == nil {
+		return nil, err
+	}
+
+	Log.Printf("Speedwire request for %s failed (%v) -> fallback to WebConnect", d.Address(), err)
+	values, webErr := client.GetValuesCtx(ctx)
+	if webErr != nil {
+		return nil, fmt.Errorf("%w (WebConnect fallback: %v)", err, webErr)
+	}
+	return values, nil
+}
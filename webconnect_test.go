@@ -0,0 +1,101 @@
+// Copyright 2021 Benjamin Böhmke <benjamin@boehmke.net>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sunny
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newWebConnectServer answers login, value and logout requests of a WebConnect client
+func newWebConnectServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/dyn/login.json":
+			_, _ = w.Write([]byte(`{"result":{"sid":"session"}}`))
+		case "/dyn/getAllOnlValues.json":
+			_, _ = w.Write([]byte(`{"result":{"0199-B32CE5A6":{"6100_40263F00":{"1":[{"val":1500}]}}}}`))
+		default:
+			_, _ = w.Write([]byte(`{"result":{}}`))
+		}
+	}))
+	// rejected certificates are expected
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestWebConnectClient_certificates(t *testing.T) {
+	server := newWebConnectServer(t)
+	address := strings.TrimPrefix(server.URL, "https://")
+
+	certificate := server.Certificate()
+	pool := x509.NewCertPool()
+	pool.AddCert(certificate)
+
+	tests := []struct {
+		name    string
+		options []WebConnectOption
+		valid   bool
+	}{
+		{"system CAs", nil, false},
+		{"root CAs", []WebConnectOption{WithRootCAs(pool)}, true},
+		{"pinned", []WebConnectOption{WithPinnedCertificate(sha256.Sum256(certificate.Raw))}, true},
+		{"pin mismatch", []WebConnectOption{WithPinnedCertificate([sha256.Size]byte{1})}, false},
+		{"insecure", []WebConnectOption{WithInsecureSkipVerify()}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ass := assert.New(t)
+
+			client := NewWebConnectClient(address, 1234, StaticCredentials("0000"), tt.options...)
+			values, err := client.GetValuesCtx(context.Background())
+			if !tt.valid {
+				ass.Error(err)
+				return
+			}
+			ass.NoError(err)
+			ass.Equal(1500.0, values[ActivePowerPlus])
+		})
+	}
+}
+
+func TestWebConnectClient_address(t *testing.T) {
+	ass := assert.New(t)
+
+	server := newWebConnectServer(t)
+	address := "127.0.0.1:1"
+
+	// the address is resolved per request
+	client := NewWebConnectClient("", 1234, StaticCredentials("0000"), WithInsecureSkipVerify())
+	client.address = func() string { return address }
+	_, err := client.GetValuesCtx(context.Background())
+	ass.Error(err)
+
+	address = strings.TrimPrefix(server.URL, "https://")
+	_, err = client.GetValuesCtx(context.Background())
+	ass.NoError(err)
+}